@@ -34,7 +34,9 @@ func main() {
 		log.Fatalf("Failed to create gateway: %v", err)
 	}
 
-	gw.Start(ctx)
+	if err := gw.Start(ctx); err != nil {
+		log.Fatalf("Failed to start gateway: %v", err)
+	}
 
 	// Создание HTTP сервера
 	server := gatewayhttp.NewServer(gw, gatewayhttp.Config{
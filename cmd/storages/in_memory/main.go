@@ -6,7 +6,8 @@ import (
 	"log"
 	"time"
 
-	_ "github.com/Alexey-zaliznuak/orbital/docs/swagger-in-memory" // Swagger docs
+	_ "github.com/Alexey-zaliznuak/orbital/docs/swagger-storage" // Swagger docs
+	"github.com/Alexey-zaliznuak/orbital/internal/storages/httpapi"
 	inmemory "github.com/Alexey-zaliznuak/orbital/internal/storages/in_memory"
 	"github.com/Alexey-zaliznuak/orbital/pkg/httputil"
 )
@@ -25,13 +26,30 @@ func main() {
 		log.Fatalf("Failed to initialize storage: %v", err)
 	}
 
-	server := inmemory.NewServer(store, inmemory.ServerConfig{
+	server := httpapi.NewServer(store, httpapi.ServerConfig{
 		Addr:         ":8080",
 		ReadTimeout:  30 * time.Second,
 		WriteTimeout: 30 * time.Second,
 	})
 
+	var drain func()
+	if cfg.DrainOnShutdown {
+		drain = func() {
+			// Сверх ожидания подтверждений нужно время на передачу ожидающих сообщений.
+			drainCtx, cancel := context.WithTimeout(ctx, cfg.DrainTimeout+30*time.Second)
+			defer cancel()
+
+			if err := store.Drain(drainCtx); err != nil {
+				log.Printf("Drain failed: %v", err)
+			}
+		}
+	}
+
 	log.Printf("HTTP server listening on :8080")
-	httputil.Run(server, 10*time.Second)
+	httputil.RunWithDrain(server, drain, 10*time.Second)
+
+	if err := store.Close(); err != nil {
+		log.Printf("Failed to close storage: %v", err)
+	}
 	log.Printf("In-memory storage stopped")
 }
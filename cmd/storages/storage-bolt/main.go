@@ -0,0 +1,43 @@
+// Bolt storage service — персистентное хранилище во встроенной базе, без внешних зависимостей.
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	_ "github.com/Alexey-zaliznuak/orbital/docs/swagger-storage" // Swagger docs
+	boltstorage "github.com/Alexey-zaliznuak/orbital/internal/storages/bolt"
+	"github.com/Alexey-zaliznuak/orbital/internal/storages/httpapi"
+	"github.com/Alexey-zaliznuak/orbital/pkg/httputil"
+)
+
+func main() {
+	cfg := boltstorage.NewBuilder().FromEnv().Build()
+	ctx := context.Background()
+
+	log.Printf("Starting bolt storage server...")
+	log.Printf("Storage ID: %s", cfg.ID)
+	log.Printf("Database: %s", cfg.Path)
+	log.Printf("HTTP port: 8080")
+
+	store := boltstorage.NewBoltStorage()
+
+	if err := store.Initialize(ctx, cfg); err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+
+	server := httpapi.NewServer(store, httpapi.ServerConfig{
+		Addr:         ":8080",
+		ReadTimeout:  30 * time.Second,
+		WriteTimeout: 30 * time.Second,
+	})
+
+	log.Printf("HTTP server listening on :8080")
+	httputil.Run(server, 10*time.Second)
+
+	if err := store.Close(); err != nil {
+		log.Printf("Failed to close database: %v", err)
+	}
+	log.Printf("Bolt storage stopped")
+}
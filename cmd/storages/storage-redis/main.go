@@ -1,6 +1,40 @@
 // Redis storage service — горячий слой хранения сообщений.
 package main
 
+import (
+	"context"
+	"log"
+	"time"
+
+	_ "github.com/Alexey-zaliznuak/orbital/docs/swagger-storage" // Swagger docs
+	"github.com/Alexey-zaliznuak/orbital/internal/storages/httpapi"
+	redisstorage "github.com/Alexey-zaliznuak/orbital/internal/storages/redis"
+	"github.com/Alexey-zaliznuak/orbital/pkg/httputil"
+)
+
 func main() {
-	// TODO: реализовать redis storage сервис
+	cfg := redisstorage.NewBuilder().FromEnv().Build()
+	ctx := context.Background()
+
+	log.Printf("Starting redis storage server...")
+	log.Printf("Storage ID: %s", cfg.ID)
+	log.Printf("Redis: %s", cfg.RedisAddress)
+	log.Printf("HTTP port: 8080")
+
+	store := redisstorage.NewRedisStorage()
+
+	if err := store.Initialize(ctx, cfg); err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+
+	server := httpapi.NewServer(store, httpapi.ServerConfig{
+		Addr:         ":8080",
+		ReadTimeout:  30 * time.Second,
+		WriteTimeout: 30 * time.Second,
+		SharedState:  true,
+	})
+
+	log.Printf("HTTP server listening on :8080")
+	httputil.Run(server, 10*time.Second)
+	log.Printf("Redis storage stopped")
 }
@@ -1,6 +1,39 @@
 // S3 storage service — холодный слой хранения сообщений.
 package main
 
+import (
+	"context"
+	"log"
+	"time"
+
+	_ "github.com/Alexey-zaliznuak/orbital/docs/swagger-storage" // Swagger docs
+	"github.com/Alexey-zaliznuak/orbital/internal/storages/httpapi"
+	s3storage "github.com/Alexey-zaliznuak/orbital/internal/storages/s3"
+	"github.com/Alexey-zaliznuak/orbital/pkg/httputil"
+)
+
 func main() {
-	// TODO: реализовать s3 storage сервис
+	cfg := s3storage.NewBuilder().FromEnv().Build()
+	ctx := context.Background()
+
+	log.Printf("Starting s3 storage server...")
+	log.Printf("Storage ID: %s", cfg.ID)
+	log.Printf("HTTP port: 8080")
+
+	store := s3storage.NewS3Storage()
+
+	if err := store.Initialize(ctx, cfg); err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+
+	server := httpapi.NewServer(store, httpapi.ServerConfig{
+		Addr:         ":8080",
+		ReadTimeout:  30 * time.Second,
+		WriteTimeout: 30 * time.Second,
+		SharedState:  true,
+	})
+
+	log.Printf("HTTP server listening on :8080")
+	httputil.Run(server, 10*time.Second)
+	log.Printf("S3 storage stopped")
 }
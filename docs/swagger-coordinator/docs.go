@@ -884,7 +884,7 @@ const docTemplate = `{
         },
         "/storages": {
             "get": {
-                "description": "Возвращает список всех зарегистрированных Storages",
+                "description": "Возвращает список всех зарегистрированных Storages. Инстансы, не присылавшие heartbeat дольше STORAGE_INSTANCE_TTL, и Storages без живых инстансов не возвращаются",
                 "produces": [
                     "application/json"
                 ],
@@ -911,7 +911,7 @@ const docTemplate = `{
                 }
             },
             "post": {
-                "description": "Регистрирует новый Storage инстанс с диапазоном задержек. Если storage с таким id уже есть, адрес из запроса добавляется к списку addresses (без дубликатов), обновляются min/max delay и heartbeat.",
+                "description": "Регистрирует новый Storage инстанс с диапазоном задержек. Если storage с таким id уже есть, адрес из запроса добавляется к списку addresses (без дубликатов), обновляются min/max delay и heartbeat. В строгом режиме (STRICT_STORAGE_COVERAGE) регистрация, после которой часть принимавшихся задержек не примет ни один Storage, отклоняется.",
                 "consumes": [
                     "application/json"
                 ],
@@ -946,6 +946,167 @@ const docTemplate = `{
                             "$ref": "#/definitions/coordinatorapi.ErrorResponse"
                         }
                     },
+                    "409": {
+                        "description": "Регистрация создаёт разрыв в покрытии задержек",
+                        "schema": {
+                            "$ref": "#/definitions/coordinatorapi.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/coordinatorapi.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/storages/coverage": {
+            "get": {
+                "description": "Проверяет, как диапазоны задержек зарегистрированных Storages покрывают [0, ∞): разрывы — задержки, которые не принимает ни один Storage (такие сообщения gateway отправляет в пушеры сразу), пересечения — задержки, которые принимают несколько Storages",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Storages"
+                ],
+                "summary": "Покрытие задержек",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/coordinatorapi.CoverageResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/coordinatorapi.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/storages/forecast": {
+            "get": {
+                "description": "Собирает гистограммы ожидающих сообщений со всех инстансов Storages и складывает их в прогноз кластера. Параметры те же, что у гистограммы Storage; from по умолчанию — текущее время, округлённое до bucket. Недоступные инстансы перечисляются с ошибкой и в прогноз не входят",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Storages"
+                ],
+                "summary": "Прогноз нагрузки",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "default": "15m",
+                        "description": "Ширина интервала",
+                        "name": "bucket",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "default": "24h",
+                        "description": "Горизонт прогноза",
+                        "name": "horizon",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Число сегментов routing key для группировки, 0 — без группировки",
+                        "name": "group_depth",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Начало первого интервала (RFC3339)",
+                        "name": "from",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/coordinatorapi.ForecastResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/coordinatorapi.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/coordinatorapi.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/storages/rebalance": {
+            "get": {
+                "description": "Возвращает ход последней перебалансировки: стадию и число переданных сообщений по каждому инстансу",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Storages"
+                ],
+                "summary": "Ход перебалансировки",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/coordinatorapi.RebalanceResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Просит по очереди каждый инстанс Storage передать gateway ожидающие сообщения, которые не подходят под диапазон задержек Storage, чтобы gateway заново выбрал для них Storage. Инстансы из evacuate передают все ожидающие сообщения — так забирают сообщения у Storage, удалённого из кластера. Возвращает ход перебалансировки, не дожидаясь её завершения",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Storages"
+                ],
+                "summary": "Запустить перебалансировку",
+                "parameters": [
+                    {
+                        "description": "Инстансы для эвакуации",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/coordinatorapi.RebalanceRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/coordinatorapi.RebalanceResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/coordinatorapi.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Перебалансировка уже выполняется",
+                        "schema": {
+                            "$ref": "#/definitions/coordinatorapi.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -957,7 +1118,7 @@ const docTemplate = `{
         },
         "/storages/{storageID}": {
             "get": {
-                "description": "Возвращает информацию о Storage",
+                "description": "Возвращает информацию о Storage. Инстансы, не присылавшие heartbeat дольше STORAGE_INSTANCE_TTL, не возвращаются; Storage без живых инстансов не найден",
                 "produces": [
                     "application/json"
                 ],
@@ -1029,9 +1190,60 @@ const docTemplate = `{
                 }
             }
         },
+        "/storages/{storageID}/addresses": {
+            "delete": {
+                "description": "Удаляет адрес одного инстанса Storage, например при его остановке. Storage без адресов удаляется целиком; отсутствующий адрес не считается ошибкой",
+                "tags": [
+                    "Storages"
+                ],
+                "summary": "Удалить адрес инстанса Storage",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID Storage",
+                        "name": "storageID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Адрес инстанса",
+                        "name": "address",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/coordinatorapi.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Storage не найден",
+                        "schema": {
+                            "$ref": "#/definitions/coordinatorapi.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/coordinatorapi.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
         "/storages/{storageID}/heartbeat": {
             "put": {
-                "description": "Обновляет время последнего heartbeat Storage",
+                "description": "Обновляет время последнего heartbeat инстанса Storage, его статус и нагрузку: число и размер хранимых сообщений, число не подтверждённых gateway, скорость приёма и опоздание выпуска. Gateway предпочитает менее загруженные Storage и обходит опаздывающие. Без статуса инстанс Active; перегруженный инстанс сообщает Degraded. Storage Degraded, когда Degraded все его инстансы, и тогда gateway направляет ему сообщения, только если других подходящих Storage нет. Тело можно не передавать: heartbeat без address обновляет статус и время heartbeat всех инстансов Storage, их нагрузка остаётся неизвестной.",
+                "consumes": [
+                    "application/json"
+                ],
                 "tags": [
                     "Storages"
                 ],
@@ -1043,14 +1255,29 @@ const docTemplate = `{
                         "name": "storageID",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "description": "Состояние инстанса",
+                        "name": "request",
+                        "in": "body",
+                        "required": false,
+                        "schema": {
+                            "$ref": "#/definitions/coordinatorapi.StorageHeartbeatRequest"
+                        }
                     }
                 ],
                 "responses": {
                     "204": {
                         "description": "No Content"
                     },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/coordinatorapi.ErrorResponse"
+                        }
+                    },
                     "404": {
-                        "description": "Storage не найден",
+                        "description": "Storage или инстанс не найден",
                         "schema": {
                             "$ref": "#/definitions/coordinatorapi.ErrorResponse"
                         }
@@ -1071,6 +1298,25 @@ const docTemplate = `{
             "properties": {
                 "nats_address": {
                     "type": "string"
+                },
+                "stream_max_age": {
+                    "description": "0 — без ограничения",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/time.Duration"
+                        }
+                    ]
+                },
+                "stream_max_bytes": {
+                    "description": "-1 — без ограничения",
+                    "type": "integer"
+                },
+                "stream_replicas": {
+                    "type": "integer"
+                },
+                "stream_retention": {
+                    "description": "JetStream streams (orbital.storage.\u003e, orbital.gateway, orbital.push.\u003e)",
+                    "type": "string"
                 }
             }
         },
@@ -1103,6 +1349,58 @@ const docTemplate = `{
                 "logLevel": {
                     "description": "Логирование",
                     "type": "string"
+                },
+                "storageInstanceTTL": {
+                    "description": "StorageInstanceTTL — сколько инстанс Storage может не присылать heartbeat, прежде чем\nкоординатор удалит его и gateway перестанет направлять ему сообщения; 0 — не удалять.",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/time.Duration"
+                        }
+                    ]
+                },
+                "strictStorageCoverage": {
+                    "description": "StrictStorageCoverage — отклонять регистрацию Storage, после которой часть задержек,\nпринимавшихся раньше, не примет ни один Storage.",
+                    "type": "boolean"
+                }
+            }
+        },
+        "coordinatorapi.CoverageOverlapResponse": {
+            "type": "object",
+            "properties": {
+                "from": {
+                    "type": "string",
+                    "example": "1h"
+                },
+                "storage_ids": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "to": {
+                    "type": "string",
+                    "example": "unlimited"
+                }
+            }
+        },
+        "coordinatorapi.CoverageResponse": {
+            "type": "object",
+            "properties": {
+                "complete": {
+                    "description": "Complete — у любой задержки есть Storage.",
+                    "type": "boolean"
+                },
+                "gaps": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/coordinatorapi.DelayRangeResponse"
+                    }
+                },
+                "overlaps": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/coordinatorapi.CoverageOverlapResponse"
+                    }
                 }
             }
         },
@@ -1135,6 +1433,19 @@ const docTemplate = `{
                 }
             }
         },
+        "coordinatorapi.DelayRangeResponse": {
+            "type": "object",
+            "properties": {
+                "from": {
+                    "type": "string",
+                    "example": "1h"
+                },
+                "to": {
+                    "type": "string",
+                    "example": "unlimited"
+                }
+            }
+        },
         "coordinatorapi.ErrorResponse": {
             "type": "object",
             "properties": {
@@ -1143,6 +1454,20 @@ const docTemplate = `{
                 }
             }
         },
+        "coordinatorapi.ForecastResponse": {
+            "type": "object",
+            "properties": {
+                "histogram": {
+                    "$ref": "#/definitions/storageapi.HistogramResponse"
+                },
+                "storages": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/coordinatorapi.StorageForecastResponse"
+                    }
+                }
+            }
+        },
         "coordinatorapi.GatewayResponse": {
             "type": "object",
             "properties": {
@@ -1206,6 +1531,47 @@ const docTemplate = `{
                 }
             }
         },
+        "coordinatorapi.RebalanceRequest": {
+            "type": "object",
+            "properties": {
+                "evacuate": {
+                    "description": "Evacuate — адреса инстансов Storages, удалённых из кластера: они передают\nвсе свои ожидающие сообщения.",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "coordinatorapi.RebalanceResponse": {
+            "type": "object",
+            "properties": {
+                "finished_at": {
+                    "type": "string"
+                },
+                "resubmitted": {
+                    "type": "integer"
+                },
+                "started_at": {
+                    "type": "string"
+                },
+                "state": {
+                    "type": "string",
+                    "enum": [
+                        "idle",
+                        "running",
+                        "done"
+                    ],
+                    "example": "running"
+                },
+                "storages": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/coordinatorapi.StorageRebalanceResponse"
+                    }
+                }
+            }
+        },
         "coordinatorapi.RegisterGatewayRequest": {
             "type": "object",
             "properties": {
@@ -1248,6 +1614,10 @@ const docTemplate = `{
                 "min_delay": {
                     "description": "e.g. \"0s\", \"1m\", \"1h\"",
                     "type": "string"
+                },
+                "version": {
+                    "description": "версия инстанса, например тег образа",
+                    "type": "string"
                 }
             }
         },
@@ -1271,10 +1641,167 @@ const docTemplate = `{
                 }
             }
         },
+        "coordinatorapi.StorageForecastResponse": {
+            "type": "object",
+            "properties": {
+                "address": {
+                    "type": "string"
+                },
+                "error": {
+                    "description": "Error — инстанс не ответил, и его сообщения не вошли в прогноз.",
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "shared": {
+                    "type": "boolean"
+                },
+                "skipped": {
+                    "description": "Skipped — инстанс ответил, но его данные уже учтены через другой инстанс\nтого же Storage с общими данными.",
+                    "type": "boolean"
+                },
+                "total": {
+                    "description": "Total — число ожидающих сообщений инстанса на горизонте прогноза.",
+                    "type": "integer"
+                },
+                "truncated": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "coordinatorapi.StorageHeartbeatRequest": {
+            "type": "object",
+            "properties": {
+                "address": {
+                    "description": "адрес инстанса, указанный при регистрации",
+                    "type": "string"
+                },
+                "bytes": {
+                    "description": "размер их payload, 0 — не считается",
+                    "type": "integer"
+                },
+                "capacity": {
+                    "description": "лимит числа сообщений, 0 — без ограничения",
+                    "type": "integer"
+                },
+                "in_flight": {
+                    "description": "выпущено в gateway и не подтверждено",
+                    "type": "integer"
+                },
+                "ingest_rate": {
+                    "description": "сообщений в секунду, сохранённых из шины",
+                    "type": "number"
+                },
+                "measured": {
+                    "description": "нагрузка измерена; false — показатели неизвестны",
+                    "type": "boolean"
+                },
+                "pending": {
+                    "description": "сколько сообщений хранит инстанс",
+                    "type": "integer"
+                },
+                "release_lag": {
+                    "description": "опоздание выпуска наступивших сообщений",
+                    "type": "string",
+                    "example": "250ms"
+                },
+                "status": {
+                    "description": "\"Active\" (по умолчанию) или \"Degraded\"",
+                    "type": "string"
+                }
+            }
+        },
+        "coordinatorapi.StorageInstanceResponse": {
+            "type": "object",
+            "properties": {
+                "address": {
+                    "type": "string"
+                },
+                "bytes": {
+                    "description": "размер их payload, 0 — не считается",
+                    "type": "integer"
+                },
+                "capacity": {
+                    "type": "integer"
+                },
+                "in_flight": {
+                    "description": "выпущено в gateway и не подтверждено",
+                    "type": "integer"
+                },
+                "ingest_rate": {
+                    "description": "сообщений в секунду, сохранённых из шины",
+                    "type": "number"
+                },
+                "last_heartbeat": {
+                    "type": "string"
+                },
+                "measured": {
+                    "description": "нагрузка измерена; false — показатели неизвестны",
+                    "type": "boolean"
+                },
+                "pending": {
+                    "description": "сколько сообщений хранит инстанс",
+                    "type": "integer"
+                },
+                "registered_at": {
+                    "type": "string"
+                },
+                "release_lag": {
+                    "description": "опоздание выпуска наступивших сообщений",
+                    "type": "string",
+                    "example": "250ms"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "version": {
+                    "type": "string"
+                }
+            }
+        },
+        "coordinatorapi.StorageRebalanceResponse": {
+            "type": "object",
+            "properties": {
+                "address": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "evacuate": {
+                    "type": "boolean"
+                },
+                "id": {
+                    "description": "ID — пустой у эвакуируемых инстансов, не зарегистрированных в координаторе.",
+                    "type": "string"
+                },
+                "resubmitted": {
+                    "description": "Resubmitted — сколько сообщений инстанс передал gateway для повторного выбора хранилища.",
+                    "type": "integer"
+                },
+                "scanned": {
+                    "description": "Scanned — сколько ожидающих сообщений инстанс просмотрел.",
+                    "type": "integer"
+                },
+                "state": {
+                    "type": "string",
+                    "enum": [
+                        "pending",
+                        "running",
+                        "done",
+                        "skipped",
+                        "failed"
+                    ],
+                    "example": "done"
+                }
+            }
+        },
         "coordinatorapi.StorageResponse": {
             "type": "object",
             "properties": {
                 "addresses": {
+                    "description": "Addresses — адреса Instances, для клиентов, которым не нужны данные инстансов.",
                     "type": "array",
                     "items": {
                         "type": "string"
@@ -1283,6 +1810,12 @@ const docTemplate = `{
                 "id": {
                     "type": "string"
                 },
+                "instances": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/coordinatorapi.StorageInstanceResponse"
+                    }
+                },
                 "last_heartbeat": {
                     "type": "string"
                 },
@@ -1300,6 +1833,53 @@ const docTemplate = `{
                 }
             }
         },
+        "storageapi.HistogramBucketResponse": {
+            "type": "object",
+            "properties": {
+                "count": {
+                    "type": "integer"
+                },
+                "groups": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "integer",
+                        "format": "int64"
+                    }
+                },
+                "start": {
+                    "type": "string"
+                }
+            }
+        },
+        "storageapi.HistogramResponse": {
+            "type": "object",
+            "properties": {
+                "bucket": {
+                    "description": "e.g. \"15m\"",
+                    "type": "string"
+                },
+                "buckets": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/storageapi.HistogramBucketResponse"
+                    }
+                },
+                "from": {
+                    "type": "string"
+                },
+                "group_depth": {
+                    "type": "integer"
+                },
+                "shared": {
+                    "description": "Shared — данные общие для всех инстансов хранилища.",
+                    "type": "boolean"
+                },
+                "truncated": {
+                    "description": "Truncated — учтены не все сообщения горизонта.",
+                    "type": "boolean"
+                }
+            }
+        },
         "time.Duration": {
             "type": "integer",
             "format": "int64",
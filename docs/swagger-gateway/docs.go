@@ -109,6 +109,46 @@ const docTemplate = `{
                     }
                 }
             }
+        },
+        "/api/v1/messages/import": {
+            "post": {
+                "description": "Принимает поток NDJSON (формат экспорта хранилищ) и направляет каждое сообщение как обычное: в хранилище по оставшейся задержке или сразу в пушер. ID и scheduled_at сохраняются. Тело может быть сжато gzip (Content-Encoding: gzip). Строки, которые не удалось разобрать или направить, не прерывают импорт и перечисляются в ответе",
+                "consumes": [
+                    "application/x-ndjson"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Messages"
+                ],
+                "summary": "Импорт сообщений",
+                "parameters": [
+                    {
+                        "description": "Поток NDJSON",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Итог импорта",
+                        "schema": {
+                            "$ref": "#/definitions/ndjson.ImportResult"
+                        }
+                    },
+                    "400": {
+                        "description": "Поток не удалось прочитать",
+                        "schema": {
+                            "$ref": "#/definitions/gatewayapi.ErrorResponse"
+                        }
+                    }
+                }
+            }
         }
     },
     "definitions": {
@@ -126,6 +166,14 @@ const docTemplate = `{
                 },
                 "log_level": {
                     "type": "string"
+                },
+                "max_release_lag": {
+                    "description": "Опоздание выпуска сообщений, начиная с которого gateway обходит хранилище, пока\nесть другие подходящие; 0 — не учитывать опоздание.",
+                    "type": "integer"
+                },
+                "nak_delay": {
+                    "description": "Задержка повторной доставки сообщения из orbital.gateway после ошибки отправки в пушер.",
+                    "type": "integer"
                 }
             }
         },
@@ -212,6 +260,44 @@ const docTemplate = `{
                     "example": "2024-01-15T10:30:00Z"
                 }
             }
+        },
+        "ndjson.ImportError": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "line": {
+                    "type": "integer"
+                }
+            }
+        },
+        "ndjson.ImportResult": {
+            "type": "object",
+            "properties": {
+                "duplicates": {
+                    "description": "Duplicates — сколько сообщений уже были сохранены с тем же содержимым.",
+                    "type": "integer"
+                },
+                "errors": {
+                    "description": "Errors — первые ошибки отдельных строк.",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/ndjson.ImportError"
+                    }
+                },
+                "failed": {
+                    "description": "Failed — сколько строк не удалось разобрать или сохранить.",
+                    "type": "integer"
+                },
+                "imported": {
+                    "description": "Imported — сколько сообщений сохранено, включая дубликаты.",
+                    "type": "integer"
+                }
+            }
         }
     }
 }`
@@ -0,0 +1,1228 @@
+// Package swagger_storage Code generated by swaggo/swag. DO NOT EDIT
+package swagger_storage
+
+import "github.com/swaggo/swag"
+
+const docTemplate = `{
+    "schemes": {{ marshal .Schemes }},
+    "swagger": "2.0",
+    "info": {
+        "description": "{{escape .Description}}",
+        "title": "{{.Title}}",
+        "contact": {},
+        "version": "{{.Version}}"
+    },
+    "host": "{{.Host}}",
+    "basePath": "{{.BasePath}}",
+    "paths": {
+        "/drain": {
+            "get": {
+                "description": "Возвращает стадию вывода инстанса из кластера и число оставшихся и переданных сообщений",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Drain"
+                ],
+                "summary": "Ход вывода инстанса",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.DrainStatusResponse"
+                        }
+                    },
+                    "501": {
+                        "description": "Хранилище не поддерживает вывод",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Запускает вывод инстанса: он перестаёт принимать сообщения, удаляет свой адрес из координатора и передаёт сообщения другим инстансам. Возвращает ход вывода, не дожидаясь его завершения; повторный вызов возвращает ход уже начатого вывода, а после неудачного — запускает его снова",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Drain"
+                ],
+                "summary": "Вывести инстанс из кластера",
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.DrainStatusResponse"
+                        }
+                    },
+                    "501": {
+                        "description": "Хранилище не поддерживает вывод",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Хранилище не инициализировано",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/health": {
+            "get": {
+                "description": "Проверка работоспособности хранилища",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Health"
+                ],
+                "summary": "Health check",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/messages": {
+            "get": {
+                "description": "Возвращает страницу сообщений в порядке (scheduled_at, id) с фильтрами. Для следующей страницы передайте next_cursor в параметре cursor",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Messages"
+                ],
+                "summary": "Список сообщений",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Префикс routing key",
+                        "name": "routing_key_prefix",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "Пары key=value, которые должны быть в metadata",
+                        "name": "metadata",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Начало интервала scheduled_at включительно (RFC3339)",
+                        "name": "scheduled_from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Конец интервала scheduled_at не включительно (RFC3339)",
+                        "name": "scheduled_to",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "pending",
+                            "in_flight",
+                            "failed"
+                        ],
+                        "type": "string",
+                        "description": "Состояние сообщения",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Курсор страницы",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 100,
+                        "description": "Размер страницы",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ListMessagesResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    },
+                    "501": {
+                        "description": "Хранилище не поддерживает перечисление",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Хранилище не инициализировано",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Сохраняет новое сообщение в хранилище",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Messages"
+                ],
+                "summary": "Сохранить сообщение",
+                "parameters": [
+                    {
+                        "description": "Данные сообщения",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.StoreMessageRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.MessageResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Сообщение уже существует",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Инстанс выводится из кластера",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    },
+                    "507": {
+                        "description": "Хранилище заполнено",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/messages/acknowledge": {
+            "post": {
+                "description": "Удаляет обработанные сообщения. Неизвестные ID пропускаются",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Messages"
+                ],
+                "summary": "Подтвердить обработку",
+                "parameters": [
+                    {
+                        "description": "Идентификаторы сообщений",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.AcknowledgeRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Хранилище не инициализировано",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/messages/count": {
+            "get": {
+                "description": "Возвращает общее количество сообщений в хранилище",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Messages"
+                ],
+                "summary": "Количество сообщений",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.CountResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/messages/expiring": {
+            "get": {
+                "description": "Возвращает до limit ожидающих сообщений, которые наступят в пределах threshold. Состояние сообщений не меняется",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Messages"
+                ],
+                "summary": "Истекающие сообщения",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "30s",
+                        "description": "Горизонт в формате Go duration",
+                        "name": "threshold",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "default": 100,
+                        "description": "Максимальное число сообщений",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.FetchMessagesResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Хранилище не инициализировано",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/messages/export": {
+            "get": {
+                "description": "Передаёт сообщения потоком NDJSON (по сообщению на строку) в порядке (scheduled_at, id) с сохранением ID и scheduled_at. Без status выгружаются все сообщения, кроме failed. При Accept-Encoding: gzip поток сжимается. Сообщения выгружаются за один проход по хранилищу. Ошибка посреди потока обрывает соединение",
+                "produces": [
+                    "application/x-ndjson"
+                ],
+                "tags": [
+                    "Messages"
+                ],
+                "summary": "Экспорт сообщений",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Префикс routing key",
+                        "name": "routing_key_prefix",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "Пары key=value, которые должны быть в metadata",
+                        "name": "metadata",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Начало интервала scheduled_at включительно (RFC3339)",
+                        "name": "scheduled_from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Конец интервала scheduled_at не включительно (RFC3339)",
+                        "name": "scheduled_to",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "pending",
+                            "in_flight",
+                            "failed"
+                        ],
+                        "type": "string",
+                        "description": "Состояние сообщения",
+                        "name": "status",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Поток NDJSON",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    },
+                    "501": {
+                        "description": "Хранилище не поддерживает выгрузку",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Хранилище не инициализировано",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/messages/histogram": {
+            "get": {
+                "description": "Число ожидающих сообщений по интервалам scheduled_at на горизонте прогноза, с разбивкой по префиксу routing key. Просроченные сообщения входят в первый интервал. Хранилища без встроенной гистограммы строят её по не более чем 100000 ближайших сообщений и отмечают усечённый ответ truncated",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Messages"
+                ],
+                "summary": "Гистограмма ожидающих сообщений",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "default": "15m",
+                        "description": "Ширина интервала",
+                        "name": "bucket",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "default": "24h",
+                        "description": "Горизонт прогноза",
+                        "name": "horizon",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Число сегментов routing key для группировки, 0 — без группировки",
+                        "name": "group_depth",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Начало первого интервала (RFC3339), по умолчанию текущее время, округлённое до bucket",
+                        "name": "from",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.HistogramResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    },
+                    "501": {
+                        "description": "Хранилище не поддерживает выборку ожидающих сообщений",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Хранилище не инициализировано",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/messages/import": {
+            "post": {
+                "description": "Сохраняет в хранилище сообщения из потока NDJSON (формат экспорта) с сохранением ID и scheduled_at, без выбора хранилища по задержке. Тело может быть сжато gzip (Content-Encoding: gzip). Строки, которые не удалось разобрать или сохранить, не прерывают импорт и перечисляются в ответе",
+                "consumes": [
+                    "application/x-ndjson"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Messages"
+                ],
+                "summary": "Импорт сообщений",
+                "parameters": [
+                    {
+                        "description": "Поток NDJSON",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/ndjson.ImportResult"
+                        }
+                    },
+                    "400": {
+                        "description": "Поток не удалось прочитать; в ответе итог по обработанным строкам",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Хранилище не инициализировано",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/messages/ready": {
+            "get": {
+                "description": "Выдаёт до limit наступивших сообщений и переводит их в in_flight. Не подтверждённые за VisibilityTimeout сообщения выдаются повторно",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Messages"
+                ],
+                "summary": "Выдать готовые сообщения",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "default": 100,
+                        "description": "Максимальное число сообщений",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.FetchMessagesResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    },
+                    "501": {
+                        "description": "Хранилище не выдаёт сообщения",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Хранилище не инициализировано",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/messages/rehome": {
+            "post": {
+                "description": "Передаёт gateway ожидающие сообщения, оставшаяся задержка которых не подходит под диапазон [min_delay, max_delay) (с all — все ожидающие), чтобы он заново выбрал для них хранилище. Сообщения удаляются из хранилища, когда gateway подтвердит их передачу в другое хранилище. Инстанс с собственными данными при all перестаёт принимать сообщения из шины, и gateway может передать его сообщения другим инстансам того же хранилища. Вызывается перебалансировкой координатора",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Messages"
+                ],
+                "summary": "Передать сообщения вне диапазона gateway",
+                "parameters": [
+                    {
+                        "description": "Диапазон задержек хранилища",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.RehomeRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.RehomeResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    },
+                    "501": {
+                        "description": "Хранилище не поддерживает передачу сообщений",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Хранилище не инициализировано или выводится из кластера",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/messages/{id}": {
+            "get": {
+                "description": "Возвращает сообщение из хранилища по его идентификатору вместе с состоянием и числом попыток",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Messages"
+                ],
+                "summary": "Получить сообщение по ID",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Идентификатор сообщения",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.StoredMessageResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Сообщение не найдено",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Хранилище не инициализировано",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Удаляет сообщение в любом состоянии",
+                "tags": [
+                    "Messages"
+                ],
+                "summary": "Удалить сообщение",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Идентификатор сообщения",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "404": {
+                        "description": "Сообщение не найдено",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Хранилище не инициализировано",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/messages/{id}/reject": {
+            "post": {
+                "description": "Возвращает выданное сообщение в ожидание с исходным ScheduledAt (requeue) или переводит его в failed",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Messages"
+                ],
+                "summary": "Отклонить сообщение",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Идентификатор сообщения",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Параметры отклонения",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.RejectRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Сообщение не найдено",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Сообщение не выдано",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    },
+                    "501": {
+                        "description": "Хранилище не выдаёт сообщения",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Хранилище не инициализировано",
+                        "schema": {
+                            "$ref": "#/definitions/storageapi.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "ndjson.ImportError": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "line": {
+                    "type": "integer"
+                }
+            }
+        },
+        "ndjson.ImportResult": {
+            "type": "object",
+            "properties": {
+                "duplicates": {
+                    "description": "Duplicates — сколько сообщений уже были сохранены с тем же содержимым.",
+                    "type": "integer"
+                },
+                "errors": {
+                    "description": "Errors — первые ошибки отдельных строк.",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/ndjson.ImportError"
+                    }
+                },
+                "failed": {
+                    "description": "Failed — сколько строк не удалось разобрать или сохранить.",
+                    "type": "integer"
+                },
+                "imported": {
+                    "description": "Imported — сколько сообщений сохранено, включая дубликаты.",
+                    "type": "integer"
+                }
+            }
+        },
+        "storageapi.AcknowledgeRequest": {
+            "type": "object",
+            "properties": {
+                "ids": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "storageapi.CountResponse": {
+            "type": "object",
+            "properties": {
+                "count": {
+                    "type": "integer"
+                }
+            }
+        },
+        "storageapi.DrainStatusResponse": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "finished_at": {
+                    "type": "string"
+                },
+                "in_flight": {
+                    "type": "integer"
+                },
+                "pending": {
+                    "type": "integer"
+                },
+                "republished": {
+                    "type": "integer"
+                },
+                "started_at": {
+                    "type": "string"
+                },
+                "state": {
+                    "type": "string",
+                    "enum": [
+                        "idle",
+                        "draining",
+                        "done",
+                        "failed"
+                    ],
+                    "example": "draining"
+                },
+                "target": {
+                    "type": "string"
+                }
+            }
+        },
+        "storageapi.ErrorResponse": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                }
+            }
+        },
+        "storageapi.FetchMessagesResponse": {
+            "type": "object",
+            "properties": {
+                "messages": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/storageapi.StoredMessageResponse"
+                    }
+                }
+            }
+        },
+        "storageapi.HistogramBucketResponse": {
+            "type": "object",
+            "properties": {
+                "count": {
+                    "type": "integer"
+                },
+                "groups": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "integer",
+                        "format": "int64"
+                    }
+                },
+                "start": {
+                    "type": "string"
+                }
+            }
+        },
+        "storageapi.HistogramResponse": {
+            "type": "object",
+            "properties": {
+                "bucket": {
+                    "description": "e.g. \"15m\"",
+                    "type": "string"
+                },
+                "buckets": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/storageapi.HistogramBucketResponse"
+                    }
+                },
+                "from": {
+                    "type": "string"
+                },
+                "group_depth": {
+                    "type": "integer"
+                },
+                "shared": {
+                    "description": "Shared — данные общие для всех инстансов хранилища.",
+                    "type": "boolean"
+                },
+                "truncated": {
+                    "description": "Truncated — учтены не все сообщения горизонта.",
+                    "type": "boolean"
+                }
+            }
+        },
+        "storageapi.ListMessagesResponse": {
+            "type": "object",
+            "properties": {
+                "messages": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/storageapi.StoredMessageResponse"
+                    }
+                },
+                "next_cursor": {
+                    "description": "NextCursor передаётся в параметре cursor для получения следующей страницы;\nотсутствует на последней странице.",
+                    "type": "string"
+                }
+            }
+        },
+        "storageapi.MessageResponse": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "metadata": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "payload": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "routing_key": {
+                    "type": "string"
+                },
+                "routing_settings": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "scheduled_at": {
+                    "type": "string"
+                }
+            }
+        },
+        "storageapi.RehomeRequest": {
+            "type": "object",
+            "properties": {
+                "all": {
+                    "description": "All — передать все ожидающие сообщения независимо от диапазона.",
+                    "type": "boolean"
+                },
+                "max_delay": {
+                    "description": "e.g. \"1h\", \"0\" (unlimited)",
+                    "type": "string",
+                    "example": "1h"
+                },
+                "min_delay": {
+                    "description": "e.g. \"0s\", \"1m\", \"1h\"",
+                    "type": "string",
+                    "example": "1m"
+                }
+            }
+        },
+        "storageapi.RehomeResponse": {
+            "type": "object",
+            "properties": {
+                "resubmitted": {
+                    "type": "integer"
+                },
+                "scanned": {
+                    "type": "integer"
+                },
+                "shared": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "storageapi.RejectRequest": {
+            "type": "object",
+            "properties": {
+                "requeue": {
+                    "description": "Requeue — вернуть сообщение в ожидание; иначе оно переводится в failed.",
+                    "type": "boolean"
+                }
+            }
+        },
+        "storageapi.StoreMessageRequest": {
+            "type": "object",
+            "properties": {
+                "metadata": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "payload": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "routing_key": {
+                    "type": "string"
+                },
+                "routing_settings": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "scheduled_at": {
+                    "type": "string"
+                }
+            }
+        },
+        "storageapi.StoredMessageResponse": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "integer"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "last_attempt_at": {
+                    "type": "string"
+                },
+                "metadata": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "payload": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "routing_key": {
+                    "type": "string"
+                },
+                "routing_settings": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "scheduled_at": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string",
+                    "enum": [
+                        "pending",
+                        "in_flight",
+                        "failed"
+                    ],
+                    "example": "pending"
+                }
+            }
+        }
+    },
+    "tags": [
+        {
+            "description": "Проверка состояния хранилища",
+            "name": "Health"
+        },
+        {
+            "description": "Операции с сообщениями",
+            "name": "Messages"
+        }
+    ]
+}`
+
+// SwaggerInfo holds exported Swagger Info so clients can modify it
+var SwaggerInfo = &swag.Spec{
+	Version:          "1.0",
+	Host:             "",
+	BasePath:         "/api/v1",
+	Schemes:          []string{},
+	Title:            "Orbital Storage API",
+	Description:      "API для взаимодействия с хранилищами сообщений Orbital (in-memory, Redis).",
+	InfoInstanceName: "swagger",
+	SwaggerTemplate:  docTemplate,
+	LeftDelim:        "{{",
+	RightDelim:       "}}",
+}
+
+func init() {
+	swag.Register(SwaggerInfo.InstanceName(), SwaggerInfo)
+}
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"time"
+
 	"github.com/Alexey-zaliznuak/orbital/pkg/entities/coordinator"
 	"github.com/caarlos0/env/v11"
 )
@@ -23,6 +25,25 @@ func (b *ClusterConfigBuilder) WithNatsAddress(addr string) *ClusterConfigBuilde
 	return b
 }
 
+// WithStreamRetention устанавливает политику хранения JetStream streams.
+func (b *ClusterConfigBuilder) WithStreamRetention(retention string) *ClusterConfigBuilder {
+	b.cfg.StreamRetention = retention
+	return b
+}
+
+// WithStreamReplicas устанавливает количество реплик JetStream streams.
+func (b *ClusterConfigBuilder) WithStreamReplicas(replicas int) *ClusterConfigBuilder {
+	b.cfg.StreamReplicas = replicas
+	return b
+}
+
+// WithStreamLimits устанавливает ограничения JetStream streams по возрасту и размеру.
+func (b *ClusterConfigBuilder) WithStreamLimits(maxAge time.Duration, maxBytes int64) *ClusterConfigBuilder {
+	b.cfg.StreamMaxAge = maxAge
+	b.cfg.StreamMaxBytes = maxBytes
+	return b
+}
+
 // FromEnv загружает конфигурацию из переменных окружения.
 func (b *ClusterConfigBuilder) FromEnv() *ClusterConfigBuilder {
 	env.Parse(b.cfg)
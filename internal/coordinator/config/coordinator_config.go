@@ -51,6 +51,20 @@ func (b *CoordinatorConfigBuilder) WithLogLevel(level string) *CoordinatorConfig
 	return b
 }
 
+// WithStrictStorageCoverage включает отклонение регистраций Storage, создающих разрывы
+// в покрытии задержек.
+func (b *CoordinatorConfigBuilder) WithStrictStorageCoverage(strict bool) *CoordinatorConfigBuilder {
+	b.cfg.StrictStorageCoverage = strict
+	return b
+}
+
+// WithStorageInstanceTTL устанавливает, сколько инстанс Storage может не присылать
+// heartbeat, прежде чем координатор его удалит; 0 — не удалять.
+func (b *CoordinatorConfigBuilder) WithStorageInstanceTTL(ttl time.Duration) *CoordinatorConfigBuilder {
+	b.cfg.StorageInstanceTTL = ttl
+	return b
+}
+
 // FromEnv загружает конфигурацию из переменных окружения.
 func (b *CoordinatorConfigBuilder) FromEnv() *CoordinatorConfigBuilder {
 	env.Parse(b.cfg)
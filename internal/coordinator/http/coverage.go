@@ -0,0 +1,31 @@
+package http
+
+import (
+	"slices"
+	"strings"
+
+	coordinatorapi "github.com/Alexey-zaliznuak/orbital/pkg/coordinator/api"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+)
+
+// registrationGaps возвращает задержки, которые перестанет принимать хоть один Storage,
+// если зарегистрировать incoming поверх storages. Повторная регистрация заменяет
+// диапазон уже известного Storage.
+func registrationGaps(storages []*storage.Info, incoming *storage.Info) []storage.DelayRange {
+	after := slices.DeleteFunc(slices.Clone(storages), func(info *storage.Info) bool {
+		return info.ID == incoming.ID
+	})
+	after = append(after, incoming)
+
+	return storage.ComputeCoverage(after).NewGaps(storage.ComputeCoverage(storages))
+}
+
+// formatDelayRanges записывает диапазоны в виде "[1h0m0s, unlimited)".
+func formatDelayRanges(ranges []storage.DelayRange) string {
+	parts := make([]string, len(ranges))
+	for i, r := range ranges {
+		resp := coordinatorapi.DelayRangeToResponse(r)
+		parts[i] = "[" + resp.From + ", " + resp.To + ")"
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,72 @@
+package http
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+)
+
+func TestCoverageFindsGapsAndOverlaps(t *testing.T) {
+	storages := []*storage.Info{
+		{ID: "hot", MaxDelay: time.Hour},
+		{ID: "hot-spare", MinDelay: 30 * time.Minute, MaxDelay: time.Hour},
+		{ID: "warm", MinDelay: 2 * time.Hour, MaxDelay: 24 * time.Hour},
+		{ID: "cold", MinDelay: 48 * time.Hour},
+	}
+
+	coverage := storage.ComputeCoverage(storages)
+
+	wantGaps := []storage.DelayRange{
+		{From: time.Hour, To: 2 * time.Hour},
+		{From: 24 * time.Hour, To: 48 * time.Hour},
+	}
+	if !slices.Equal(coverage.Gaps, wantGaps) {
+		t.Fatalf("expected gaps %v, got %v", wantGaps, coverage.Gaps)
+	}
+
+	if len(coverage.Overlaps) != 1 {
+		t.Fatalf("expected one overlap, got %v", coverage.Overlaps)
+	}
+	overlap := coverage.Overlaps[0]
+	if overlap.From != 30*time.Minute || overlap.To != time.Hour || !slices.Equal(overlap.StorageIDs, []string{"hot", "hot-spare"}) {
+		t.Fatalf("unexpected overlap %+v", overlap)
+	}
+
+	if storage.ComputeCoverage(nil).Gaps[0] != (storage.DelayRange{}) {
+		t.Fatal("expected empty cluster to leave [0, unlimited) uncovered")
+	}
+}
+
+func TestRegistrationGaps(t *testing.T) {
+	storages := []*storage.Info{
+		{ID: "hot", MaxDelay: time.Hour},
+		{ID: "cold", MinDelay: 2 * time.Hour},
+	}
+
+	// Закрывает существующий разрыв.
+	if gaps := registrationGaps(storages, &storage.Info{ID: "warm", MinDelay: time.Hour, MaxDelay: 2 * time.Hour}); len(gaps) != 0 {
+		t.Fatalf("expected no new gaps, got %v", gaps)
+	}
+
+	// Сужение диапазона открывает [30m, 1h).
+	gaps := registrationGaps(storages, &storage.Info{ID: "hot", MaxDelay: 30 * time.Minute})
+	if !slices.Equal(gaps, []storage.DelayRange{{From: 30 * time.Minute, To: time.Hour}}) {
+		t.Fatalf("unexpected gaps %v", gaps)
+	}
+	if got := formatDelayRanges(gaps); got != "[30m0s, 1h0m0s)" {
+		t.Fatalf("unexpected format %q", got)
+	}
+
+	// Первый Storage в пустом кластере ничего не открывает.
+	if gaps := registrationGaps(nil, &storage.Info{ID: "hot", MaxDelay: time.Hour}); len(gaps) != 0 {
+		t.Fatalf("expected no new gaps in empty cluster, got %v", gaps)
+	}
+
+	// Ограничение неограниченного сверху Storage открывает хвост.
+	gaps = registrationGaps(storages, &storage.Info{ID: "cold", MinDelay: 2 * time.Hour, MaxDelay: 24 * time.Hour})
+	if !slices.Equal(gaps, []storage.DelayRange{{From: 24 * time.Hour}}) {
+		t.Fatalf("unexpected gaps %v", gaps)
+	}
+}
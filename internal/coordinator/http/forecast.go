@@ -0,0 +1,92 @@
+package http
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	coordinatorapi "github.com/Alexey-zaliznuak/orbital/pkg/coordinator/api"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+	storagesdk "github.com/Alexey-zaliznuak/orbital/pkg/sdk/storage"
+	storageapi "github.com/Alexey-zaliznuak/orbital/pkg/sdk/storage/api"
+)
+
+// forecastTimeout — сколько координатор ждёт гистограмму от одного инстанса Storage.
+const forecastTimeout = 5 * time.Second
+
+// histogramFetcher запрашивает гистограмму у инстанса Storage по его адресу.
+type histogramFetcher func(ctx context.Context, address string, query storage.HistogramQuery) (*storage.Histogram, error)
+
+// fetchHistogram запрашивает гистограмму через storage SDK.
+func fetchHistogram(ctx context.Context, address string, query storage.HistogramQuery) (*storage.Histogram, error) {
+	client := storagesdk.NewClient(storagesdk.ClientConfig{BaseURL: address, Timeout: forecastTimeout})
+	return client.Histogram(ctx, query)
+}
+
+// instanceHistogram — ответ одного инстанса Storage.
+type instanceHistogram struct {
+	info      *storage.Info
+	address   string
+	histogram *storage.Histogram
+	err       error
+}
+
+// forecast опрашивает все инстансы storages параллельно и складывает их гистограммы.
+// Инстансы Storage с общими данными описывают одни и те же сообщения, поэтому от такого
+// Storage учитывается только первый ответивший инстанс. Недоступные инстансы
+// не прерывают прогноз и перечисляются в ответе с ошибкой.
+func forecast(ctx context.Context, storages []*storage.Info, query storage.HistogramQuery, fetch histogramFetcher, now time.Time) coordinatorapi.ForecastResponse {
+	if query.From.IsZero() {
+		query.From = now.Truncate(query.Bucket)
+	}
+
+	var instances []*instanceHistogram
+	for _, info := range storages {
+		for _, address := range info.Addresses() {
+			instances = append(instances, &instanceHistogram{info: info, address: address})
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, inst := range instances {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			inst.histogram, inst.err = fetch(ctx, inst.address, query)
+		}()
+	}
+	wg.Wait()
+
+	total := storage.NewHistogram(query, now)
+	counted := make(map[string]bool)
+	resp := coordinatorapi.ForecastResponse{Storages: make([]coordinatorapi.StorageForecastResponse, len(instances))}
+
+	for i, inst := range instances {
+		entry := coordinatorapi.StorageForecastResponse{ID: inst.info.ID, Address: inst.address}
+
+		if inst.err != nil {
+			entry.Error = inst.err.Error()
+			resp.Storages[i] = entry
+			continue
+		}
+
+		h := inst.histogram
+		for _, b := range h.Buckets {
+			entry.Total += b.Count
+		}
+		entry.Truncated = h.Truncated
+		entry.Shared = h.Shared
+
+		if h.Shared && counted[inst.info.ID] {
+			entry.Skipped = true
+		} else {
+			total.Merge(h)
+			counted[inst.info.ID] = true
+		}
+
+		resp.Storages[i] = entry
+	}
+
+	resp.Histogram = storageapi.HistogramResponseFromHistogram(total)
+	return resp
+}
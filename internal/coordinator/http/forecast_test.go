@@ -0,0 +1,77 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+)
+
+func TestForecastAggregatesStorages(t *testing.T) {
+	now := time.Date(2025, 1, 1, 8, 50, 0, 0, time.UTC)
+	query := storage.HistogramQuery{Bucket: time.Hour, Horizon: 2 * time.Hour}
+
+	// Каждый адрес отвечает гистограммой с count сообщениями в каждом интервале.
+	instances := map[string]struct {
+		count  int64
+		shared bool
+	}{
+		"http://memory-1": {1, false},
+		"http://memory-2": {2, false},
+		"http://redis-1":  {10, true},
+		"http://redis-2":  {10, true},
+	}
+	fetch := func(_ context.Context, address string, q storage.HistogramQuery) (*storage.Histogram, error) {
+		inst, ok := instances[address]
+		if !ok {
+			return nil, errors.New("connection refused")
+		}
+		h := storage.NewHistogram(q, now)
+		for i := range h.Buckets {
+			h.Buckets[i].Count = inst.count
+		}
+		h.Shared = inst.shared
+		return h, nil
+	}
+
+	storages := []*storage.Info{
+		{ID: "hot", Instances: instancesAt("http://memory-1", "http://memory-2")},
+		{ID: "warm", Instances: instancesAt("http://redis-1", "http://redis-2")},
+		{ID: "cold", Instances: instancesAt("http://down")},
+	}
+
+	resp := forecast(context.Background(), storages, query, fetch, now)
+
+	if len(resp.Histogram.Buckets) != 2 {
+		t.Fatalf("expected 2 buckets, got %d", len(resp.Histogram.Buckets))
+	}
+	for _, b := range resp.Histogram.Buckets {
+		if b.Count != 13 {
+			t.Fatalf("expected 13 messages per bucket, got %d", b.Count)
+		}
+	}
+
+	skipped, failed := 0, 0
+	for _, st := range resp.Storages {
+		if st.Skipped {
+			skipped++
+		}
+		if st.Error != "" {
+			failed++
+		}
+	}
+	if len(resp.Storages) != 5 || skipped != 1 || failed != 1 {
+		t.Fatalf("unexpected instances: %+v", resp.Storages)
+	}
+}
+
+// instancesAt возвращает инстансы Storage с адресами addresses.
+func instancesAt(addresses ...string) []storage.Instance {
+	instances := make([]storage.Instance, len(addresses))
+	for i, address := range addresses {
+		instances[i] = storage.Instance{Address: address}
+	}
+	return instances
+}
@@ -3,6 +3,7 @@ package http
 import (
 	"encoding/json"
 	"errors"
+	"io"
 	"net/http"
 	"time"
 
@@ -17,6 +18,7 @@ import (
 	"github.com/Alexey-zaliznuak/orbital/pkg/entities/pusher"
 	"github.com/Alexey-zaliznuak/orbital/pkg/entities/routing_rule"
 	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+	storageapi "github.com/Alexey-zaliznuak/orbital/pkg/sdk/storage/api"
 )
 
 // === Health ===
@@ -352,13 +354,14 @@ func (s *Server) unregisterGateway(w http.ResponseWriter, r *http.Request) {
 
 // registerStorage godoc
 // @Summary		Зарегистрировать Storage
-// @Description	Регистрирует новый Storage инстанс с диапазоном задержек. Если storage с таким id уже есть, адрес из запроса добавляется к списку addresses (без дубликатов), обновляются min/max delay и heartbeat.
+// @Description	Регистрирует новый Storage инстанс с диапазоном задержек. Если storage с таким id уже есть, адрес из запроса добавляется к списку addresses (без дубликатов), обновляются min/max delay и heartbeat. В строгом режиме (STRICT_STORAGE_COVERAGE) регистрация, после которой часть принимавшихся задержек не примет ни один Storage, отклоняется.
 // @Tags		Storages
 // @Accept		json
 // @Produce		json
 // @Param		request	body		coordinatorapi.RegisterStorageRequest	true	"Данные Storage"
 // @Success		201		{object}	coordinatorapi.StorageResponse
 // @Failure		400		{object}	coordinatorapi.ErrorResponse
+// @Failure		409		{object}	coordinatorapi.ErrorResponse	"Регистрация создаёт разрыв в покрытии задержек"
 // @Failure		500		{object}	coordinatorapi.ErrorResponse
 // @Router		/storages [post]
 func (s *Server) registerStorage(w http.ResponseWriter, r *http.Request) {
@@ -390,13 +393,28 @@ func (s *Server) registerStorage(w http.ResponseWriter, r *http.Request) {
 
 	now := time.Now()
 	st := &storage.Info{
-		ID:            req.ID,
-		Addresses:     []string{req.Address},
-		MinDelay:      minDelay,
-		MaxDelay:      maxDelay,
+		ID:       req.ID,
+		MinDelay: minDelay,
+		MaxDelay: maxDelay,
+	}
+	st.AddInstance(storage.Instance{
+		Address:       req.Address,
 		Status:        node.NodeStatusActive,
+		Version:       req.Version,
 		RegisteredAt:  now,
 		LastHeartbeat: now,
+	})
+
+	if s.coordinator.GetCoordinatorConfig().StrictStorageCoverage {
+		storages, err := s.listLiveStorages(r.Context())
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if gaps := registrationGaps(storages, st); len(gaps) > 0 {
+			s.writeError(w, http.StatusConflict, "registration leaves delays uncovered: "+formatDelayRanges(gaps))
+			return
+		}
 	}
 
 	if err := s.coordinator.GetStorage().RegisterStorage(r.Context(), st); err != nil {
@@ -409,7 +427,7 @@ func (s *Server) registerStorage(w http.ResponseWriter, r *http.Request) {
 
 // getStorage godoc
 // @Summary		Получить Storage по ID
-// @Description	Возвращает информацию о Storage
+// @Description	Возвращает информацию о Storage. Инстансы, не присылавшие heartbeat дольше STORAGE_INSTANCE_TTL, не возвращаются; Storage без живых инстансов не найден
 // @Tags		Storages
 // @Produce		json
 // @Param		storageID	path		string	true	"ID Storage"
@@ -420,7 +438,7 @@ func (s *Server) registerStorage(w http.ResponseWriter, r *http.Request) {
 func (s *Server) getStorage(w http.ResponseWriter, r *http.Request) {
 	storageID := chi.URLParam(r, "storageID")
 
-	storage, err := s.coordinator.GetStorage().GetStorage(r.Context(), storageID)
+	st, err := s.coordinator.GetStorage().GetStorage(r.Context(), storageID)
 	if err != nil {
 		if errors.Is(err, etcd.ErrNotFound) {
 			s.writeError(w, http.StatusNotFound, "storage not found")
@@ -430,19 +448,25 @@ func (s *Server) getStorage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.writeJSON(w, http.StatusOK, coordinatorapi.StorageToResponse(storage))
+	live := liveStorages([]*storage.Info{st}, s.coordinator.GetCoordinatorConfig().StorageInstanceTTL, time.Now())
+	if len(live) == 0 {
+		s.writeError(w, http.StatusNotFound, "storage not found")
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, coordinatorapi.StorageToResponse(live[0]))
 }
 
 // listStorages godoc
 // @Summary		Список Storages
-// @Description	Возвращает список всех зарегистрированных Storages
+// @Description	Возвращает список всех зарегистрированных Storages. Инстансы, не присылавшие heartbeat дольше STORAGE_INSTANCE_TTL, и Storages без живых инстансов не возвращаются
 // @Tags		Storages
 // @Produce		json
 // @Success		200	{array}		coordinatorapi.StorageResponse
 // @Failure		500	{object}	coordinatorapi.ErrorResponse
 // @Router		/storages [get]
 func (s *Server) listStorages(w http.ResponseWriter, r *http.Request) {
-	storages, err := s.coordinator.GetStorage().ListStorages(r.Context())
+	storages, err := s.listLiveStorages(r.Context())
 	if err != nil {
 		s.writeError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -458,17 +482,51 @@ func (s *Server) listStorages(w http.ResponseWriter, r *http.Request) {
 
 // updateStorageHeartbeat godoc
 // @Summary		Обновить heartbeat Storage
-// @Description	Обновляет время последнего heartbeat Storage
+// @Description	Обновляет время последнего heartbeat инстанса Storage, его статус и нагрузку: число и размер хранимых сообщений, число не подтверждённых gateway, скорость приёма и опоздание выпуска. Gateway предпочитает менее загруженные Storage и обходит опаздывающие. Без статуса инстанс Active; перегруженный инстанс сообщает Degraded. Storage Degraded, когда Degraded все его инстансы, и тогда gateway направляет ему сообщения, только если других подходящих Storage нет. Тело можно не передавать: heartbeat без address обновляет статус и время heartbeat всех инстансов Storage, их нагрузка остаётся неизвестной.
 // @Tags		Storages
-// @Param		storageID	path	string	true	"ID Storage"
+// @Accept		json
+// @Param		storageID	path	string								true	"ID Storage"
+// @Param		request		body	coordinatorapi.StorageHeartbeatRequest	false	"Состояние инстанса"
 // @Success		204			"No Content"
-// @Failure		404			{object}	coordinatorapi.ErrorResponse	"Storage не найден"
+// @Failure		400			{object}	coordinatorapi.ErrorResponse
+// @Failure		404			{object}	coordinatorapi.ErrorResponse	"Storage или инстанс не найден"
 // @Failure		500			{object}	coordinatorapi.ErrorResponse
 // @Router		/storages/{storageID}/heartbeat [put]
 func (s *Server) updateStorageHeartbeat(w http.ResponseWriter, r *http.Request) {
 	storageID := chi.URLParam(r, "storageID")
 
-	if err := s.coordinator.GetStorage().UpdateStorageHeartbeat(r.Context(), storageID); err != nil {
+	// Инстансы, не сообщающие адрес и нагрузку, присылают пустое тело или только статус:
+	// такой heartbeat относится ко всем инстансам Storage, нагрузка остаётся неизвестной.
+	var req coordinatorapi.StorageHeartbeatRequest
+	if err := s.decodeJSON(r, &req); err != nil && !errors.Is(err, io.EOF) {
+		s.writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	status := node.NodeStatusActive
+	switch req.Status {
+	case "", node.NodeStatusActive.String():
+	case node.NodeStatusDegraded.String():
+		status = node.NodeStatusDegraded
+	default:
+		s.writeError(w, http.StatusBadRequest, "status must be Active or Degraded")
+		return
+	}
+
+	load, err := coordinatorapi.ParseLoad(req.StorageLoad)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid release_lag format")
+		return
+	}
+
+	hb := storage.Heartbeat{
+		Address:  req.Address,
+		Status:   status,
+		Capacity: req.Capacity,
+		Load:     load,
+	}
+
+	if err := s.coordinator.GetStorage().UpdateStorageHeartbeat(r.Context(), storageID, hb); err != nil {
 		if errors.Is(err, etcd.ErrNotFound) {
 			s.writeError(w, http.StatusNotFound, "storage not found")
 			return
@@ -504,6 +562,130 @@ func (s *Server) unregisterStorage(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// unregisterStorageAddress godoc
+// @Summary		Удалить адрес инстанса Storage
+// @Description	Удаляет адрес одного инстанса Storage, например при его остановке. Storage без адресов удаляется целиком; отсутствующий адрес не считается ошибкой
+// @Tags		Storages
+// @Param		storageID	path	string	true	"ID Storage"
+// @Param		address		query	string	true	"Адрес инстанса"
+// @Success		204			"No Content"
+// @Failure		400			{object}	coordinatorapi.ErrorResponse
+// @Failure		404			{object}	coordinatorapi.ErrorResponse	"Storage не найден"
+// @Failure		500			{object}	coordinatorapi.ErrorResponse
+// @Router		/storages/{storageID}/addresses [delete]
+func (s *Server) unregisterStorageAddress(w http.ResponseWriter, r *http.Request) {
+	storageID := chi.URLParam(r, "storageID")
+
+	address := r.URL.Query().Get("address")
+	if address == "" {
+		s.writeError(w, http.StatusBadRequest, "address is required")
+		return
+	}
+
+	if err := s.coordinator.GetStorage().UnregisterStorageAddress(r.Context(), storageID, address); err != nil {
+		if errors.Is(err, etcd.ErrNotFound) {
+			s.writeError(w, http.StatusNotFound, "storage not found")
+			return
+		}
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// storagesForecast godoc
+// @Summary		Прогноз нагрузки
+// @Description	Собирает гистограммы ожидающих сообщений со всех инстансов Storages и складывает их в прогноз кластера. Параметры те же, что у гистограммы Storage; from по умолчанию — текущее время, округлённое до bucket. Недоступные инстансы перечисляются с ошибкой и в прогноз не входят
+// @Tags		Storages
+// @Produce		json
+// @Param		bucket		query		string	false	"Ширина интервала"	default(15m)
+// @Param		horizon		query		string	false	"Горизонт прогноза"	default(24h)
+// @Param		group_depth	query		int		false	"Число сегментов routing key для группировки, 0 — без группировки"
+// @Param		from		query		string	false	"Начало первого интервала (RFC3339)"
+// @Success		200			{object}	coordinatorapi.ForecastResponse
+// @Failure		400			{object}	coordinatorapi.ErrorResponse
+// @Failure		500			{object}	coordinatorapi.ErrorResponse
+// @Router		/storages/forecast [get]
+func (s *Server) storagesForecast(w http.ResponseWriter, r *http.Request) {
+	query, err := storageapi.ParseHistogramQuery(r.URL.Query())
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	storages, err := s.listLiveStorages(r.Context())
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, forecast(r.Context(), storages, query, s.fetchHistogram, time.Now()))
+}
+
+// storagesCoverage godoc
+// @Summary		Покрытие задержек
+// @Description	Проверяет, как диапазоны задержек зарегистрированных Storages покрывают [0, ∞): разрывы — задержки, которые не принимает ни один Storage (такие сообщения gateway отправляет в пушеры сразу), пересечения — задержки, которые принимают несколько Storages
+// @Tags		Storages
+// @Produce		json
+// @Success		200	{object}	coordinatorapi.CoverageResponse
+// @Failure		500	{object}	coordinatorapi.ErrorResponse
+// @Router		/storages/coverage [get]
+func (s *Server) storagesCoverage(w http.ResponseWriter, r *http.Request) {
+	storages, err := s.listLiveStorages(r.Context())
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, coordinatorapi.CoverageToResponse(storage.ComputeCoverage(storages)))
+}
+
+// startRebalance godoc
+// @Summary		Запустить перебалансировку
+// @Description	Просит по очереди каждый инстанс Storage передать gateway ожидающие сообщения, которые не подходят под диапазон задержек Storage, чтобы gateway заново выбрал для них Storage. Инстансы из evacuate передают все ожидающие сообщения — так забирают сообщения у Storage, удалённого из кластера. Возвращает ход перебалансировки, не дожидаясь её завершения
+// @Tags		Storages
+// @Accept		json
+// @Produce		json
+// @Param		request	body		coordinatorapi.RebalanceRequest	false	"Инстансы для эвакуации"
+// @Success		202		{object}	coordinatorapi.RebalanceResponse
+// @Failure		400		{object}	coordinatorapi.ErrorResponse
+// @Failure		409		{object}	coordinatorapi.ErrorResponse	"Перебалансировка уже выполняется"
+// @Failure		500		{object}	coordinatorapi.ErrorResponse
+// @Router		/storages/rebalance [post]
+func (s *Server) startRebalance(w http.ResponseWriter, r *http.Request) {
+	var req coordinatorapi.RebalanceRequest
+	if err := s.decodeJSON(r, &req); err != nil && !errors.Is(err, io.EOF) {
+		s.writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	storages, err := s.listLiveStorages(r.Context())
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	status, started := s.rebalancer.start(storages, req.Evacuate, time.Now())
+	if !started {
+		s.writeError(w, http.StatusConflict, "rebalance is already running")
+		return
+	}
+
+	s.writeJSON(w, http.StatusAccepted, status)
+}
+
+// rebalanceStatus godoc
+// @Summary		Ход перебалансировки
+// @Description	Возвращает ход последней перебалансировки: стадию и число переданных сообщений по каждому инстансу
+// @Tags		Storages
+// @Produce		json
+// @Success		200	{object}	coordinatorapi.RebalanceResponse
+// @Router		/storages/rebalance [get]
+func (s *Server) rebalanceStatus(w http.ResponseWriter, r *http.Request) {
+	s.writeJSON(w, http.StatusOK, s.rebalancer.current())
+}
+
 // === Pushers ===
 
 // registerPusher godoc
@@ -0,0 +1,79 @@
+package http
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+)
+
+// liveStorages убирает из storages инстансы, которые не присылали heartbeat дольше ttl,
+// и пропускает Storages, у которых живых инстансов не осталось. Исходные записи
+// не меняются; ttl 0 отключает проверку.
+func liveStorages(storages []*storage.Info, ttl time.Duration, now time.Time) []*storage.Info {
+	if ttl <= 0 {
+		return storages
+	}
+
+	cutoff := now.Add(-ttl)
+	live := make([]*storage.Info, 0, len(storages))
+	for _, info := range storages {
+		if info == nil {
+			continue
+		}
+		st := *info
+		st.Instances = append([]storage.Instance(nil), info.Instances...)
+		if st.RemoveStaleInstances(cutoff) > 0 && len(st.Instances) == 0 {
+			continue
+		}
+		live = append(live, &st)
+	}
+	return live
+}
+
+// listLiveStorages возвращает зарегистрированные Storages без устаревших инстансов.
+func (s *Server) listLiveStorages(ctx context.Context) ([]*storage.Info, error) {
+	storages, err := s.coordinator.GetStorage().ListStorages(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return liveStorages(storages, s.coordinator.GetCoordinatorConfig().StorageInstanceTTL, time.Now()), nil
+}
+
+// reapStaleInstances раз в половину ttl удаляет из координатора инстансы Storage,
+// не присылавшие heartbeat дольше ttl, пока не отменён ctx. Удалённый по ошибке
+// инстанс получит 404 на следующий heartbeat и зарегистрируется заново.
+func (s *Server) reapStaleInstances(ctx context.Context, ttl time.Duration) {
+	ticker := time.NewTicker(ttl / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		storages, err := s.coordinator.GetStorage().ListStorages(ctx)
+		if err != nil {
+			log.Printf("Failed to list storages for stale instance check: %v", err)
+			continue
+		}
+
+		cutoff := time.Now().Add(-ttl)
+		for _, info := range storages {
+			for _, inst := range info.Instances {
+				if !inst.LastHeartbeat.Before(cutoff) {
+					continue
+				}
+				if err := s.coordinator.GetStorage().UnregisterStorageAddress(ctx, info.ID, inst.Address); err != nil {
+					log.Printf("Failed to remove stale storage instance %s of %s: %v", inst.Address, info.ID, err)
+					continue
+				}
+				log.Printf("Removed stale storage instance %s of %s, last heartbeat %s",
+					inst.Address, info.ID, inst.LastHeartbeat.Format(time.RFC3339))
+			}
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/internal/coordinator/storage/etcd"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/coordinator"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/node"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+)
+
+// fakeCoordinator отдаёт заданную конфигурацию и хранилище координатора.
+type fakeCoordinator struct {
+	storage coordinator.CoordinatorStorage
+	config  coordinator.CoordinatorConfig
+}
+
+func (c *fakeCoordinator) GetStorage() coordinator.CoordinatorStorage { return c.storage }
+func (c *fakeCoordinator) GetClusterConfig() *coordinator.ClusterConfig {
+	return &coordinator.ClusterConfig{}
+}
+func (c *fakeCoordinator) GetCoordinatorConfig() *coordinator.CoordinatorConfig { return &c.config }
+
+// fakeStorages хранит Storages в памяти; остальные методы CoordinatorStorage не нужны.
+type fakeStorages struct {
+	coordinator.CoordinatorStorage
+	storages []*storage.Info
+}
+
+func (f *fakeStorages) ListStorages(context.Context) ([]*storage.Info, error) {
+	return f.storages, nil
+}
+
+func (f *fakeStorages) UpdateStorageHeartbeat(_ context.Context, storageID string, hb storage.Heartbeat) error {
+	for _, st := range f.storages {
+		if st.ID == storageID && st.ApplyHeartbeat(hb, time.Now()) {
+			return nil
+		}
+	}
+	return etcd.ErrNotFound
+}
+
+func TestStorageHeartbeatWithoutBody(t *testing.T) {
+	st := &storage.Info{ID: "hot", MaxDelay: time.Minute}
+	st.AddInstance(storage.Instance{Address: "http://hot-1", Status: node.NodeStatusDegraded})
+	st.ApplyHeartbeat(storage.Heartbeat{Address: "http://hot-1", Status: node.NodeStatusDegraded, Load: storage.Load{Measured: true, Pending: 5}}, time.Time{})
+
+	server := NewServer(&fakeCoordinator{storage: &fakeStorages{storages: []*storage.Info{st}}}, Config{})
+
+	for _, body := range []string{"", `{"status":"Active"}`} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPut, "/api/v1/storages/hot/heartbeat", strings.NewReader(body))
+		server.Router().ServeHTTP(rec, req)
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("body %q: expected 204, got %d: %s", body, rec.Code, rec.Body.String())
+		}
+	}
+
+	inst := st.Instance("http://hot-1")
+	if inst.Status != node.NodeStatusActive || inst.LastHeartbeat.IsZero() || inst.Pending != 5 {
+		t.Fatalf("unexpected instance after heartbeats without address %+v", inst)
+	}
+}
+
+func TestLiveStoragesDropsStaleInstances(t *testing.T) {
+	now := time.Now()
+	instance := func(address string, age time.Duration) storage.Instance {
+		return storage.Instance{Address: address, Status: node.NodeStatusActive, LastHeartbeat: now.Add(-age)}
+	}
+
+	hot := &storage.Info{ID: "hot", Instances: []storage.Instance{instance("http://hot-1", time.Second), instance("http://hot-2", time.Hour)}}
+	cold := &storage.Info{ID: "cold", Instances: []storage.Instance{instance("http://cold-1", time.Hour)}}
+	storages := []*storage.Info{hot, cold}
+
+	live := liveStorages(storages, time.Minute, now)
+	if len(live) != 1 || live[0].ID != "hot" || !slices.Equal(live[0].Addresses(), []string{"http://hot-1"}) {
+		t.Fatalf("unexpected live storages %+v", live)
+	}
+	if len(hot.Instances) != 2 {
+		t.Fatalf("expected registered storage to be kept intact, got %+v", hot)
+	}
+
+	if live := liveStorages(storages, 0, now); len(live) != 2 {
+		t.Fatalf("expected zero ttl to keep all storages, got %+v", live)
+	}
+
+	server := NewServer(&fakeCoordinator{
+		storage: &fakeStorages{storages: storages},
+		config:  coordinator.CoordinatorConfig{StorageInstanceTTL: time.Minute},
+	}, Config{})
+	rec := httptest.NewRecorder()
+	server.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/storages", nil))
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "cold") || strings.Contains(rec.Body.String(), "hot-2") {
+		t.Fatalf("expected stale instances to be hidden, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,171 @@
+package http
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	coordinatorapi "github.com/Alexey-zaliznuak/orbital/pkg/coordinator/api"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+	storagesdk "github.com/Alexey-zaliznuak/orbital/pkg/sdk/storage"
+)
+
+// rehomeTimeout — сколько координатор ждёт, пока инстанс Storage передаст сообщения gateway.
+const rehomeTimeout = 5 * time.Minute
+
+// Стадии перебалансировки и её инстансов.
+const (
+	rebalanceIdle    = "idle"
+	rebalancePending = "pending"
+	rebalanceRunning = "running"
+	rebalanceDone    = "done"
+	rebalanceSkipped = "skipped"
+	rebalanceFailed  = "failed"
+)
+
+// messageRehomer просит инстанс Storage по его адресу передать gateway сообщения вне query.
+type messageRehomer func(ctx context.Context, address string, query storage.RehomeQuery) (*storage.RehomeResult, error)
+
+// rehomeMessages вызывает Rehome через storage SDK.
+func rehomeMessages(ctx context.Context, address string, query storage.RehomeQuery) (*storage.RehomeResult, error) {
+	client := storagesdk.NewClient(storagesdk.ClientConfig{BaseURL: address, Timeout: rehomeTimeout})
+	return client.Rehome(ctx, query)
+}
+
+// rebalanceTarget — инстанс Storage и диапазон, под который он проверяет свои сообщения.
+type rebalanceTarget struct {
+	storageID string
+	address   string
+	query     storage.RehomeQuery
+}
+
+// rebalancer перебалансирует сообщения между Storages: по очереди просит каждый инстанс
+// передать gateway ожидающие сообщения, которые не подходят под диапазон задержек
+// Storage по данным координатора, чтобы gateway заново выбрал для них Storage.
+// Одновременно выполняется одна перебалансировка; ход последней хранится до следующей.
+type rebalancer struct {
+	rehome messageRehomer
+
+	mu     sync.Mutex
+	status coordinatorapi.RebalanceResponse
+	// done закрывается по завершении текущей перебалансировки.
+	done chan struct{}
+}
+
+func newRebalancer(rehome messageRehomer) *rebalancer {
+	return &rebalancer{
+		rehome: rehome,
+		status: coordinatorapi.RebalanceResponse{State: rebalanceIdle, Storages: []coordinatorapi.StorageRebalanceResponse{}},
+	}
+}
+
+// start запускает перебалансировку инстансов storages и эвакуацию инстансов по адресам
+// evacuate: они передают все ожидающие сообщения. Возвращает ход перебалансировки
+// и false, если предыдущая ещё выполняется.
+func (r *rebalancer) start(storages []*storage.Info, evacuate []string, now time.Time) (coordinatorapi.RebalanceResponse, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.status.State == rebalanceRunning {
+		return r.snapshot(), false
+	}
+
+	var targets []rebalanceTarget
+	for _, info := range storages {
+		for _, address := range info.Addresses() {
+			targets = append(targets, rebalanceTarget{
+				storageID: info.ID,
+				address:   address,
+				query: storage.RehomeQuery{
+					MinDelay: info.MinDelay,
+					MaxDelay: info.MaxDelay,
+					All:      slices.Contains(evacuate, address),
+				},
+			})
+		}
+	}
+	for _, address := range evacuate {
+		if !slices.ContainsFunc(targets, func(t rebalanceTarget) bool { return t.address == address }) {
+			targets = append(targets, rebalanceTarget{address: address, query: storage.RehomeQuery{All: true}})
+		}
+	}
+
+	entries := make([]coordinatorapi.StorageRebalanceResponse, len(targets))
+	for i, t := range targets {
+		entries[i] = coordinatorapi.StorageRebalanceResponse{
+			ID:       t.storageID,
+			Address:  t.address,
+			Evacuate: t.query.All,
+			State:    rebalancePending,
+		}
+	}
+
+	r.status = coordinatorapi.RebalanceResponse{State: rebalanceRunning, StartedAt: now, Storages: entries}
+	r.done = make(chan struct{})
+	go r.run(targets, r.done)
+
+	return r.snapshot(), true
+}
+
+// current возвращает ход последней перебалансировки.
+func (r *rebalancer) current() coordinatorapi.RebalanceResponse {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.snapshot()
+}
+
+// run обходит инстансы по очереди. Инстансы Storage с общими данными описывают одни
+// и те же сообщения, поэтому у такого Storage проверяется только первый ответивший
+// инстанс. Недоступный инстанс не прерывает перебалансировку.
+func (r *rebalancer) run(targets []rebalanceTarget, done chan struct{}) {
+	defer close(done)
+
+	shared := make(map[string]bool)
+	for i, t := range targets {
+		if t.storageID != "" && shared[t.storageID] && !t.query.All {
+			r.update(i, func(entry *coordinatorapi.StorageRebalanceResponse) { entry.State = rebalanceSkipped })
+			continue
+		}
+
+		r.update(i, func(entry *coordinatorapi.StorageRebalanceResponse) { entry.State = rebalanceRunning })
+
+		result, err := r.rehome(context.Background(), t.address, t.query)
+		if err != nil {
+			r.update(i, func(entry *coordinatorapi.StorageRebalanceResponse) {
+				entry.State = rebalanceFailed
+				entry.Error = err.Error()
+			})
+			continue
+		}
+
+		if result.Shared && t.storageID != "" {
+			shared[t.storageID] = true
+		}
+		r.update(i, func(entry *coordinatorapi.StorageRebalanceResponse) {
+			entry.State = rebalanceDone
+			entry.Scanned = result.Scanned
+			entry.Resubmitted = result.Resubmitted
+			r.status.Resubmitted += result.Resubmitted
+		})
+	}
+
+	r.mu.Lock()
+	r.status.State = rebalanceDone
+	r.status.FinishedAt = time.Now()
+	r.mu.Unlock()
+}
+
+// update изменяет запись i-го инстанса под блокировкой.
+func (r *rebalancer) update(i int, change func(entry *coordinatorapi.StorageRebalanceResponse)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	change(&r.status.Storages[i])
+}
+
+// snapshot копирует ход перебалансировки. Вызывающий удерживает mu.
+func (r *rebalancer) snapshot() coordinatorapi.RebalanceResponse {
+	status := r.status
+	status.Storages = slices.Clone(r.status.Storages)
+	return status
+}
@@ -0,0 +1,90 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+)
+
+func TestRebalanceVisitsInstances(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		queries = make(map[string]storage.RehomeQuery)
+	)
+	release := make(chan struct{})
+
+	rehome := func(_ context.Context, address string, query storage.RehomeQuery) (*storage.RehomeResult, error) {
+		<-release
+
+		mu.Lock()
+		queries[address] = query
+		mu.Unlock()
+
+		switch address {
+		case "http://down":
+			return nil, errors.New("connection refused")
+		case "http://redis-1", "http://redis-2":
+			return &storage.RehomeResult{Scanned: 10, Resubmitted: 4, Shared: true}, nil
+		default:
+			return &storage.RehomeResult{Scanned: 5, Resubmitted: 1}, nil
+		}
+	}
+
+	storages := []*storage.Info{
+		{ID: "hot", MaxDelay: time.Hour, Instances: instancesAt("http://memory-1", "http://memory-2")},
+		{ID: "warm", MinDelay: time.Hour, MaxDelay: 24 * time.Hour, Instances: instancesAt("http://redis-1", "http://redis-2")},
+		{ID: "cold", MinDelay: 24 * time.Hour, Instances: instancesAt("http://down")},
+	}
+
+	r := newRebalancer(rehome)
+	status, started := r.start(storages, []string{"http://memory-2", "http://removed"}, time.Now())
+	if !started || status.State != rebalanceRunning || len(status.Storages) != 6 {
+		t.Fatalf("unexpected initial status %+v", status)
+	}
+
+	if _, started := r.start(storages, nil, time.Now()); started {
+		t.Fatal("expected second rebalance to be rejected while first is running")
+	}
+
+	close(release)
+	<-r.done
+
+	status = r.current()
+	if status.State != rebalanceDone || status.FinishedAt.IsZero() {
+		t.Fatalf("expected finished rebalance, got %+v", status)
+	}
+
+	states := make(map[string]string)
+	for _, entry := range status.Storages {
+		states[entry.Address] = entry.State
+	}
+	want := map[string]string{
+		"http://memory-1": rebalanceDone,
+		"http://memory-2": rebalanceDone,
+		"http://redis-1":  rebalanceDone,
+		"http://redis-2":  rebalanceSkipped,
+		"http://down":     rebalanceFailed,
+		"http://removed":  rebalanceDone,
+	}
+	for address, state := range want {
+		if states[address] != state {
+			t.Fatalf("expected %s to be %s, got %s", address, state, states[address])
+		}
+	}
+
+	// memory-1, memory-2, removed по 1 и redis-1 — 4.
+	if status.Resubmitted != 7 {
+		t.Fatalf("expected 7 resubmitted messages, got %d", status.Resubmitted)
+	}
+
+	if q := queries["http://redis-1"]; q.MinDelay != time.Hour || q.MaxDelay != 24*time.Hour || q.All {
+		t.Fatalf("unexpected query for warm storage %+v", q)
+	}
+	if !queries["http://memory-2"].All || !queries["http://removed"].All || queries["http://memory-1"].All {
+		t.Fatalf("expected only evacuated instances to hand off all messages, got %+v", queries)
+	}
+}
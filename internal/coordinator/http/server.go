@@ -14,9 +14,13 @@ import (
 
 // Server представляет HTTP сервер координатора.
 type Server struct {
-	coordinator coordinator.Coordinator
-	router      *chi.Mux
-	server      *http.Server
+	coordinator    coordinator.Coordinator
+	fetchHistogram histogramFetcher
+	rebalancer     *rebalancer
+	router         *chi.Mux
+	server         *http.Server
+	// stopReaper останавливает удаление устаревших инстансов Storage.
+	stopReaper context.CancelFunc
 }
 
 // Config конфигурация HTTP сервера.
@@ -29,7 +33,9 @@ type Config struct {
 // NewServer создаёт новый HTTP сервер.
 func NewServer(coordinator coordinator.Coordinator, cfg Config) *Server {
 	s := &Server{
-		coordinator: coordinator,
+		coordinator:    coordinator,
+		fetchHistogram: fetchHistogram,
+		rebalancer:     newRebalancer(rehomeMessages),
 	}
 
 	s.router = s.setupRouter()
@@ -86,9 +92,14 @@ func (s *Server) setupRouter() *chi.Mux {
 		r.Route("/storages", func(r chi.Router) {
 			r.Post("/", s.registerStorage)
 			r.Get("/", s.listStorages)
+			r.Get("/forecast", s.storagesForecast)
+			r.Get("/coverage", s.storagesCoverage)
+			r.Post("/rebalance", s.startRebalance)
+			r.Get("/rebalance", s.rebalanceStatus)
 			r.Get("/{storageID}", s.getStorage)
 			r.Put("/{storageID}/heartbeat", s.updateStorageHeartbeat)
 			r.Delete("/{storageID}", s.unregisterStorage)
+			r.Delete("/{storageID}/addresses", s.unregisterStorageAddress)
 		})
 
 		// Pushers
@@ -117,13 +128,21 @@ func (s *Server) setupRouter() *chi.Mux {
 	return r
 }
 
-// Start запускает HTTP сервер.
+// Start запускает HTTP сервер и удаление инстансов Storage, переставших присылать heartbeat.
 func (s *Server) Start() error {
+	if ttl := s.coordinator.GetCoordinatorConfig().StorageInstanceTTL; ttl > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopReaper = cancel
+		go s.reapStaleInstances(ctx, ttl)
+	}
 	return s.server.ListenAndServe()
 }
 
 // Shutdown gracefully останавливает сервер.
 func (s *Server) Shutdown(ctx context.Context) error {
+	if s.stopReaper != nil {
+		s.stopReaper()
+	}
 	return s.server.Shutdown(ctx)
 }
 
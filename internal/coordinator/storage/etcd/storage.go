@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"slices"
 	"time"
 
 	"github.com/google/uuid"
@@ -351,8 +350,8 @@ func (s *Storage) RegisterStorage(ctx context.Context, st *storage.Info) error {
 		return nil
 	}
 
-	// Запись с таким ID уже есть: добавляем адрес к списку (без дубликатов),
-	// обновляем задержки и heartbeat — см. storage.Info.
+	// Запись с таким ID уже есть: добавляем инстанс (повторная регистрация адреса
+	// обновляет его) и задержки — см. storage.Info.
 	for {
 		resp, err := s.client.Get(ctx, key)
 		if err != nil {
@@ -403,15 +402,11 @@ func (s *Storage) RegisterStorage(ctx context.Context, st *storage.Info) error {
 }
 
 func mergeStorageRegistration(dst *storage.Info, incoming *storage.Info) {
-	for _, addr := range incoming.Addresses {
-		if !slices.Contains(dst.Addresses, addr) {
-			dst.Addresses = append(dst.Addresses, addr)
-		}
+	for _, inst := range incoming.Instances {
+		dst.AddInstance(inst)
 	}
 	dst.MinDelay = incoming.MinDelay
 	dst.MaxDelay = incoming.MaxDelay
-	dst.LastHeartbeat = incoming.LastHeartbeat
-	dst.Status = node.NodeStatusActive
 }
 
 func (s *Storage) GetStorage(ctx context.Context, storageID string) (*storage.Info, error) {
@@ -458,36 +453,18 @@ func (s *Storage) ListStorages(ctx context.Context) ([]*storage.Info, error) {
 	return storages, nil
 }
 
-func (s *Storage) UpdateStorageHeartbeat(ctx context.Context, storageID string) error {
+func (s *Storage) UpdateStorageHeartbeat(ctx context.Context, storageID string, hb storage.Heartbeat) error {
 	ctx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 
-	key := keyPrefixStorages + storageID
-
-	resp, err := s.client.Get(ctx, key)
-	if err != nil {
-		return fmt.Errorf("failed to get storage: %w", err)
-	}
-
-	if len(resp.Kvs) == 0 {
-		return ErrNotFound
-	}
-
-	var st storage.Info
-	if err := json.Unmarshal(resp.Kvs[0].Value, &st); err != nil {
-		return fmt.Errorf("failed to unmarshal storage: %w", err)
-	}
-
-	st.LastHeartbeat = time.Now()
-	st.Status = node.NodeStatusActive
-
-	data, err := json.Marshal(st)
-	if err != nil {
-		return fmt.Errorf("failed to marshal storage: %w", err)
-	}
-
-	_, err = s.client.Put(ctx, key, string(data))
-	return err
+	// Инстансы одного Storage шлют heartbeat независимо, поэтому запись меняется
+	// так же, как при регистрации, чтобы не потерять чужое обновление.
+	return s.updateStorage(ctx, keyPrefixStorages+storageID, func(st *storage.Info) (bool, error) {
+		if !st.ApplyHeartbeat(hb, time.Now()) {
+			return false, ErrNotFound
+		}
+		return true, nil
+	})
 }
 
 func (s *Storage) UnregisterStorage(ctx context.Context, storageID string) error {
@@ -508,6 +485,61 @@ func (s *Storage) UnregisterStorage(ctx context.Context, storageID string) error
 	return nil
 }
 
+func (s *Storage) UnregisterStorageAddress(ctx context.Context, storageID, address string) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	return s.updateStorage(ctx, keyPrefixStorages+storageID, func(st *storage.Info) (bool, error) {
+		return st.RemoveInstance(address), nil
+	})
+}
+
+// updateStorage применяет change к записи Storage по ключу key. Как и при регистрации,
+// запись сохраняется, только если её не изменили параллельно, иначе попытка повторяется.
+// change возвращает false, если запись менять не нужно. Storage без инстансов удаляется.
+func (s *Storage) updateStorage(ctx context.Context, key string, change func(st *storage.Info) (bool, error)) error {
+	for {
+		resp, err := s.client.Get(ctx, key)
+		if err != nil {
+			return fmt.Errorf("failed to get storage: %w", err)
+		}
+		if len(resp.Kvs) == 0 {
+			return ErrNotFound
+		}
+
+		kv := resp.Kvs[0]
+		var st storage.Info
+		if err := json.Unmarshal(kv.Value, &st); err != nil {
+			return fmt.Errorf("failed to unmarshal storage: %w", err)
+		}
+
+		changed, err := change(&st)
+		if err != nil || !changed {
+			return err
+		}
+
+		op := clientv3.OpDelete(key)
+		if len(st.Instances) > 0 {
+			data, err := json.Marshal(&st)
+			if err != nil {
+				return fmt.Errorf("failed to marshal storage: %w", err)
+			}
+			op = clientv3.OpPut(key, string(data))
+		}
+
+		txnResp, err := s.client.Txn(ctx).
+			If(clientv3.Compare(clientv3.ModRevision(key), "=", kv.ModRevision)).
+			Then(op).
+			Commit()
+		if err != nil {
+			return fmt.Errorf("failed to update storage: %w", err)
+		}
+		if txnResp.Succeeded {
+			return nil
+		}
+	}
+}
+
 // === Pushers ===
 
 func (s *Storage) RegisterPusher(ctx context.Context, p *pusher.Info) error {
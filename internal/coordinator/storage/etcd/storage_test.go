@@ -0,0 +1,116 @@
+package etcd
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/node"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+)
+
+func TestStorageInstances(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	register := func(address, version string, at time.Time) *storage.Info {
+		st := &storage.Info{ID: "hot", MaxDelay: time.Minute}
+		st.AddInstance(storage.Instance{
+			Address:       address,
+			Status:        node.NodeStatusActive,
+			Version:       version,
+			RegisteredAt:  at,
+			LastHeartbeat: at,
+		})
+		return st
+	}
+
+	st := register("http://hot-1", "v1", start)
+	mergeStorageRegistration(st, register("http://hot-2", "v1", start.Add(time.Minute)))
+
+	// Перезапуск инстанса с новой версией не меняет время его первой регистрации.
+	restarted := register("http://hot-1", "v2", start.Add(2*time.Minute))
+	restarted.MaxDelay = time.Hour
+	mergeStorageRegistration(st, restarted)
+
+	if !slices.Equal(st.Addresses(), []string{"http://hot-1", "http://hot-2"}) || st.MaxDelay != time.Hour {
+		t.Fatalf("unexpected storage after registrations %+v", st)
+	}
+	if inst := st.Instance("http://hot-1"); inst.Version != "v2" || !inst.RegisteredAt.Equal(start) {
+		t.Fatalf("unexpected restarted instance %+v", inst)
+	}
+
+	beat := start.Add(3 * time.Minute)
+	hb := storage.Heartbeat{
+		Address:  "http://hot-2",
+		Status:   node.NodeStatusDegraded,
+		Capacity: 100,
+		Load:     storage.Load{Pending: 90, ReleaseLag: time.Second},
+	}
+	if !st.ApplyHeartbeat(hb, beat) {
+		t.Fatal("expected heartbeat of registered instance to apply")
+	}
+	if inst := st.Instance("http://hot-2"); inst.Status != node.NodeStatusDegraded || inst.Pending != 90 ||
+		inst.Capacity != 100 || !inst.LastHeartbeat.Equal(beat) {
+		t.Fatalf("unexpected instance after heartbeat %+v", inst)
+	}
+	if st.Status != node.NodeStatusActive || !st.LastHeartbeat.Equal(beat) || !st.RegisteredAt.Equal(start) ||
+		st.Load() != hb.Load {
+		t.Fatalf("unexpected storage summary %+v", st)
+	}
+
+	if st.ApplyHeartbeat(storage.Heartbeat{Address: "http://unknown"}, beat) {
+		t.Fatal("expected heartbeat of unknown instance to be rejected")
+	}
+
+	// Без Active инстансов Storage считается перегруженным.
+	if !st.RemoveInstance("http://hot-1") || st.RemoveInstance("http://hot-1") {
+		t.Fatal("expected instance to be removed once")
+	}
+	if st.Status != node.NodeStatusDegraded || len(st.Instances) != 1 {
+		t.Fatalf("unexpected storage after removal %+v", st)
+	}
+}
+
+func TestStorageHeartbeatWithoutAddressAndStaleInstances(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	st := &storage.Info{ID: "hot", MaxDelay: time.Minute}
+	for _, address := range []string{"http://hot-1", "http://hot-2"} {
+		st.AddInstance(storage.Instance{
+			Address:       address,
+			Status:        node.NodeStatusActive,
+			RegisteredAt:  start,
+			LastHeartbeat: start,
+		})
+	}
+	measured := storage.Load{Measured: true, Pending: 10}
+	st.ApplyHeartbeat(storage.Heartbeat{Address: "http://hot-1", Status: node.NodeStatusActive, Capacity: 100, Load: measured}, start)
+
+	// Heartbeat без адреса обновляет все инстансы, не трогая их нагрузку.
+	beat := start.Add(time.Minute)
+	if !st.ApplyHeartbeat(storage.Heartbeat{Status: node.NodeStatusDegraded}, beat) {
+		t.Fatal("expected heartbeat without address to apply")
+	}
+	for _, inst := range st.Instances {
+		if inst.Status != node.NodeStatusDegraded || !inst.LastHeartbeat.Equal(beat) {
+			t.Fatalf("unexpected instance after heartbeat without address %+v", inst)
+		}
+	}
+	if inst := st.Instance("http://hot-1"); inst.Load != measured || inst.Capacity != 100 {
+		t.Fatalf("expected load to be kept, got %+v", inst)
+	}
+	if (&storage.Info{}).ApplyHeartbeat(storage.Heartbeat{}, beat) {
+		t.Fatal("expected heartbeat without address to be rejected for storage without instances")
+	}
+
+	st.ApplyHeartbeat(storage.Heartbeat{Address: "http://hot-2", Status: node.NodeStatusActive}, beat.Add(time.Minute))
+	if removed := st.RemoveStaleInstances(beat.Add(time.Second)); removed != 1 {
+		t.Fatalf("expected one stale instance, removed %d", removed)
+	}
+	if !slices.Equal(st.Addresses(), []string{"http://hot-2"}) || st.Status != node.NodeStatusActive {
+		t.Fatalf("unexpected storage after removing stale instances %+v", st)
+	}
+	if removed := st.RemoveStaleInstances(beat.Add(time.Second)); removed != 0 {
+		t.Fatalf("expected no stale instances left, removed %d", removed)
+	}
+}
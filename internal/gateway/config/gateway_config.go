@@ -1,6 +1,8 @@
 package config
 
 import (
+	"time"
+
 	"github.com/Alexey-zaliznuak/orbital/pkg/entities/gateway"
 	"github.com/caarlos0/env/v11"
 )
@@ -22,6 +24,12 @@ func (b *GatewayConfigBuilder) WithClusterAddress(addr string) *GatewayConfigBui
 	return b
 }
 
+// WithMaxReleaseLag устанавливает опоздание выпуска, с которого хранилище обходится (0 — не учитывать).
+func (b *GatewayConfigBuilder) WithMaxReleaseLag(lag time.Duration) *GatewayConfigBuilder {
+	b.cfg.MaxReleaseLag = lag
+	return b
+}
+
 // FromEnv загружает конфигурацию из переменных окружения.
 func (b *GatewayConfigBuilder) FromEnv() *GatewayConfigBuilder {
 	env.Parse(b.cfg)
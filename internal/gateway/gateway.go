@@ -2,27 +2,40 @@ package gateway
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"sync"
 	"time"
 
 	"github.com/Alexey-zaliznuak/orbital/pkg/bus"
+	"github.com/Alexey-zaliznuak/orbital/pkg/clock"
 	"github.com/Alexey-zaliznuak/orbital/pkg/entities/gateway"
 	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/node"
 	"github.com/Alexey-zaliznuak/orbital/pkg/entities/pusher"
 	routingrule "github.com/Alexey-zaliznuak/orbital/pkg/entities/routing_rule"
 	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
 	"github.com/Alexey-zaliznuak/orbital/pkg/logger"
 	natsclient "github.com/Alexey-zaliznuak/orbital/pkg/nats"
 	"github.com/Alexey-zaliznuak/orbital/pkg/sdk/coordinator"
+	"github.com/nats-io/nats.go"
 	"go.uber.org/zap"
 )
 
+// messageBus — операции шины, которые использует gateway. Реализуется bus.Client.
+type messageBus interface {
+	SendToStorage(storageID string, msgs []*message.Message) error
+	SendToPusher(pusherID string, msgs []*message.Message) error
+	AckToStorage(storageID string, ids []string) error
+	NewHandlerOnGatewayMessages(handler nats.MsgHandler) (*nats.Subscription, error)
+}
+
 type BaseGateway struct {
 	config            *gateway.GatewayConfig
 	coordinatorClient *coordinator.Client
 	natsClient        *natsclient.Client
-	bus               *bus.Client
+	bus               messageBus
+	clock             clock.Clock
 
 	storages   []*storage.Info
 	storagesMu sync.RWMutex
@@ -38,24 +51,26 @@ type BaseGateway struct {
 	minDelayForSaveInStorage time.Duration
 }
 
-func (g *BaseGateway) Consume(message *message.Message) error {
-	delay := time.Until(message.ScheduledAt)
+// Consume направляет сообщение в хранилище по оставшейся задержке или сразу в пушер.
+// Сообщению без ID назначается ID до первой отправки: повторные доставки пачки
+// хранилищу распознаются как дубликаты, а не сохраняются заново.
+func (g *BaseGateway) Consume(msg *message.Message) error {
+	if msg.ID == "" {
+		msg.ID = message.GenerateID()
+	}
+
+	delay := msg.ScheduledAt.Sub(g.clock.Now())
 
 	if delay <= g.minDelayForSaveInStorage {
-		return g.sendToPusher(message)
+		return g.sendToPusher(msg)
 	}
 
-	return g.sendToStorage(message)
+	return g.sendToStorage(msg)
 }
 
 func (g *BaseGateway) sendToStorage(msg *message.Message) error {
-	storages := g.GetStorages()
-	delay := time.Until(msg.ScheduledAt)
-
-	for _, storage := range storages {
-		if storage.AcceptsDelay(delay) {
-			return g.bus.SendToStorage(storage.ID, []*message.Message{msg})
-		}
+	if target := selectStorage(g.GetStorages(), msg.ScheduledAt.Sub(g.clock.Now()), g.config.MaxReleaseLag); target != nil {
+		return g.bus.SendToStorage(target.ID, []*message.Message{msg})
 	}
 
 	logger.Log.Warn(
@@ -68,6 +83,42 @@ func (g *BaseGateway) sendToStorage(msg *message.Message) error {
 	return g.sendToPusher(msg)
 }
 
+// selectStorage выбирает хранилище для задержки delay среди принимающих её. Хранилища
+// в статусе Degraded (близкие к лимиту ёмкости) и опаздывающие с выпуском сообщений
+// больше maxReleaseLag (0 — не учитывать) выбираются, только если других нет. Хранилища
+// с неизвестной нагрузкой (инстанс ещё не прислал heartbeat или не смог посчитать
+// сообщения) уступают хранилищам с измеренной. Среди равных по состоянию выбирается
+// хранилище, у самого загруженного инстанса которого меньше сообщений; при равной
+// нагрузке — первое.
+func selectStorage(storages []*storage.Info, delay, maxReleaseLag time.Duration) *storage.Info {
+	var (
+		best        *storage.Info
+		bestBackOff bool
+		bestUnknown bool
+		bestPending int64
+	)
+
+	for _, st := range storages {
+		if !st.AcceptsDelay(delay) {
+			continue
+		}
+
+		load := st.Load()
+		backOff := st.Status == node.NodeStatusDegraded || (maxReleaseLag > 0 && load.ReleaseLag > maxReleaseLag)
+		unknown := !load.Measured
+
+		switch {
+		case best == nil,
+			bestBackOff && !backOff,
+			bestBackOff == backOff && bestUnknown && !unknown,
+			bestBackOff == backOff && bestUnknown == unknown && load.Pending < bestPending:
+			best, bestBackOff, bestUnknown, bestPending = st, backOff, unknown, load.Pending
+		}
+	}
+
+	return best
+}
+
 func (g *BaseGateway) sendToPusher(msg *message.Message) error {
 	rules := g.GetRoutingRules()
 
@@ -86,8 +137,107 @@ func (g *BaseGateway) sendToPusher(msg *message.Message) error {
 	return nil
 }
 
-func (g *BaseGateway) Start(ctx context.Context) {
+func (g *BaseGateway) Start(ctx context.Context) error {
+	if _, err := g.bus.NewHandlerOnGatewayMessages(g.HandleReadyMessages); err != nil {
+		return fmt.Errorf("failed to subscribe to gateway messages: %w", err)
+	}
+
 	go g.runRefreshLoop(ctx)
+	return nil
+}
+
+// HandleReadyMessages отправляет в пушеры сообщения, выпущенные хранилищем,
+// и подтверждает их хранилищу. При ошибке отправки хранилищу подтверждаются
+// уже отправленные сообщения, а пачка возвращается в JetStream: остальные
+// сообщения будут отправлены при повторной доставке. Пачки с заголовком
+// HeaderRehome обрабатываются rehome.
+func (g *BaseGateway) HandleReadyMessages(msg *nats.Msg) {
+	msgs := make([]*message.Message, 0)
+
+	if err := json.Unmarshal(msg.Data, &msgs); err != nil {
+		logger.Log.Error("Received messages unmarshal error", zap.Error(err))
+		if err := msg.Term(); err != nil {
+			logger.Log.Error("Failed to terminate bus message", zap.Error(err))
+		}
+		return
+	}
+
+	storageID := msg.Header.Get(bus.HeaderStorageID)
+
+	var (
+		ids []string
+		err error
+	)
+	if msg.Header.Get(bus.HeaderRehome) != "" {
+		ids, err = g.rehome(storageID, msgs, msg.Header.Get(bus.HeaderEvacuate) != "")
+	} else {
+		ids, err = g.sendAllToPushers(msgs)
+	}
+
+	if storageID != "" && len(ids) > 0 {
+		if err := g.bus.AckToStorage(storageID, ids); err != nil {
+			// Хранилище отправит сообщения повторно после visibility timeout.
+			logger.Log.Error("Failed to ack messages to storage", zap.String("storage", storageID), zap.Error(err))
+		}
+	}
+
+	if err != nil {
+		logger.Log.Warn("Failed to route messages, will be redelivered", zap.Int("routed", len(ids)), zap.Error(err))
+		if err := msg.NakWithDelay(g.config.NakDelay); err != nil {
+			logger.Log.Error("Failed to nak bus message", zap.Error(err))
+		}
+		return
+	}
+
+	if err := msg.Ack(); err != nil {
+		logger.Log.Error("Failed to ack bus message", zap.Error(err))
+	}
+}
+
+// sendAllToPushers отправляет сообщения в пушеры и возвращает их ID. При ошибке
+// возвращает ID сообщений, отправленных до неё.
+func (g *BaseGateway) sendAllToPushers(msgs []*message.Message) ([]string, error) {
+	ids := make([]string, 0, len(msgs))
+	for _, m := range msgs {
+		if err := g.sendToPusher(m); err != nil {
+			return ids, fmt.Errorf("send message %s to pusher: %w", m.ID, err)
+		}
+		ids = append(ids, m.ID)
+	}
+	return ids, nil
+}
+
+// rehome заново выбирает хранилище для ожидающих сообщений хранилища source, как для
+// новых сообщений, и возвращает ID переданных сообщений, при ошибке — переданных до неё.
+// Сообщения, для которых не подходит ни одно хранилище, остаются в source; без evacuate
+// остаются и те, для которых подходит только source. С evacuate инстанс source покидает
+// кластер, и такие сообщения заберут другие инстансы source из orbital.storage.{ID}.
+func (g *BaseGateway) rehome(source string, msgs []*message.Message, evacuate bool) ([]string, error) {
+	storages := g.GetStorages()
+
+	ids := make([]string, 0, len(msgs))
+	for _, m := range msgs {
+		delay := m.ScheduledAt.Sub(g.clock.Now())
+
+		if delay <= g.minDelayForSaveInStorage {
+			if err := g.sendToPusher(m); err != nil {
+				return ids, fmt.Errorf("send message %s to pusher: %w", m.ID, err)
+			}
+			ids = append(ids, m.ID)
+			continue
+		}
+
+		target := selectStorage(storages, delay, g.config.MaxReleaseLag)
+		if target == nil || (target.ID == source && !evacuate) {
+			continue
+		}
+		if err := g.bus.SendToStorage(target.ID, []*message.Message{m}); err != nil {
+			return ids, fmt.Errorf("send message %s to storage %s: %w", m.ID, target.ID, err)
+		}
+		ids = append(ids, m.ID)
+	}
+
+	return ids, nil
 }
 
 func (g *BaseGateway) runRefreshLoop(ctx context.Context) {
@@ -207,11 +357,17 @@ func NewBaseGateway(ctx context.Context, cfg *gateway.GatewayConfig) (*BaseGatew
 		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
 	}
 
+	busClient := bus.New(nc)
+	if err := busClient.Provision(clusterCfg); err != nil {
+		return nil, fmt.Errorf("failed to provision NATS streams: %w", err)
+	}
+
 	g := &BaseGateway{
 		config:                   cfg,
 		coordinatorClient:        coordinatorClient,
 		natsClient:               nc,
-		bus:                      bus.New(nc),
+		bus:                      busClient,
+		clock:                    clock.OrSystem(cfg.Clock),
 		storages:                 make([]*storage.Info, 0),
 		pushers:                  make([]*pusher.Info, 0),
 		routingRules:             make([]*routingrule.RoutingRule, 0),
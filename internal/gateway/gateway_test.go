@@ -0,0 +1,219 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/bus"
+	"github.com/Alexey-zaliznuak/orbital/pkg/clock"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/gateway"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/node"
+	routingrule "github.com/Alexey-zaliznuak/orbital/pkg/entities/routing_rule"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+	"github.com/nats-io/nats.go"
+)
+
+func TestSelectStoragePrefersNotDegraded(t *testing.T) {
+	storages := []*storage.Info{
+		{ID: "hot-full", MaxDelay: time.Hour, Status: node.NodeStatusDegraded},
+		{ID: "hot", MaxDelay: time.Hour, Status: node.NodeStatusActive},
+		{ID: "cold", MinDelay: time.Hour},
+	}
+
+	if got := selectStorage(storages, time.Minute, 0); got == nil || got.ID != "hot" {
+		t.Fatalf("expected hot, got %v", got)
+	}
+
+	if got := selectStorage(storages[:1], time.Minute, 0); got == nil || got.ID != "hot-full" {
+		t.Fatalf("expected degraded storage as fallback, got %v", got)
+	}
+
+	if got := selectStorage(storages[:2], 2*time.Hour, 0); got != nil {
+		t.Fatalf("expected no storage, got %v", got)
+	}
+}
+
+func TestSelectStoragePrefersLessLoaded(t *testing.T) {
+	loaded := func(id string, pending int64, lag time.Duration) *storage.Info {
+		return &storage.Info{
+			ID:        id,
+			MaxDelay:  time.Hour,
+			Status:    node.NodeStatusActive,
+			Instances: []storage.Instance{{Address: "http://" + id, Load: storage.Load{Measured: true, Pending: pending, ReleaseLag: lag}}},
+		}
+	}
+
+	storages := []*storage.Info{
+		loaded("hot-busy", 500, 0),
+		loaded("hot-lagging", 10, time.Minute),
+		loaded("hot-idle", 100, 0),
+		loaded("hot-idle-2", 100, 0),
+	}
+
+	if got := selectStorage(storages, time.Minute, 5*time.Second); got == nil || got.ID != "hot-idle" {
+		t.Fatalf("expected least loaded storage in time, got %v", got)
+	}
+
+	if got := selectStorage(storages, time.Minute, 0); got == nil || got.ID != "hot-lagging" {
+		t.Fatalf("expected lag to be ignored without threshold, got %v", got)
+	}
+
+	if got := selectStorage(storages[1:2], time.Minute, 5*time.Second); got == nil || got.ID != "hot-lagging" {
+		t.Fatalf("expected lagging storage as fallback, got %v", got)
+	}
+
+	// Только что зарегистрированное хранилище без heartbeat не считается самым свободным.
+	fresh := &storage.Info{
+		ID:        "hot-fresh",
+		MaxDelay:  time.Hour,
+		Status:    node.NodeStatusActive,
+		Instances: []storage.Instance{{Address: "http://hot-fresh"}},
+	}
+	if got := selectStorage(append([]*storage.Info{fresh}, storages...), time.Minute, 5*time.Second); got == nil || got.ID != "hot-idle" {
+		t.Fatalf("expected storage with measured load, got %v", got)
+	}
+	if got := selectStorage([]*storage.Info{storages[1], fresh}, time.Minute, 5*time.Second); got == nil || got.ID != "hot-fresh" {
+		t.Fatalf("expected storage with unknown load before lagging one, got %v", got)
+	}
+}
+
+// routingBus запоминает, куда gateway отправил сообщения и какие подтвердил хранилищам.
+// Отправка сообщения с ID failOn завершается ошибкой.
+type routingBus struct {
+	sent   map[string][]string
+	acked  map[string][]string
+	failOn string
+}
+
+func (b *routingBus) SendToStorage(storageID string, msgs []*message.Message) error {
+	for _, m := range msgs {
+		if m.ID == b.failOn {
+			return errors.New("bus unavailable")
+		}
+		b.sent[storageID] = append(b.sent[storageID], m.ID)
+	}
+	return nil
+}
+
+func (b *routingBus) SendToPusher(pusherID string, msgs []*message.Message) error {
+	return b.SendToStorage("pusher:"+pusherID, msgs)
+}
+
+func (b *routingBus) AckToStorage(storageID string, ids []string) error {
+	b.acked[storageID] = append(b.acked[storageID], ids...)
+	return nil
+}
+
+func (b *routingBus) NewHandlerOnGatewayMessages(nats.MsgHandler) (*nats.Subscription, error) {
+	return nil, nil
+}
+
+func TestRehomeSelectsStorageAgain(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(now)
+	rb := &routingBus{sent: make(map[string][]string), acked: make(map[string][]string)}
+	g := &BaseGateway{
+		config: &gateway.GatewayConfig{Clock: clk},
+		bus:    rb,
+		clock:  clk,
+		storages: []*storage.Info{
+			{ID: "hot", MaxDelay: time.Hour},
+			{ID: "warm", MinDelay: time.Hour, MaxDelay: 24 * time.Hour},
+		},
+		routingRules:             []*routingrule.RoutingRule{{ID: "all", MatchType: routingrule.MatchPrefix, PusherID: "p", Enabled: true}},
+		minDelayForSaveInStorage: time.Second,
+	}
+
+	msgs := []*message.Message{
+		message.NewMessage(message.WithID("to-warm"), message.WithScheduledAt(now.Add(2*time.Hour))),
+		message.NewMessage(message.WithID("stays"), message.WithScheduledAt(now.Add(time.Minute))),
+		message.NewMessage(message.WithID("orphan"), message.WithScheduledAt(now.Add(48*time.Hour))),
+		message.NewMessage(message.WithID("due"), message.WithScheduledAt(now)),
+	}
+	data, err := json.Marshal(msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := nats.NewMsg("orbital.gateway")
+	msg.Header.Set(bus.HeaderStorageID, "hot")
+	msg.Header.Set(bus.HeaderRehome, "true")
+	msg.Data = data
+
+	g.HandleReadyMessages(msg)
+
+	if !slices.Equal(rb.sent["warm"], []string{"to-warm"}) || !slices.Equal(rb.sent["pusher:p"], []string{"due"}) || len(rb.sent["hot"]) != 0 {
+		t.Fatalf("unexpected routing %v", rb.sent)
+	}
+	// Сообщения, для которых подходит только исходное хранилище или никакое, остаются в нём.
+	if !slices.Equal(rb.acked["hot"], []string{"to-warm", "due"}) {
+		t.Fatalf("unexpected acks %v", rb.acked)
+	}
+
+	// Покидающий кластер инстанс передаёт сообщения и другим инстансам своего хранилища.
+	rb.sent, rb.acked = make(map[string][]string), make(map[string][]string)
+	msg.Header.Set(bus.HeaderEvacuate, "true")
+
+	g.HandleReadyMessages(msg)
+
+	if !slices.Equal(rb.sent["hot"], []string{"stays"}) || !slices.Equal(rb.acked["hot"], []string{"to-warm", "stays", "due"}) {
+		t.Fatalf("unexpected evacuation routing %v and acks %v", rb.sent, rb.acked)
+	}
+}
+
+func TestHandleReadyMessagesAcksPushedBeforeFailure(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(now)
+	rb := &routingBus{sent: make(map[string][]string), acked: make(map[string][]string), failOn: "b"}
+	g := &BaseGateway{
+		config:       &gateway.GatewayConfig{Clock: clk},
+		bus:          rb,
+		clock:        clk,
+		routingRules: []*routingrule.RoutingRule{{ID: "all", MatchType: routingrule.MatchPrefix, PusherID: "p", Enabled: true}},
+	}
+
+	data, err := json.Marshal([]*message.Message{
+		message.NewMessage(message.WithID("a"), message.WithScheduledAt(now)),
+		message.NewMessage(message.WithID("b"), message.WithScheduledAt(now)),
+		message.NewMessage(message.WithID("c"), message.WithScheduledAt(now)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := nats.NewMsg("orbital.gateway")
+	msg.Header.Set(bus.HeaderStorageID, "hot")
+	msg.Data = data
+
+	g.HandleReadyMessages(msg)
+
+	// Отправленное до ошибки сообщение подтверждается хранилищу, остальные ждут повторной доставки.
+	if !slices.Equal(rb.sent["pusher:p"], []string{"a"}) || !slices.Equal(rb.acked["hot"], []string{"a"}) {
+		t.Fatalf("unexpected routing %v and acks %v", rb.sent, rb.acked)
+	}
+}
+
+func TestConsumeAssignsIDBeforeSending(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(now)
+	rb := &routingBus{sent: make(map[string][]string), acked: make(map[string][]string)}
+	g := &BaseGateway{
+		config:                   &gateway.GatewayConfig{Clock: clk},
+		bus:                      rb,
+		clock:                    clk,
+		storages:                 []*storage.Info{{ID: "hot", MaxDelay: time.Hour}},
+		minDelayForSaveInStorage: time.Second,
+	}
+
+	msg := &message.Message{ScheduledAt: now.Add(time.Minute)}
+	if err := g.Consume(msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.ID == "" || !slices.Equal(rb.sent["hot"], []string{msg.ID}) {
+		t.Fatalf("expected message to be sent with assigned ID, got %q and %v", msg.ID, rb.sent)
+	}
+}
@@ -2,8 +2,13 @@ package http
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"time"
 
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+	"github.com/Alexey-zaliznuak/orbital/pkg/ndjson"
 	"github.com/Alexey-zaliznuak/orbital/pkg/sdk/gateway/api"
 
 	// Используется в swagger-аннотациях.
@@ -23,6 +28,9 @@ func (s *Server) healthCheck(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
 
+// importBatchSize — сколько строк импорта читается перед направлением сообщений.
+const importBatchSize = 100
+
 // === Helpers ===
 
 func (s *Server) writeJSON(w http.ResponseWriter, status int, data any) {
@@ -80,3 +88,45 @@ func (s *Server) consumeMessage(w http.ResponseWriter, r *http.Request) {
 
 	s.writeJSON(w, http.StatusCreated, gatewayapi.NewMessageResponseFromMessage(msg))
 }
+
+// importMessages godoc
+// @Summary		Импорт сообщений
+// @Description	Принимает поток NDJSON (формат экспорта хранилищ) и направляет каждое сообщение как обычное: в хранилище по оставшейся задержке или сразу в пушер. ID и scheduled_at сохраняются. Тело может быть сжато gzip (Content-Encoding: gzip). Строки, которые не удалось разобрать или направить, не прерывают импорт и перечисляются в ответе
+// @Tags		Messages
+// @Accept		application/x-ndjson
+// @Produce		json
+// @Param		request	body		string				true	"Поток NDJSON"
+// @Success		200		{object}	ndjson.ImportResult	"Итог импорта"
+// @Failure		400		{object}	gatewayapi.ErrorResponse	"Поток не удалось прочитать"
+// @Router		/api/v1/messages/import [post]
+func (s *Server) importMessages(w http.ResponseWriter, r *http.Request) {
+	// Импорт не ограничен по времени: WriteTimeout сервера отсчитывается от заголовков
+	// запроса, и без снятия дедлайна итог долгого импорта не дошёл бы до клиента.
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Time{})
+	rc.SetWriteDeadline(time.Time{})
+
+	body, err := ndjson.RequestBody(r)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer body.Close()
+
+	result, err := ndjson.Import(body, importBatchSize, func(msgs []*message.Message) ([]storage.StoreResult, error) {
+		results := make([]storage.StoreResult, len(msgs))
+		for i, msg := range msgs {
+			if msg.ID == "" {
+				msg.ID = message.GenerateID()
+			}
+			results[i] = storage.StoreResult{ID: msg.ID, Err: s.gateway.Consume(msg)}
+		}
+		return results, nil
+	})
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, fmt.Sprintf("imported %d messages: %v", result.Imported, err))
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, result)
+}
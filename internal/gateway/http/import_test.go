@@ -0,0 +1,92 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/gateway"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+	gatewaysdk "github.com/Alexey-zaliznuak/orbital/pkg/sdk/gateway"
+)
+
+// recordingGateway запоминает принятые сообщения и отклоняет routing key "bad".
+type recordingGateway struct {
+	consumed []*message.Message
+}
+
+func (g *recordingGateway) Consume(msg *message.Message) error {
+	if msg.RoutingKey == "bad" {
+		return errors.New("no route")
+	}
+	g.consumed = append(g.consumed, msg)
+	return nil
+}
+
+func (g *recordingGateway) Start(context.Context) error { return nil }
+
+func (g *recordingGateway) GetConfig() *gateway.GatewayConfig { return &gateway.GatewayConfig{} }
+
+func TestImportRoutesEachMessage(t *testing.T) {
+	gw := &recordingGateway{}
+	srv := httptest.NewServer(NewServer(gw, Config{}).Router())
+	defer srv.Close()
+
+	body := strings.Join([]string{
+		`{"id":"a","routing_key":"rk","scheduled_at":"2030-01-01T00:00:00Z"}`,
+		``,
+		`{"routing_key":"rk"}`,
+		`{"id":"c","routing_key":"bad"}`,
+		`not json`,
+	}, "\n")
+
+	client := gatewaysdk.NewClient(gatewaysdk.ClientConfig{BaseURL: srv.URL})
+	result, err := client.Import(context.Background(), strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Imported != 2 || result.Failed != 2 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if result.Errors[0].ID != "c" || result.Errors[0].Line != 4 || result.Errors[1].Line != 5 {
+		t.Fatalf("unexpected errors %+v", result.Errors)
+	}
+
+	if len(gw.consumed) != 2 || gw.consumed[0].ID != "a" || gw.consumed[1].ID == "" {
+		t.Fatalf("unexpected consumed messages %+v", gw.consumed)
+	}
+	if want := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC); !gw.consumed[0].ScheduledAt.Equal(want) {
+		t.Fatalf("expected ScheduledAt %v, got %v", want, gw.consumed[0].ScheduledAt)
+	}
+}
+
+// slowGateway принимает сообщения с задержкой.
+type slowGateway struct {
+	recordingGateway
+	delay time.Duration
+}
+
+func (g *slowGateway) Consume(msg *message.Message) error {
+	time.Sleep(g.delay)
+	return g.recordingGateway.Consume(msg)
+}
+
+func TestImportOutlivesWriteTimeout(t *testing.T) {
+	srv := httptest.NewUnstartedServer(NewServer(&slowGateway{delay: 300 * time.Millisecond}, Config{}).Router())
+	srv.Config.WriteTimeout = 100 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	client := gatewaysdk.NewClient(gatewaysdk.ClientConfig{BaseURL: srv.URL})
+	result, err := client.Import(context.Background(), strings.NewReader(`{"id":"a","routing_key":"rk"}`+"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Imported != 1 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+}
@@ -58,7 +58,6 @@ func (s *Server) setupRouter() *chi.Mux {
 	r.Use(middleware.RealIP)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
-	r.Use(middleware.Timeout(30 * time.Second))
 
 	// Swagger UI
 	r.Get("/swagger/*", httpSwagger.Handler(
@@ -67,11 +66,18 @@ func (s *Server) setupRouter() *chi.Mux {
 
 	// API v1
 	r.Route("/api/v1", func(r chi.Router) {
-		r.Get("/health", s.healthCheck)
+		// Импорт передаёт поток произвольной длины и не ограничен по времени.
+		r.Post("/messages/import", s.importMessages)
 
-		r.Post("/message", s.consumeMessage)
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.Timeout(30 * time.Second))
 
-		r.Get("/config", s.getGatewayConfig)
+			r.Get("/health", s.healthCheck)
+
+			r.Post("/message", s.consumeMessage)
+
+			r.Get("/config", s.getGatewayConfig)
+		})
 	})
 
 	return r
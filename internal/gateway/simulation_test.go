@@ -0,0 +1,167 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"testing"
+	"time"
+
+	inmemory "github.com/Alexey-zaliznuak/orbital/internal/storages/in_memory"
+	"github.com/Alexey-zaliznuak/orbital/pkg/clock"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/gateway"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+	routingrule "github.com/Alexey-zaliznuak/orbital/pkg/entities/routing_rule"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+	"github.com/nats-io/nats.go"
+)
+
+// simulatedBus доставляет сообщения gateway напрямую в хранилище и запоминает,
+// когда по часам clk каждое сообщение ушло в пушер.
+type simulatedBus struct {
+	clk       clock.Clock
+	storage   storage.MessageStorage
+	delivered map[string][]time.Time
+}
+
+func (b *simulatedBus) SendToStorage(_ string, msgs []*message.Message) error {
+	results, err := b.storage.Store(context.Background(), msgs)
+	if err != nil {
+		return err
+	}
+	for _, r := range results {
+		if r.Err != nil {
+			return r.Err
+		}
+	}
+	return nil
+}
+
+func (b *simulatedBus) SendToPusher(_ string, msgs []*message.Message) error {
+	for _, m := range msgs {
+		b.delivered[m.ID] = append(b.delivered[m.ID], b.clk.Now())
+	}
+	return nil
+}
+
+func (b *simulatedBus) AckToStorage(string, []string) error { return nil }
+
+func (b *simulatedBus) NewHandlerOnGatewayMessages(nats.MsgHandler) (*nats.Subscription, error) {
+	return nil, nil
+}
+
+// TestSimulateDay прогоняет сутки планирования на поддельных часах: сообщения
+// поступают в gateway в течение дня с задержками до шести часов, хранилище выдаёт
+// наступившие сообщения каждую виртуальную секунду.
+func TestSimulateDay(t *testing.T) {
+	const (
+		total    = 5000
+		step     = time.Second
+		day      = 24 * time.Hour
+		maxDelay = 6 * time.Hour
+	)
+
+	ctx := context.Background()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(start)
+
+	store, err := inmemory.NewStandalone(ctx, inmemory.NewBuilder().
+		WithShards(4).
+		WithVisibilityTimeout(time.Minute).
+		WithClock(clk).
+		Build())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bus := &simulatedBus{clk: clk, storage: store, delivered: make(map[string][]time.Time)}
+	g := &BaseGateway{
+		config:                   &gateway.GatewayConfig{Clock: clk},
+		bus:                      bus,
+		clock:                    clk,
+		storages:                 []*storage.Info{{ID: "hot"}},
+		routingRules:             []*routingrule.RoutingRule{{ID: "all", Pattern: "", MatchType: routingrule.MatchPrefix, PusherID: "p", Enabled: true}},
+		minDelayForSaveInStorage: 10 * time.Millisecond,
+	}
+
+	type arrival struct {
+		at    time.Duration
+		delay time.Duration
+		id    string
+	}
+
+	rnd := rand.New(rand.NewPCG(1, 2))
+	arrivals := make([]arrival, total)
+	for i := range arrivals {
+		arrivals[i] = arrival{
+			at:    time.Duration(rnd.Int64N(int64(day - maxDelay))).Truncate(time.Millisecond),
+			delay: time.Duration(rnd.Int64N(int64(maxDelay))).Truncate(time.Millisecond),
+			id:    fmt.Sprintf("m-%05d", i),
+		}
+		if i%10 == 0 {
+			arrivals[i].delay = 0
+		}
+	}
+	slices.SortFunc(arrivals, func(a, b arrival) int { return int(a.at - b.at) })
+
+	scheduled := make(map[string]time.Time, total)
+	next := 0
+
+	for elapsed := time.Duration(0); elapsed <= day; elapsed += step {
+		for next < total && arrivals[next].at <= elapsed {
+			a := arrivals[next]
+			clk.Set(start.Add(a.at))
+
+			// Задержка отсчитывается от часов симуляции и при WithDelay перед WithClock.
+			msg := message.NewMessage(
+				message.WithID(a.id),
+				message.WithRoutingKey("rk"),
+				message.WithDelay(a.delay),
+				message.WithClock(clk),
+			)
+			scheduled[msg.ID] = msg.ScheduledAt
+
+			if err := g.Consume(msg); err != nil {
+				t.Fatalf("Consume %s: %v", msg.ID, err)
+			}
+			next++
+		}
+
+		clk.Set(start.Add(elapsed))
+
+		ready, err := store.FetchReady(ctx, 1000)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ids := make([]string, len(ready))
+		for i, m := range ready {
+			if err := g.sendToPusher(m.Message); err != nil {
+				t.Fatal(err)
+			}
+			ids[i] = m.ID
+		}
+		if err := store.Acknowledge(ctx, ids); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(bus.delivered) != total {
+		t.Fatalf("expected %d delivered messages, got %d", total, len(bus.delivered))
+	}
+
+	for id, at := range scheduled {
+		deliveries := bus.delivered[id]
+		if len(deliveries) != 1 {
+			t.Fatalf("message %s delivered %d times", id, len(deliveries))
+		}
+		if deliveries[0].Before(at) || deliveries[0].After(at.Add(step)) {
+			t.Fatalf("message %s scheduled at %v delivered at %v", id, at, deliveries[0])
+		}
+	}
+
+	if n, _ := store.Count(ctx); n != 0 {
+		t.Fatalf("expected empty storage, got %d messages", n)
+	}
+}
@@ -0,0 +1,88 @@
+package boltstorage
+
+import (
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/clock"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+	"github.com/caarlos0/env/v11"
+)
+
+type BoltStorageConfig struct {
+	storage.BaseStorageConfig
+
+	// Path путь к файлу базы; создаётся при первом запуске.
+	Path string `env:"BOLT_PATH" envDefault:"./data/orbital.db"`
+	// NoSync отключает fsync после каждой транзакции: быстрее, но последние
+	// сохранённые сообщения могут потеряться при сбое ОС или питания.
+	NoSync bool `env:"BOLT_NO_SYNC" envDefault:"false"`
+}
+
+type BoltStorageConfigBuilder struct {
+	cfg *BoltStorageConfig
+}
+
+func NewBuilder() *BoltStorageConfigBuilder {
+	return &BoltStorageConfigBuilder{
+		cfg: &BoltStorageConfig{},
+	}
+}
+
+func (b *BoltStorageConfigBuilder) WithID(id string) *BoltStorageConfigBuilder {
+	b.cfg.ID = id
+	return b
+}
+
+func (b *BoltStorageConfigBuilder) WithAddress(addr string) *BoltStorageConfigBuilder {
+	b.cfg.Address = addr
+	return b
+}
+
+func (b *BoltStorageConfigBuilder) WithClusterAddress(addr string) *BoltStorageConfigBuilder {
+	b.cfg.ClusterAddress = addr
+	return b
+}
+
+func (b *BoltStorageConfigBuilder) WithPath(path string) *BoltStorageConfigBuilder {
+	b.cfg.Path = path
+	return b
+}
+
+func (b *BoltStorageConfigBuilder) WithNoSync(noSync bool) *BoltStorageConfigBuilder {
+	b.cfg.NoSync = noSync
+	return b
+}
+
+func (b *BoltStorageConfigBuilder) WithSendExpiredInterval(d time.Duration) *BoltStorageConfigBuilder {
+	b.cfg.SendExpiredInterval = d
+	return b
+}
+
+func (b *BoltStorageConfigBuilder) WithMaxOutputBatchSize(size int) *BoltStorageConfigBuilder {
+	b.cfg.MaxOutputBatchSize = size
+	return b
+}
+
+func (b *BoltStorageConfigBuilder) WithNakDelay(d time.Duration) *BoltStorageConfigBuilder {
+	b.cfg.NakDelay = d
+	return b
+}
+
+func (b *BoltStorageConfigBuilder) WithVisibilityTimeout(d time.Duration) *BoltStorageConfigBuilder {
+	b.cfg.VisibilityTimeout = d
+	return b
+}
+
+func (b *BoltStorageConfigBuilder) WithClock(c clock.Clock) *BoltStorageConfigBuilder {
+	b.cfg.Clock = c
+	return b
+}
+
+func (b *BoltStorageConfigBuilder) FromEnv() *BoltStorageConfigBuilder {
+	env.Parse(b.cfg)
+	return b
+}
+
+func (b *BoltStorageConfigBuilder) Build() *BoltStorageConfig {
+	return b.cfg
+}
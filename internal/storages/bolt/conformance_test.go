@@ -0,0 +1,37 @@
+package boltstorage
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/Alexey-zaliznuak/orbital/internal/storages/storagetest"
+	"github.com/Alexey-zaliznuak/orbital/pkg/clock"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T, clk clock.Clock) *storagetest.Instance {
+		cfg := newTestConfig(filepath.Join(t.TempDir(), "orbital.db"))
+		cfg.Clock = clk
+
+		open := func(t *testing.T) *BoltStorage {
+			s := NewBoltStorage()
+			if err := s.initState(cfg); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { s.Close() })
+			return s
+		}
+
+		s := open(t)
+
+		return &storagetest.Instance{
+			Storage: s,
+			// Файл блокируется открывшим его процессом, поэтому прежний экземпляр закрывается.
+			Reopen: func(t *testing.T) storage.MessageStorage {
+				s.Close()
+				return open(t)
+			},
+		}
+	})
+}
@@ -0,0 +1,126 @@
+package boltstorage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Alexey-zaliznuak/orbital/internal/storages/pipeline"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+	"github.com/Alexey-zaliznuak/orbital/pkg/logger"
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/zap"
+)
+
+// Rehome передаёт gateway ожидающие сообщения, которые не подходят под диапазон query.
+// Интервалы query.Ranges просматриваются по ключам schedule страницами по
+// MaxOutputBatchSize, каждая в своей транзакции чтения. С query.All инстанс покидает
+// кластер: он перестаёт принимать сообщения из шины, и gateway может передать его
+// сообщения другим инстансам хранилища.
+func (s *BoltStorage) Rehome(_ context.Context, query storage.RehomeQuery) (*storage.RehomeResult, error) {
+	if err := s.checkReady(); err != nil {
+		return nil, err
+	}
+	if s.rehomeVia == nil {
+		return nil, pipeline.ErrNoBus
+	}
+
+	// Иначе инстанс мог бы сам получить свои сообщения из orbital.storage.{ID}
+	// как дубликаты и удалить их по подтверждению gateway.
+	if query.All {
+		s.stopIntake()
+	}
+
+	now := s.clock.Now()
+	result := &storage.RehomeResult{}
+
+	for _, r := range query.Ranges(now) {
+		from := scheduleKey(r.From, "")
+		var end []byte
+		if !r.To.IsZero() {
+			end = scheduleKey(r.To, "")
+		}
+
+		for from != nil {
+			var (
+				page []*message.Message
+				err  error
+			)
+			page, from, err = s.schedulePage(from, end)
+			if err != nil {
+				return result, err
+			}
+			result.Scanned += len(page)
+
+			misplaced := make([]*message.Message, 0, len(page))
+			for _, msg := range page {
+				if query.Misplaced(msg.ScheduledAt.Sub(now)) {
+					misplaced = append(misplaced, msg)
+				}
+			}
+
+			sent, err := pipeline.Rehome(s.rehomeVia, s.cfg.ID, misplaced, s.cfg.MaxOutputBatchSize, query.All)
+			result.Resubmitted += sent
+			if err != nil {
+				return result, err
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// schedulePage читает до MaxOutputBatchSize ожидающих сообщений с ключами schedule
+// в [from, end) и возвращает ключ, с которого продолжать, или nil, если диапазон
+// исчерпан; end == nil — без верхней границы.
+func (s *BoltStorage) schedulePage(from, end []byte) ([]*message.Message, []byte, error) {
+	var (
+		page []*message.Message
+		next []byte
+	)
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		messages := tx.Bucket(messagesBucket)
+
+		c := tx.Bucket(scheduleBucket).Cursor()
+		for k, _ := c.Seek(from); k != nil && (end == nil || bytes.Compare(k, end) < 0); k, _ = c.Next() {
+			if len(page) == s.cfg.MaxOutputBatchSize {
+				next = bytes.Clone(k)
+				return nil
+			}
+
+			body := messages.Get(k[8:])
+			if body == nil {
+				continue
+			}
+
+			var msg message.Message
+			if err := json.Unmarshal(body, &msg); err != nil {
+				return fmt.Errorf("unmarshal message %s: %w", k[8:], err)
+			}
+			page = append(page, &msg)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("bolt rehome: %w", err)
+	}
+
+	return page, next, nil
+}
+
+// stopIntake прекращает приём новых и продвинутых сообщений из шины; следующие
+// достаются другим инстансам хранилища.
+func (s *BoltStorage) stopIntake() {
+	s.intakeOnce.Do(func() {
+		if s.subscriptions == nil {
+			return
+		}
+		if err := s.subscriptions.StopIntake(); err != nil {
+			logger.Log.Warn("Failed to stop bus intake", zap.Error(err))
+		}
+	})
+}
@@ -0,0 +1,701 @@
+// Package boltstorage реализует персистентное хранилище сообщений во встроенной
+// базе bbolt — без внешних зависимостей, для небольших установок.
+//
+// Тела сообщений хранятся в bucket messages по ID. Bucket schedule упорядочен по
+// ключу (ScheduledAt, ID): наступившие сообщения забираются сканированием
+// диапазона с начала. Выпущенные сообщения переносятся в bucket inflight с ключом
+// (now+VisibilityTimeout, ID) и удаляются после подтверждения от gateway или
+// принявшего их хранилища. Bucket visibility хранит текущий ключ каждого сообщения
+// в schedule или inflight. Bucket attempts хранит число и время последней выдачи,
+// bucket failed — сообщения, отклонённые без повторной постановки.
+package boltstorage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/internal/storages/pipeline"
+	"github.com/Alexey-zaliznuak/orbital/pkg/clock"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+	"github.com/Alexey-zaliznuak/orbital/pkg/logger"
+	"github.com/Alexey-zaliznuak/orbital/pkg/sdk/coordinator"
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/zap"
+)
+
+var (
+	messagesBucket   = []byte("messages")
+	scheduleBucket   = []byte("schedule")
+	inflightBucket   = []byte("inflight")
+	visibilityBucket = []byte("visibility")
+	attemptsBucket   = []byte("attempts")
+	failedBucket     = []byte("failed")
+)
+
+type BoltStorage struct {
+	mu sync.RWMutex
+
+	initOnce sync.Once
+
+	db       *bolt.DB
+	promoter *pipeline.Promoter
+	// rehomeVia передаёт gateway сообщения вне диапазона задержек.
+	rehomeVia pipeline.RehomeSender
+	// subscriptions — подписки на шину, nil у хранилища без кластера.
+	subscriptions *pipeline.Subscriptions
+	// intakeOnce — однократная остановка приёма сообщений из шины при эвакуации.
+	intakeOnce sync.Once
+
+	cfg   *BoltStorageConfig
+	clock clock.Clock
+	ready bool
+}
+
+func NewBoltStorage() *BoltStorage {
+	return &BoltStorage{}
+}
+
+func (s *BoltStorage) Initialize(ctx context.Context, rawConfig any) error {
+	var err error
+
+	s.initOnce.Do(func() {
+		err = s.initialize(ctx, rawConfig)
+		if err != nil {
+			logger.Log.Error("failed to initialize storage", zap.Error(err))
+		}
+	})
+
+	return err
+}
+
+func (s *BoltStorage) initialize(ctx context.Context, rawConfig any) error {
+	cfg, ok := rawConfig.(*BoltStorageConfig)
+
+	if !ok {
+		return fmt.Errorf("expected *BoltStorageConfig, got %T", rawConfig)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.initState(cfg); err != nil {
+		return err
+	}
+
+	busClient, err := pipeline.Connect(ctx, cfg.ClusterAddress)
+	if err != nil {
+		return err
+	}
+
+	coordinatorClient := coordinator.NewClient(coordinator.ClientConfig{
+		BaseURL: cfg.ClusterAddress,
+	})
+	s.promoter = pipeline.NewPromoter(busClient, coordinatorClient.ListStorages, &cfg.BaseStorageConfig)
+	s.rehomeVia = busClient
+
+	subscriptions, err := pipeline.Subscribe(busClient, cfg.ID, s, s.Acknowledge, cfg.NakDelay)
+	if err != nil {
+		return err
+	}
+	s.subscriptions = subscriptions
+
+	go s.runReleaseWorker(ctx)
+	meter := pipeline.NewLoadMeter(s, subscriptions, cfg.Clock)
+	go pipeline.RunHeartbeat(ctx, coordinatorClient, &cfg.BaseStorageConfig, pipeline.MeterReport(meter))
+
+	return nil
+}
+
+// initState открывает базу и создаёт bucket-ы. Выпущенные, но не подтверждённые
+// до сбоя сообщения остаются в inflight и будут выпущены повторно после VisibilityTimeout.
+func (s *BoltStorage) initState(cfg *BoltStorageConfig) error {
+	if dir := filepath.Dir(cfg.Path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("failed to create data directory: %w", err)
+		}
+	}
+
+	db, err := bolt.Open(cfg.Path, 0o600, &bolt.Options{Timeout: time.Second, NoSync: cfg.NoSync})
+	if err != nil {
+		return fmt.Errorf("failed to open bolt database: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{messagesBucket, scheduleBucket, inflightBucket, visibilityBucket, attemptsBucket, failedBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return fmt.Errorf("failed to create buckets: %w", err)
+	}
+
+	s.cfg = cfg
+	s.clock = clock.OrSystem(cfg.Clock)
+	s.db = db
+	s.ready = true
+
+	return nil
+}
+
+// Close закрывает базу. После Close хранилище не принимает операций.
+func (s *BoltStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.ready {
+		return nil
+	}
+
+	s.ready = false
+	return s.db.Close()
+}
+
+// runReleaseWorker периодически забирает наступившие сообщения и отправляет их в gateway.
+func (s *BoltStorage) runReleaseWorker(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.SendExpiredInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.processMessages(ctx); err != nil {
+				logger.Log.Error("failed to process expired messages", zap.Error(err))
+			}
+		}
+	}
+}
+
+func (s *BoltStorage) HealthCheck(_ context.Context) (storage.StorageHealth, error) {
+	if err := s.checkReady(); err != nil {
+		return storage.StorageHealthDisconnect, err
+	}
+	return storage.StorageHealthOK, nil
+}
+
+// Store сохраняет пачку сообщений одной транзакцией: сообщение с уже занятым ID
+// и идентичным содержимым считается дубликатом, с отличающимся — получает ErrAlreadyExists.
+func (s *BoltStorage) Store(_ context.Context, msgs []*message.Message) ([]storage.StoreResult, error) {
+	if err := s.checkReady(); err != nil {
+		return nil, err
+	}
+
+	msgs = storage.WithIDs(msgs)
+	results := make([]storage.StoreResult, len(msgs))
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		messages := tx.Bucket(messagesBucket)
+		schedule := tx.Bucket(scheduleBucket)
+		visibility := tx.Bucket(visibilityBucket)
+
+		for i, msg := range msgs {
+			results[i].ID = msg.ID
+
+			id := []byte(msg.ID)
+
+			if existing := messages.Get(id); existing != nil {
+				var stored message.Message
+				if err := json.Unmarshal(existing, &stored); err != nil {
+					results[i].Err = fmt.Errorf("unmarshal stored message %s: %w", msg.ID, err)
+				} else if stored.Equal(msg) {
+					results[i].Duplicate = true
+				} else {
+					results[i].Err = fmt.Errorf("%w: %s", storage.ErrAlreadyExists, msg.ID)
+				}
+				continue
+			}
+
+			body, err := json.Marshal(msg)
+			if err != nil {
+				results[i].Err = fmt.Errorf("marshal message %s: %w", msg.ID, err)
+				continue
+			}
+
+			key := scheduleKey(msg.ScheduledAt, msg.ID)
+
+			if err := messages.Put(id, body); err != nil {
+				return err
+			}
+			if err := schedule.Put(key, nil); err != nil {
+				return err
+			}
+			if err := visibility.Put(id, key); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("bolt store: %w", err)
+	}
+
+	return results, nil
+}
+
+// processMessages забирает наступившие и подлежащие продвижению сообщения и выпускает их.
+// Если отправка не удалась, сообщения будут забраны повторно после VisibilityTimeout.
+func (s *BoltStorage) processMessages(ctx context.Context) error {
+	now := s.clock.Now()
+
+	claimed, err := s.claim(now, s.promoter.Horizon(ctx, now), s.cfg.MaxOutputBatchSize)
+	if err != nil {
+		return err
+	}
+
+	if len(claimed) == 0 {
+		return nil
+	}
+
+	msgs := make([]*message.Message, len(claimed))
+	for i, stored := range claimed {
+		msgs[i] = stored.Message
+	}
+
+	return s.promoter.Release(ctx, msgs, now)
+}
+
+// claim забирает до limit сообщений: сначала выпущенных, но не подтверждённых
+// к моменту now, затем ещё не выпускавшихся, — с ScheduledAt не позже horizon,
+// откладывает их повторный выпуск до now+VisibilityTimeout и отмечает попытку.
+func (s *BoltStorage) claim(now, horizon time.Time, limit int) ([]*storage.StoredMessage, error) {
+	if err := s.checkReady(); err != nil {
+		return nil, err
+	}
+
+	var claimed []*storage.StoredMessage
+	deadline := now.Add(s.cfg.VisibilityTimeout)
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		messages := tx.Bucket(messagesBucket)
+		schedule := tx.Bucket(scheduleBucket)
+		inflight := tx.Bucket(inflightBucket)
+		visibility := tx.Bucket(visibilityBucket)
+		attempts := tx.Bucket(attemptsBucket)
+
+		due := dueKeys(inflight, now, limit)
+		expired := len(due)
+		due = append(due, dueKeys(schedule, horizon, limit-expired)...)
+
+		for i, key := range due {
+			id := key[8:]
+
+			from := schedule
+			if i < expired {
+				from = inflight
+			}
+
+			body := messages.Get(id)
+			if body == nil {
+				// Сообщение удалено, а запись расписания осталась — убираем её.
+				if err := from.Delete(key); err != nil {
+					return err
+				}
+				continue
+			}
+
+			var msg message.Message
+			if err := json.Unmarshal(body, &msg); err != nil {
+				logger.Log.Error("Failed to unmarshal stored message", zap.Error(err))
+				continue
+			}
+
+			// Выпущенное для продвижения сообщение может быть ещё не готово к выдаче
+			// с меньшим horizon — оно остаётся в inflight.
+			if msg.ScheduledAt.After(horizon) {
+				continue
+			}
+
+			if err := from.Delete(key); err != nil {
+				return err
+			}
+
+			next := scheduleKey(deadline, msg.ID)
+			if err := inflight.Put(next, nil); err != nil {
+				return err
+			}
+			if err := visibility.Put(id, next); err != nil {
+				return err
+			}
+
+			count, _ := decodeAttempts(attempts.Get(id))
+			if err := attempts.Put(id, encodeAttempts(count+1, now)); err != nil {
+				return err
+			}
+
+			claimed = append(claimed, &storage.StoredMessage{
+				Message:       &msg,
+				Status:        storage.MessageStatusInFlight,
+				Attempts:      count + 1,
+				LastAttemptAt: now,
+			})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("bolt claim: %w", err)
+	}
+
+	return claimed, nil
+}
+
+// FetchExpiring возвращает до limit ещё не выпускавшихся сообщений с ScheduledAt
+// в пределах threshold. Ключи schedule упорядочены по ScheduledAt.
+func (s *BoltStorage) FetchExpiring(_ context.Context, threshold time.Duration, limit int) ([]*storage.StoredMessage, error) {
+	if err := s.checkReady(); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	var expiring []*storage.StoredMessage
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		messages := tx.Bucket(messagesBucket)
+		attempts := tx.Bucket(attemptsBucket)
+
+		for _, key := range dueKeys(tx.Bucket(scheduleBucket), s.clock.Now().Add(threshold), limit) {
+			id := key[8:]
+
+			body := messages.Get(id)
+			if body == nil {
+				continue
+			}
+
+			var msg message.Message
+			if err := json.Unmarshal(body, &msg); err != nil {
+				return fmt.Errorf("unmarshal message %s: %w", id, err)
+			}
+
+			count, at := decodeAttempts(attempts.Get(id))
+			expiring = append(expiring, &storage.StoredMessage{
+				Message:       &msg,
+				Status:        storage.MessageStatusPending,
+				Attempts:      count,
+				LastAttemptAt: at,
+			})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("bolt fetch expiring: %w", err)
+	}
+
+	return expiring, nil
+}
+
+// FetchReady выдаёт до limit наступивших сообщений, включая не подтверждённые
+// в течение VisibilityTimeout.
+func (s *BoltStorage) FetchReady(_ context.Context, limit int) ([]*storage.StoredMessage, error) {
+	if limit <= 0 {
+		return nil, s.checkReady()
+	}
+
+	now := s.clock.Now()
+
+	claimed, err := s.claim(now, now, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(claimed, func(a, b *storage.StoredMessage) int {
+		if c := a.ScheduledAt.Compare(b.ScheduledAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	return claimed, nil
+}
+
+// Reject возвращает выданное сообщение в schedule с исходным ScheduledAt
+// или переносит его в failed.
+func (s *BoltStorage) Reject(_ context.Context, id string, requeue bool) error {
+	if err := s.checkReady(); err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		inflight := tx.Bucket(inflightBucket)
+		visibility := tx.Bucket(visibilityBucket)
+		key := []byte(id)
+
+		body := tx.Bucket(messagesBucket).Get(key)
+		if body == nil {
+			return fmt.Errorf("%w: %s", storage.ErrNotFound, id)
+		}
+
+		current := visibility.Get(key)
+		if current == nil || inflight.Get(current) == nil {
+			return fmt.Errorf("%w: %s", storage.ErrNotInFlight, id)
+		}
+		if err := inflight.Delete(current); err != nil {
+			return err
+		}
+
+		if !requeue {
+			if err := visibility.Delete(key); err != nil {
+				return err
+			}
+			return tx.Bucket(failedBucket).Put(key, nil)
+		}
+
+		var msg message.Message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			return fmt.Errorf("unmarshal message %s: %w", id, err)
+		}
+
+		next := scheduleKey(msg.ScheduledAt, id)
+		if err := tx.Bucket(scheduleBucket).Put(next, nil); err != nil {
+			return err
+		}
+		return visibility.Put(key, next)
+	})
+}
+
+// Delete удаляет сообщение в любом состоянии.
+func (s *BoltStorage) Delete(_ context.Context, id string) error {
+	if err := s.checkReady(); err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(messagesBucket).Get([]byte(id)) == nil {
+			return fmt.Errorf("%w: %s", storage.ErrNotFound, id)
+		}
+		return deleteMessage(tx, []byte(id))
+	})
+}
+
+// dueKeys возвращает до limit первых ключей bucket с моментом не позже until.
+// Ключи копируются: bucket изменяется только после обхода курсором.
+func dueKeys(b *bolt.Bucket, until time.Time, limit int) [][]byte {
+	// Все ключи с моментом не позже until меньше первого ключа следующей наносекунды.
+	end := scheduleKey(until.Add(time.Nanosecond), "")
+
+	var keys [][]byte
+	c := b.Cursor()
+	for k, _ := c.First(); k != nil && bytes.Compare(k, end) < 0 && len(keys) < limit; k, _ = c.Next() {
+		keys = append(keys, bytes.Clone(k))
+	}
+
+	return keys
+}
+
+// Acknowledge удаляет сообщения, доставку которых подтвердил gateway,
+// сохранение которых подтвердило более горячее хранилище или обработку
+// которых подтвердил клиент FetchReady.
+func (s *BoltStorage) Acknowledge(_ context.Context, ids []string) error {
+	if err := s.checkReady(); err != nil {
+		return err
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		for _, id := range ids {
+			if err := deleteMessage(tx, []byte(id)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("bolt acknowledge: %w", err)
+	}
+
+	return nil
+}
+
+// deleteMessage удаляет сообщение id из всех bucket-ов.
+func deleteMessage(tx *bolt.Tx, id []byte) error {
+	visibility := tx.Bucket(visibilityBucket)
+
+	if next := visibility.Get(id); next != nil {
+		if err := tx.Bucket(scheduleBucket).Delete(next); err != nil {
+			return err
+		}
+		if err := tx.Bucket(inflightBucket).Delete(next); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range [][]byte{visibilityBucket, attemptsBucket, failedBucket, messagesBucket} {
+		if err := tx.Bucket(name).Delete(id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Get возвращает сообщение вместе с его состоянием.
+func (s *BoltStorage) Get(_ context.Context, id string) (*storage.StoredMessage, error) {
+	if err := s.checkReady(); err != nil {
+		return nil, err
+	}
+
+	var stored *storage.StoredMessage
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		key := []byte(id)
+
+		body := tx.Bucket(messagesBucket).Get(key)
+		if body == nil {
+			return fmt.Errorf("%w: %s", storage.ErrNotFound, id)
+		}
+
+		stored = &storage.StoredMessage{Message: &message.Message{}, Status: storage.MessageStatusPending}
+		if err := json.Unmarshal(body, stored.Message); err != nil {
+			return fmt.Errorf("unmarshal message %s: %w", id, err)
+		}
+
+		if tx.Bucket(failedBucket).Get(key) != nil {
+			stored.Status = storage.MessageStatusFailed
+		} else if current := tx.Bucket(visibilityBucket).Get(key); current != nil && tx.Bucket(inflightBucket).Get(current) != nil {
+			stored.Status = storage.MessageStatusInFlight
+		}
+
+		stored.Attempts, stored.LastAttemptAt = decodeAttempts(tx.Bucket(attemptsBucket).Get(key))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return stored, nil
+}
+
+func (s *BoltStorage) GetByID(_ context.Context, id string) (*message.Message, error) {
+	if err := s.checkReady(); err != nil {
+		return nil, err
+	}
+
+	var msg *message.Message
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		body := tx.Bucket(messagesBucket).Get([]byte(id))
+		if body == nil {
+			return fmt.Errorf("%w: %s", storage.ErrNotFound, id)
+		}
+
+		msg = &message.Message{}
+		if err := json.Unmarshal(body, msg); err != nil {
+			return fmt.Errorf("unmarshal message %s: %w", id, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+func (s *BoltStorage) Count(_ context.Context) (int64, error) {
+	if err := s.checkReady(); err != nil {
+		return 0, err
+	}
+
+	var n int64
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		n = int64(tx.Bucket(messagesBucket).Stats().KeyN)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("bolt count: %w", err)
+	}
+
+	return n, nil
+}
+
+// ProbeLoad реализует pipeline.LoadProber: самый ранний наступивший ключ расписания
+// и число ключей bucket inflight, без чтения тел сообщений. Сообщения без
+// ScheduledAt (нулевой момент) не опаздывают и не учитываются.
+func (s *BoltStorage) ProbeLoad(_ context.Context, now time.Time) (time.Time, int64, error) {
+	if err := s.checkReady(); err != nil {
+		return time.Time{}, 0, err
+	}
+
+	var (
+		earliestDue time.Time
+		inFlight    int64
+	)
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		end := scheduleKey(now.Add(time.Nanosecond), "")
+		if k, _ := tx.Bucket(scheduleBucket).Cursor().Seek(scheduleKey(time.Unix(0, 1), "")); k != nil && bytes.Compare(k, end) < 0 {
+			earliestDue = time.Unix(0, int64(binary.BigEndian.Uint64(k)))
+		}
+		inFlight = int64(tx.Bucket(inflightBucket).Stats().KeyN)
+		return nil
+	})
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("bolt probe load: %w", err)
+	}
+
+	return earliestDue, inFlight, nil
+}
+
+// scheduleKey возвращает ключ расписания: момент в наносекундах (big-endian,
+// чтобы порядок байтов совпадал с порядком времени) и ID. Сообщения без
+// ScheduledAt получают нулевой момент и доставляются немедленно.
+func scheduleKey(at time.Time, id string) []byte {
+	var nanos uint64
+	if !at.IsZero() && at.UnixNano() > 0 {
+		nanos = uint64(at.UnixNano())
+	}
+
+	key := make([]byte, 8+len(id))
+	binary.BigEndian.PutUint64(key, nanos)
+	copy(key[8:], id)
+	return key
+}
+
+// encodeAttempts кодирует число выдач и время последней из них в наносекундах.
+func encodeAttempts(count int, at time.Time) []byte {
+	value := make([]byte, 16)
+	binary.BigEndian.PutUint64(value, uint64(count))
+	binary.BigEndian.PutUint64(value[8:], uint64(at.UnixNano()))
+	return value
+}
+
+// decodeAttempts декодирует значение encodeAttempts; nil означает, что выдач не было.
+func decodeAttempts(value []byte) (int, time.Time) {
+	if len(value) != 16 {
+		return 0, time.Time{}
+	}
+	count := int(binary.BigEndian.Uint64(value))
+	return count, time.Unix(0, int64(binary.BigEndian.Uint64(value[8:])))
+}
+
+func (s *BoltStorage) checkReady() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if !s.ready {
+		return storage.ErrNotInitialized
+	}
+	return nil
+}
@@ -0,0 +1,320 @@
+package boltstorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+)
+
+func newTestConfig(path string) *BoltStorageConfig {
+	return NewBuilder().
+		WithID("test").
+		WithPath(path).
+		WithNoSync(true).
+		WithMaxOutputBatchSize(10).
+		WithVisibilityTimeout(time.Minute).
+		Build()
+}
+
+// newTestStorage открывает хранилище во временном каталоге без подключения к кластеру.
+func newTestStorage(t *testing.T) *BoltStorage {
+	t.Helper()
+
+	s := NewBoltStorage()
+	if err := s.initState(newTestConfig(filepath.Join(t.TempDir(), "orbital.db"))); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	return s
+}
+
+func TestStoreAndGet(t *testing.T) {
+	s := newTestStorage(t)
+	ctx := context.Background()
+
+	msg := message.NewMessage(
+		message.WithID("a"),
+		message.WithRoutingKey("rk"),
+		message.WithPayload([]byte("payload")),
+		message.WithMetadataValue("k", "v"),
+		message.WithScheduledAt(time.Now().Add(time.Hour)),
+	)
+
+	results, err := s.Store(ctx, []*message.Message{msg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Err != nil || results[0].Duplicate {
+		t.Fatalf("unexpected result %+v", results[0])
+	}
+
+	got, err := s.GetByID(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(msg) {
+		t.Fatalf("stored message differs: %+v", got)
+	}
+
+	if _, err := s.GetByID(ctx, "missing"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	if n, _ := s.Count(ctx); n != 1 {
+		t.Fatalf("expected 1 message, got %d", n)
+	}
+}
+
+func TestStoreDuplicateAndConflict(t *testing.T) {
+	s := newTestStorage(t)
+	ctx := context.Background()
+
+	msg := message.NewMessage(message.WithID("a"), message.WithPayload([]byte("v1")))
+	if _, err := s.Store(ctx, []*message.Message{msg}); err != nil {
+		t.Fatal(err)
+	}
+
+	conflict := *msg
+	conflict.Payload = []byte("v2")
+
+	results, err := s.Store(ctx, []*message.Message{msg, &conflict})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !results[0].Duplicate || results[0].Err != nil {
+		t.Fatalf("expected duplicate, got %+v", results[0])
+	}
+	if !errors.Is(results[1].Err, storage.ErrAlreadyExists) {
+		t.Fatalf("expected ErrAlreadyExists, got %+v", results[1])
+	}
+}
+
+func TestClaimReleasesDueMessagesInOrder(t *testing.T) {
+	s := newTestStorage(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	msgs := []*message.Message{
+		message.NewMessage(message.WithID("future"), message.WithScheduledAt(now.Add(time.Hour))),
+		message.NewMessage(message.WithID("past"), message.WithScheduledAt(now.Add(-time.Second))),
+		message.NewMessage(message.WithID("older"), message.WithScheduledAt(now.Add(-time.Minute))),
+		message.NewMessage(message.WithID("due")),
+	}
+	if _, err := s.Store(ctx, msgs); err != nil {
+		t.Fatal(err)
+	}
+
+	claimed, err := s.claim(now, now, s.cfg.MaxOutputBatchSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed) != 3 {
+		t.Fatalf("expected 3 due messages, got %d", len(claimed))
+	}
+	for i, id := range []string{"due", "older", "past"} {
+		if claimed[i].ID != id {
+			t.Fatalf("expected %s at position %d, got %s", id, i, claimed[i].ID)
+		}
+	}
+
+	again, err := s.claim(now, now, s.cfg.MaxOutputBatchSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again) != 0 {
+		t.Fatalf("expected no messages, got %d", len(again))
+	}
+
+	redelivered, err := s.claim(now.Add(2*time.Minute), now.Add(2*time.Minute), s.cfg.MaxOutputBatchSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(redelivered) != 3 {
+		t.Fatalf("expected 3 redelivered messages, got %d", len(redelivered))
+	}
+}
+
+func TestAcknowledge(t *testing.T) {
+	s := newTestStorage(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	if _, err := s.Store(ctx, []*message.Message{message.NewMessage(message.WithID("a"))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.claim(now, now, s.cfg.MaxOutputBatchSize); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Acknowledge(ctx, []string{"a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, _ := s.Count(ctx); n != 0 {
+		t.Fatalf("expected no messages, got %d", n)
+	}
+
+	claimed, err := s.claim(now.Add(2*time.Minute), now.Add(2*time.Minute), s.cfg.MaxOutputBatchSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed) != 0 {
+		t.Fatalf("expected acknowledged message not to be redelivered, got %d", len(claimed))
+	}
+}
+
+func TestRecoveryAfterReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "orbital.db")
+	ctx := context.Background()
+	now := time.Now()
+
+	s := NewBoltStorage()
+	if err := s.initState(newTestConfig(path)); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := []*message.Message{
+		message.NewMessage(message.WithID("inflight")),
+		message.NewMessage(message.WithID("pending"), message.WithScheduledAt(now.Add(time.Hour))),
+	}
+	if _, err := s.Store(ctx, msgs); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.claim(now, now, s.cfg.MaxOutputBatchSize); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := NewBoltStorage()
+	if err := reopened.initState(newTestConfig(path)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { reopened.Close() })
+
+	if n, _ := reopened.Count(ctx); n != 2 {
+		t.Fatalf("expected 2 messages after reopen, got %d", n)
+	}
+
+	// Неподтверждённое сообщение выпускается повторно после VisibilityTimeout.
+	claimed, err := reopened.claim(now.Add(2*time.Minute), now.Add(2*time.Minute), reopened.cfg.MaxOutputBatchSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed) != 1 || claimed[0].ID != "inflight" {
+		t.Fatalf("expected in-flight message to be redelivered, got %v", claimed)
+	}
+}
+
+func TestClaimUntilHorizon(t *testing.T) {
+	s := newTestStorage(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	msgs := []*message.Message{
+		message.NewMessage(message.WithID("soon"), message.WithScheduledAt(now.Add(time.Minute))),
+		message.NewMessage(message.WithID("later"), message.WithScheduledAt(now.Add(time.Hour))),
+	}
+	if _, err := s.Store(ctx, msgs); err != nil {
+		t.Fatal(err)
+	}
+
+	horizon := now.Add(5 * time.Minute)
+
+	claimed, err := s.claim(now, horizon, s.cfg.MaxOutputBatchSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed) != 1 || claimed[0].ID != "soon" {
+		t.Fatalf("expected message before horizon to be claimed, got %v", claimed)
+	}
+
+	// Выпущенное сообщение не забирается повторно до истечения VisibilityTimeout,
+	// даже если срок видимости раньше horizon.
+	again, err := s.claim(now, horizon, s.cfg.MaxOutputBatchSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again) != 0 {
+		t.Fatalf("expected no messages, got %d", len(again))
+	}
+}
+
+// recordingRehome запоминает сообщения, переданные gateway.
+type recordingRehome struct {
+	ids      []string
+	evacuate bool
+}
+
+func (r *recordingRehome) Rehome(_ string, msgs []*message.Message) error {
+	for _, msg := range msgs {
+		r.ids = append(r.ids, msg.ID)
+	}
+	return nil
+}
+
+func (r *recordingRehome) Evacuate(storageID string, msgs []*message.Message) error {
+	r.evacuate = true
+	return r.Rehome(storageID, msgs)
+}
+
+func TestRehome(t *testing.T) {
+	s := newTestStorage(t)
+	sent := &recordingRehome{}
+	s.rehomeVia = sent
+	ctx := context.Background()
+	now := time.Now()
+
+	msgs := []*message.Message{
+		message.NewMessage(message.WithID("due"), message.WithScheduledAt(now.Add(-time.Minute))),
+		message.NewMessage(message.WithID("too-soon"), message.WithScheduledAt(now.Add(time.Minute))),
+		message.NewMessage(message.WithID("claimed"), message.WithScheduledAt(now.Add(30*time.Second))),
+		message.NewMessage(message.WithID("fits"), message.WithScheduledAt(now.Add(time.Hour))),
+	}
+	// Больше MaxOutputBatchSize, чтобы просмотр прошёл несколько страниц.
+	far := make([]string, 0, 12)
+	for i := range 12 {
+		id := fmt.Sprintf("too-far-%02d", i)
+		msgs = append(msgs, message.NewMessage(message.WithID(id), message.WithScheduledAt(now.Add(48*time.Hour))))
+		far = append(far, id)
+	}
+	if _, err := s.Store(ctx, msgs); err != nil {
+		t.Fatal(err)
+	}
+	// Выпущенные сообщения не передаются.
+	if _, err := s.claim(now, now.Add(45*time.Second), s.cfg.MaxOutputBatchSize); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := s.Rehome(ctx, storage.RehomeQuery{MinDelay: 5 * time.Minute, MaxDelay: 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append([]string{"too-soon"}, far...)
+	if result.Resubmitted != len(want) || sent.evacuate || !slices.Equal(sent.ids, want) {
+		t.Fatalf("unexpected rehome %+v: %v", result, sent.ids)
+	}
+
+	// Эвакуация передаёт все ожидающие сообщения, сообщения остаются до подтверждения gateway.
+	sent.ids = nil
+	result, err = s.Rehome(ctx, storage.RehomeQuery{All: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = append([]string{"too-soon", "fits"}, far...)
+	if result.Resubmitted != len(want) || !sent.evacuate || !slices.Equal(sent.ids, want) {
+		t.Fatalf("unexpected evacuation %+v: %v", result, sent.ids)
+	}
+	if n, _ := s.Count(ctx); n != int64(len(msgs)) {
+		t.Fatalf("expected rehomed messages to stay until acknowledged, got %d", n)
+	}
+}
@@ -0,0 +1,14 @@
+// Package httpapi provides HTTP API shared by the Orbital storage services.
+//
+//	@title			Orbital Storage API
+//	@version		1.0
+//	@description	API для взаимодействия с хранилищами сообщений Orbital (in-memory, Redis).
+//
+//	@BasePath	/api/v1
+//
+//	@tag.name			Health
+//	@tag.description	Проверка состояния хранилища
+//
+//	@tag.name			Messages
+//	@tag.description	Операции с сообщениями
+package httpapi
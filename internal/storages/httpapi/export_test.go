@@ -0,0 +1,159 @@
+package httpapi
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	inmemory "github.com/Alexey-zaliznuak/orbital/internal/storages/in_memory"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+	storagesdk "github.com/Alexey-zaliznuak/orbital/pkg/sdk/storage"
+)
+
+// newTestServer запускает HTTP API поверх in-memory хранилища без подключения к кластеру.
+func newTestServer(t *testing.T) (*inmemory.InMemoryStorage, *storagesdk.Client, string) {
+	t.Helper()
+
+	store, err := inmemory.NewStandalone(context.Background(), inmemory.NewBuilder().
+		WithShards(4).
+		WithVisibilityTimeout(time.Minute).
+		Build())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(NewServer(store, ServerConfig{}).Router())
+	t.Cleanup(srv.Close)
+
+	return store, storagesdk.NewClient(storagesdk.ClientConfig{BaseURL: srv.URL}), srv.URL
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	src, srcClient, _ := newTestServer(t)
+	dst, dstClient, _ := newTestServer(t)
+
+	// Больше одной пачки экспорта.
+	const total = exportFlushSize + 500
+	base := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+
+	msgs := make([]*message.Message, total)
+	for i := range msgs {
+		msgs[i] = message.NewMessage(
+			message.WithID(fmt.Sprintf("m-%04d", i)),
+			message.WithRoutingKey("orders.created"),
+			message.WithPayload([]byte(fmt.Sprintf("payload-%d", i))),
+			message.WithMetadataValue("n", fmt.Sprint(i)),
+			message.WithScheduledAt(base.Add(time.Duration(i)*time.Second)),
+		)
+	}
+	failed := message.NewMessage(message.WithID("failed"), message.WithScheduledAt(time.Now().Add(-time.Second)))
+
+	if _, err := src.Store(ctx, append(msgs, failed)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := src.FetchReady(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.Reject(ctx, "failed", false); err != nil {
+		t.Fatal(err)
+	}
+
+	var dump bytes.Buffer
+	if err := srcClient.Export(ctx, &dump, storage.ListFilter{}); err != nil {
+		t.Fatal(err)
+	}
+
+	dump.WriteString("{not json}\n")
+
+	result, err := dstClient.Import(ctx, &dump)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Imported != total || result.Failed != 1 || len(result.Errors) != 1 || result.Errors[0].Line != total+1 {
+		t.Fatalf("unexpected import result %+v", result)
+	}
+
+	for _, want := range msgs {
+		got, err := dst.GetByID(ctx, want.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Equal(want) {
+			t.Fatalf("imported message differs: %+v, want %+v", got, want)
+		}
+	}
+	if _, err := dst.GetByID(ctx, "failed"); err == nil {
+		t.Fatal("expected failed message not to be exported")
+	}
+}
+
+func TestImportGzip(t *testing.T) {
+	ctx := context.Background()
+	dst, _, baseURL := newTestServer(t)
+
+	var body bytes.Buffer
+	gz := gzip.NewWriter(&body)
+	fmt.Fprintln(gz, `{"id":"a","routing_key":"rk","scheduled_at":"2030-01-01T00:00:00Z"}`)
+	fmt.Fprintln(gz, `{"id":"b","routing_key":"rk","scheduled_at":"2030-01-02T00:00:00Z"}`)
+	gz.Close()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/api/v1/messages/import", &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Encoding", "gzip")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %d", resp.StatusCode)
+	}
+
+	got, err := dst.GetByID(ctx, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC); !got.ScheduledAt.Equal(want) {
+		t.Fatalf("expected ScheduledAt %v, got %v", want, got.ScheduledAt)
+	}
+}
+
+// slowStore сохраняет сообщения с задержкой.
+type slowStore struct {
+	storage.MessageStorage
+	delay time.Duration
+}
+
+func (s *slowStore) Store(ctx context.Context, msgs []*message.Message) ([]storage.StoreResult, error) {
+	time.Sleep(s.delay)
+	return s.MessageStorage.Store(ctx, msgs)
+}
+
+func TestImportOutlivesWriteTimeout(t *testing.T) {
+	ctx := context.Background()
+	store, _, _ := newTestServer(t)
+
+	srv := httptest.NewUnstartedServer(NewServer(&slowStore{MessageStorage: store, delay: 300 * time.Millisecond}, ServerConfig{}).Router())
+	srv.Config.WriteTimeout = 100 * time.Millisecond
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	client := storagesdk.NewClient(storagesdk.ClientConfig{BaseURL: srv.URL})
+	result, err := client.Import(ctx, bytes.NewBufferString(`{"id":"a","routing_key":"rk","scheduled_at":"2030-01-01T00:00:00Z"}`+"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Imported != 1 {
+		t.Fatalf("unexpected import result %+v", result)
+	}
+}
@@ -0,0 +1,728 @@
+package httpapi
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+	"github.com/Alexey-zaliznuak/orbital/pkg/logger"
+	"github.com/Alexey-zaliznuak/orbital/pkg/ndjson"
+	storageapi "github.com/Alexey-zaliznuak/orbital/pkg/sdk/storage/api"
+)
+
+// defaultFetchLimit — число сообщений, выдаваемых без явного limit.
+const defaultFetchLimit = 100
+
+// maxHistogramScan — сколько сообщений читает гистограмма через FetchExpiring.
+const maxHistogramScan = 100_000
+
+// Размеры пачки, после которой экспорт сбрасывает поток клиенту, и пачки импорта.
+const (
+	exportFlushSize = 1000
+	importBatchSize = 500
+)
+
+// healthCheck godoc
+//
+//	@Summary		Health check
+//	@Description	Проверка работоспособности хранилища
+//	@Tags			Health
+//	@Produce		json
+//	@Success		200	{object}	map[string]string
+//	@Failure		500	{object}	storageapi.ErrorResponse
+//	@Router			/health [get]
+func (s *Server) healthCheck(w http.ResponseWriter, r *http.Request) {
+	health, err := s.storage.HealthCheck(r.Context())
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.writeJSON(w, http.StatusOK, map[string]string{"status": string(health)})
+}
+
+// store godoc
+//
+//	@Summary		Сохранить сообщение
+//	@Description	Сохраняет новое сообщение в хранилище
+//	@Tags			Messages
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		storageapi.StoreMessageRequest	true	"Данные сообщения"
+//	@Success		201		{object}	storageapi.MessageResponse
+//	@Failure		400		{object}	storageapi.ErrorResponse
+//	@Failure		409		{object}	storageapi.ErrorResponse	"Сообщение уже существует"
+//	@Failure		500		{object}	storageapi.ErrorResponse
+//	@Failure		503		{object}	storageapi.ErrorResponse	"Инстанс выводится из кластера"
+//	@Failure		507		{object}	storageapi.ErrorResponse	"Хранилище заполнено"
+//	@Router			/messages [post]
+func (s *Server) store(w http.ResponseWriter, r *http.Request) {
+	var req storageapi.StoreMessageRequest
+	if err := s.decodeJSON(r, &req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	msg := req.ToMessage()
+	results, err := s.storage.Store(r.Context(), []*message.Message{msg})
+	if err != nil {
+		s.writeStorageError(w, err)
+		return
+	}
+
+	if err := results[0].Err; err != nil {
+		if errors.Is(err, storage.ErrAlreadyExists) {
+			s.writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		if errors.Is(err, storage.ErrCapacityExceeded) {
+			s.writeError(w, http.StatusInsufficientStorage, err.Error())
+			return
+		}
+
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.writeJSON(w, http.StatusCreated, storageapi.MessageResponseFromMessage(msg))
+}
+
+// get godoc
+//
+//	@Summary		Получить сообщение по ID
+//	@Description	Возвращает сообщение из хранилища по его идентификатору вместе с состоянием и числом попыток
+//	@Tags			Messages
+//	@Produce		json
+//	@Param			id	path		string	true	"Идентификатор сообщения"
+//	@Success		200	{object}	storageapi.StoredMessageResponse
+//	@Failure		404	{object}	storageapi.ErrorResponse	"Сообщение не найдено"
+//	@Failure		503	{object}	storageapi.ErrorResponse	"Хранилище не инициализировано"
+//	@Failure		500	{object}	storageapi.ErrorResponse
+//	@Router			/messages/{id} [get]
+func (s *Server) get(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	msg, err := s.storage.Get(r.Context(), id)
+	if err != nil {
+		s.writeStorageError(w, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, storageapi.StoredMessageResponseFromStored(msg))
+}
+
+// list godoc
+//
+//	@Summary		Список сообщений
+//	@Description	Возвращает страницу сообщений в порядке (scheduled_at, id) с фильтрами. Для следующей страницы передайте next_cursor в параметре cursor
+//	@Tags			Messages
+//	@Produce		json
+//	@Param			routing_key_prefix	query		string		false	"Префикс routing key"
+//	@Param			metadata			query		[]string	false	"Пары key=value, которые должны быть в metadata"	collectionFormat(multi)
+//	@Param			scheduled_from		query		string		false	"Начало интервала scheduled_at включительно (RFC3339)"
+//	@Param			scheduled_to		query		string		false	"Конец интервала scheduled_at не включительно (RFC3339)"
+//	@Param			status				query		string		false	"Состояние сообщения"	Enums(pending, in_flight, failed)
+//	@Param			cursor				query		string		false	"Курсор страницы"
+//	@Param			limit				query		int			false	"Размер страницы"	default(100)
+//	@Success		200					{object}	storageapi.ListMessagesResponse
+//	@Failure		400					{object}	storageapi.ErrorResponse
+//	@Failure		501					{object}	storageapi.ErrorResponse	"Хранилище не поддерживает перечисление"
+//	@Failure		503					{object}	storageapi.ErrorResponse	"Хранилище не инициализировано"
+//	@Failure		500					{object}	storageapi.ErrorResponse
+//	@Router			/messages [get]
+func (s *Server) list(w http.ResponseWriter, r *http.Request) {
+	lister, ok := s.storage.(storage.MessageLister)
+	if !ok {
+		s.writeError(w, http.StatusNotImplemented, storage.ErrNotSupported.Error())
+		return
+	}
+
+	query, err := parseListQuery(r)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	page, err := lister.List(r.Context(), query)
+	if err != nil {
+		s.writeStorageError(w, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, storageapi.ListMessagesResponseFromPage(page))
+}
+
+// fetchReady godoc
+//
+//	@Summary		Выдать готовые сообщения
+//	@Description	Выдаёт до limit наступивших сообщений и переводит их в in_flight. Не подтверждённые за VisibilityTimeout сообщения выдаются повторно
+//	@Tags			Messages
+//	@Produce		json
+//	@Param			limit	query		int	false	"Максимальное число сообщений"	default(100)
+//	@Success		200		{object}	storageapi.FetchMessagesResponse
+//	@Failure		400		{object}	storageapi.ErrorResponse
+//	@Failure		501		{object}	storageapi.ErrorResponse	"Хранилище не выдаёт сообщения"
+//	@Failure		503		{object}	storageapi.ErrorResponse	"Хранилище не инициализировано"
+//	@Failure		500		{object}	storageapi.ErrorResponse
+//	@Router			/messages/ready [get]
+func (s *Server) fetchReady(w http.ResponseWriter, r *http.Request) {
+	limit, err := parseLimit(r)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	msgs, err := s.storage.FetchReady(r.Context(), limit)
+	if err != nil {
+		s.writeStorageError(w, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, storageapi.FetchMessagesResponseFromStored(msgs))
+}
+
+// fetchExpiring godoc
+//
+//	@Summary		Истекающие сообщения
+//	@Description	Возвращает до limit ожидающих сообщений, которые наступят в пределах threshold. Состояние сообщений не меняется
+//	@Tags			Messages
+//	@Produce		json
+//	@Param			threshold	query		string	true	"Горизонт в формате Go duration"	example(30s)
+//	@Param			limit		query		int		false	"Максимальное число сообщений"	default(100)
+//	@Success		200			{object}	storageapi.FetchMessagesResponse
+//	@Failure		400			{object}	storageapi.ErrorResponse
+//	@Failure		503			{object}	storageapi.ErrorResponse	"Хранилище не инициализировано"
+//	@Failure		500			{object}	storageapi.ErrorResponse
+//	@Router			/messages/expiring [get]
+func (s *Server) fetchExpiring(w http.ResponseWriter, r *http.Request) {
+	threshold, err := time.ParseDuration(r.URL.Query().Get("threshold"))
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid threshold")
+		return
+	}
+
+	limit, err := parseLimit(r)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	msgs, err := s.storage.FetchExpiring(r.Context(), threshold, limit)
+	if err != nil {
+		s.writeStorageError(w, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, storageapi.FetchMessagesResponseFromStored(msgs))
+}
+
+// export godoc
+//
+//	@Summary		Экспорт сообщений
+//	@Description	Передаёт сообщения потоком NDJSON (по сообщению на строку) в порядке (scheduled_at, id) с сохранением ID и scheduled_at. Без status выгружаются все сообщения, кроме failed. При Accept-Encoding: gzip поток сжимается. Сообщения выгружаются за один проход по хранилищу. Ошибка посреди потока обрывает соединение
+//	@Tags			Messages
+//	@Produce		application/x-ndjson
+//	@Param			routing_key_prefix	query		string		false	"Префикс routing key"
+//	@Param			metadata			query		[]string	false	"Пары key=value, которые должны быть в metadata"	collectionFormat(multi)
+//	@Param			scheduled_from		query		string		false	"Начало интервала scheduled_at включительно (RFC3339)"
+//	@Param			scheduled_to		query		string		false	"Конец интервала scheduled_at не включительно (RFC3339)"
+//	@Param			status				query		string		false	"Состояние сообщения"	Enums(pending, in_flight, failed)
+//	@Success		200					{string}	string		"Поток NDJSON"
+//	@Failure		400					{object}	storageapi.ErrorResponse
+//	@Failure		501					{object}	storageapi.ErrorResponse	"Хранилище не поддерживает выгрузку"
+//	@Failure		503					{object}	storageapi.ErrorResponse	"Хранилище не инициализировано"
+//	@Failure		500					{object}	storageapi.ErrorResponse
+//	@Router			/messages/export [get]
+func (s *Server) export(w http.ResponseWriter, r *http.Request) {
+	exporter, ok := s.storage.(storage.MessageExporter)
+	if !ok {
+		s.writeError(w, http.StatusNotImplemented, storage.ErrNotSupported.Error())
+		return
+	}
+
+	filter, err := parseListFilter(r)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	skipFailed := filter.Status == ""
+
+	rc := http.NewResponseController(w)
+	var (
+		enc     *ndjson.Encoder
+		gz      *gzip.Writer
+		pending int
+	)
+	// Заголовки отправляются с первым сообщением, чтобы ошибка хранилища
+	// до начала выгрузки вернулась обычным ответом.
+	start := func() {
+		// Поток не ограничен по времени: соединение закрывается клиентом или по ошибке.
+		rc.SetWriteDeadline(time.Time{})
+
+		w.Header().Set("Content-Type", ndjson.ContentType)
+		var out io.Writer = w
+		if ndjson.AcceptsGzip(r) {
+			w.Header().Set("Content-Encoding", "gzip")
+			gz = gzip.NewWriter(w)
+			out = gz
+		}
+		w.WriteHeader(http.StatusOK)
+		enc = ndjson.NewEncoder(out)
+	}
+	flush := func() {
+		if gz != nil {
+			gz.Flush()
+		}
+		rc.Flush()
+		pending = 0
+	}
+
+	err = exporter.Export(r.Context(), filter, func(m *storage.StoredMessage) error {
+		if skipFailed && m.Status == storage.MessageStatusFailed {
+			return nil
+		}
+		if enc == nil {
+			start()
+		}
+		if err := enc.Encode(m.Message); err != nil {
+			return err
+		}
+		if pending++; pending == exportFlushSize {
+			flush()
+		}
+		return nil
+	})
+	if err != nil {
+		if enc == nil {
+			s.writeStorageError(w, err)
+			return
+		}
+		// Заголовки уже отправлены: обрываем соединение, чтобы клиент
+		// не принял неполный поток за полный.
+		logger.Log.Error("Export interrupted", zap.Error(err))
+		panic(http.ErrAbortHandler)
+	}
+
+	if enc == nil {
+		start()
+	}
+	if gz != nil {
+		gz.Close()
+	}
+}
+
+// importMessages godoc
+//
+//	@Summary		Импорт сообщений
+//	@Description	Сохраняет в хранилище сообщения из потока NDJSON (формат экспорта) с сохранением ID и scheduled_at, без выбора хранилища по задержке. Тело может быть сжато gzip (Content-Encoding: gzip). Строки, которые не удалось разобрать или сохранить, не прерывают импорт и перечисляются в ответе
+//	@Tags			Messages
+//	@Accept			application/x-ndjson
+//	@Produce		json
+//	@Param			request	body		string	true	"Поток NDJSON"
+//	@Success		200		{object}	ndjson.ImportResult
+//	@Failure		400		{object}	storageapi.ErrorResponse	"Поток не удалось прочитать; в ответе итог по обработанным строкам"
+//	@Failure		503		{object}	storageapi.ErrorResponse	"Хранилище не инициализировано"
+//	@Failure		500		{object}	storageapi.ErrorResponse
+//	@Router			/messages/import [post]
+func (s *Server) importMessages(w http.ResponseWriter, r *http.Request) {
+	// Импорт не ограничен по времени: WriteTimeout сервера отсчитывается от заголовков
+	// запроса, и без снятия дедлайна итог долгого импорта не дошёл бы до клиента.
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Time{})
+	rc.SetWriteDeadline(time.Time{})
+
+	body, err := ndjson.RequestBody(r)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer body.Close()
+
+	var storeErr error
+	result, err := ndjson.Import(body, importBatchSize, func(msgs []*message.Message) ([]storage.StoreResult, error) {
+		results, err := s.storage.Store(r.Context(), msgs)
+		storeErr = err
+		return results, err
+	})
+	switch {
+	case err == nil:
+		s.writeJSON(w, http.StatusOK, result)
+	case storeErr != nil:
+		s.writeStorageError(w, fmt.Errorf("imported %d messages: %w", result.Imported, storeErr))
+	default:
+		s.writeError(w, http.StatusBadRequest, fmt.Sprintf("imported %d messages: %v", result.Imported, err))
+	}
+}
+
+// histogram godoc
+//
+//	@Summary		Гистограмма ожидающих сообщений
+//	@Description	Число ожидающих сообщений по интервалам scheduled_at на горизонте прогноза, с разбивкой по префиксу routing key. Просроченные сообщения входят в первый интервал. Хранилища без встроенной гистограммы строят её по не более чем 100000 ближайших сообщений и отмечают усечённый ответ truncated
+//	@Tags			Messages
+//	@Produce		json
+//	@Param			bucket		query		string	false	"Ширина интервала"	default(15m)
+//	@Param			horizon		query		string	false	"Горизонт прогноза"	default(24h)
+//	@Param			group_depth	query		int		false	"Число сегментов routing key для группировки, 0 — без группировки"
+//	@Param			from		query		string	false	"Начало первого интервала (RFC3339), по умолчанию текущее время, округлённое до bucket"
+//	@Success		200			{object}	storageapi.HistogramResponse
+//	@Failure		400			{object}	storageapi.ErrorResponse
+//	@Failure		501			{object}	storageapi.ErrorResponse	"Хранилище не поддерживает выборку ожидающих сообщений"
+//	@Failure		503			{object}	storageapi.ErrorResponse	"Хранилище не инициализировано"
+//	@Failure		500			{object}	storageapi.ErrorResponse
+//	@Router			/messages/histogram [get]
+func (s *Server) histogram(w http.ResponseWriter, r *http.Request) {
+	query, err := storageapi.ParseHistogramQuery(r.URL.Query())
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var h *storage.Histogram
+	if provider, ok := s.storage.(storage.HistogramProvider); ok {
+		h, err = provider.ScheduledHistogram(r.Context(), query)
+	} else {
+		h, err = s.histogramFromExpiring(r, query)
+	}
+	if err != nil {
+		s.writeStorageError(w, err)
+		return
+	}
+	h.Shared = s.sharedState
+
+	s.writeJSON(w, http.StatusOK, storageapi.HistogramResponseFromHistogram(h))
+}
+
+// histogramFromExpiring строит гистограмму по FetchExpiring для хранилищ
+// без HistogramProvider, учитывая не более maxHistogramScan сообщений.
+func (s *Server) histogramFromExpiring(r *http.Request, query storage.HistogramQuery) (*storage.Histogram, error) {
+	now := time.Now()
+	h := storage.NewHistogram(query, now)
+
+	threshold := h.From.Add(query.Horizon).Sub(now)
+	if threshold <= 0 {
+		return h, nil
+	}
+
+	msgs, err := s.storage.FetchExpiring(r.Context(), threshold, maxHistogramScan+1)
+	if err != nil {
+		return nil, err
+	}
+	if len(msgs) > maxHistogramScan {
+		msgs = msgs[:maxHistogramScan]
+		h.Truncated = true
+	}
+
+	for _, m := range msgs {
+		h.Add(m.ScheduledAt, m.RoutingKey)
+	}
+
+	return h, nil
+}
+
+// acknowledge godoc
+//
+//	@Summary		Подтвердить обработку
+//	@Description	Удаляет обработанные сообщения. Неизвестные ID пропускаются
+//	@Tags			Messages
+//	@Accept			json
+//	@Param			request	body	storageapi.AcknowledgeRequest	true	"Идентификаторы сообщений"
+//	@Success		204
+//	@Failure		400	{object}	storageapi.ErrorResponse
+//	@Failure		503	{object}	storageapi.ErrorResponse	"Хранилище не инициализировано"
+//	@Failure		500	{object}	storageapi.ErrorResponse
+//	@Router			/messages/acknowledge [post]
+func (s *Server) acknowledge(w http.ResponseWriter, r *http.Request) {
+	var req storageapi.AcknowledgeRequest
+	if err := s.decodeJSON(r, &req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if err := s.storage.Acknowledge(r.Context(), req.IDs); err != nil {
+		s.writeStorageError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// reject godoc
+//
+//	@Summary		Отклонить сообщение
+//	@Description	Возвращает выданное сообщение в ожидание с исходным ScheduledAt (requeue) или переводит его в failed
+//	@Tags			Messages
+//	@Accept			json
+//	@Param			id		path	string					true	"Идентификатор сообщения"
+//	@Param			request	body	storageapi.RejectRequest	true	"Параметры отклонения"
+//	@Success		204
+//	@Failure		400	{object}	storageapi.ErrorResponse
+//	@Failure		404	{object}	storageapi.ErrorResponse	"Сообщение не найдено"
+//	@Failure		409	{object}	storageapi.ErrorResponse	"Сообщение не выдано"
+//	@Failure		501	{object}	storageapi.ErrorResponse	"Хранилище не выдаёт сообщения"
+//	@Failure		503	{object}	storageapi.ErrorResponse	"Хранилище не инициализировано"
+//	@Failure		500	{object}	storageapi.ErrorResponse
+//	@Router			/messages/{id}/reject [post]
+func (s *Server) reject(w http.ResponseWriter, r *http.Request) {
+	var req storageapi.RejectRequest
+	if err := s.decodeJSON(r, &req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if err := s.storage.Reject(r.Context(), chi.URLParam(r, "id"), req.Requeue); err != nil {
+		s.writeStorageError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// delete godoc
+//
+//	@Summary		Удалить сообщение
+//	@Description	Удаляет сообщение в любом состоянии
+//	@Tags			Messages
+//	@Param			id	path	string	true	"Идентификатор сообщения"
+//	@Success		204
+//	@Failure		404	{object}	storageapi.ErrorResponse	"Сообщение не найдено"
+//	@Failure		503	{object}	storageapi.ErrorResponse	"Хранилище не инициализировано"
+//	@Failure		500	{object}	storageapi.ErrorResponse
+//	@Router			/messages/{id} [delete]
+func (s *Server) delete(w http.ResponseWriter, r *http.Request) {
+	if err := s.storage.Delete(r.Context(), chi.URLParam(r, "id")); err != nil {
+		s.writeStorageError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// count godoc
+//
+//	@Summary		Количество сообщений
+//	@Description	Возвращает общее количество сообщений в хранилище
+//	@Tags			Messages
+//	@Produce		json
+//	@Success		200	{object}	storageapi.CountResponse
+//	@Failure		500	{object}	storageapi.ErrorResponse
+//	@Router			/messages/count [get]
+func (s *Server) count(w http.ResponseWriter, r *http.Request) {
+	n, err := s.storage.Count(r.Context())
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.writeJSON(w, http.StatusOK, storageapi.CountResponse{Count: n})
+}
+
+// rehome godoc
+//
+//	@Summary		Передать сообщения вне диапазона gateway
+//	@Description	Передаёт gateway ожидающие сообщения, оставшаяся задержка которых не подходит под диапазон [min_delay, max_delay) (с all — все ожидающие), чтобы он заново выбрал для них хранилище. Сообщения удаляются из хранилища, когда gateway подтвердит их передачу в другое хранилище. Инстанс с собственными данными при all перестаёт принимать сообщения из шины, и gateway может передать его сообщения другим инстансам того же хранилища. Вызывается перебалансировкой координатора
+//	@Tags			Messages
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		storageapi.RehomeRequest	true	"Диапазон задержек хранилища"
+//	@Success		200		{object}	storageapi.RehomeResponse
+//	@Failure		400		{object}	storageapi.ErrorResponse
+//	@Failure		501		{object}	storageapi.ErrorResponse	"Хранилище не поддерживает передачу сообщений"
+//	@Failure		503		{object}	storageapi.ErrorResponse	"Хранилище не инициализировано или выводится из кластера"
+//	@Failure		500		{object}	storageapi.ErrorResponse
+//	@Router			/messages/rehome [post]
+func (s *Server) rehome(w http.ResponseWriter, r *http.Request) {
+	rehomer, ok := s.storage.(storage.Rehomer)
+	if !ok {
+		s.writeError(w, http.StatusNotImplemented, storage.ErrNotSupported.Error())
+		return
+	}
+
+	var req storageapi.RehomeRequest
+	if err := s.decodeJSON(r, &req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	query, err := req.ToQuery()
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result, err := rehomer.Rehome(r.Context(), query)
+	if err != nil {
+		s.writeStorageError(w, err)
+		return
+	}
+	result.Shared = s.sharedState
+
+	s.writeJSON(w, http.StatusOK, storageapi.RehomeResponseFromResult(result))
+}
+
+// startDrain godoc
+//
+//	@Summary		Вывести инстанс из кластера
+//	@Description	Запускает вывод инстанса: он перестаёт принимать сообщения, удаляет свой адрес из координатора и передаёт сообщения другим инстансам. Возвращает ход вывода, не дожидаясь его завершения; повторный вызов возвращает ход уже начатого вывода, а после неудачного — запускает его снова
+//	@Tags			Drain
+//	@Produce		json
+//	@Success		202	{object}	storageapi.DrainStatusResponse
+//	@Failure		503	{object}	storageapi.ErrorResponse	"Хранилище не инициализировано"
+//	@Failure		501	{object}	storageapi.ErrorResponse	"Хранилище не поддерживает вывод"
+//	@Router			/drain [post]
+func (s *Server) startDrain(w http.ResponseWriter, r *http.Request) {
+	drainer, ok := s.storage.(storage.Drainer)
+	if !ok {
+		s.writeError(w, http.StatusNotImplemented, storage.ErrNotSupported.Error())
+		return
+	}
+
+	// Вывод не прерывается отменой ctx: запускаем его и сразу прекращаем ожидание.
+	ctx, cancel := context.WithCancel(r.Context())
+	cancel()
+	if err := drainer.Drain(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		s.writeStorageError(w, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusAccepted, storageapi.DrainStatusResponseFromStatus(drainer.DrainStatus()))
+}
+
+// drainStatus godoc
+//
+//	@Summary		Ход вывода инстанса
+//	@Description	Возвращает стадию вывода инстанса из кластера и число оставшихся и переданных сообщений
+//	@Tags			Drain
+//	@Produce		json
+//	@Success		200	{object}	storageapi.DrainStatusResponse
+//	@Failure		501	{object}	storageapi.ErrorResponse	"Хранилище не поддерживает вывод"
+//	@Router			/drain [get]
+func (s *Server) drainStatus(w http.ResponseWriter, r *http.Request) {
+	drainer, ok := s.storage.(storage.Drainer)
+	if !ok {
+		s.writeError(w, http.StatusNotImplemented, storage.ErrNotSupported.Error())
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, storageapi.DrainStatusResponseFromStatus(drainer.DrainStatus()))
+}
+
+// === Helpers ===
+
+func (s *Server) writeJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+func (s *Server) writeError(w http.ResponseWriter, status int, msg string) {
+	s.writeJSON(w, status, storageapi.ErrorResponse{Error: msg})
+}
+
+// writeStorageError отображает ошибку MessageStorage в код ответа.
+func (s *Server) writeStorageError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		s.writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, storage.ErrNotInFlight):
+		s.writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, storage.ErrInvalidCursor):
+		s.writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, storage.ErrNotSupported):
+		s.writeError(w, http.StatusNotImplemented, err.Error())
+	case errors.Is(err, storage.ErrNotInitialized), errors.Is(err, storage.ErrDraining):
+		s.writeError(w, http.StatusServiceUnavailable, err.Error())
+	default:
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// parseLimit читает параметр limit; без него возвращает defaultFetchLimit.
+func parseLimit(r *http.Request) (int, error) {
+	raw := r.URL.Query().Get("limit")
+	if raw == "" {
+		return defaultFetchLimit, nil
+	}
+
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit <= 0 {
+		return 0, errors.New("invalid limit")
+	}
+
+	return limit, nil
+}
+
+// parseListQuery читает фильтры, курсор и размер страницы списка сообщений.
+func parseListQuery(r *http.Request) (storage.ListQuery, error) {
+	limit, err := parseLimit(r)
+	if err != nil {
+		return storage.ListQuery{}, err
+	}
+
+	filter, err := parseListFilter(r)
+	if err != nil {
+		return storage.ListQuery{}, err
+	}
+
+	return storage.ListQuery{
+		Filter: filter,
+		Cursor: r.URL.Query().Get("cursor"),
+		Limit:  limit,
+	}, nil
+}
+
+// parseListFilter читает фильтры списка и экспорта сообщений.
+func parseListFilter(r *http.Request) (storage.ListFilter, error) {
+	values := r.URL.Query()
+
+	filter := storage.ListFilter{
+		RoutingKeyPrefix: values.Get("routing_key_prefix"),
+		Status:           storage.MessageStatus(values.Get("status")),
+	}
+
+	switch filter.Status {
+	case "", storage.MessageStatusPending, storage.MessageStatusInFlight, storage.MessageStatusFailed:
+	default:
+		return storage.ListFilter{}, errors.New("invalid status")
+	}
+
+	for _, pair := range values["metadata"] {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return storage.ListFilter{}, errors.New("invalid metadata filter, expected key=value")
+		}
+		if filter.Metadata == nil {
+			filter.Metadata = make(map[string]string)
+		}
+		filter.Metadata[key] = value
+	}
+
+	for param, target := range map[string]*time.Time{
+		"scheduled_from": &filter.ScheduledFrom,
+		"scheduled_to":   &filter.ScheduledTo,
+	} {
+		raw := values.Get(param)
+		if raw == "" {
+			continue
+		}
+		var err error
+		if *target, err = time.Parse(time.RFC3339Nano, raw); err != nil {
+			return storage.ListFilter{}, fmt.Errorf("invalid %s", param)
+		}
+	}
+
+	return filter, nil
+}
+
+func (s *Server) decodeJSON(r *http.Request, v any) error {
+	return json.NewDecoder(r.Body).Decode(v)
+}
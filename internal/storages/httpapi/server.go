@@ -1,4 +1,4 @@
-package inmemory
+package httpapi
 
 import (
 	"context"
@@ -12,12 +12,13 @@ import (
 	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
 )
 
-// Server представляет HTTP-сервер in-memory хранилища.
+// Server представляет HTTP-сервер хранилища.
 // Предоставляет REST API для взаимодействия с MessageStorage.
 type Server struct {
-	storage storage.MessageStorage
-	router  *chi.Mux
-	server  *http.Server
+	storage     storage.MessageStorage
+	sharedState bool
+	router      *chi.Mux
+	server      *http.Server
 }
 
 // ServerConfig содержит конфигурацию HTTP-сервера хранилища.
@@ -29,12 +30,17 @@ type ServerConfig struct {
 
 	// WriteTimeout — максимальное время записи ответа.
 	WriteTimeout time.Duration
+
+	// SharedState — инстансы хранилища работают с общими данными (Redis, PostgreSQL, S3),
+	// а не каждый со своими. Координатор не суммирует их гистограммы.
+	SharedState bool
 }
 
-// NewServer создаёт новый HTTP-сервер для in-memory хранилища.
+// NewServer создаёт новый HTTP-сервер для хранилища.
 func NewServer(store storage.MessageStorage, cfg ServerConfig) *Server {
 	s := &Server{
-		storage: store,
+		storage:     store,
+		sharedState: cfg.SharedState,
 	}
 
 	s.router = s.setupRouter()
@@ -56,7 +62,6 @@ func (s *Server) setupRouter() *chi.Mux {
 	r.Use(middleware.RealIP)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
-	r.Use(middleware.Timeout(30 * time.Second))
 
 	// Swagger UI
 	r.Get("/swagger/*", httpSwagger.Handler(
@@ -64,12 +69,31 @@ func (s *Server) setupRouter() *chi.Mux {
 	))
 
 	r.Route("/api/v1", func(r chi.Router) {
-		r.Get("/health", s.healthCheck)
-
-		r.Route("/messages", func(r chi.Router) {
-			r.Post("/", s.store)
-			r.Get("/count", s.count)
-			r.Get("/{id}", s.getByID)
+		// Экспорт и импорт передают потоки произвольной длины и не ограничены по времени.
+		r.Get("/messages/export", s.export)
+		r.Post("/messages/import", s.importMessages)
+
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.Timeout(30 * time.Second))
+
+			r.Get("/health", s.healthCheck)
+
+			r.Post("/drain", s.startDrain)
+			r.Get("/drain", s.drainStatus)
+
+			r.Route("/messages", func(r chi.Router) {
+				r.Post("/", s.store)
+				r.Get("/", s.list)
+				r.Get("/count", s.count)
+				r.Get("/ready", s.fetchReady)
+				r.Get("/expiring", s.fetchExpiring)
+				r.Get("/histogram", s.histogram)
+				r.Post("/acknowledge", s.acknowledge)
+				r.Post("/rehome", s.rehome)
+				r.Get("/{id}", s.get)
+				r.Delete("/{id}", s.delete)
+				r.Post("/{id}/reject", s.reject)
+			})
 		})
 	})
 
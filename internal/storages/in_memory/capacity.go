@@ -0,0 +1,140 @@
+package inmemory
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/node"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+	"github.com/Alexey-zaliznuak/orbital/pkg/logger"
+	"go.uber.org/zap"
+)
+
+var ErrCapacityExceeded = storage.ErrCapacityExceeded
+
+// spillSender отправляет не поместившиеся сообщения в резервное хранилище. Реализуется bus.Client.
+type spillSender interface {
+	SendToStorage(storageID string, msgs []*message.Message) error
+}
+
+// usage — занятая ёмкость хранилища: число сообщений и суммарный размер payload.
+// Store резервирует место под сообщения до сохранения, поэтому параллельные пачки
+// не превышают лимиты в сумме; после сохранения резерв заменяется фактическим размером.
+type usage struct {
+	messages atomic.Int64
+	bytes    atomic.Int64
+}
+
+func (u *usage) add(messages, bytes int64) {
+	u.messages.Add(messages)
+	u.bytes.Add(bytes)
+}
+
+// reserve занимает место под сообщение размером bytes, если оно укладывается в лимиты
+// (0 — без ограничения).
+func (u *usage) reserve(bytes, maxMessages, maxBytes int64) bool {
+	messages := u.messages.Add(1)
+	total := u.bytes.Add(bytes)
+
+	if (maxMessages > 0 && messages > maxMessages) || (maxBytes > 0 && total > maxBytes) {
+		u.add(-1, -bytes)
+		return false
+	}
+
+	return true
+}
+
+// admit резервирует место под сообщения пачки и возвращает индексы принятых и не
+// поместившихся сообщений, а также размер резерва, который вызывающий освобождает
+// после сохранения. Сообщения с уже занятым ID принимаются без резерва: их обработает
+// проверка дубликатов.
+func (s *InMemoryStorage) admit(msgs []*message.Message) (admitted, overflow []int, reserved, reservedBytes int64) {
+	if s.cfg.MaxMessages <= 0 && s.cfg.MaxPayloadBytes <= 0 {
+		admitted = make([]int, len(msgs))
+		for i := range msgs {
+			admitted[i] = i
+		}
+		return admitted, nil, 0, 0
+	}
+
+	admitted = make([]int, 0, len(msgs))
+	for i, msg := range msgs {
+		size := int64(len(msg.Payload))
+		if s.used.reserve(size, s.cfg.MaxMessages, s.cfg.MaxPayloadBytes) {
+			admitted = append(admitted, i)
+			reserved++
+			reservedBytes += size
+			continue
+		}
+
+		if s.shards[shardIndex(msg.ID, len(s.shards))].has(msg.ID) {
+			admitted = append(admitted, i)
+			continue
+		}
+
+		overflow = append(overflow, i)
+	}
+
+	return admitted, overflow, reserved, reservedBytes
+}
+
+// spill отправляет не поместившиеся сообщения в SpillStorageID, а без него или при
+// ошибке отправки отмечает их результаты ErrCapacityExceeded.
+func (s *InMemoryStorage) spill(msgs []*message.Message, overflow []int, results []storage.StoreResult) {
+	spilled := make([]*message.Message, len(overflow))
+	for j, i := range overflow {
+		spilled[j] = msgs[i]
+		results[i].ID = msgs[i].ID
+	}
+
+	if s.cfg.SpillStorageID != "" && s.spillTo != nil {
+		err := s.spillTo.SendToStorage(s.cfg.SpillStorageID, spilled)
+		if err == nil {
+			logger.Log.Warn("Storage is full, messages spilled",
+				zap.String("to", s.cfg.SpillStorageID), zap.Int("count", len(spilled)))
+			return
+		}
+		logger.Log.Error("Failed to spill messages", zap.String("to", s.cfg.SpillStorageID), zap.Error(err))
+	}
+
+	for _, i := range overflow {
+		results[i].Err = fmt.Errorf("%w: %s", ErrCapacityExceeded, msgs[i].ID)
+	}
+}
+
+// Status возвращает Degraded, если занятая ёмкость достигла доли SoftLimitRatio
+// любого из лимитов, иначе Active. SoftLimitRatio вне (0, 1] означает, что мягкий
+// лимит совпадает с жёстким.
+func (s *InMemoryStorage) Status() node.NodeStatus {
+	if s.overSoftLimit(s.used.messages.Load(), s.cfg.MaxMessages) ||
+		s.overSoftLimit(s.used.bytes.Load(), s.cfg.MaxPayloadBytes) {
+		return node.NodeStatusDegraded
+	}
+	return node.NodeStatusActive
+}
+
+// Report возвращает состояние инстанса для heartbeat: статус по мягкому лимиту,
+// лимит MaxMessages и нагрузку, дополненную размером payload и числом сообщений
+// в полёте.
+func (s *InMemoryStorage) Report(ctx context.Context) storage.Heartbeat {
+	var load storage.Load
+	if s.meter != nil {
+		load = s.meter.Measure(ctx)
+	}
+	load.Bytes = s.used.bytes.Load()
+	for _, sh := range s.shards {
+		load.InFlight += int64(sh.inFlight())
+	}
+
+	return storage.Heartbeat{Status: s.Status(), Capacity: s.cfg.MaxMessages, Load: load}
+}
+
+func (s *InMemoryStorage) overSoftLimit(used, limit int64) bool {
+	ratio := s.cfg.SoftLimitRatio
+	if ratio <= 0 || ratio > 1 {
+		ratio = 1
+	}
+	return limit > 0 && float64(used) >= ratio*float64(limit)
+}
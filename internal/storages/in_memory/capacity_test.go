@@ -0,0 +1,210 @@
+package inmemory
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/internal/storages/pipeline"
+	"github.com/Alexey-zaliznuak/orbital/pkg/clock"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/node"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+)
+
+// recordingSpill запоминает сообщения, отправленные в резервное хранилище.
+type recordingSpill struct {
+	to   string
+	msgs []*message.Message
+	err  error
+}
+
+func (r *recordingSpill) SendToStorage(storageID string, msgs []*message.Message) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.to = storageID
+	r.msgs = append(r.msgs, msgs...)
+	return nil
+}
+
+func newCapacityStorage(cfg *InMemoryStorageConfig) *InMemoryStorage {
+	s := NewInMemoryStorage()
+	s.initState(cfg)
+	return s
+}
+
+func testMessages(n int, payload string) []*message.Message {
+	msgs := make([]*message.Message, n)
+	for i := range msgs {
+		msgs[i] = message.NewMessage(
+			message.WithID("m-"+strconv.Itoa(i)),
+			message.WithPayload([]byte(payload)),
+		)
+	}
+	return msgs
+}
+
+func TestStoreRejectsOverMessageLimit(t *testing.T) {
+	s := newCapacityStorage(NewBuilder().WithShards(2).WithCapacity(3, 0).WithSoftLimitRatio(0.5).Build())
+	ctx := context.Background()
+
+	if s.Status() != node.NodeStatusActive {
+		t.Fatal("empty storage must be active")
+	}
+
+	msgs := testMessages(5, "x")
+	results, err := s.Store(ctx, msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, result := range results {
+		full := errors.Is(result.Err, storage.ErrCapacityExceeded)
+		if full != (i >= 3) {
+			t.Fatalf("message %d: unexpected result %+v", i, result)
+		}
+		if result.ID != msgs[i].ID {
+			t.Fatalf("message %d: expected ID %s, got %s", i, msgs[i].ID, result.ID)
+		}
+	}
+
+	if n, _ := s.Count(ctx); n != 3 {
+		t.Fatalf("expected 3 messages, got %d", n)
+	}
+	if s.Status() != node.NodeStatusDegraded {
+		t.Fatal("full storage must be degraded")
+	}
+	if health, _ := s.HealthCheck(ctx); health != storage.StorageHealthDegraded {
+		t.Fatalf("expected degraded health, got %s", health)
+	}
+
+	// Повторная доставка сохранённого сообщения остаётся дубликатом, а не ошибкой ёмкости.
+	results, err = s.Store(ctx, msgs[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !results[0].Duplicate {
+		t.Fatalf("expected duplicate, got %+v", results[0])
+	}
+
+	if err := s.Cancel(ctx, []string{msgs[0].ID, msgs[1].ID}); err != nil {
+		t.Fatal(err)
+	}
+	if s.Status() != node.NodeStatusActive {
+		t.Fatal("storage must become active after removal")
+	}
+
+	results, err = s.Store(ctx, msgs[3:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range results {
+		if result.Err != nil {
+			t.Fatalf("unexpected result after removal %+v", result)
+		}
+	}
+}
+
+func TestStoreRejectsOverPayloadLimit(t *testing.T) {
+	s := newCapacityStorage(NewBuilder().WithCapacity(0, 10).Build())
+
+	results, err := s.Store(context.Background(), testMessages(3, "abcd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if results[0].Err != nil || results[1].Err != nil {
+		t.Fatalf("expected first two messages to fit, got %+v", results)
+	}
+	if !errors.Is(results[2].Err, storage.ErrCapacityExceeded) {
+		t.Fatalf("expected ErrCapacityExceeded, got %+v", results[2])
+	}
+	if got := s.used.bytes.Load(); got != 8 {
+		t.Fatalf("expected 8 used bytes, got %d", got)
+	}
+}
+
+func TestStoreSpillsOverLimit(t *testing.T) {
+	s := newCapacityStorage(NewBuilder().WithCapacity(2, 0).WithSpillStorageID("cold-l1").Build())
+	spill := &recordingSpill{}
+	s.spillTo = spill
+
+	results, err := s.Store(context.Background(), testMessages(3, "x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, result := range results {
+		if result.Err != nil {
+			t.Fatalf("unexpected result %+v", result)
+		}
+	}
+	if spill.to != "cold-l1" || len(spill.msgs) != 1 || spill.msgs[0].ID != "m-2" {
+		t.Fatalf("expected m-2 to be spilled to cold-l1, got %s %v", spill.to, spill.msgs)
+	}
+
+	spill.err = errors.New("bus unavailable")
+	results, err = s.Store(context.Background(), []*message.Message{message.NewMessage(message.WithID("m-3"))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(results[0].Err, storage.ErrCapacityExceeded) {
+		t.Fatalf("expected ErrCapacityExceeded on spill failure, got %+v", results[0])
+	}
+}
+
+func TestUsageRestoredFromDump(t *testing.T) {
+	cfg := NewBuilder().WithCapacity(10, 0).WithDumpFile(t.TempDir() + "/dump.bin").Build()
+	s := newCapacityStorage(cfg)
+	ctx := context.Background()
+
+	if _, err := s.Store(ctx, testMessages(4, "abc")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Dump(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := newCapacityStorage(cfg)
+	if err := restored.LoadFromDump(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := restored.used.messages.Load(); got != 4 {
+		t.Fatalf("expected 4 used messages, got %d", got)
+	}
+	if got := restored.used.bytes.Load(); got != 12 {
+		t.Fatalf("expected 12 used bytes, got %d", got)
+	}
+}
+
+func TestReportLoad(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(now)
+	s := newCapacityStorage(NewBuilder().WithCapacity(10, 0).WithClock(clk).Build())
+	s.meter = pipeline.NewLoadMeter(s, nil, clk)
+	ctx := context.Background()
+
+	msgs := testMessages(3, "abcd")
+	for _, msg := range msgs {
+		msg.ScheduledAt = now
+	}
+	if _, err := s.Store(ctx, msgs); err != nil {
+		t.Fatal(err)
+	}
+	if ready, err := s.FetchReady(ctx, 1); err != nil || len(ready) != 1 {
+		t.Fatalf("expected 1 ready message, got %d (%v)", len(ready), err)
+	}
+
+	// Оставшиеся наступившие сообщения не выпущены уже 2 секунды.
+	clk.Advance(2 * time.Second)
+
+	hb := s.Report(ctx)
+	want := storage.Load{Measured: true, Pending: 3, Bytes: 12, InFlight: 1, ReleaseLag: 2 * time.Second}
+	if hb.Status != node.NodeStatusActive || hb.Capacity != 10 || hb.Load != want {
+		t.Fatalf("unexpected report %+v", hb)
+	}
+}
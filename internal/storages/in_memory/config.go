@@ -3,6 +3,7 @@ package inmemory
 import (
 	"time"
 
+	"github.com/Alexey-zaliznuak/orbital/pkg/clock"
 	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
 	"github.com/caarlos0/env/v11"
 )
@@ -10,8 +11,47 @@ import (
 type InMemoryStorageConfig struct {
 	storage.BaseStorageConfig
 
-	UseDump  bool   `env:"USE_DUMP" envDefault:"true"`
-	DumpFile string `env:"DUMP_FILE" envDefault:"./dump.json"`
+	UseDump bool `env:"USE_DUMP" envDefault:"true"`
+	// DumpFile — путь к бинарному снимку (см. snapshot.go). JSON-дамп прежних версий
+	// по этому пути тоже читается и перезаписывается снимком.
+	DumpFile string `env:"DUMP_FILE" envDefault:"./dump.snap"`
+	// DumpInterval период фонового снимка при выключенном WAL (0 — только при остановке).
+	DumpInterval time.Duration `env:"DUMP_INTERVAL" envDefault:"1m"`
+	// UseWAL включает журнал операций: Store, подтверждения и отмены пишутся в WAL_DIR
+	// до применения и проигрываются при старте поверх снимка DUMP_FILE.
+	// Раз в WAL_CHECKPOINT_INTERVAL состояние сохраняется в DUMP_FILE, а журнал усекается.
+	// Сообщение из шины подтверждается сразу после записи в журнал, поэтому только при
+	// WAL_FSYNC=always подтверждённое сообщение переживает падение узла. При interval
+	// теряются сообщения, подтверждённые за последний WAL_FSYNC_INTERVAL, при never —
+	// всё, что ОС не успела сбросить на диск.
+	UseWAL                bool          `env:"USE_WAL" envDefault:"true"`
+	WALDir                string        `env:"WAL_DIR" envDefault:"./wal"`
+	WALFsync              string        `env:"WAL_FSYNC" envDefault:"always"` // always | interval | never
+	WALFsyncInterval      time.Duration `env:"WAL_FSYNC_INTERVAL" envDefault:"100ms"`
+	WALSegmentSize        int64         `env:"WAL_SEGMENT_SIZE" envDefault:"67108864"`
+	WALCheckpointInterval time.Duration `env:"WAL_CHECKPOINT_INTERVAL" envDefault:"1m"`
+
+	// Shards количество независимых частей хранилища (0 — по числу GOMAXPROCS).
+	Shards int `env:"SHARDS" envDefault:"0"`
+
+	// Лимиты ёмкости (0 — без ограничения): число сообщений и суммарный размер payload в байтах.
+	// При достижении доли SoftLimitRatio любого лимита хранилище сообщает координатору статус
+	// Degraded, и gateway направляет ему сообщения, только если других подходящих хранилищ нет.
+	// Сообщения сверх лимита отправляются в хранилище SpillStorageID, а без него отклоняются
+	// с ErrCapacityExceeded и доставляются повторно через NakDelay.
+	MaxMessages     int64   `env:"MAX_MESSAGES" envDefault:"0"`
+	MaxPayloadBytes int64   `env:"MAX_PAYLOAD_BYTES" envDefault:"0"`
+	SoftLimitRatio  float64 `env:"SOFT_LIMIT_RATIO" envDefault:"0.8"`
+	SpillStorageID  string  `env:"SPILL_STORAGE_ID" envDefault:""`
+
+	// Вывод инстанса из кластера (drain): по SIGTERM, если DrainOnShutdown, или через
+	// POST /api/v1/drain инстанс перестаёт принимать сообщения, удаляет свой адрес
+	// из координатора и публикует ожидающие сообщения в orbital.storage.{DrainStorageID}
+	// (по умолчанию — собственный ID, где их заберут другие инстансы). Выпущенные
+	// в gateway сообщения ждут подтверждения не дольше DrainTimeout и тоже публикуются.
+	DrainOnShutdown bool          `env:"DRAIN_ON_SHUTDOWN" envDefault:"true"`
+	DrainStorageID  string        `env:"DRAIN_STORAGE_ID" envDefault:""`
+	DrainTimeout    time.Duration `env:"DRAIN_TIMEOUT" envDefault:"30s"`
 }
 
 type InMemoryStorageConfigBuilder struct {
@@ -69,11 +109,84 @@ func (b *InMemoryStorageConfigBuilder) WithDumpFile(path string) *InMemoryStorag
 	return b
 }
 
+func (b *InMemoryStorageConfigBuilder) WithDumpInterval(d time.Duration) *InMemoryStorageConfigBuilder {
+	b.cfg.DumpInterval = d
+	return b
+}
+
 func (b *InMemoryStorageConfigBuilder) WithMaxOutputBatchSize(size int) *InMemoryStorageConfigBuilder {
 	b.cfg.MaxOutputBatchSize = size
 	return b
 }
 
+// WithWAL включает журнал операций в каталоге dir.
+func (b *InMemoryStorageConfigBuilder) WithWAL(dir string) *InMemoryStorageConfigBuilder {
+	b.cfg.UseWAL = true
+	b.cfg.WALDir = dir
+	return b
+}
+
+func (b *InMemoryStorageConfigBuilder) WithWALFsync(policy string, interval time.Duration) *InMemoryStorageConfigBuilder {
+	b.cfg.WALFsync = policy
+	b.cfg.WALFsyncInterval = interval
+	return b
+}
+
+func (b *InMemoryStorageConfigBuilder) WithWALSegmentSize(size int64) *InMemoryStorageConfigBuilder {
+	b.cfg.WALSegmentSize = size
+	return b
+}
+
+func (b *InMemoryStorageConfigBuilder) WithWALCheckpointInterval(d time.Duration) *InMemoryStorageConfigBuilder {
+	b.cfg.WALCheckpointInterval = d
+	return b
+}
+
+func (b *InMemoryStorageConfigBuilder) WithShards(n int) *InMemoryStorageConfigBuilder {
+	b.cfg.Shards = n
+	return b
+}
+
+// WithCapacity задаёт лимиты числа сообщений и суммарного размера payload (0 — без ограничения).
+func (b *InMemoryStorageConfigBuilder) WithCapacity(maxMessages, maxPayloadBytes int64) *InMemoryStorageConfigBuilder {
+	b.cfg.MaxMessages = maxMessages
+	b.cfg.MaxPayloadBytes = maxPayloadBytes
+	return b
+}
+
+func (b *InMemoryStorageConfigBuilder) WithSoftLimitRatio(ratio float64) *InMemoryStorageConfigBuilder {
+	b.cfg.SoftLimitRatio = ratio
+	return b
+}
+
+func (b *InMemoryStorageConfigBuilder) WithSpillStorageID(id string) *InMemoryStorageConfigBuilder {
+	b.cfg.SpillStorageID = id
+	return b
+}
+
+// WithDrain задаёт хранилище, которому передаются сообщения при выводе инстанса
+// (пустое — собственный ID), и время ожидания подтверждений выпущенных сообщений.
+func (b *InMemoryStorageConfigBuilder) WithDrain(storageID string, timeout time.Duration) *InMemoryStorageConfigBuilder {
+	b.cfg.DrainStorageID = storageID
+	b.cfg.DrainTimeout = timeout
+	return b
+}
+
+func (b *InMemoryStorageConfigBuilder) WithNakDelay(d time.Duration) *InMemoryStorageConfigBuilder {
+	b.cfg.NakDelay = d
+	return b
+}
+
+func (b *InMemoryStorageConfigBuilder) WithVisibilityTimeout(d time.Duration) *InMemoryStorageConfigBuilder {
+	b.cfg.VisibilityTimeout = d
+	return b
+}
+
+func (b *InMemoryStorageConfigBuilder) WithClock(c clock.Clock) *InMemoryStorageConfigBuilder {
+	b.cfg.Clock = c
+	return b
+}
+
 func (b *InMemoryStorageConfigBuilder) FromEnv() *InMemoryStorageConfigBuilder {
 	env.Parse(b.cfg)
 	return b
@@ -0,0 +1,46 @@
+package inmemory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Alexey-zaliznuak/orbital/internal/storages/storagetest"
+	"github.com/Alexey-zaliznuak/orbital/pkg/clock"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T, clk clock.Clock) *storagetest.Instance {
+		dir := t.TempDir()
+		cfg := NewBuilder().
+			WithShards(4).
+			WithVisibilityTimeout(storagetest.VisibilityTimeout).
+			WithDumpFile(dir+"/dump.bin").
+			WithWAL(dir+"/wal").
+			WithWALFsync(WALFsyncAlways, 0).
+			WithWALSegmentSize(1 << 20).
+			WithClock(clk).
+			Build()
+
+		open := func(t *testing.T) *InMemoryStorage {
+			s := NewInMemoryStorage()
+			s.initState(cfg)
+			if err := s.restore(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { s.wal.close() })
+			return s
+		}
+
+		s := open(t)
+
+		return &storagetest.Instance{
+			Storage: s,
+			// Без финального снимка: состояние восстанавливается только из WAL.
+			Reopen: func(t *testing.T) storage.MessageStorage {
+				s.wal.close()
+				return open(t)
+			},
+		}
+	})
+}
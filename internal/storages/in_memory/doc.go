@@ -1,14 +0,0 @@
-// Package inmemory provides HTTP API for the In-Memory Storage service.
-//
-//	@title			Orbital In-Memory Storage API
-//	@version		1.0
-//	@description	API для взаимодействия с in-memory хранилищем сообщений Orbital.
-//
-//	@BasePath	/api/v1
-//
-//	@tag.name			Health
-//	@tag.description	Проверка состояния хранилища
-//
-//	@tag.name			Messages
-//	@tag.description	Операции с сообщениями
-package inmemory
@@ -0,0 +1,318 @@
+package inmemory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/internal/storages/pipeline"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+	"github.com/Alexey-zaliznuak/orbital/pkg/logger"
+	"github.com/Alexey-zaliznuak/orbital/pkg/sdk/coordinator"
+	"go.uber.org/zap"
+)
+
+// drainPollInterval — как часто вывод проверяет, подтверждены ли выпущенные сообщения.
+const drainPollInterval = 100 * time.Millisecond
+
+// drainState — состояние вывода инстанса из кластера.
+type drainState struct {
+	// active — Store отклоняет новые сообщения.
+	active atomic.Bool
+	// isolate — остановка приёма, heartbeat и release worker'ов, однократная
+	// для всех попыток вывода.
+	isolate sync.Once
+
+	mu sync.Mutex
+	// done закрывается по завершении последней попытки вывода.
+	done   chan struct{}
+	status storage.DrainStatus
+	err    error
+}
+
+// Drain выводит инстанс из кластера: перестаёт принимать сообщения из шины и через
+// Store, удаляет адрес инстанса из координатора и публикует ожидающие сообщения
+// в orbital.storage.{DrainStorageID}. Выпущенные сообщения ждут подтверждения
+// не дольше DrainTimeout, после чего тоже публикуются: получатель может увидеть
+// их повторно. Отклонённые (failed) сообщения остаются в инстансе и его снимке.
+// Вызов во время вывода ждёт его завершения, после неудачного вывода — повторяет
+// передачу оставшихся сообщений. Отмена ctx прекращает ожидание, но не сам вывод.
+func (s *InMemoryStorage) Drain(ctx context.Context) error {
+	if err := s.checkReady(); err != nil {
+		return err
+	}
+
+	s.drain.mu.Lock()
+	if s.drain.done == nil || s.drain.status.State == storage.DrainStateFailed {
+		s.drain.done = make(chan struct{})
+		s.startDrainLocked()
+		go s.runDrain(s.drain.done)
+	}
+	done := s.drain.done
+	s.drain.mu.Unlock()
+
+	select {
+	case <-done:
+		s.drain.mu.Lock()
+		defer s.drain.mu.Unlock()
+		return s.drain.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// DrainStatus возвращает ход вывода инстанса. Pending и InFlight считаются
+// по текущему состоянию хранилища.
+func (s *InMemoryStorage) DrainStatus() storage.DrainStatus {
+	s.drain.mu.Lock()
+	status := s.drain.status
+	s.drain.mu.Unlock()
+
+	if status.State == "" {
+		status.State = storage.DrainStateIdle
+	}
+	if s.checkReady() == nil {
+		for _, sh := range s.shards {
+			pending, inFlight := sh.drainCounts()
+			status.Pending += pending
+			status.InFlight += inFlight
+		}
+	}
+
+	return status
+}
+
+// startDrainLocked отмечает начало попытки вывода до запуска runDrain, чтобы DrainStatus
+// сразу после Drain не возвращал DrainStateIdle или результат прошлой попытки.
+// Вызывающий удерживает drain.mu.
+func (s *InMemoryStorage) startDrainLocked() {
+	target := s.cfg.DrainStorageID
+	if target == "" {
+		target = s.cfg.ID
+	}
+
+	status := &s.drain.status
+	if status.StartedAt.IsZero() {
+		status.StartedAt = s.clock.Now()
+	}
+	status.State = storage.DrainStateDraining
+	status.Target = target
+	status.Error = ""
+	status.FinishedAt = time.Time{}
+	s.drain.err = nil
+
+	logger.Log.Info("Draining storage instance", zap.String("target", target))
+}
+
+func (s *InMemoryStorage) runDrain(done chan struct{}) {
+	defer close(done)
+
+	s.drain.mu.Lock()
+	target := s.drain.status.Target
+	s.drain.mu.Unlock()
+
+	err := s.handOffAll(target)
+
+	s.drain.mu.Lock()
+	s.drain.err = err
+	s.drain.status.FinishedAt = s.clock.Now()
+	if err != nil {
+		s.drain.status.State = storage.DrainStateFailed
+		s.drain.status.Error = err.Error()
+	} else {
+		s.drain.status.State = storage.DrainStateDone
+	}
+	republished := s.drain.status.Republished
+	s.drain.mu.Unlock()
+
+	if err != nil {
+		logger.Log.Error("Failed to drain storage instance", zap.Error(err))
+		return
+	}
+	logger.Log.Info("Storage instance drained", zap.Int("republished", republished))
+}
+
+// handOffAll останавливает приём и выпуск сообщений и передаёт их хранилищу target.
+func (s *InMemoryStorage) handOffAll(target string) error {
+	if s.spillTo == nil {
+		return pipeline.ErrNoBus
+	}
+
+	s.drain.isolate.Do(s.isolate)
+
+	if err := s.handOff(target, false); err != nil {
+		return err
+	}
+
+	s.awaitAcks(s.cfg.DrainTimeout)
+
+	if err := s.handOff(target, true); err != nil {
+		return err
+	}
+
+	if s.subscriptions != nil {
+		if err := s.subscriptions.Close(); err != nil {
+			logger.Log.Warn("Failed to unsubscribe from acks", zap.Error(err))
+		}
+	}
+
+	return nil
+}
+
+// isolate останавливает приём и выпуск сообщений и выводит инстанс из координатора.
+func (s *InMemoryStorage) isolate() {
+	s.drain.active.Store(true)
+	s.stopIntake()
+	s.leaveCluster()
+
+	// Release worker'ы останавливаются, чтобы не выпускать передаваемые сообщения повторно.
+	if s.stopWorkers != nil {
+		s.stopWorkers()
+		s.workers.Wait()
+	}
+}
+
+// stopIntake прекращает приём новых и продвинутых сообщений из шины; следующие
+// достаются другим инстансам хранилища.
+func (s *InMemoryStorage) stopIntake() {
+	s.intakeOnce.Do(func() {
+		if s.subscriptions == nil {
+			return
+		}
+		if err := s.subscriptions.StopIntake(); err != nil {
+			logger.Log.Warn("Failed to stop bus intake", zap.Error(err))
+		}
+	})
+}
+
+// leaveCluster останавливает heartbeat и удаляет адрес инстанса из координатора,
+// чтобы gateway и другие сервисы перестали к нему обращаться.
+func (s *InMemoryStorage) leaveCluster() {
+	if s.stopHeartbeat != nil {
+		s.stopHeartbeat()
+		<-s.heartbeatDone
+	}
+
+	if s.unregister == nil || s.cfg.Address == "" {
+		return
+	}
+
+	err := s.unregister(context.Background(), s.cfg.ID, s.cfg.Address)
+	if err != nil && !errors.Is(err, coordinator.ErrStorageNotRegistered) {
+		logger.Log.Warn("Failed to unregister storage address", zap.Error(err))
+	}
+}
+
+// handOff публикует сообщения в orbital.storage.{target} пачками по MaxOutputBatchSize
+// и удаляет их из инстанса. С includeSent передаются и выпущенные сообщения.
+func (s *InMemoryStorage) handOff(target string, includeSent bool) error {
+	limit := max(s.cfg.MaxOutputBatchSize, 1)
+
+	for _, sh := range s.shards {
+		for {
+			msgs := sh.handOffBatch(includeSent, limit)
+			if len(msgs) == 0 {
+				break
+			}
+
+			if err := s.spillTo.SendToStorage(target, msgs); err != nil {
+				return fmt.Errorf("failed to hand off messages to %s: %w", target, err)
+			}
+
+			ids := make([]string, len(msgs))
+			for i, msg := range msgs {
+				ids[i] = msg.ID
+			}
+			if err := s.Cancel(context.Background(), ids); err != nil {
+				return fmt.Errorf("failed to remove handed off messages: %w", err)
+			}
+
+			s.updateDrain(func(status *storage.DrainStatus) {
+				status.Republished += len(msgs)
+			})
+		}
+	}
+
+	return nil
+}
+
+// awaitAcks ждёт подтверждения выпущенных сообщений не дольше timeout.
+func (s *InMemoryStorage) awaitAcks(timeout time.Duration) {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if s.DrainStatus().InFlight == 0 {
+			return
+		}
+
+		select {
+		case <-deadline.C:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *InMemoryStorage) updateDrain(update func(status *storage.DrainStatus)) {
+	s.drain.mu.Lock()
+	defer s.drain.mu.Unlock()
+	update(&s.drain.status)
+}
+
+// drainCounts возвращает число ожидающих и выпущенных, но не подтверждённых сообщений.
+func (sh *shard) drainCounts() (pending, inFlight int) {
+	sh.messagesMu.RLock()
+	defer sh.messagesMu.RUnlock()
+
+	sh.inflightMu.RLock()
+	defer sh.inflightMu.RUnlock()
+
+	for id := range sh.messages {
+		switch sh.status(id) {
+		case storage.MessageStatusPending:
+			pending++
+		case storage.MessageStatusInFlight:
+			inFlight++
+		}
+	}
+
+	return pending, inFlight
+}
+
+// handOffBatch возвращает до limit ожидающих сообщений, а с includeSent — и выпущенных.
+// Отклонённые сообщения не передаются.
+func (sh *shard) handOffBatch(includeSent bool, limit int) []*message.Message {
+	sh.messagesMu.RLock()
+	defer sh.messagesMu.RUnlock()
+
+	sh.inflightMu.RLock()
+	defer sh.inflightMu.RUnlock()
+
+	msgs := make([]*message.Message, 0, min(limit, len(sh.messages)))
+	for id, msg := range sh.messages {
+		switch sh.status(id) {
+		case storage.MessageStatusFailed:
+			continue
+		case storage.MessageStatusInFlight:
+			if !includeSent {
+				continue
+			}
+		}
+
+		copied := *msg
+		msgs = append(msgs, &copied)
+		if len(msgs) >= limit {
+			break
+		}
+	}
+
+	return msgs
+}
@@ -0,0 +1,146 @@
+package inmemory
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+)
+
+func TestDrainHandsOffMessages(t *testing.T) {
+	cfg := NewBuilder().
+		WithID("hot").
+		WithAddress("http://hot-1:8080").
+		WithShards(2).
+		WithMaxOutputBatchSize(2).
+		WithDrain("hot-peer", 50*time.Millisecond).
+		Build()
+	s := newCapacityStorage(cfg)
+	spill := &recordingSpill{}
+	s.spillTo = spill
+	ctx := context.Background()
+
+	later := time.Now().Add(time.Hour)
+	msgs := []*message.Message{
+		message.NewMessage(message.WithID("pending-1"), message.WithScheduledAt(later)),
+		message.NewMessage(message.WithID("pending-2"), message.WithScheduledAt(later)),
+		message.NewMessage(message.WithID("pending-3"), message.WithScheduledAt(later)),
+		message.NewMessage(message.WithID("acked")),
+		message.NewMessage(message.WithID("unacked")),
+		message.NewMessage(message.WithID("failed")),
+	}
+	if _, err := s.Store(ctx, msgs); err != nil {
+		t.Fatal(err)
+	}
+	if ready, err := s.FetchReady(ctx, 10); err != nil || len(ready) != 3 {
+		t.Fatalf("expected 3 ready messages, got %d (%v)", len(ready), err)
+	}
+	if err := s.Reject(ctx, "failed", false); err != nil {
+		t.Fatal(err)
+	}
+
+	// Подтверждение приходит, пока инстанс выводится из кластера.
+	var unregistered string
+	s.unregister = func(ctx context.Context, storageID, address string) error {
+		unregistered = storageID + " " + address
+		return s.Acknowledge(ctx, []string{"acked"})
+	}
+
+	if status := s.DrainStatus(); status.State != storage.DrainStateIdle || status.Pending != 3 || status.InFlight != 2 {
+		t.Fatalf("unexpected status before drain %+v", status)
+	}
+
+	if err := s.Drain(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if unregistered != "hot http://hot-1:8080" {
+		t.Fatalf("expected address to be unregistered, got %q", unregistered)
+	}
+
+	ids := make([]string, len(spill.msgs))
+	for i, msg := range spill.msgs {
+		ids[i] = msg.ID
+	}
+	slices.Sort(ids)
+	if spill.to != "hot-peer" || !slices.Equal(ids, []string{"pending-1", "pending-2", "pending-3", "unacked"}) {
+		t.Fatalf("unexpected hand off to %s: %v", spill.to, ids)
+	}
+
+	status := s.DrainStatus()
+	if status.State != storage.DrainStateDone || status.Target != "hot-peer" || status.Republished != 4 ||
+		status.Pending != 0 || status.InFlight != 0 || status.FinishedAt.IsZero() {
+		t.Fatalf("unexpected status after drain %+v", status)
+	}
+
+	// Отклонённое сообщение остаётся в инстансе.
+	if n, _ := s.Count(ctx); n != 1 {
+		t.Fatalf("expected only failed message to stay, got %d", n)
+	}
+
+	if _, err := s.Store(ctx, testMessages(1, "x")); !errors.Is(err, storage.ErrDraining) {
+		t.Fatalf("expected ErrDraining, got %v", err)
+	}
+}
+
+func TestDrainFailureKeepsMessages(t *testing.T) {
+	s := newCapacityStorage(NewBuilder().WithID("hot").WithDrain("", time.Millisecond).Build())
+	s.spillTo = &recordingSpill{err: errors.New("bus unavailable")}
+	ctx := context.Background()
+
+	if _, err := s.Store(ctx, testMessages(2, "x")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Drain(ctx); err == nil {
+		t.Fatal("expected drain to fail")
+	}
+
+	status := s.DrainStatus()
+	if status.State != storage.DrainStateFailed || status.Target != "hot" || status.Error == "" || status.Pending != 2 {
+		t.Fatalf("unexpected status %+v", status)
+	}
+}
+
+func TestDrainRetriesAfterFailure(t *testing.T) {
+	s := newCapacityStorage(NewBuilder().WithID("hot").WithDrain("", time.Millisecond).Build())
+	spill := &recordingSpill{err: errors.New("bus unavailable")}
+	s.spillTo = spill
+	ctx := context.Background()
+
+	if _, err := s.Store(ctx, testMessages(2, "x")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Drain(ctx); err == nil {
+		t.Fatal("expected drain to fail")
+	}
+	first := s.DrainStatus().StartedAt
+
+	// Шина восстановилась: повторный вызов передаёт оставшиеся сообщения.
+	spill.err = nil
+	if err := s.Drain(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	status := s.DrainStatus()
+	if status.State != storage.DrainStateDone || status.Error != "" || status.Republished != 2 ||
+		status.Pending != 0 || !status.StartedAt.Equal(first) {
+		t.Fatalf("unexpected status after retry %+v", status)
+	}
+	if len(spill.msgs) != 2 || spill.to != "hot" {
+		t.Fatalf("unexpected hand off to %s: %d messages", spill.to, len(spill.msgs))
+	}
+
+	// Завершённый вывод не повторяется.
+	if err := s.Drain(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(spill.msgs) != 2 {
+		t.Fatalf("expected no repeated hand off, got %d messages", len(spill.msgs))
+	}
+}
@@ -0,0 +1,73 @@
+package inmemory
+
+import (
+	"container/heap"
+	"context"
+	"slices"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+)
+
+// Export передаёт emit сообщения, удовлетворяющие filter, в порядке (ScheduledAt, ID).
+// Каждый shard копируется один раз до начала выгрузки, поэтому она не видит сообщений,
+// сохранённых или удалённых во время неё; упорядоченные снимки shard'ов сливаются.
+func (s *InMemoryStorage) Export(ctx context.Context, filter storage.ListFilter, emit func(*storage.StoredMessage) error) error {
+	if err := s.checkReady(); err != nil {
+		return err
+	}
+
+	merge := make(shardMerge, 0, len(s.shards))
+	for _, sh := range s.shards {
+		snapshot := sh.matching(&filter)
+		if len(snapshot) == 0 {
+			continue
+		}
+		slices.SortFunc(snapshot, func(a, b *storage.StoredMessage) int { return compareSchedule(a.Message, b.Message) })
+		merge = append(merge, snapshot)
+	}
+	heap.Init(&merge)
+
+	for merge.Len() > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		head := merge[0]
+		if err := emit(head[0]); err != nil {
+			return err
+		}
+
+		if len(head) > 1 {
+			merge[0] = head[1:]
+			heap.Fix(&merge, 0)
+		} else {
+			heap.Pop(&merge)
+		}
+	}
+
+	return nil
+}
+
+// shardMerge — min-heap упорядоченных снимков shard'ов по их первому сообщению.
+type shardMerge [][]*storage.StoredMessage
+
+// === heap.Interface ===
+
+func (m shardMerge) Len() int { return len(m) }
+
+func (m shardMerge) Less(i, j int) bool {
+	return compareSchedule(m[i][0].Message, m[j][0].Message) < 0
+}
+
+func (m shardMerge) Swap(i, j int) { m[i], m[j] = m[j], m[i] }
+
+func (m *shardMerge) Push(x any) { *m = append(*m, x.([]*storage.StoredMessage)) }
+
+func (m *shardMerge) Pop() any {
+	old := *m
+	n := len(old)
+	snapshot := old[n-1]
+	old[n-1] = nil
+	*m = old[:n-1]
+	return snapshot
+}
@@ -0,0 +1,66 @@
+package inmemory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/clock"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+)
+
+func TestScheduledHistogram(t *testing.T) {
+	ctx := context.Background()
+	clk := clock.NewFake(time.Date(2025, 1, 1, 8, 50, 0, 0, time.UTC))
+	s := newCapacityStorage(NewBuilder().WithShards(4).WithVisibilityTimeout(time.Minute).WithClock(clk).Build())
+
+	at := func(hour, minute int) time.Time { return time.Date(2025, 1, 1, hour, minute, 0, 0, time.UTC) }
+	msgs := []*message.Message{
+		message.NewMessage(message.WithID("overdue"), message.WithRoutingKey("billing.charge"), message.WithScheduledAt(at(8, 0))),
+		message.NewMessage(message.WithID("inflight"), message.WithRoutingKey("billing.charge"), message.WithScheduledAt(at(8, 1))),
+		message.NewMessage(message.WithID("blast-1"), message.WithRoutingKey("marketing.email.promo"), message.WithScheduledAt(at(9, 0))),
+		message.NewMessage(message.WithID("blast-2"), message.WithRoutingKey("marketing.push"), message.WithScheduledAt(at(9, 10))),
+		message.NewMessage(message.WithID("later"), message.WithRoutingKey("billing.refund"), message.WithScheduledAt(at(10, 30))),
+		message.NewMessage(message.WithID("beyond"), message.WithRoutingKey("billing.refund"), message.WithScheduledAt(at(20, 0))),
+	}
+	if _, err := s.Store(ctx, msgs); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.FetchReady(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := s.ScheduledHistogram(ctx, storage.HistogramQuery{Bucket: time.Hour, Horizon: 3 * time.Hour, GroupDepth: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !h.From.Equal(at(8, 0)) || len(h.Buckets) != 3 {
+		t.Fatalf("unexpected histogram shape: from %v, %d buckets", h.From, len(h.Buckets))
+	}
+
+	want := []struct {
+		count  int64
+		groups map[string]int64
+	}{
+		{1, map[string]int64{"billing": 1}},
+		{2, map[string]int64{"marketing": 2}},
+		{1, map[string]int64{"billing": 1}},
+	}
+	for i, w := range want {
+		b := h.Buckets[i]
+		if b.Count != w.count || len(b.Groups) != len(w.groups) {
+			t.Fatalf("bucket %d: expected %d %v, got %d %v", i, w.count, w.groups, b.Count, b.Groups)
+		}
+		for group, count := range w.groups {
+			if b.Groups[group] != count {
+				t.Fatalf("bucket %d: expected %v, got %v", i, w.groups, b.Groups)
+			}
+		}
+	}
+
+	if _, err := s.ScheduledHistogram(ctx, storage.HistogramQuery{Bucket: time.Second, Horizon: 24 * time.Hour}); err == nil {
+		t.Fatal("expected error for too many buckets")
+	}
+}
@@ -0,0 +1,233 @@
+package inmemory
+
+import (
+	"container/heap"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+)
+
+// scheduleIndex — min-heap ожидающих сообщений по ScheduledAt (при равенстве — по ID).
+// Позволяет находить наступившие сообщения за O(due * log n) вместо полного обхода.
+//
+// Удаление ленивое: индекс может содержать сообщения, уже удалённые из хранилища,
+// поэтому вызывающий проверяет каждое извлечённое сообщение по основной map.
+type scheduleIndex struct {
+	items []*message.Message
+}
+
+func newScheduleIndex(capacity int) *scheduleIndex {
+	return &scheduleIndex{items: make([]*message.Message, 0, capacity)}
+}
+
+// rebuild заменяет содержимое индекса сообщениями msgs за O(n).
+func (idx *scheduleIndex) rebuild(msgs []*message.Message) {
+	idx.items = msgs
+	heap.Init(idx)
+}
+
+// push добавляет сообщение в индекс.
+func (idx *scheduleIndex) push(msg *message.Message) {
+	heap.Push(idx, msg)
+}
+
+// popReady извлекает из индекса самое раннее сообщение, если оно готово к отправке на момент now.
+func (idx *scheduleIndex) popReady(now time.Time) (*message.Message, bool) {
+	if len(idx.items) == 0 || !isReady(idx.items[0], now) {
+		return nil, false
+	}
+	return heap.Pop(idx).(*message.Message), true
+}
+
+// compactMinStale — сколько устаревших элементов должно накопиться в индексе, прежде чем
+// его стоит перестраивать: иначе перестройка маленького индекса обходится дороже обхода.
+const compactMinStale = 1024
+
+// needsCompaction сообщает, пора ли перестроить индекс из total элементов, из которых
+// live актуальны: устаревших накопилось больше, чем актуальных. Перестройка за O(live)
+// случается не чаще, чем раз в live ленивых удалений, и индекс не растёт больше чем вдвое.
+func needsCompaction(total, live int) bool {
+	stale := total - live
+	return stale >= compactMinStale && stale > live
+}
+
+// compact оставляет в индексе только сообщения, для которых live возвращает true.
+func (idx *scheduleIndex) compact(live func(*message.Message) bool) {
+	idx.rebuild(slices.DeleteFunc(idx.items, func(msg *message.Message) bool { return !live(msg) }))
+}
+
+// compareSchedule упорядочивает сообщения по ScheduledAt, при равенстве — по ID.
+func compareSchedule(a, b *message.Message) int {
+	if c := a.ScheduledAt.Compare(b.ScheduledAt); c != 0 {
+		return c
+	}
+	return strings.Compare(a.ID, b.ID)
+}
+
+// === heap.Interface ===
+
+func (idx *scheduleIndex) Len() int { return len(idx.items) }
+
+func (idx *scheduleIndex) Less(i, j int) bool {
+	return compareSchedule(idx.items[i], idx.items[j]) < 0
+}
+
+func (idx *scheduleIndex) Swap(i, j int) { idx.items[i], idx.items[j] = idx.items[j], idx.items[i] }
+
+func (idx *scheduleIndex) Push(x any) { idx.items = append(idx.items, x.(*message.Message)) }
+
+func (idx *scheduleIndex) Pop() any {
+	n := len(idx.items)
+	msg := idx.items[n-1]
+	idx.items[n-1] = nil
+	idx.items = idx.items[:n-1]
+	return msg
+}
+
+// visibilityIndex — min-heap inflight-сообщений по времени последней выдачи sentAt,
+// то есть по сроку видимости sentAt + VisibilityTimeout: ещё не выданные (с нулевым
+// sentAt) идут первыми. Позволяет находить сообщения, которые пора выдать, не обходя
+// все inflight-сообщения.
+//
+// Удаление ленивое: при каждой выдаче сообщение добавляется в индекс заново, а прежний
+// элемент устаревает, поэтому вызывающий проверяет элемент через current.
+type visibilityIndex struct {
+	items []visibilityItem
+}
+
+// visibilityItem — inflight-сообщение и время его выдачи на момент добавления в индекс.
+type visibilityItem struct {
+	entry  *inflightEntry
+	sentAt time.Time
+}
+
+func newVisibilityIndex(capacity int) *visibilityIndex {
+	return &visibilityIndex{items: make([]visibilityItem, 0, capacity)}
+}
+
+// rebuild заменяет содержимое индекса сообщениями entries за O(n).
+func (idx *visibilityIndex) rebuild(entries []*inflightEntry) {
+	clear(idx.items)
+	idx.items = idx.items[:0]
+	for _, entry := range entries {
+		idx.items = append(idx.items, visibilityItem{entry: entry, sentAt: entry.sentAt})
+	}
+	heap.Init(idx)
+}
+
+// push добавляет сообщение в индекс с его текущим sentAt.
+func (idx *visibilityIndex) push(entry *inflightEntry) {
+	heap.Push(idx, visibilityItem{entry: entry, sentAt: entry.sentAt})
+}
+
+// popVisible извлекает из индекса элемент с самым ранним сроком видимости, если
+// на момент now он истёк или сообщение ещё не выдавалось.
+func (idx *visibilityIndex) popVisible(now time.Time, visibilityTimeout time.Duration) (visibilityItem, bool) {
+	if len(idx.items) == 0 || !idx.items[0].visible(now, visibilityTimeout) {
+		return visibilityItem{}, false
+	}
+	return heap.Pop(idx).(visibilityItem), true
+}
+
+// eachVisible вызывает fn для всех элементов, срок видимости которых на момент now истёк,
+// не извлекая их: обходит только такие узлы heap'а и их непосредственных потомков.
+func (idx *visibilityIndex) eachVisible(now time.Time, visibilityTimeout time.Duration, fn func(visibilityItem)) {
+	stack := []int{0}
+	for len(stack) > 0 {
+		i := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if i >= len(idx.items) || !idx.items[i].visible(now, visibilityTimeout) {
+			continue
+		}
+		fn(idx.items[i])
+		stack = append(stack, 2*i+1, 2*i+2)
+	}
+}
+
+// visible сообщает, можно ли выдать сообщение элемента на момент now.
+func (it visibilityItem) visible(now time.Time, visibilityTimeout time.Duration) bool {
+	return it.sentAt.IsZero() || now.Sub(it.sentAt) >= visibilityTimeout
+}
+
+// === heap.Interface ===
+
+func (idx *visibilityIndex) Len() int { return len(idx.items) }
+
+func (idx *visibilityIndex) Less(i, j int) bool {
+	if c := idx.items[i].sentAt.Compare(idx.items[j].sentAt); c != 0 {
+		return c < 0
+	}
+	return compareSchedule(idx.items[i].entry.msg, idx.items[j].entry.msg) < 0
+}
+
+func (idx *visibilityIndex) Swap(i, j int) { idx.items[i], idx.items[j] = idx.items[j], idx.items[i] }
+
+func (idx *visibilityIndex) Push(x any) { idx.items = append(idx.items, x.(visibilityItem)) }
+
+func (idx *visibilityIndex) Pop() any {
+	n := len(idx.items)
+	it := idx.items[n-1]
+	idx.items[n-1] = visibilityItem{}
+	idx.items = idx.items[:n-1]
+	return it
+}
+
+// topSchedule хранит не больше limit самых ранних по (ScheduledAt, ID) сообщений:
+// max-heap, в корне которого — самое позднее из отобранных. Отбор страницы List
+// стоит O(n * log limit) вместо сортировки всех подходящих сообщений.
+type topSchedule struct {
+	limit int
+	items []*storage.StoredMessage
+}
+
+func newTopSchedule(limit int) *topSchedule {
+	return &topSchedule{limit: limit, items: make([]*storage.StoredMessage, 0, limit)}
+}
+
+// admits сообщает, попадёт ли msg в отобранные: позволяет не проверять фильтр
+// и не копировать заведомо лишние сообщения.
+func (t *topSchedule) admits(msg *message.Message) bool {
+	return len(t.items) < t.limit || compareSchedule(msg, t.items[0].Message) < 0
+}
+
+// offer добавляет сообщение, вытесняя самое позднее из отобранных при переполнении.
+func (t *topSchedule) offer(stored *storage.StoredMessage) {
+	if !t.admits(stored.Message) {
+		return
+	}
+	if len(t.items) < t.limit {
+		heap.Push(t, stored)
+		return
+	}
+	t.items[0] = stored
+	heap.Fix(t, 0)
+}
+
+// sorted возвращает отобранные сообщения по возрастанию (ScheduledAt, ID).
+func (t *topSchedule) sorted() []*storage.StoredMessage {
+	slices.SortFunc(t.items, func(a, b *storage.StoredMessage) int { return compareSchedule(a.Message, b.Message) })
+	return t.items
+}
+
+// === heap.Interface ===
+
+func (t *topSchedule) Len() int { return len(t.items) }
+
+func (t *topSchedule) Less(i, j int) bool {
+	return compareSchedule(t.items[i].Message, t.items[j].Message) > 0
+}
+
+func (t *topSchedule) Swap(i, j int) { t.items[i], t.items[j] = t.items[j], t.items[i] }
+
+func (t *topSchedule) Push(x any) { t.items = append(t.items, x.(*storage.StoredMessage)) }
+
+func (t *topSchedule) Pop() any {
+	n := len(t.items)
+	stored := t.items[n-1]
+	t.items[n-1] = nil
+	t.items = t.items[:n-1]
+	return stored
+}
@@ -0,0 +1,170 @@
+package inmemory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+)
+
+func TestFetchReadyAndAcknowledge(t *testing.T) {
+	s := newCapacityStorage(NewBuilder().WithShards(4).WithVisibilityTimeout(time.Minute).Build())
+	ctx := context.Background()
+	now := time.Now()
+
+	msgs := []*message.Message{
+		message.NewMessage(message.WithID("b"), message.WithScheduledAt(now.Add(-time.Second))),
+		message.NewMessage(message.WithID("a"), message.WithScheduledAt(now.Add(-2*time.Second))),
+		message.NewMessage(message.WithID("c"), message.WithScheduledAt(now.Add(-time.Millisecond))),
+		message.NewMessage(message.WithID("future"), message.WithScheduledAt(now.Add(time.Hour))),
+	}
+	if _, err := s.Store(ctx, msgs); err != nil {
+		t.Fatal(err)
+	}
+
+	ready, err := s.FetchReady(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ready) != 2 || ready[0].ID != "a" || ready[1].ID != "b" {
+		t.Fatalf("unexpected ready messages %+v", ready)
+	}
+	for _, m := range ready {
+		if m.Status != storage.MessageStatusInFlight || m.Attempts != 1 || m.LastAttemptAt.IsZero() {
+			t.Fatalf("unexpected state of %s: %+v", m.ID, m)
+		}
+	}
+
+	rest, err := s.FetchReady(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rest) != 1 || rest[0].ID != "c" {
+		t.Fatalf("expected only c, got %+v", rest)
+	}
+
+	if err := s.Acknowledge(ctx, []string{"a", "b", "c"}); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := s.Count(ctx); n != 1 {
+		t.Fatalf("expected 1 message, got %d", n)
+	}
+}
+
+func TestFetchExpiring(t *testing.T) {
+	s := newCapacityStorage(NewBuilder().WithVisibilityTimeout(time.Minute).Build())
+	ctx := context.Background()
+	now := time.Now()
+
+	msgs := []*message.Message{
+		message.NewMessage(message.WithID("soon"), message.WithScheduledAt(now.Add(time.Minute))),
+		message.NewMessage(message.WithID("later"), message.WithScheduledAt(now.Add(time.Hour))),
+	}
+	if _, err := s.Store(ctx, msgs); err != nil {
+		t.Fatal(err)
+	}
+
+	expiring, err := s.FetchExpiring(ctx, 5*time.Minute, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expiring) != 1 || expiring[0].ID != "soon" || expiring[0].Status != storage.MessageStatusPending {
+		t.Fatalf("unexpected expiring messages %+v", expiring)
+	}
+
+	stored, err := s.Get(ctx, "soon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != storage.MessageStatusPending || stored.Attempts != 0 {
+		t.Fatalf("FetchExpiring changed message state: %+v", stored)
+	}
+}
+
+func TestReject(t *testing.T) {
+	s := newCapacityStorage(NewBuilder().WithVisibilityTimeout(time.Minute).Build())
+	ctx := context.Background()
+
+	if _, err := s.Store(ctx, []*message.Message{message.NewMessage(message.WithID("a"))}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Reject(ctx, "a", true); !errors.Is(err, storage.ErrNotInFlight) {
+		t.Fatalf("expected ErrNotInFlight, got %v", err)
+	}
+	if err := s.Reject(ctx, "missing", false); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	if _, err := s.FetchReady(ctx, 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Reject(ctx, "a", true); err != nil {
+		t.Fatal(err)
+	}
+
+	ready, err := s.FetchReady(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ready) != 1 || ready[0].Attempts != 2 {
+		t.Fatalf("expected requeued message with 2 attempts, got %+v", ready)
+	}
+
+	if err := s.Reject(ctx, "a", false); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := s.Get(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != storage.MessageStatusFailed {
+		t.Fatalf("expected failed status, got %s", stored.Status)
+	}
+	if again, _ := s.FetchReady(ctx, 10); len(again) != 0 {
+		t.Fatalf("failed message was fetched again: %+v", again)
+	}
+
+	if err := s.Delete(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(ctx, "a"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestFailedStatusRestoredFromDump(t *testing.T) {
+	cfg := NewBuilder().WithVisibilityTimeout(time.Minute).WithDumpFile(t.TempDir() + "/dump.bin").Build()
+	s := newCapacityStorage(cfg)
+	ctx := context.Background()
+
+	if _, err := s.Store(ctx, []*message.Message{message.NewMessage(message.WithID("a"))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.FetchReady(ctx, 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Reject(ctx, "a", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Dump(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := newCapacityStorage(cfg)
+	if err := restored.LoadFromDump(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := restored.Get(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != storage.MessageStatusFailed {
+		t.Fatalf("expected failed status after restore, got %s", stored.Status)
+	}
+}
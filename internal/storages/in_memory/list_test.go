@@ -0,0 +1,213 @@
+package inmemory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+)
+
+func listIDs(page *storage.ListPage) []string {
+	ids := make([]string, len(page.Messages))
+	for i, m := range page.Messages {
+		ids[i] = m.ID
+	}
+	return ids
+}
+
+func TestListPagination(t *testing.T) {
+	s := newCapacityStorage(NewBuilder().WithShards(4).WithVisibilityTimeout(time.Minute).Build())
+	ctx := context.Background()
+	base := time.Now().Add(time.Hour)
+
+	var msgs []*message.Message
+	for i := range 10 {
+		// Пары сообщений с одинаковым ScheduledAt упорядочиваются по ID.
+		msgs = append(msgs, message.NewMessage(
+			message.WithID(fmt.Sprintf("m-%02d", 9-i)),
+			message.WithScheduledAt(base.Add(time.Duration(i/2)*time.Second)),
+		))
+	}
+	if _, err := s.Store(ctx, msgs); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		got    []string
+		cursor string
+		pages  int
+	)
+	for {
+		page, err := s.List(ctx, storage.ListQuery{Cursor: cursor, Limit: 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, listIDs(page)...)
+		pages++
+
+		// Сообщение, сохранённое между страницами раньше курсора, не сдвигает выдачу.
+		if pages == 1 {
+			early := message.NewMessage(message.WithID("early"), message.WithScheduledAt(base.Add(-time.Hour)))
+			if _, err := s.Store(ctx, []*message.Message{early}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+
+	want := []string{"m-08", "m-09", "m-06", "m-07", "m-04", "m-05", "m-02", "m-03", "m-00", "m-01"}
+	if pages != 4 || fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("expected %v in 4 pages, got %v in %d", want, got, pages)
+	}
+
+	if _, err := s.List(ctx, storage.ListQuery{Cursor: "%%%", Limit: 3}); !errors.Is(err, storage.ErrInvalidCursor) {
+		t.Fatalf("expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+func TestListFilters(t *testing.T) {
+	s := newCapacityStorage(NewBuilder().WithShards(4).WithVisibilityTimeout(time.Minute).Build())
+	ctx := context.Background()
+	now := time.Now()
+
+	msgs := []*message.Message{
+		message.NewMessage(message.WithID("due"), message.WithRoutingKey("orders.created"), message.WithScheduledAt(now.Add(-time.Second))),
+		message.NewMessage(message.WithID("a"), message.WithRoutingKey("orders.paid"), message.WithMetadataValue("tenant", "x"), message.WithScheduledAt(now.Add(time.Hour))),
+		message.NewMessage(message.WithID("b"), message.WithRoutingKey("orders.paid"), message.WithMetadataValue("tenant", "y"), message.WithScheduledAt(now.Add(2*time.Hour))),
+		message.NewMessage(message.WithID("c"), message.WithRoutingKey("users.created"), message.WithMetadataValue("tenant", "x"), message.WithScheduledAt(now.Add(3*time.Hour))),
+	}
+	if _, err := s.Store(ctx, msgs); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.FetchReady(ctx, 10); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		filter storage.ListFilter
+		want   []string
+	}{
+		{"all", storage.ListFilter{}, []string{"due", "a", "b", "c"}},
+		{"routing key prefix", storage.ListFilter{RoutingKeyPrefix: "orders."}, []string{"due", "a", "b"}},
+		{"metadata", storage.ListFilter{Metadata: map[string]string{"tenant": "x"}}, []string{"a", "c"}},
+		{"scheduled range", storage.ListFilter{ScheduledFrom: now.Add(time.Hour), ScheduledTo: now.Add(3 * time.Hour)}, []string{"a", "b"}},
+		{"pending", storage.ListFilter{Status: storage.MessageStatusPending}, []string{"a", "b", "c"}},
+		{"in flight", storage.ListFilter{Status: storage.MessageStatusInFlight}, []string{"due"}},
+		{"combined", storage.ListFilter{RoutingKeyPrefix: "orders.", Metadata: map[string]string{"tenant": "x"}, Status: storage.MessageStatusPending}, []string{"a"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			page, err := s.List(ctx, storage.ListQuery{Filter: tc.filter, Limit: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := listIDs(page); fmt.Sprint(got) != fmt.Sprint(tc.want) || page.NextCursor != "" {
+				t.Fatalf("expected %v, got %v (next %q)", tc.want, got, page.NextCursor)
+			}
+		})
+	}
+}
+
+func TestListPagesMatchFullOrder(t *testing.T) {
+	s := newCapacityStorage(NewBuilder().WithShards(8).WithVisibilityTimeout(time.Minute).Build())
+	ctx := context.Background()
+	base := time.Now().Add(time.Hour)
+
+	// Сообщения сохраняются вразнобой, часть — с одинаковым ScheduledAt.
+	rng := rand.New(rand.NewPCG(1, 2))
+	msgs := make([]*message.Message, 500)
+	for i := range msgs {
+		msgs[i] = message.NewMessage(
+			message.WithID(fmt.Sprintf("m-%03d", i)),
+			message.WithScheduledAt(base.Add(time.Duration(rng.IntN(100))*time.Second)),
+		)
+	}
+	if _, err := s.Store(ctx, msgs); err != nil {
+		t.Fatal(err)
+	}
+
+	want := make([]string, len(msgs))
+	slices.SortFunc(msgs, compareSchedule)
+	for i, msg := range msgs {
+		want[i] = msg.ID
+	}
+
+	var (
+		got    []string
+		cursor string
+	)
+	for {
+		page, err := s.List(ctx, storage.ListQuery{Cursor: cursor, Limit: 37})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, listIDs(page)...)
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+
+	if !slices.Equal(got, want) {
+		t.Fatalf("pages differ from full order: got %d messages", len(got))
+	}
+}
+
+func TestExportSnapshot(t *testing.T) {
+	s := newCapacityStorage(NewBuilder().WithShards(4).WithVisibilityTimeout(time.Minute).Build())
+	ctx := context.Background()
+	base := time.Now().Add(time.Hour)
+
+	var want []string
+	for i := range 20 {
+		id := fmt.Sprintf("m-%02d", i)
+		msg := message.NewMessage(message.WithID(id), message.WithRoutingKey("orders"), message.WithScheduledAt(base.Add(time.Duration(i)*time.Second)))
+		if _, err := s.Store(ctx, []*message.Message{msg}); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, id)
+	}
+	other := message.NewMessage(message.WithID("other"), message.WithRoutingKey("users"), message.WithScheduledAt(base))
+	if _, err := s.Store(ctx, []*message.Message{other}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Сообщения, сохранённые и удалённые во время выгрузки, её не меняют.
+	var got []string
+	err := s.Export(ctx, storage.ListFilter{RoutingKeyPrefix: "orders"}, func(m *storage.StoredMessage) error {
+		if len(got) == 0 {
+			late := message.NewMessage(message.WithID("late"), message.WithRoutingKey("orders"), message.WithScheduledAt(base.Add(time.Minute)))
+			if _, err := s.Store(ctx, []*message.Message{late}); err != nil {
+				return err
+			}
+			if err := s.Delete(ctx, "m-19"); err != nil {
+				return err
+			}
+		}
+		got = append(got, m.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	stop := errors.New("stop")
+	if err := s.Export(ctx, storage.ListFilter{}, func(*storage.StoredMessage) error { return stop }); !errors.Is(err, stop) {
+		t.Fatalf("expected emit error, got %v", err)
+	}
+}
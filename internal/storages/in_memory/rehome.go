@@ -0,0 +1,78 @@
+package inmemory
+
+import (
+	"context"
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/internal/storages/pipeline"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+)
+
+// Rehome передаёт gateway пачками по MaxOutputBatchSize ожидающие сообщения, которые
+// не подходят под диапазон query. Сообщения остаются в хранилище, пока gateway
+// не подтвердит, что выбрал для них другое хранилище; уже перенесённые в inflight
+// сообщения не передаются. С query.All инстанс покидает кластер: он перестаёт принимать
+// сообщения из шины, и gateway может передать его сообщения другим инстансам хранилища.
+func (s *InMemoryStorage) Rehome(_ context.Context, query storage.RehomeQuery) (*storage.RehomeResult, error) {
+	if err := s.checkReady(); err != nil {
+		return nil, err
+	}
+	if s.drain.active.Load() {
+		return nil, storage.ErrDraining
+	}
+	if s.rehomeVia == nil {
+		return nil, pipeline.ErrNoBus
+	}
+
+	// Иначе инстанс мог бы сам получить свои сообщения из orbital.storage.{ID}
+	// как дубликаты и удалить их по подтверждению gateway.
+	if query.All {
+		s.stopIntake()
+	}
+
+	now := s.clock.Now()
+	result := &storage.RehomeResult{}
+
+	for _, sh := range s.shards {
+		scanned, misplaced := sh.misplaced(query, now)
+		result.Scanned += scanned
+
+		sent, err := pipeline.Rehome(s.rehomeVia, s.cfg.ID, misplaced, s.cfg.MaxOutputBatchSize, query.All)
+		result.Resubmitted += sent
+		if err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// misplaced возвращает число ожидающих сообщений и копии тех из них, которые
+// на момент now не подходят под диапазон query.
+func (sh *shard) misplaced(query storage.RehomeQuery, now time.Time) (int, []*message.Message) {
+	sh.messagesMu.RLock()
+	defer sh.messagesMu.RUnlock()
+
+	sh.inflightMu.RLock()
+	defer sh.inflightMu.RUnlock()
+
+	scanned := 0
+	msgs := make([]*message.Message, 0)
+	for id, msg := range sh.messages {
+		if _, failed := sh.failed[id]; failed {
+			continue
+		}
+		if _, inFlight := sh.inflight[id]; inFlight {
+			continue
+		}
+
+		scanned++
+		if query.Misplaced(msg.ScheduledAt.Sub(now)) {
+			copied := *msg
+			msgs = append(msgs, &copied)
+		}
+	}
+
+	return scanned, msgs
+}
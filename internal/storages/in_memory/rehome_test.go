@@ -0,0 +1,79 @@
+package inmemory
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/clock"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+)
+
+// recordingRehome запоминает сообщения, переданные gateway.
+type recordingRehome struct {
+	from     string
+	ids      []string
+	evacuate bool
+}
+
+func (r *recordingRehome) Rehome(storageID string, msgs []*message.Message) error {
+	r.from = storageID
+	for _, msg := range msgs {
+		r.ids = append(r.ids, msg.ID)
+	}
+	return nil
+}
+
+func (r *recordingRehome) Evacuate(storageID string, msgs []*message.Message) error {
+	r.evacuate = true
+	return r.Rehome(storageID, msgs)
+}
+
+func TestRehomeMisplacedMessages(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := newCapacityStorage(NewBuilder().WithID("hot").WithShards(2).WithMaxOutputBatchSize(1).WithClock(clock.NewFake(now)).Build())
+	ctx := context.Background()
+
+	msgs := []*message.Message{
+		message.NewMessage(message.WithID("fits"), message.WithScheduledAt(now.Add(30*time.Minute))),
+		message.NewMessage(message.WithID("too-far"), message.WithScheduledAt(now.Add(2*time.Hour))),
+		message.NewMessage(message.WithID("due"), message.WithScheduledAt(now)),
+	}
+	if _, err := s.Store(ctx, msgs); err != nil {
+		t.Fatal(err)
+	}
+
+	// Без подключения к шине передавать некуда.
+	if _, err := s.Rehome(ctx, storage.RehomeQuery{MaxDelay: time.Hour}); err == nil {
+		t.Fatal("expected error without bus")
+	}
+
+	sent := &recordingRehome{}
+	s.rehomeVia = sent
+
+	result, err := s.Rehome(ctx, storage.RehomeQuery{MaxDelay: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Scanned != 3 || result.Resubmitted != 1 || sent.from != "hot" || !slices.Equal(sent.ids, []string{"too-far"}) ||
+		sent.evacuate {
+		t.Fatalf("unexpected rehome %+v from %s: %v", result, sent.from, sent.ids)
+	}
+
+	// Сообщение остаётся до подтверждения от gateway.
+	if n, _ := s.Count(ctx); n != 3 {
+		t.Fatalf("expected messages to stay until ack, got %d", n)
+	}
+
+	sent.ids = nil
+	result, err = s.Rehome(ctx, storage.RehomeQuery{All: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(sent.ids)
+	if result.Resubmitted != 2 || !slices.Equal(sent.ids, []string{"fits", "too-far"}) || !sent.evacuate {
+		t.Fatalf("expected all not yet due messages to be evacuated, got %+v: %v", result, sent.ids)
+	}
+}
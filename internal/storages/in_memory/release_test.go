@@ -0,0 +1,178 @@
+package inmemory
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/internal/storages/pipeline"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+)
+
+// recordingSender запоминает сообщения, выпущенные в gateway, и может отказывать.
+// Если задан during, он вызывается перед публикацией.
+type recordingSender struct {
+	mu      sync.Mutex
+	gateway []*message.Message
+	err     error
+	during  func()
+}
+
+func (r *recordingSender) SendToGateway(_ string, msgs []*message.Message) error {
+	if r.during != nil {
+		r.during()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return r.err
+	}
+	r.gateway = append(r.gateway, msgs...)
+	return nil
+}
+
+func (r *recordingSender) Promote(_, _ string, _ []*message.Message) error {
+	return nil
+}
+
+func newReleaseStorage(t *testing.T, sender *recordingSender) *InMemoryStorage {
+	t.Helper()
+
+	cfg := NewBuilder().WithShards(4).WithVisibilityTimeout(time.Minute).WithMaxOutputBatchSize(7).Build()
+	s := newCapacityStorage(cfg)
+	noStorages := func(context.Context) ([]*storage.Info, error) { return nil, nil }
+	s.promoter = pipeline.NewPromoter(sender, noStorages, &cfg.BaseStorageConfig)
+	return s
+}
+
+func TestReleaseAndFetchReadyDoNotDeliverTwice(t *testing.T) {
+	sender := &recordingSender{}
+	s := newReleaseStorage(t, sender)
+	ctx := context.Background()
+
+	const n = 500
+	msgs := make([]*message.Message, n)
+	for i := range msgs {
+		msgs[i] = message.NewMessage(message.WithID("m-" + strconv.Itoa(i)))
+	}
+	if _, err := s.Store(ctx, msgs); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.moveExpiredToInflight(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		wg      sync.WaitGroup
+		fetchMu sync.Mutex
+		fetched []*storage.StoredMessage
+	)
+	for _, sh := range s.shards {
+		wg.Go(func() {
+			for range n {
+				if err := s.processMessages(ctx, sh); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		})
+	}
+	for range 4 {
+		wg.Go(func() {
+			for range n {
+				ready, err := s.FetchReady(ctx, 5)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				fetchMu.Lock()
+				fetched = append(fetched, ready...)
+				fetchMu.Unlock()
+			}
+		})
+	}
+	wg.Wait()
+
+	delivered := make(map[string]int, n)
+	for _, msg := range sender.gateway {
+		delivered[msg.ID]++
+	}
+	for _, msg := range fetched {
+		delivered[msg.ID]++
+	}
+	if len(delivered) != n {
+		t.Fatalf("expected all %d messages to be delivered, got %d", n, len(delivered))
+	}
+	for id, times := range delivered {
+		if times != 1 {
+			t.Fatalf("message %s delivered %d times", id, times)
+		}
+	}
+}
+
+func TestFetchReadySkipsMessagesBeingReleased(t *testing.T) {
+	sender := &recordingSender{}
+	s := newReleaseStorage(t, sender)
+	ctx := context.Background()
+
+	if _, err := s.Store(ctx, []*message.Message{message.NewMessage(message.WithID("a"))}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.moveExpiredToInflight(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Пока release worker публикует сообщение, FetchReady не должен выдать его повторно.
+	var during []*storage.StoredMessage
+	sender.during = func() {
+		ready, err := s.FetchReady(ctx, 10)
+		if err != nil {
+			t.Error(err)
+		}
+		during = ready
+	}
+
+	sh := s.shards[shardIndex("a", len(s.shards))]
+	if err := s.processMessages(ctx, sh); err != nil {
+		t.Fatal(err)
+	}
+	if len(during) != 0 {
+		t.Fatalf("expected message being released not to be fetched, got %d", len(during))
+	}
+	if len(sender.gateway) != 1 {
+		t.Fatalf("expected message to be released, got %d", len(sender.gateway))
+	}
+}
+
+func TestFailedReleaseIsRolledBack(t *testing.T) {
+	sender := &recordingSender{err: errors.New("bus unavailable")}
+	s := newReleaseStorage(t, sender)
+	ctx := context.Background()
+
+	if _, err := s.Store(ctx, []*message.Message{message.NewMessage(message.WithID("a"))}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.moveExpiredToInflight(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	sh := s.shards[shardIndex("a", len(s.shards))]
+	if err := s.processMessages(ctx, sh); err == nil {
+		t.Fatal("expected release error")
+	}
+
+	// Неудачный выпуск не считается попыткой: сообщение сразу доступно FetchReady.
+	ready, err := s.FetchReady(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ready) != 1 || ready[0].Attempts != 1 {
+		t.Fatalf("expected message to be fetched with 1 attempt, got %+v", ready)
+	}
+}
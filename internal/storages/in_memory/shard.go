@@ -0,0 +1,597 @@
+package inmemory
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+)
+
+// shard — независимая часть хранилища со своими блокировками и индексом.
+// Сообщение всегда попадает в shard, определяемый хешем его ID (см. shardIndex).
+type shard struct {
+	messagesMu sync.RWMutex
+	messages   map[string]*message.Message
+	// pending — индекс ожидающих (ещё не inflight) сообщений по ScheduledAt, защищён messagesMu.
+	pending *scheduleIndex
+
+	inflightMu sync.RWMutex
+	inflight   map[string]*inflightEntry
+	// visible — индекс inflight-сообщений по сроку видимости, защищён inflightMu.
+	visible *visibilityIndex
+	// sent — сколько inflight-сообщений выдано и ждёт подтверждения, защищён inflightMu.
+	sent int
+	// failed — сообщения, отклонённые без повторной постановки, защищён inflightMu.
+	failed map[string]struct{}
+	// deliveries — история выдачи сообщений, защищена inflightMu. Переживает Reject
+	// с requeue, но не рестарт.
+	deliveries map[string]*delivery
+}
+
+// delivery — сколько раз и когда последний раз выдавалось сообщение.
+type delivery struct {
+	attempts      int
+	lastAttemptAt time.Time
+}
+
+func newShard() *shard {
+	return &shard{
+		messages:   make(map[string]*message.Message),
+		pending:    newScheduleIndex(0),
+		inflight:   make(map[string]*inflightEntry),
+		visible:    newVisibilityIndex(0),
+		failed:     make(map[string]struct{}),
+		deliveries: make(map[string]*delivery),
+	}
+}
+
+// shardIndex возвращает номер shard'а для сообщения с идентификатором id.
+func shardIndex(id string, shards int) int {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return int(h.Sum32() % uint32(shards))
+}
+
+// store сохраняет msgs[i] для каждого i из idx и записывает результат в results[i].
+// У всех сообщений уже должен быть ID. Возвращает число и размер payload новых сообщений.
+func (sh *shard) store(msgs []*message.Message, idx []int, results []storage.StoreResult) (added, addedBytes int64) {
+	sh.messagesMu.Lock()
+	defer sh.messagesMu.Unlock()
+
+	for _, i := range idx {
+		copied := *msgs[i]
+		results[i].ID = copied.ID
+
+		if existing, exists := sh.messages[copied.ID]; exists {
+			if existing.Equal(&copied) {
+				results[i].Duplicate = true
+			} else {
+				results[i].Err = fmt.Errorf("%w: %s", ErrAlreadyExists, copied.ID)
+			}
+			continue
+		}
+
+		sh.messages[copied.ID] = &copied
+		sh.pending.push(&copied)
+		added++
+		addedBytes += int64(len(copied.Payload))
+	}
+
+	return added, addedBytes
+}
+
+// moveExpiredToInflight переносит в inflight сообщения с ScheduledAt не позже until:
+// наступившие и подлежащие продвижению в более горячее хранилище.
+func (sh *shard) moveExpiredToInflight(until time.Time) {
+	sh.messagesMu.Lock()
+	defer sh.messagesMu.Unlock()
+
+	sh.inflightMu.Lock()
+	defer sh.inflightMu.Unlock()
+
+	for {
+		msg, ok := sh.pending.popReady(until)
+		if !ok {
+			return
+		}
+		// Сообщение могло быть удалено из хранилища или отклонено после попадания в индекс.
+		if sh.messages[msg.ID] != msg {
+			continue
+		}
+		if _, failed := sh.failed[msg.ID]; failed {
+			continue
+		}
+		entry := &inflightEntry{msg: msg}
+		sh.inflight[msg.ID] = entry
+		sh.visible.push(entry)
+	}
+}
+
+// releaseMark — состояние выпуска inflight-сообщения до claimUnsent, для отката.
+type releaseMark struct {
+	sentAt    time.Time
+	delivery  delivery
+	delivered bool
+}
+
+// claimUnsent отмечает выпущенными в момент now до limit inflight-сообщений, которые
+// ещё не выпускались или не были подтверждены в течение visibilityTimeout, и возвращает
+// их вместе с прежним состоянием. Отметка ставится под inflightMu до публикации, чтобы
+// FetchReady не выдал те же сообщения, пока они публикуются.
+func (sh *shard) claimUnsent(now time.Time, visibilityTimeout time.Duration, limit int) ([]*message.Message, []releaseMark) {
+	sh.inflightMu.Lock()
+	defer sh.inflightMu.Unlock()
+
+	msgs := make([]*message.Message, 0, min(limit, len(sh.inflight)))
+	marks := make([]releaseMark, 0, cap(msgs))
+	for len(msgs) < limit {
+		it, ok := sh.visible.popVisible(now, visibilityTimeout)
+		if !ok {
+			break
+		}
+		if !sh.current(it) {
+			continue
+		}
+		entry := it.entry
+
+		mark := releaseMark{sentAt: entry.sentAt}
+		if d, ok := sh.deliveries[entry.msg.ID]; ok {
+			mark.delivery, mark.delivered = *d, true
+		}
+		sh.markAttempt(entry, now)
+
+		msgs = append(msgs, entry.msg)
+		marks = append(marks, mark)
+	}
+
+	return msgs, marks
+}
+
+// unclaimUnsent откатывает отметки claimUnsent, поставленные в момент sentAt, если
+// публикация не удалась. Подтверждённые за это время сообщения пропускаются.
+func (sh *shard) unclaimUnsent(msgs []*message.Message, marks []releaseMark, sentAt time.Time) {
+	sh.inflightMu.Lock()
+	defer sh.inflightMu.Unlock()
+
+	for i, msg := range msgs {
+		entry, ok := sh.inflight[msg.ID]
+		if !ok || entry.msg != msg || !entry.sentAt.Equal(sentAt) {
+			continue
+		}
+
+		sh.setSentAt(entry, marks[i].sentAt)
+		if d, ok := sh.deliveries[msg.ID]; ok && marks[i].delivered {
+			*d = marks[i].delivery
+		} else {
+			delete(sh.deliveries, msg.ID)
+		}
+	}
+}
+
+// markAttempt отмечает выдачу inflight-сообщения. Вызывающий удерживает inflightMu.
+func (sh *shard) markAttempt(entry *inflightEntry, at time.Time) {
+	sh.setSentAt(entry, at)
+
+	d, ok := sh.deliveries[entry.msg.ID]
+	if !ok {
+		d = &delivery{}
+		sh.deliveries[entry.msg.ID] = d
+	}
+	d.attempts++
+	d.lastAttemptAt = at
+}
+
+// setSentAt меняет время выдачи inflight-сообщения и переносит его в индексе видимости;
+// прежний элемент индекса устаревает. Вызывающий удерживает inflightMu.
+func (sh *shard) setSentAt(entry *inflightEntry, sentAt time.Time) {
+	switch {
+	case entry.sentAt.IsZero() && !sentAt.IsZero():
+		sh.sent++
+	case !entry.sentAt.IsZero() && sentAt.IsZero():
+		sh.sent--
+	}
+	entry.sentAt = sentAt
+	sh.visible.push(entry)
+	sh.compactVisible()
+}
+
+// current сообщает, актуален ли элемент индекса видимости: сообщение всё ещё inflight
+// и с тех пор не выдавалось. Вызывающий удерживает inflightMu.
+func (sh *shard) current(it visibilityItem) bool {
+	return sh.inflight[it.entry.msg.ID] == it.entry && it.entry.sentAt.Equal(it.sentAt)
+}
+
+// dropInflight удаляет сообщение id из inflight. Элемент индекса видимости устаревает.
+// Вызывающий удерживает inflightMu.
+func (sh *shard) dropInflight(id string) {
+	entry, ok := sh.inflight[id]
+	if !ok {
+		return
+	}
+	if !entry.sentAt.IsZero() {
+		sh.sent--
+	}
+	delete(sh.inflight, id)
+	sh.compactVisible()
+}
+
+// compactVisible перестраивает индекс видимости, когда в нём накопилось слишком много
+// устаревших элементов: у каждого inflight-сообщения актуален ровно один элемент.
+// Вызывающий удерживает inflightMu.
+func (sh *shard) compactVisible() {
+	if !needsCompaction(len(sh.visible.items), len(sh.inflight)) {
+		return
+	}
+	entries := make([]*inflightEntry, 0, len(sh.inflight))
+	for _, entry := range sh.inflight {
+		entries = append(entries, entry)
+	}
+	sh.visible.rebuild(entries)
+}
+
+// compactPending перестраивает индекс ожидающих, когда в нём накопилось слишком много
+// удалённых, отклонённых или выданных сообщений. Вызывающий удерживает messagesMu и inflightMu.
+func (sh *shard) compactPending() {
+	if !needsCompaction(len(sh.pending.items), len(sh.messages)-len(sh.inflight)-len(sh.failed)) {
+		return
+	}
+	sh.pending.compact(func(msg *message.Message) bool {
+		if sh.messages[msg.ID] != msg {
+			return false
+		}
+		_, inFlight := sh.inflight[msg.ID]
+		_, failed := sh.failed[msg.ID]
+		return !inFlight && !failed
+	})
+}
+
+// readyCandidates возвращает наступившие на момент now inflight-сообщения, которые
+// ещё не выдавались или не были подтверждены в течение visibilityTimeout.
+func (sh *shard) readyCandidates(now time.Time, visibilityTimeout time.Duration) []*message.Message {
+	sh.inflightMu.RLock()
+	defer sh.inflightMu.RUnlock()
+
+	candidates := make([]*message.Message, 0)
+	sh.visible.eachVisible(now, visibilityTimeout, func(it visibilityItem) {
+		if sh.current(it) && isReady(it.entry.msg, now) {
+			candidates = append(candidates, it.entry.msg)
+		}
+	})
+
+	return candidates
+}
+
+// claimReady выдаёт сообщения msgs, которые всё ещё можно выдать, и отмечает попытку.
+// Сообщения, выданные или подтверждённые после readyCandidates, пропускаются.
+func (sh *shard) claimReady(msgs []*message.Message, now time.Time, visibilityTimeout time.Duration) []*storage.StoredMessage {
+	sh.inflightMu.Lock()
+	defer sh.inflightMu.Unlock()
+
+	claimed := make([]*storage.StoredMessage, 0, len(msgs))
+	for _, msg := range msgs {
+		entry, ok := sh.inflight[msg.ID]
+		if !ok || entry.msg != msg || !sh.claimable(entry, now, visibilityTimeout) {
+			continue
+		}
+
+		sh.markAttempt(entry, now)
+		claimed = append(claimed, sh.stored(msg, storage.MessageStatusInFlight))
+	}
+
+	return claimed
+}
+
+// claimable сообщает, можно ли выдать inflight-сообщение. Вызывающий удерживает inflightMu.
+func (sh *shard) claimable(entry *inflightEntry, now time.Time, visibilityTimeout time.Duration) bool {
+	if !isReady(entry.msg, now) {
+		return false
+	}
+	return entry.sentAt.IsZero() || now.Sub(entry.sentAt) >= visibilityTimeout
+}
+
+// fetchExpiring возвращает ожидающие сообщения с ScheduledAt не позже until: ещё
+// находящиеся в индексе и перенесённые в inflight, но не выданные.
+func (sh *shard) fetchExpiring(until time.Time) []*storage.StoredMessage {
+	sh.messagesMu.RLock()
+	defer sh.messagesMu.RUnlock()
+
+	sh.inflightMu.RLock()
+	defer sh.inflightMu.RUnlock()
+
+	expiring := make([]*storage.StoredMessage, 0)
+	for _, msg := range sh.pending.items {
+		if msg.ScheduledAt.After(until) || sh.messages[msg.ID] != msg {
+			continue
+		}
+		if _, failed := sh.failed[msg.ID]; failed {
+			continue
+		}
+		if _, inFlight := sh.inflight[msg.ID]; inFlight {
+			continue
+		}
+		expiring = append(expiring, sh.stored(msg, storage.MessageStatusPending))
+	}
+
+	for _, entry := range sh.inflight {
+		if entry.sentAt.IsZero() && !entry.msg.ScheduledAt.After(until) {
+			expiring = append(expiring, sh.stored(entry.msg, storage.MessageStatusPending))
+		}
+	}
+
+	return expiring
+}
+
+// reject возвращает выданное сообщение id: с requeue — в индекс ожидающих,
+// без него — в failed.
+func (sh *shard) reject(id string, requeue bool) error {
+	sh.messagesMu.Lock()
+	defer sh.messagesMu.Unlock()
+
+	sh.inflightMu.Lock()
+	defer sh.inflightMu.Unlock()
+
+	msg, ok := sh.messages[id]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+
+	entry, ok := sh.inflight[id]
+	if !ok || entry.sentAt.IsZero() {
+		return fmt.Errorf("%w: %s", ErrNotInFlight, id)
+	}
+
+	sh.dropInflight(id)
+	if requeue {
+		sh.pending.push(msg)
+	} else {
+		sh.failed[id] = struct{}{}
+	}
+
+	return nil
+}
+
+// fail переводит сообщения ids в failed независимо от их состояния.
+// Используется при проигрывании WAL.
+func (sh *shard) fail(ids []string) {
+	sh.messagesMu.Lock()
+	defer sh.messagesMu.Unlock()
+
+	sh.inflightMu.Lock()
+	defer sh.inflightMu.Unlock()
+
+	for _, id := range ids {
+		if _, ok := sh.messages[id]; !ok {
+			continue
+		}
+		sh.dropInflight(id)
+		sh.failed[id] = struct{}{}
+	}
+	sh.compactPending()
+}
+
+// stored оборачивает msg в StoredMessage с историей выдачи.
+// Вызывающий удерживает inflightMu.
+func (sh *shard) stored(msg *message.Message, status storage.MessageStatus) *storage.StoredMessage {
+	copied := *msg
+	result := &storage.StoredMessage{Message: &copied, Status: status}
+
+	if d, ok := sh.deliveries[msg.ID]; ok {
+		result.Attempts = d.attempts
+		result.LastAttemptAt = d.lastAttemptAt
+	}
+
+	return result
+}
+
+// remove удаляет сообщения с идентификаторами ids.
+// Возвращает число и размер payload удалённых сообщений.
+func (sh *shard) remove(ids []string) (removed, removedBytes int64) {
+	sh.messagesMu.Lock()
+	defer sh.messagesMu.Unlock()
+
+	sh.inflightMu.Lock()
+	defer sh.inflightMu.Unlock()
+
+	for _, id := range ids {
+		msg, ok := sh.messages[id]
+		if !ok {
+			continue
+		}
+		sh.dropInflight(id)
+		delete(sh.failed, id)
+		delete(sh.deliveries, id)
+		delete(sh.messages, id)
+		removed++
+		removedBytes += int64(len(msg.Payload))
+	}
+	sh.compactPending()
+
+	return removed, removedBytes
+}
+
+func (sh *shard) has(id string) bool {
+	sh.messagesMu.RLock()
+	defer sh.messagesMu.RUnlock()
+
+	_, ok := sh.messages[id]
+	return ok
+}
+
+func (sh *shard) get(id string) (*message.Message, bool) {
+	sh.messagesMu.RLock()
+	defer sh.messagesMu.RUnlock()
+
+	msg, ok := sh.messages[id]
+	if !ok {
+		return nil, false
+	}
+
+	copied := *msg
+	return &copied, true
+}
+
+// getStored возвращает сообщение id вместе с его состоянием.
+func (sh *shard) getStored(id string) (*storage.StoredMessage, bool) {
+	sh.messagesMu.RLock()
+	defer sh.messagesMu.RUnlock()
+
+	sh.inflightMu.RLock()
+	defer sh.inflightMu.RUnlock()
+
+	msg, ok := sh.messages[id]
+	if !ok {
+		return nil, false
+	}
+
+	return sh.stored(msg, sh.status(id)), true
+}
+
+// status возвращает состояние сообщения id. Перенесённые в inflight, но ещё
+// не выданные сообщения считаются ожидающими. Вызывающий удерживает inflightMu.
+func (sh *shard) status(id string) storage.MessageStatus {
+	if _, failed := sh.failed[id]; failed {
+		return storage.MessageStatusFailed
+	}
+	if entry, inFlight := sh.inflight[id]; inFlight && !entry.sentAt.IsZero() {
+		return storage.MessageStatusInFlight
+	}
+	return storage.MessageStatusPending
+}
+
+// list отбирает в top сообщения, удовлетворяющие filter и идущие после курсора after
+// (nil — с начала). Сообщения, которые не попадут в top, фильтром не проверяются.
+func (sh *shard) list(filter *storage.ListFilter, after *storage.ListCursor, top *topSchedule) {
+	sh.messagesMu.RLock()
+	defer sh.messagesMu.RUnlock()
+
+	sh.inflightMu.RLock()
+	defer sh.inflightMu.RUnlock()
+
+	for id, msg := range sh.messages {
+		if after != nil && !after.Precedes(msg) {
+			continue
+		}
+		if !top.admits(msg) {
+			continue
+		}
+		if status := sh.status(id); filter.Match(msg, status) {
+			top.offer(sh.stored(msg, status))
+		}
+	}
+}
+
+// matching возвращает копии всех сообщений, удовлетворяющих filter, в произвольном
+// порядке — снимок shard'а на момент вызова.
+func (sh *shard) matching(filter *storage.ListFilter) []*storage.StoredMessage {
+	sh.messagesMu.RLock()
+	defer sh.messagesMu.RUnlock()
+
+	sh.inflightMu.RLock()
+	defer sh.inflightMu.RUnlock()
+
+	matched := make([]*storage.StoredMessage, 0)
+	for id, msg := range sh.messages {
+		if status := sh.status(id); filter.Match(msg, status) {
+			matched = append(matched, sh.stored(msg, status))
+		}
+	}
+
+	return matched
+}
+
+// histogram учитывает в h ожидающие сообщения shard'а.
+func (sh *shard) histogram(h *storage.Histogram) {
+	sh.messagesMu.RLock()
+	defer sh.messagesMu.RUnlock()
+
+	sh.inflightMu.RLock()
+	defer sh.inflightMu.RUnlock()
+
+	for id, msg := range sh.messages {
+		if sh.status(id) == storage.MessageStatusPending {
+			h.Add(msg.ScheduledAt, msg.RoutingKey)
+		}
+	}
+}
+
+func (sh *shard) count() int {
+	sh.messagesMu.RLock()
+	defer sh.messagesMu.RUnlock()
+
+	return len(sh.messages)
+}
+
+// inFlight возвращает число выпущенных в gateway и не подтверждённых сообщений.
+func (sh *shard) inFlight() int {
+	sh.inflightMu.RLock()
+	defer sh.inflightMu.RUnlock()
+
+	return sh.sent
+}
+
+// load заменяет содержимое shard'а сообщениями messages, из которых inflight уже выпущены,
+// а failed — отклонены.
+func (sh *shard) load(messages map[string]*message.Message, inflight, failed []string) {
+	sh.messagesMu.Lock()
+	defer sh.messagesMu.Unlock()
+
+	sh.inflightMu.Lock()
+	defer sh.inflightMu.Unlock()
+
+	sh.messages = messages
+	sh.inflight = make(map[string]*inflightEntry, len(inflight))
+	sh.sent = 0
+	sh.failed = make(map[string]struct{}, len(failed))
+	sh.deliveries = make(map[string]*delivery)
+
+	for _, id := range failed {
+		if _, ok := messages[id]; ok {
+			sh.failed[id] = struct{}{}
+		}
+	}
+
+	// Подтверждения отправок до рестарта потеряны — сообщения будут отправлены повторно.
+	entries := make([]*inflightEntry, 0, len(inflight))
+	for _, id := range inflight {
+		msg, ok := messages[id]
+		if !ok {
+			continue
+		}
+		entry := &inflightEntry{msg: msg}
+		sh.inflight[id] = entry
+		entries = append(entries, entry)
+	}
+	sh.visible.rebuild(entries)
+
+	pending := make([]*message.Message, 0, len(sh.messages)-len(sh.inflight)-len(sh.failed))
+	for id, msg := range sh.messages {
+		_, inFlight := sh.inflight[id]
+		_, isFailed := sh.failed[id]
+		if !inFlight && !isFailed {
+			pending = append(pending, msg)
+		}
+	}
+	sh.pending.rebuild(pending)
+}
+
+// snapshot возвращает сообщения shard'а с признаками inflight и failed.
+// Сообщения после сохранения не изменяются, поэтому копируются только указатели.
+func (sh *shard) snapshot() []snapshotEntry {
+	sh.messagesMu.RLock()
+	defer sh.messagesMu.RUnlock()
+
+	sh.inflightMu.RLock()
+	defer sh.inflightMu.RUnlock()
+
+	entries := make([]snapshotEntry, 0, len(sh.messages))
+	for id, msg := range sh.messages {
+		_, inflight := sh.inflight[id]
+		_, failed := sh.failed[id]
+		entries = append(entries, snapshotEntry{msg: msg, inflight: inflight, failed: failed})
+	}
+
+	return entries
+}
@@ -0,0 +1,154 @@
+package inmemory
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+)
+
+func TestShardIndexIsStable(t *testing.T) {
+	used := make(map[int]bool)
+	for i := range 1000 {
+		id := "msg-" + strconv.Itoa(i)
+		n := shardIndex(id, 8)
+		if n < 0 || n >= 8 || shardIndex(id, 8) != n {
+			t.Fatalf("unstable or out of range shard %d for %s", n, id)
+		}
+		used[n] = true
+	}
+	if len(used) != 8 {
+		t.Fatalf("expected messages in every shard, got %d shards", len(used))
+	}
+}
+
+func TestShardReleaseAndAcknowledge(t *testing.T) {
+	sh := newShard()
+	now := time.Now()
+
+	msgs := []*message.Message{
+		message.NewMessage(message.WithID("ready"), message.WithScheduledAt(now.Add(-time.Second))),
+		message.NewMessage(message.WithID("future"), message.WithScheduledAt(now.Add(time.Hour))),
+	}
+	sh.store(msgs, []int{0, 1}, make([]storage.StoreResult, len(msgs)))
+
+	sh.moveExpiredToInflight(now)
+	unsent, _ := sh.claimUnsent(now, time.Minute, 10)
+	if len(unsent) != 1 || unsent[0].ID != "ready" {
+		t.Fatalf("expected only ready message to be released, got %v", unsent)
+	}
+
+	// Выпущенное сообщение ждёт подтверждения до истечения visibility timeout.
+	if got, _ := sh.claimUnsent(now.Add(time.Second), time.Minute, 10); len(got) != 0 {
+		t.Fatalf("expected released message to wait for ack, got %v", got)
+	}
+	if got, _ := sh.claimUnsent(now.Add(time.Minute), time.Minute, 10); len(got) != 1 {
+		t.Fatalf("expected redelivery after visibility timeout, got %v", got)
+	}
+
+	sh.remove([]string{"ready"})
+	if _, ok := sh.get("ready"); ok {
+		t.Fatal("expected acknowledged message to be removed")
+	}
+	if got, _ := sh.claimUnsent(now.Add(2*time.Minute), time.Minute, 10); len(got) != 0 {
+		t.Fatalf("expected no in-flight messages after ack, got %v", got)
+	}
+	if sh.count() != 1 {
+		t.Fatalf("expected future message to stay, got %d messages", sh.count())
+	}
+}
+
+func TestShardIndexesStayBounded(t *testing.T) {
+	sh := newShard()
+	now := time.Now()
+	const n = 4 * compactMinStale
+
+	msgs := make([]*message.Message, n)
+	idx := make([]int, n)
+	for i := range msgs {
+		msgs[i] = message.NewMessage(message.WithID("msg-"+strconv.Itoa(i)), message.WithScheduledAt(now.Add(-time.Second)))
+		idx[i] = i
+	}
+	sh.store(msgs, idx, make([]storage.StoreResult, n))
+	sh.moveExpiredToInflight(now)
+
+	// Каждая повторная выдача оставляет в индексе видимости устаревший элемент.
+	for round := range 5 {
+		at := now.Add(time.Duration(round) * time.Minute)
+		if got, _ := sh.claimUnsent(at, time.Minute, n); len(got) != n {
+			t.Fatalf("round %d: expected %d messages to be released, got %d", round, n, len(got))
+		}
+		if sh.inFlight() != n {
+			t.Fatalf("round %d: expected %d in-flight messages, got %d", round, n, sh.inFlight())
+		}
+		if len(sh.visible.items) > 2*n {
+			t.Fatalf("round %d: visibility index grew to %d items for %d messages", round, len(sh.visible.items), n)
+		}
+	}
+
+	// Выданные сообщения видны FetchReady только после visibility timeout.
+	last := now.Add(4 * time.Minute)
+	if got := sh.readyCandidates(last.Add(time.Second), time.Minute); len(got) != 0 {
+		t.Fatalf("expected released messages to be hidden, got %d", len(got))
+	}
+	if got := sh.readyCandidates(last.Add(time.Minute), time.Minute); len(got) != n {
+		t.Fatalf("expected %d messages after visibility timeout, got %d", n, len(got))
+	}
+
+	ids := make([]string, n)
+	for i, msg := range msgs {
+		ids[i] = msg.ID
+	}
+	sh.remove(ids[:n-1])
+	if sh.inFlight() != 1 || len(sh.visible.items) > compactMinStale {
+		t.Fatalf("expected index to be compacted after removal, got %d in-flight and %d items", sh.inFlight(), len(sh.visible.items))
+	}
+
+	// Отменённые до выдачи сообщения не копятся в индексе ожидающих.
+	future := make([]*message.Message, n)
+	for i := range future {
+		future[i] = message.NewMessage(message.WithID("future-"+strconv.Itoa(i)), message.WithScheduledAt(now.Add(time.Hour)))
+		ids[i] = future[i].ID
+	}
+	sh.store(future, idx, make([]storage.StoreResult, n))
+	sh.remove(ids[:n-1])
+	if len(sh.pending.items) > compactMinStale {
+		t.Fatalf("expected pending index to be compacted, got %d items", len(sh.pending.items))
+	}
+}
+
+func TestStoreSpreadsMessagesAcrossShards(t *testing.T) {
+	s := NewInMemoryStorage()
+	s.initState(NewBuilder().WithShards(4).Build())
+	ctx := context.Background()
+
+	msgs := make([]*message.Message, 100)
+	for i := range msgs {
+		msgs[i] = message.NewMessage(message.WithID("msg-" + strconv.Itoa(i)))
+	}
+	if _, err := s.Store(ctx, msgs); err != nil {
+		t.Fatal(err)
+	}
+
+	total := 0
+	for _, sh := range s.shards {
+		if sh.count() == 0 {
+			t.Fatal("expected every shard to hold messages")
+		}
+		total += sh.count()
+	}
+	if n, _ := s.Count(ctx); n != 100 || total != 100 {
+		t.Fatalf("expected 100 messages, got %d in %d shards", n, total)
+	}
+
+	// Каждое сообщение читается из своего shard'а.
+	for _, msg := range msgs {
+		got, err := s.GetByID(ctx, msg.ID)
+		if err != nil || got.ID != msg.ID {
+			t.Fatalf("GetByID(%s): %v, %v", msg.ID, got, err)
+		}
+	}
+}
@@ -0,0 +1,335 @@
+package inmemory
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+)
+
+// Бинарный формат снимка хранилища.
+//
+//	header:  magic (8 байт) | version uint32
+//	record:  tag=1 | flags | ID | RoutingKey | RoutingSettings | Payload | Metadata | CreatedAt | ScheduledAt
+//	trailer: tag=0 | count uint64 | CRC32 всех предшествующих байт uint32
+//
+// Строки и []byte кодируются как uvarint длина + байты, map — как uvarint количество пар
+// и пары строк, time.Time — через MarshalBinary с uvarint длиной. Числа — little endian.
+// Снимок пишется и читается потоково, без промежуточного представления всего состояния.
+const (
+	snapshotMagic   = "ORBSNAP\x00"
+	snapshotVersion = 1
+
+	snapshotTagEnd     byte = 0
+	snapshotTagMessage byte = 1
+
+	snapshotFlagInflight byte = 1 << 0
+	snapshotFlagFailed   byte = 1 << 1
+
+	// snapshotMaxField — верхняя граница длины поля, защищает от выделения памяти
+	// по повреждённым данным.
+	snapshotMaxField = 256 << 20
+)
+
+var errSnapshotCorrupt = errors.New("snapshot corrupted")
+
+// snapshotEntry — сообщение shard'а в момент снимка.
+type snapshotEntry struct {
+	msg      *message.Message
+	inflight bool
+	failed   bool
+}
+
+// snapshotWriter потоково кодирует сообщения в бинарный снимок.
+type snapshotWriter struct {
+	w     *bufio.Writer
+	crc   hash.Hash32
+	count uint64
+	buf   []byte
+}
+
+func newSnapshotWriter(w io.Writer) (*snapshotWriter, error) {
+	sw := &snapshotWriter{
+		w:   bufio.NewWriter(w),
+		crc: crc32.NewIEEE(),
+	}
+
+	sw.buf = append(sw.buf, snapshotMagic...)
+	sw.buf = binary.LittleEndian.AppendUint32(sw.buf, snapshotVersion)
+
+	if err := sw.flushRecord(); err != nil {
+		return nil, err
+	}
+
+	return sw, nil
+}
+
+func (sw *snapshotWriter) writeMessage(entry snapshotEntry) error {
+	msg := entry.msg
+
+	var flags byte
+	if entry.inflight {
+		flags |= snapshotFlagInflight
+	}
+	if entry.failed {
+		flags |= snapshotFlagFailed
+	}
+
+	sw.buf = append(sw.buf, snapshotTagMessage, flags)
+	sw.buf = appendString(sw.buf, msg.ID)
+	sw.buf = appendString(sw.buf, msg.RoutingKey)
+	sw.buf = appendMap(sw.buf, msg.RoutingSettings)
+	sw.buf = binary.AppendUvarint(sw.buf, uint64(len(msg.Payload)))
+	sw.buf = append(sw.buf, msg.Payload...)
+	sw.buf = appendMap(sw.buf, msg.Metadata)
+
+	var err error
+	if sw.buf, err = appendTime(sw.buf, msg.CreatedAt); err != nil {
+		return err
+	}
+	if sw.buf, err = appendTime(sw.buf, msg.ScheduledAt); err != nil {
+		return err
+	}
+
+	sw.count++
+	return sw.flushRecord()
+}
+
+// close записывает trailer с количеством сообщений и контрольной суммой.
+func (sw *snapshotWriter) close() error {
+	sw.buf = append(sw.buf, snapshotTagEnd)
+	sw.buf = binary.LittleEndian.AppendUint64(sw.buf, sw.count)
+	if err := sw.flushRecord(); err != nil {
+		return err
+	}
+
+	sw.buf = binary.LittleEndian.AppendUint32(sw.buf, sw.crc.Sum32())
+	if _, err := sw.w.Write(sw.buf); err != nil {
+		return err
+	}
+
+	return sw.w.Flush()
+}
+
+func (sw *snapshotWriter) flushRecord() error {
+	sw.crc.Write(sw.buf)
+	_, err := sw.w.Write(sw.buf)
+	sw.buf = sw.buf[:0]
+	return err
+}
+
+// isSnapshot сообщает, начинается ли поток с заголовка бинарного снимка.
+func isSnapshot(r *bufio.Reader) bool {
+	head, err := r.Peek(len(snapshotMagic))
+	return err == nil && string(head) == snapshotMagic
+}
+
+// readSnapshot потоково декодирует бинарный снимок и передаёт каждое сообщение в fn.
+// Контрольная сумма проверяется после последнего сообщения: при ошибке вызывающий
+// должен отбросить всё, что получил через fn.
+func readSnapshot(r *bufio.Reader, fn func(entry snapshotEntry)) error {
+	cr := &crcReader{r: r, crc: crc32.NewIEEE()}
+
+	header := make([]byte, len(snapshotMagic)+4)
+	if _, err := io.ReadFull(cr, header); err != nil {
+		return fmt.Errorf("%w: header: %w", errSnapshotCorrupt, err)
+	}
+	if string(header[:len(snapshotMagic)]) != snapshotMagic {
+		return fmt.Errorf("%w: bad magic", errSnapshotCorrupt)
+	}
+	if version := binary.LittleEndian.Uint32(header[len(snapshotMagic):]); version != snapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %d", version)
+	}
+
+	var count uint64
+	for {
+		tag, err := cr.ReadByte()
+		if err != nil {
+			return fmt.Errorf("%w: %w", errSnapshotCorrupt, err)
+		}
+
+		if tag == snapshotTagEnd {
+			break
+		}
+		if tag != snapshotTagMessage {
+			return fmt.Errorf("%w: unknown record tag %d", errSnapshotCorrupt, tag)
+		}
+
+		entry, err := readSnapshotMessage(cr)
+		if err != nil {
+			return fmt.Errorf("%w: message %d: %w", errSnapshotCorrupt, count, err)
+		}
+
+		fn(entry)
+		count++
+	}
+
+	trailer := make([]byte, 8)
+	if _, err := io.ReadFull(cr, trailer); err != nil {
+		return fmt.Errorf("%w: trailer: %w", errSnapshotCorrupt, err)
+	}
+	if expected := binary.LittleEndian.Uint64(trailer); expected != count {
+		return fmt.Errorf("%w: expected %d messages, got %d", errSnapshotCorrupt, expected, count)
+	}
+
+	sum := cr.crc.Sum32()
+	checksum := make([]byte, 4)
+	if _, err := io.ReadFull(r, checksum); err != nil {
+		return fmt.Errorf("%w: checksum: %w", errSnapshotCorrupt, err)
+	}
+	if binary.LittleEndian.Uint32(checksum) != sum {
+		return fmt.Errorf("%w: checksum mismatch", errSnapshotCorrupt)
+	}
+
+	return nil
+}
+
+func readSnapshotMessage(r *crcReader) (snapshotEntry, error) {
+	flags, err := r.ReadByte()
+	if err != nil {
+		return snapshotEntry{}, err
+	}
+
+	msg := &message.Message{}
+
+	if msg.ID, err = readString(r); err != nil {
+		return snapshotEntry{}, err
+	}
+	if msg.RoutingKey, err = readString(r); err != nil {
+		return snapshotEntry{}, err
+	}
+	if msg.RoutingSettings, err = readMap(r); err != nil {
+		return snapshotEntry{}, err
+	}
+	if msg.Payload, err = readBytes(r); err != nil {
+		return snapshotEntry{}, err
+	}
+	if msg.Metadata, err = readMap(r); err != nil {
+		return snapshotEntry{}, err
+	}
+	if msg.CreatedAt, err = readTime(r); err != nil {
+		return snapshotEntry{}, err
+	}
+	if msg.ScheduledAt, err = readTime(r); err != nil {
+		return snapshotEntry{}, err
+	}
+
+	return snapshotEntry{
+		msg:      msg,
+		inflight: flags&snapshotFlagInflight != 0,
+		failed:   flags&snapshotFlagFailed != 0,
+	}, nil
+}
+
+// crcReader считает CRC32 всех прочитанных байт.
+type crcReader struct {
+	r   *bufio.Reader
+	crc hash.Hash32
+}
+
+func (cr *crcReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.crc.Write(p[:n])
+	return n, err
+}
+
+func (cr *crcReader) ReadByte() (byte, error) {
+	b, err := cr.r.ReadByte()
+	if err == nil {
+		cr.crc.Write([]byte{b})
+	}
+	return b, err
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+func appendMap(buf []byte, m map[string]string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(m)))
+	for k, v := range m {
+		buf = appendString(buf, k)
+		buf = appendString(buf, v)
+	}
+	return buf
+}
+
+func appendTime(buf []byte, t time.Time) ([]byte, error) {
+	raw, err := t.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("snapshot encode time: %w", err)
+	}
+	buf = binary.AppendUvarint(buf, uint64(len(raw)))
+	return append(buf, raw...), nil
+}
+
+func readBytes(r *crcReader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > snapshotMaxField {
+		return nil, fmt.Errorf("field length %d exceeds limit", n)
+	}
+	if n == 0 {
+		return nil, nil
+	}
+
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func readString(r *crcReader) (string, error) {
+	buf, err := readBytes(r)
+	return string(buf), err
+}
+
+func readMap(r *crcReader) (map[string]string, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > snapshotMaxField {
+		return nil, fmt.Errorf("map size %d exceeds limit", n)
+	}
+	if n == 0 {
+		return nil, nil
+	}
+
+	m := make(map[string]string, n)
+	for range n {
+		k, err := readString(r)
+		if err != nil {
+			return nil, err
+		}
+		v, err := readString(r)
+		if err != nil {
+			return nil, err
+		}
+		m[k] = v
+	}
+	return m, nil
+}
+
+func readTime(r *crcReader) (time.Time, error) {
+	raw, err := readBytes(r)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var t time.Time
+	if err := t.UnmarshalBinary(raw); err != nil {
+		return time.Time{}, err
+	}
+	return t, nil
+}
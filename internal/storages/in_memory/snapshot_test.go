@@ -0,0 +1,126 @@
+package inmemory
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+)
+
+// writeTestSnapshot кодирует entries в бинарный снимок.
+func writeTestSnapshot(t *testing.T, entries ...snapshotEntry) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	sw, err := newSnapshotWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if err := sw.writeMessage(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sw.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	msg := message.NewMessage(
+		message.WithID("a"),
+		message.WithRoutingKey("rk"),
+		message.WithPayload([]byte("payload")),
+		message.WithMetadataValue("k", "v"),
+		message.WithScheduledAt(time.Now().Add(time.Hour)),
+	)
+	data := writeTestSnapshot(t, snapshotEntry{msg: msg, inflight: true})
+
+	var got []snapshotEntry
+	if err := readSnapshot(bufio.NewReader(bytes.NewReader(data)), func(entry snapshotEntry) { got = append(got, entry) }); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || !got[0].inflight || got[0].failed || !got[0].msg.Equal(msg) {
+		t.Fatalf("unexpected entries %+v", got)
+	}
+}
+
+func TestSnapshotChecksumMismatch(t *testing.T) {
+	msg := message.NewMessage(message.WithID("a"), message.WithPayload([]byte("payload")))
+	data := writeTestSnapshot(t, snapshotEntry{msg: msg})
+
+	// Повреждённый payload не нарушает структуру записи, его выдаёт только контрольная сумма.
+	i := bytes.Index(data, []byte("payload"))
+	data[i] ^= 0xff
+
+	err := readSnapshot(bufio.NewReader(bytes.NewReader(data)), func(snapshotEntry) {})
+	if !errors.Is(err, errSnapshotCorrupt) {
+		t.Fatalf("expected errSnapshotCorrupt, got %v", err)
+	}
+}
+
+func TestLoadLegacyJSONDump(t *testing.T) {
+	dumpFile := t.TempDir() + "/dump.json"
+	cfg := NewBuilder().WithVisibilityTimeout(time.Minute).WithDumpFile(dumpFile).Build()
+	ctx := context.Background()
+
+	pending := message.NewMessage(message.WithID("pending"), message.WithPayload([]byte("p")), message.WithScheduledAt(time.Now().Add(time.Hour)))
+	inflight := message.NewMessage(message.WithID("inflight"), message.WithPayload([]byte("in")))
+	data, err := json.Marshal(dumpData{
+		Messages: map[string]*message.Message{pending.ID: pending, inflight.ID: inflight},
+		Inflight: []string{inflight.ID},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dumpFile, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newCapacityStorage(cfg)
+	if err := s.LoadFromDump(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, _ := s.Count(ctx); n != 2 {
+		t.Fatalf("expected 2 messages, got %d", n)
+	}
+	for _, msg := range []*message.Message{pending, inflight} {
+		got, err := s.GetByID(ctx, msg.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Equal(msg) {
+			t.Fatalf("restored message differs: %+v, want %+v", got, msg)
+		}
+	}
+
+	// Выпущенное до рестарта сообщение снова ждёт выпуска в gateway.
+	if _, ok := s.shards[shardIndex(inflight.ID, len(s.shards))].inflight[inflight.ID]; !ok {
+		t.Fatal("expected in-flight message to be restored as in-flight")
+	}
+	if _, ok := s.shards[shardIndex(pending.ID, len(s.shards))].inflight[pending.ID]; ok {
+		t.Fatal("expected pending message to stay pending")
+	}
+
+	// Следующий снимок перезаписывает JSON-дамп в бинарном формате.
+	if err := s.Dump(ctx); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(dumpFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if !isSnapshot(bufio.NewReader(file)) {
+		t.Fatal("expected dump to be rewritten as binary snapshot")
+	}
+}
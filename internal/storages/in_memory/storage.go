@@ -1,54 +1,99 @@
 package inmemory
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"math"
+	"io"
 	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
 	"sync"
 	"time"
 
+	"github.com/Alexey-zaliznuak/orbital/internal/storages/pipeline"
 	"github.com/Alexey-zaliznuak/orbital/pkg/bus"
+	"github.com/Alexey-zaliznuak/orbital/pkg/clock"
 	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/node"
 	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
 	"github.com/Alexey-zaliznuak/orbital/pkg/logger"
-	natsclient "github.com/Alexey-zaliznuak/orbital/pkg/nats"
 	"github.com/Alexey-zaliznuak/orbital/pkg/sdk/coordinator"
-	"github.com/nats-io/nats.go"
 	"go.uber.org/zap"
 )
 
 var (
-	ErrNotFound       = errors.New("message not found")
-	ErrNotInitialized = errors.New("storage not initialized")
-	ErrAlreadyExists  = errors.New("message with this ID already exists")
+	ErrNotFound       = storage.ErrNotFound
+	ErrNotInitialized = storage.ErrNotInitialized
+	ErrAlreadyExists  = storage.ErrAlreadyExists
+	ErrNotInFlight    = storage.ErrNotInFlight
 )
 
+// dumpData — JSON-формат дампа предыдущих версий, поддерживается только для чтения.
 type dumpData struct {
 	Messages map[string]*message.Message `json:"messages"`
 	Inflight []string                    `json:"inflight"`
 }
 
+// inflightEntry — сообщение, выпущенное в gateway и ожидающее подтверждения.
+type inflightEntry struct {
+	msg *message.Message
+	// sentAt — время последней отправки в gateway; zero value — ещё не отправлялось.
+	sentAt time.Time
+}
+
 type InMemoryStorage struct {
 	mu sync.RWMutex
 
 	initOnce     sync.Once
 	loadDumpOnce sync.Once
 
-	messagesMu sync.RWMutex
-	messages   map[string]*message.Message
-
-	inflightMu sync.RWMutex
-	inflight   map[string]*message.Message
+	// shards — части хранилища, каждая со своими блокировками и release worker'ом.
+	shards []*shard
 
-	inflightProcessMu    sync.Mutex
-	sendExpiredProcessMu sync.Mutex
+	// wal — журнал операций, nil если UseWAL выключен.
+	wal *wal
+	// checkpointMu удерживается на чтение на время записи операции в WAL и её применения,
+	// на запись — на время ротации сегмента при checkpoint. Так все операции из
+	// сегментов до ротации гарантированно попадают в снимок.
+	checkpointMu sync.RWMutex
 
 	busClient *bus.Client
+	promoter  *pipeline.Promoter
+	// spillTo принимает сообщения сверх лимитов ёмкости и передаваемые при выводе
+	// инстанса; nil — сообщения сверх лимитов отклоняются, а вывод невозможен.
+	spillTo spillSender
+	// rehomeVia передаёт gateway сообщения вне диапазона задержек, nil — без кластера.
+	rehomeVia pipeline.RehomeSender
+	// subscriptions — подписки на шину, nil у хранилища без кластера.
+	subscriptions *pipeline.Subscriptions
+	// intakeOnce — однократная остановка приёма сообщений из шины при выводе или эвакуации.
+	intakeOnce sync.Once
+	// meter измеряет нагрузку для heartbeat, nil — без кластера.
+	meter *pipeline.LoadMeter
+	// unregister удаляет адрес инстанса из координатора при выводе, nil — без кластера.
+	unregister func(ctx context.Context, storageID, address string) error
+
+	// Фоновые задачи останавливаются по отдельности: при выводе инстанса — heartbeat
+	// и release worker'ы, в Close — всё вместе с финальным снимком.
+	stop            context.CancelFunc
+	stopWorkers     context.CancelFunc
+	stopHeartbeat   context.CancelFunc
+	workers         sync.WaitGroup
+	heartbeatDone   chan struct{}
+	persistenceDone chan struct{}
+	closeOnce       sync.Once
+
+	drain drainState
+
+	// used — занятая ёмкость для лимитов MaxMessages и MaxPayloadBytes.
+	used usage
 
 	cfg   *InMemoryStorageConfig
+	clock clock.Clock
 	ready bool
 }
 
@@ -56,6 +101,20 @@ func NewInMemoryStorage() *InMemoryStorage {
 	return &InMemoryStorage{}
 }
 
+// NewStandalone создаёт хранилище с конфигурацией cfg без подключения к кластеру:
+// без шины, координатора и фоновых воркеров. Состояние восстанавливается из снимка
+// и WAL, сообщения забираются через FetchReady. Используется для встраивания и симуляций.
+func NewStandalone(ctx context.Context, cfg *InMemoryStorageConfig) (*InMemoryStorage, error) {
+	s := NewInMemoryStorage()
+	s.initState(cfg)
+
+	if err := s.restore(ctx); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
 func (s *InMemoryStorage) Initialize(ctx context.Context, rawConfig any) error {
 	var err error
 
@@ -83,228 +142,619 @@ func (s *InMemoryStorage) initialize(ctx context.Context, rawConfig any) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	busClient, err := pipeline.Connect(ctx, cfg.ClusterAddress)
+	if err != nil {
+		return err
+	}
+	s.busClient = busClient
+	s.spillTo = busClient
+	s.rehomeVia = busClient
+
 	coordinatorClient := coordinator.NewClient(coordinator.ClientConfig{
 		BaseURL: cfg.ClusterAddress,
 	})
+	s.promoter = pipeline.NewPromoter(busClient, coordinatorClient.ListStorages, &cfg.BaseStorageConfig)
+
+	s.initState(cfg)
+
+	if err := s.restore(ctx); err != nil {
+		return err
+	}
 
-	clusterCfg, err := coordinatorClient.GetClusterConfig(ctx)
+	subscriptions, err := pipeline.Subscribe(s.busClient, cfg.ID, s, s.Acknowledge, cfg.NakDelay)
 	if err != nil {
-		return fmt.Errorf("failed to get cluster config: %w", err)
+		return err
 	}
+	s.subscriptions = subscriptions
+	s.meter = pipeline.NewLoadMeter(s, subscriptions, cfg.Clock)
+	s.unregister = coordinatorClient.UnregisterStorageAddress
 
-	natsClient, err := natsclient.New(natsclient.Config{
-		URL: clusterCfg.NatsAddress,
-	})
+	// Фоновые задачи живут до Close, а не до отмены ctx инициализации.
+	runCtx, stop := context.WithCancel(context.WithoutCancel(ctx))
+	workersCtx, stopWorkers := context.WithCancel(runCtx)
+	heartbeatCtx, stopHeartbeat := context.WithCancel(runCtx)
+	s.stop, s.stopWorkers, s.stopHeartbeat = stop, stopWorkers, stopHeartbeat
 
-	if err != nil {
-		return fmt.Errorf("failed to connect to NATS: %w", err)
+	for _, sh := range s.shards {
+		s.workers.Add(1)
+		go func() {
+			defer s.workers.Done()
+			s.runReleaseWorker(workersCtx, sh)
+		}()
 	}
 
-	s.busClient = bus.New(natsClient)
+	s.persistenceDone = make(chan struct{})
+	go func() {
+		defer close(s.persistenceDone)
+		s.runPersistence(runCtx)
+	}()
 
-	s.cfg = cfg
-	s.messages = make(map[string]*message.Message)
-	s.inflight = make(map[string]*message.Message)
-	s.ready = true
+	s.heartbeatDone = make(chan struct{})
+	go func() {
+		defer close(s.heartbeatDone)
+		pipeline.RunHeartbeat(heartbeatCtx, coordinatorClient, &cfg.BaseStorageConfig, s.Report)
+	}()
 
-	s.loadDumpOnce.Do(func() {
-		if !cfg.UseDump {
+	return nil
+}
+
+// Close останавливает фоновые задачи и ждёт финального снимка и закрытия WAL.
+// Хранилище без кластера (NewStandalone) сохраняет снимок сразу.
+// Повторные вызовы ничего не делают.
+func (s *InMemoryStorage) Close() error {
+	if err := s.checkReady(); err != nil {
+		return err
+	}
+
+	s.closeOnce.Do(func() {
+		if s.stop == nil {
+			s.shutdownPersistence()
 			return
 		}
-		if err := s.LoadFromDump(ctx); err != nil {
-			logger.Log.Error("failed to load dump", zap.Error(err))
+
+		s.stop()
+		s.workers.Wait()
+		<-s.heartbeatDone
+		<-s.persistenceDone
+	})
+
+	return nil
+}
+
+// restore загружает снимок и проигрывает поверх него WAL, после чего открывает WAL для записи.
+// Отсутствующий снимок не ошибка; повреждённый — ошибка, и хранилище не запускается.
+func (s *InMemoryStorage) restore(ctx context.Context) error {
+	var loadErr error
+	s.loadDumpOnce.Do(func() {
+		if !s.cfg.UseDump && !s.cfg.UseWAL {
+			return
 		}
+		loadErr = s.LoadFromDump(ctx)
 	})
 
-	findExpiredTicker := time.NewTicker(cfg.FindExpiredInterval)
-	sendExpiredTicker := time.NewTicker(cfg.SendExpiredInterval)
+	// Нечитаемый снимок нельзя пропускать: первый же checkpoint перезаписал бы его
+	// пустым состоянием и удалил сегменты WAL, то есть все сохранённые сообщения.
+	if loadErr != nil {
+		return fmt.Errorf("failed to load dump: %w", loadErr)
+	}
 
-	s.busClient.NewHandlerOnStorageMessages(cfg.ID, s.HandleNewMessages)
+	if s.cfg.UseWAL {
+		w, err := openWAL(s.cfg.WALDir, s.cfg.WALFsync, s.cfg.WALSegmentSize, s.applyWALRecord)
+		if err != nil {
+			return fmt.Errorf("failed to open wal: %w", err)
+		}
+		s.wal = w
+	}
 
-	go func() {
-		defer findExpiredTicker.Stop()
-		defer sendExpiredTicker.Stop()
-
-		for {
-			select {
-			case <-ctx.Done():
-				if s.cfg.UseDump {
-					if err := s.Dump(ctx); err != nil {
-						logger.Log.Error("failed to dump", zap.Error(err))
-					}
+	return nil
+}
+
+// runReleaseWorker периодически переносит наступившие и подлежащие продвижению
+// сообщения shard'а в inflight и выпускает их до отмены ctx.
+func (s *InMemoryStorage) runReleaseWorker(ctx context.Context, sh *shard) {
+	findExpiredTicker := time.NewTicker(s.cfg.FindExpiredInterval)
+	defer findExpiredTicker.Stop()
+
+	sendExpiredTicker := time.NewTicker(s.cfg.SendExpiredInterval)
+	defer sendExpiredTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-findExpiredTicker.C:
+			sh.moveExpiredToInflight(s.promoter.Horizon(ctx, s.clock.Now()))
+		case <-sendExpiredTicker.C:
+			if err := s.processMessages(ctx, sh); err != nil {
+				logger.Log.Error("failed to process expired messages", zap.Error(err))
+			}
+		}
+	}
+}
+
+// runPersistence периодически сбрасывает WAL на диск и делает checkpoint
+// (или просто снимок, если WAL выключен), а при отмене ctx сохраняет финальный снимок.
+func (s *InMemoryStorage) runPersistence(ctx context.Context) {
+	var checkpointC, fsyncC <-chan time.Time
+
+	// Без WAL снимок делается раз в DumpInterval: checkpoint WAL и так сохраняет снимок.
+	if s.wal == nil && s.cfg.UseDump && s.cfg.DumpInterval > 0 {
+		dumpTicker := time.NewTicker(s.cfg.DumpInterval)
+		defer dumpTicker.Stop()
+		checkpointC = dumpTicker.C
+	}
+
+	if s.wal != nil {
+		checkpointTicker := time.NewTicker(s.cfg.WALCheckpointInterval)
+		defer checkpointTicker.Stop()
+		checkpointC = checkpointTicker.C
+
+		if s.cfg.WALFsync == WALFsyncInterval {
+			fsyncTicker := time.NewTicker(s.cfg.WALFsyncInterval)
+			defer fsyncTicker.Stop()
+			fsyncC = fsyncTicker.C
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.shutdownPersistence()
+			return
+		case <-checkpointC:
+			if s.wal == nil {
+				if err := s.Dump(ctx); err != nil {
+					logger.Log.Error("failed to dump", zap.Error(err))
 				}
-				return
-			case <-findExpiredTicker.C:
-				go func() {
-					if ok := s.inflightProcessMu.TryLock(); !ok {
-						return
-					}
-					defer s.inflightProcessMu.Unlock()
-
-					if err := s.moveExpiredToInflight(ctx); err != nil {
-						logger.Log.Error("failed to move ready to inflight", zap.Error(err))
-					}
-				}()
-			case <-sendExpiredTicker.C:
-				go func() {
-					if ok := s.sendExpiredProcessMu.TryLock(); !ok {
-						return
-					}
-					defer s.sendExpiredProcessMu.Unlock()
-
-					if err := s.processMessages(ctx); err != nil {
-						logger.Log.Error("failed to process expired messages", zap.Error(err))
-					}
-				}()
+				continue
+			}
+			if err := s.checkpoint(); err != nil {
+				logger.Log.Error("failed to checkpoint", zap.Error(err))
+			}
+		case <-fsyncC:
+			if err := s.wal.sync(); err != nil {
+				logger.Log.Error("failed to sync wal", zap.Error(err))
 			}
 		}
-	}()
+	}
+}
+
+func (s *InMemoryStorage) shutdownPersistence() {
+	if s.wal == nil {
+		if s.cfg.UseDump {
+			if err := s.Dump(context.Background()); err != nil {
+				logger.Log.Error("failed to dump", zap.Error(err))
+			}
+		}
+		return
+	}
+
+	if err := s.checkpoint(); err != nil {
+		logger.Log.Error("failed to checkpoint", zap.Error(err))
+	}
+	if err := s.wal.close(); err != nil {
+		logger.Log.Error("failed to close wal", zap.Error(err))
+	}
+}
+
+// checkpoint сохраняет состояние в DumpFile и удаляет сегменты WAL, вошедшие в снимок.
+// Операции, записанные после ротации, могут частично попасть в снимок: их повторное
+// применение при проигрывании идемпотентно.
+func (s *InMemoryStorage) checkpoint() error {
+	s.checkpointMu.Lock()
+	seq, err := s.wal.rotate()
+	s.checkpointMu.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("wal rotate: %w", err)
+	}
+
+	if err := s.Dump(context.Background()); err != nil {
+		return err
+	}
+
+	if err := s.wal.removeBefore(seq); err != nil {
+		return err
+	}
 
 	return nil
 }
 
+// applyWALRecord применяет к состоянию операцию, проигранную из WAL.
+func (s *InMemoryStorage) applyWALRecord(rec *walRecord) {
+	switch rec.Op {
+	case walOpStore:
+		s.store(rec.Messages)
+	case walOpAck, walOpCancel:
+		s.remove(rec.IDs)
+	case walOpFail:
+		for _, id := range rec.IDs {
+			s.shards[shardIndex(id, len(s.shards))].fail([]string{id})
+		}
+	default:
+		logger.Log.Warn("Unknown wal operation, skipping", zap.Uint8("op", uint8(rec.Op)))
+	}
+}
+
+// logOperation записывает операцию в WAL, если он включён.
+// Вызывающий удерживает checkpointMu на чтение до применения операции.
+func (s *InMemoryStorage) logOperation(rec *walRecord) error {
+	if s.wal == nil {
+		return nil
+	}
+
+	if err := s.wal.append(rec); err != nil {
+		return fmt.Errorf("wal append: %w", err)
+	}
+
+	return nil
+}
+
+// initState подготавливает пустое хранилище с конфигурацией cfg.
+// Количество shard'ов по умолчанию равно GOMAXPROCS.
+func (s *InMemoryStorage) initState(cfg *InMemoryStorageConfig) {
+	shards := cfg.Shards
+	if shards <= 0 {
+		shards = runtime.GOMAXPROCS(0)
+	}
+
+	s.cfg = cfg
+	s.clock = clock.OrSystem(cfg.Clock)
+	s.shards = make([]*shard, shards)
+	for i := range s.shards {
+		s.shards[i] = newShard()
+	}
+	s.ready = true
+}
+
 func (s *InMemoryStorage) HealthCheck(_ context.Context) (storage.StorageHealth, error) {
 	if err := s.checkReady(); err != nil {
 		return storage.StorageHealthDisconnect, err
 	}
+	if s.Status() == node.NodeStatusDegraded {
+		return storage.StorageHealthDegraded, nil
+	}
 	return storage.StorageHealthOK, nil
 }
 
-func (s *InMemoryStorage) Store(_ context.Context, msgs []*message.Message) error {
+// Store сохраняет сообщения по одному: сообщение с уже занятым ID и идентичным
+// содержимым считается дубликатом, с отличающимся — получает ErrAlreadyExists.
+// Сообщения сверх лимитов ёмкости отправляются в SpillStorageID или получают
+// ErrCapacityExceeded. Во время вывода инстанса Store возвращает ErrDraining.
+func (s *InMemoryStorage) Store(_ context.Context, msgs []*message.Message) ([]storage.StoreResult, error) {
 	if err := s.checkReady(); err != nil {
-		return err
+		return nil, err
+	}
+	if s.drain.active.Load() {
+		return nil, storage.ErrDraining
 	}
 
-	s.messagesMu.Lock()
-	defer s.messagesMu.Unlock()
+	msgs = storage.WithIDs(msgs)
 
-	for _, msg := range msgs {
-		copied := *msg
-		if copied.ID == "" {
-			copied.ID = message.GenerateID()
-		}
+	admitted, overflow, reserved, reservedBytes := s.admit(msgs)
+	defer s.used.add(-reserved, -reservedBytes)
 
-		if _, exists := s.messages[copied.ID]; exists {
-			return fmt.Errorf("%w: %s", ErrAlreadyExists, copied.ID)
+	results := make([]storage.StoreResult, len(msgs))
+	if len(overflow) > 0 {
+		s.spill(msgs, overflow, results)
+	}
+	if len(admitted) == 0 {
+		return results, nil
+	}
+
+	toStore := msgs
+	if len(overflow) > 0 {
+		toStore = make([]*message.Message, len(admitted))
+		for j, i := range admitted {
+			toStore[j] = msgs[i]
 		}
+	}
 
-		s.messages[copied.ID] = &copied
+	s.checkpointMu.RLock()
+	defer s.checkpointMu.RUnlock()
+
+	if err := s.logOperation(&walRecord{Op: walOpStore, Messages: toStore}); err != nil {
+		return nil, err
 	}
 
-	return nil
+	for j, result := range s.store(toStore) {
+		results[admitted[j]] = result
+	}
+
+	return results, nil
 }
 
-func (s *InMemoryStorage) HandleNewMessages(msg *nats.Msg) {
-	msgs := make([]*message.Message, 0)
+// store раскладывает сообщения с уже заданными ID по shard'ам.
+func (s *InMemoryStorage) store(msgs []*message.Message) []storage.StoreResult {
+	results := make([]storage.StoreResult, len(msgs))
+	byShard := make(map[int][]int)
 
-	if err := json.Unmarshal(msg.Data, &msgs); err != nil {
-		logger.Log.Error("Received messages unmarshal error", zap.Error(err))
-		return
+	for i, msg := range msgs {
+		n := shardIndex(msg.ID, len(s.shards))
+		byShard[n] = append(byShard[n], i)
 	}
 
-	if err := s.Store(context.Background(), msgs); err != nil {
-		logger.Log.Error("Failed to store messages", zap.Error(err))
+	for n, idx := range byShard {
+		s.used.add(s.shards[n].store(msgs, idx, results))
 	}
+
+	return results
 }
 
-func (s *InMemoryStorage) processMessages(ctx context.Context) error {
+// processMessages выпускает (в gateway или более горячее хранилище) сообщения shard'а,
+// которые ещё не выпускались или не были подтверждены в течение VisibilityTimeout.
+// Сообщения остаются в inflight до подтверждения.
+func (s *InMemoryStorage) processMessages(ctx context.Context, sh *shard) error {
 	if err := s.checkReady(); err != nil {
 		return err
 	}
 
-	s.inflightMu.RLock()
-
-	batchSize := int(math.Min(float64(len(s.inflight)), float64(s.cfg.MaxOutputBatchSize)))
+	now := s.clock.Now()
 
-	if batchSize == 0 {
+	msgs, marks := sh.claimUnsent(now, s.cfg.VisibilityTimeout, s.cfg.MaxOutputBatchSize)
+	if len(msgs) == 0 {
 		return nil
 	}
 
-	ids := make([]string, 0, batchSize)
-	msgs := make([]*message.Message, 0, batchSize)
+	if err := s.promoter.Release(ctx, msgs, now); err != nil {
+		sh.unclaimUnsent(msgs, marks, now)
+		return err
+	}
 
-	for _, msg := range s.inflight {
-		msgs = append(msgs, msg)
-		ids = append(ids, msg.ID)
+	return nil
+}
 
-		if len(msgs) >= batchSize {
-			break
-		}
+// FetchExpiring возвращает до limit ожидающих сообщений с ScheduledAt в пределах threshold.
+func (s *InMemoryStorage) FetchExpiring(_ context.Context, threshold time.Duration, limit int) ([]*storage.StoredMessage, error) {
+	if err := s.checkReady(); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		return nil, nil
 	}
 
-	s.inflightMu.RUnlock()
+	until := s.clock.Now().Add(threshold)
 
-	if err := s.busClient.SendToGateway(msgs); err != nil {
+	expiring := make([]*storage.StoredMessage, 0)
+	for _, sh := range s.shards {
+		expiring = append(expiring, sh.fetchExpiring(until)...)
+	}
+
+	return firstScheduled(expiring, limit), nil
+}
+
+// FetchReady выдаёт до limit наступивших сообщений. Сообщения, которые release worker
+// уже выпустил в gateway и чей VisibilityTimeout не истёк, не выдаются.
+func (s *InMemoryStorage) FetchReady(_ context.Context, limit int) ([]*storage.StoredMessage, error) {
+	if err := s.checkReady(); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	now := s.clock.Now()
+
+	candidates := make([]*message.Message, 0)
+	for _, sh := range s.shards {
+		sh.moveExpiredToInflight(now)
+		candidates = append(candidates, sh.readyCandidates(now, s.cfg.VisibilityTimeout)...)
+	}
+
+	slices.SortFunc(candidates, compareSchedule)
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+
+	byShard := make(map[int][]*message.Message)
+	for _, msg := range candidates {
+		n := shardIndex(msg.ID, len(s.shards))
+		byShard[n] = append(byShard[n], msg)
+	}
+
+	ready := make([]*storage.StoredMessage, 0, len(candidates))
+	for n, msgs := range byShard {
+		ready = append(ready, s.shards[n].claimReady(msgs, now, s.cfg.VisibilityTimeout)...)
+	}
+
+	return firstScheduled(ready, limit), nil
+}
+
+func (s *InMemoryStorage) moveExpiredToInflight(_ context.Context) error {
+	if err := s.checkReady(); err != nil {
 		return err
 	}
 
-	if err := s.acknowledge(ctx, ids); err != nil {
+	now := s.clock.Now()
+	for _, sh := range s.shards {
+		sh.moveExpiredToInflight(now)
+	}
+
+	return nil
+}
+
+// firstScheduled сортирует сообщения по ScheduledAt и оставляет первые limit.
+func firstScheduled(msgs []*storage.StoredMessage, limit int) []*storage.StoredMessage {
+	slices.SortFunc(msgs, func(a, b *storage.StoredMessage) int { return compareSchedule(a.Message, b.Message) })
+	if len(msgs) > limit {
+		msgs = msgs[:limit]
+	}
+	return msgs
+}
+
+// Acknowledge удаляет сообщения, доставку которых подтвердил gateway,
+// сохранение которых подтвердило более горячее хранилище или обработку
+// которых подтвердил клиент FetchReady.
+func (s *InMemoryStorage) Acknowledge(_ context.Context, ids []string) error {
+	if err := s.checkReady(); err != nil {
+		return err
+	}
+
+	s.checkpointMu.RLock()
+	defer s.checkpointMu.RUnlock()
+
+	if err := s.logOperation(&walRecord{Op: walOpAck, IDs: ids}); err != nil {
 		return err
 	}
 
+	s.remove(ids)
 	return nil
 }
 
-func (s *InMemoryStorage) moveExpiredToInflight(_ context.Context) error {
+// Reject возвращает выданное сообщение в очередь или переводит его в Failed.
+// Повторная постановка не журналируется: после рестарта выданные сообщения
+// и так выдаются повторно.
+func (s *InMemoryStorage) Reject(_ context.Context, id string, requeue bool) error {
 	if err := s.checkReady(); err != nil {
 		return err
 	}
 
-	now := time.Now()
+	sh := s.shards[shardIndex(id, len(s.shards))]
+	if requeue {
+		return sh.reject(id, true)
+	}
 
-	s.messagesMu.RLock()
-	defer s.messagesMu.RUnlock()
+	s.checkpointMu.RLock()
+	defer s.checkpointMu.RUnlock()
 
-	s.inflightMu.Lock()
-	defer s.inflightMu.Unlock()
+	// Проверяем состояние до записи в WAL, чтобы не журналировать отклонённые операции.
+	if stored, ok := sh.getStored(id); !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	} else if stored.Status != storage.MessageStatusInFlight {
+		return fmt.Errorf("%w: %s", ErrNotInFlight, id)
+	}
 
-	for id, msg := range s.messages {
-		if _, inFlight := s.inflight[id]; inFlight {
-			continue
-		}
-		if !isReady(msg, now) {
-			continue
-		}
-		s.inflight[id] = msg
+	if err := s.logOperation(&walRecord{Op: walOpFail, IDs: []string{id}}); err != nil {
+		return err
 	}
 
-	return nil
+	return sh.reject(id, false)
 }
 
-func (s *InMemoryStorage) acknowledge(_ context.Context, ids []string) error {
+// Delete удаляет сообщение в любом состоянии.
+func (s *InMemoryStorage) Delete(ctx context.Context, id string) error {
 	if err := s.checkReady(); err != nil {
 		return err
 	}
 
-	s.messagesMu.Lock()
-	defer s.messagesMu.Unlock()
+	if !s.shards[shardIndex(id, len(s.shards))].has(id) {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
 
-	s.inflightMu.Lock()
-	defer s.inflightMu.Unlock()
+	return s.Cancel(ctx, []string{id})
+}
 
-	for _, id := range ids {
-		delete(s.inflight, id)
-		delete(s.messages, id)
+// Cancel удаляет запланированные сообщения до их отправки в gateway.
+// Отсутствующие идентификаторы пропускаются.
+func (s *InMemoryStorage) Cancel(_ context.Context, ids []string) error {
+	if err := s.checkReady(); err != nil {
+		return err
+	}
+
+	s.checkpointMu.RLock()
+	defer s.checkpointMu.RUnlock()
+
+	if err := s.logOperation(&walRecord{Op: walOpCancel, IDs: ids}); err != nil {
+		return err
 	}
 
+	s.remove(ids)
 	return nil
 }
 
-func (s *InMemoryStorage) GetByID(_ context.Context, id string) (*message.Message, error) {
+// remove удаляет сообщения с идентификаторами ids из их shard'ов.
+func (s *InMemoryStorage) remove(ids []string) {
+	byShard := make(map[int][]string)
+	for _, id := range ids {
+		n := shardIndex(id, len(s.shards))
+		byShard[n] = append(byShard[n], id)
+	}
+
+	for n, shardIDs := range byShard {
+		removed, removedBytes := s.shards[n].remove(shardIDs)
+		s.used.add(-removed, -removedBytes)
+	}
+}
+
+// Get возвращает сообщение вместе с его состоянием.
+func (s *InMemoryStorage) Get(_ context.Context, id string) (*storage.StoredMessage, error) {
 	if err := s.checkReady(); err != nil {
 		return nil, err
 	}
 
-	s.messagesMu.RLock()
-	defer s.messagesMu.RUnlock()
+	stored, ok := s.shards[shardIndex(id, len(s.shards))].getStored(id)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
 
-	msg, ok := s.messages[id]
+	return stored, nil
+}
+
+// List возвращает страницу сообщений, удовлетворяющих фильтру, в порядке (ScheduledAt, ID).
+// Каждая страница просматривает все сообщения хранилища, но копирует и упорядочивает
+// только кандидатов в страницу.
+func (s *InMemoryStorage) List(_ context.Context, query storage.ListQuery) (*storage.ListPage, error) {
+	if err := s.checkReady(); err != nil {
+		return nil, err
+	}
+
+	var after *storage.ListCursor
+	if query.Cursor != "" {
+		cursor, err := storage.ParseListCursor(query.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		after = &cursor
+	}
+
+	if query.Limit <= 0 {
+		return &storage.ListPage{}, nil
+	}
+
+	// Лишнее сообщение показывает, что за страницей есть продолжение.
+	top := newTopSchedule(query.Limit + 1)
+	for _, sh := range s.shards {
+		sh.list(&query.Filter, after, top)
+	}
+
+	matched := top.sorted()
+	page := &storage.ListPage{Messages: matched}
+	if len(matched) > query.Limit {
+		page.Messages = matched[:query.Limit]
+		page.NextCursor = storage.CursorAfter(page.Messages[query.Limit-1].Message).Encode()
+	}
+
+	return page, nil
+}
+
+// ScheduledHistogram строит гистограмму ожидающих сообщений по ScheduledAt.
+func (s *InMemoryStorage) ScheduledHistogram(_ context.Context, query storage.HistogramQuery) (*storage.Histogram, error) {
+	if err := s.checkReady(); err != nil {
+		return nil, err
+	}
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+
+	h := storage.NewHistogram(query, s.clock.Now())
+	for _, sh := range s.shards {
+		sh.histogram(h)
+	}
+
+	return h, nil
+}
+
+func (s *InMemoryStorage) GetByID(_ context.Context, id string) (*message.Message, error) {
+	if err := s.checkReady(); err != nil {
+		return nil, err
+	}
+
+	msg, ok := s.shards[shardIndex(id, len(s.shards))].get(id)
 	if !ok {
 		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
 	}
 
-	copied := *msg
-	return &copied, nil
+	return msg, nil
 }
 
 func (s *InMemoryStorage) Count(_ context.Context) (int64, error) {
@@ -312,80 +762,152 @@ func (s *InMemoryStorage) Count(_ context.Context) (int64, error) {
 		return 0, err
 	}
 
-	s.messagesMu.RLock()
-	defer s.messagesMu.RUnlock()
+	var total int64
+	for _, sh := range s.shards {
+		total += int64(sh.count())
+	}
 
-	return int64(len(s.messages)), nil
+	return total, nil
 }
 
+// Dump сохраняет состояние в DumpFile в бинарном формате снимка (см. snapshot.go).
+// Снимок пишется во временный файл и атомарно подменяет предыдущий, поэтому
+// падение во время записи не портит последний удачный снимок.
 func (s *InMemoryStorage) Dump(_ context.Context) error {
 	if err := s.checkReady(); err != nil {
 		return err
 	}
 
-	s.messagesMu.RLock()
-	defer s.messagesMu.RUnlock()
+	tmp := s.cfg.DumpFile + ".tmp"
+
+	file, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("dump create %s: %w", tmp, err)
+	}
+
+	if err := s.writeSnapshot(file); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("dump sync %s: %w", tmp, err)
+	}
 
-	s.inflightMu.RLock()
-	defer s.inflightMu.RUnlock()
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("dump close %s: %w", tmp, err)
+	}
 
-	inflight := make([]string, 0, len(s.inflight))
+	if err := os.Rename(tmp, s.cfg.DumpFile); err != nil {
+		return fmt.Errorf("dump rename %s: %w", s.cfg.DumpFile, err)
+	}
 
-	for id := range s.inflight {
-		inflight = append(inflight, id)
+	// Без fsync каталога переименование может не пережить падение, а сегменты WAL
+	// после checkpoint уже удалены.
+	if err := syncDir(filepath.Dir(s.cfg.DumpFile)); err != nil {
+		return fmt.Errorf("dump sync dir: %w", err)
 	}
 
-	data := dumpData{
-		Messages: s.messages,
-		Inflight: inflight,
+	return nil
+}
+
+// syncDir сбрасывает на диск записи каталога dir: созданные и переименованные в нём файлы.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
 	}
+	defer d.Close()
+
+	return d.Sync()
+}
 
-	raw, err := json.MarshalIndent(data, "", "  ")
+// writeSnapshot кодирует shard'ы по одному, не собирая всё состояние в памяти.
+func (s *InMemoryStorage) writeSnapshot(w io.Writer) error {
+	sw, err := newSnapshotWriter(w)
 	if err != nil {
-		return fmt.Errorf("dump marshal: %w", err)
+		return fmt.Errorf("dump write header: %w", err)
+	}
+
+	for _, sh := range s.shards {
+		for _, entry := range sh.snapshot() {
+			if err := sw.writeMessage(entry); err != nil {
+				return fmt.Errorf("dump write message %s: %w", entry.msg.ID, err)
+			}
+		}
 	}
 
-	if err := os.WriteFile(s.cfg.DumpFile, raw, 0o644); err != nil {
-		return fmt.Errorf("dump write %s: %w", s.cfg.DumpFile, err)
+	if err := sw.close(); err != nil {
+		return fmt.Errorf("dump write trailer: %w", err)
 	}
 
 	return nil
 }
 
+// LoadFromDump восстанавливает состояние из DumpFile. Поддерживается как бинарный
+// снимок, так и JSON-дамп предыдущих версий.
 func (s *InMemoryStorage) LoadFromDump(_ context.Context) error {
-	raw, err := os.ReadFile(s.cfg.DumpFile)
+	file, err := os.Open(s.cfg.DumpFile)
 	if errors.Is(err, os.ErrNotExist) {
 		return nil
 	}
 	if err != nil {
 		return fmt.Errorf("dump read %s: %w", s.cfg.DumpFile, err)
 	}
+	defer file.Close()
+
+	messages := make([]map[string]*message.Message, len(s.shards))
+	inflight := make([][]string, len(s.shards))
+	failed := make([][]string, len(s.shards))
+	for i := range s.shards {
+		messages[i] = make(map[string]*message.Message)
+	}
 
-	var data dumpData
-	if err := json.Unmarshal(raw, &data); err != nil {
-		return fmt.Errorf("dump unmarshal: %w", err)
+	add := func(entry snapshotEntry) {
+		n := shardIndex(entry.msg.ID, len(s.shards))
+		messages[n][entry.msg.ID] = entry.msg
+		if entry.inflight {
+			inflight[n] = append(inflight[n], entry.msg.ID)
+		}
+		if entry.failed {
+			failed[n] = append(failed[n], entry.msg.ID)
+		}
 	}
 
-	s.messagesMu.Lock()
-	defer s.messagesMu.Unlock()
+	reader := bufio.NewReader(file)
 
-	s.inflightMu.Lock()
-	defer s.inflightMu.Unlock()
+	if isSnapshot(reader) {
+		if err := readSnapshot(reader, add); err != nil {
+			return fmt.Errorf("dump decode %s: %w", s.cfg.DumpFile, err)
+		}
+	} else {
+		var data dumpData
+		if err := json.NewDecoder(reader).Decode(&data); err != nil {
+			return fmt.Errorf("dump unmarshal: %w", err)
+		}
 
-	s.messages = data.Messages
-	if s.messages == nil {
-		s.messages = make(map[string]*message.Message)
+		inflightIDs := make(map[string]struct{}, len(data.Inflight))
+		for _, id := range data.Inflight {
+			inflightIDs[id] = struct{}{}
+		}
+		for _, msg := range data.Messages {
+			_, isInflight := inflightIDs[msg.ID]
+			add(snapshotEntry{msg: msg, inflight: isInflight})
+		}
 	}
 
-	s.inflight = make(map[string]*message.Message, len(data.Inflight))
-
-	for _, id := range data.Inflight {
-		msg, ok := data.Messages[id]
-		if !ok {
-			continue
+	var loaded, loadedBytes int64
+	for i, sh := range s.shards {
+		sh.load(messages[i], inflight[i], failed[i])
+		for _, msg := range messages[i] {
+			loaded++
+			loadedBytes += int64(len(msg.Payload))
 		}
-		s.inflight[id] = msg
 	}
+	s.used.messages.Store(loaded)
+	s.used.bytes.Store(loadedBytes)
 
 	return nil
 }
@@ -0,0 +1,136 @@
+package inmemory
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+)
+
+// pendingMessages — количество отложенных сообщений, которыми заполняется хранилище перед замером.
+const pendingMessages = 1_000_000
+
+// newBenchStorage создаёт хранилище без подключения к кластеру и заполняет его
+// pendingMessages сообщениями, запланированными на далёкое будущее.
+// ID задаются явно, чтобы замер не зависел от генератора идентификаторов.
+func newBenchStorage(b *testing.B) *InMemoryStorage {
+	b.Helper()
+
+	s := NewInMemoryStorage()
+	s.initState(NewBuilder().WithMaxOutputBatchSize(100).Build())
+
+	ctx := context.Background()
+	base := time.Now().Add(24 * time.Hour)
+	batch := make([]*message.Message, 0, 1000)
+
+	for i := range pendingMessages {
+		batch = append(batch, message.NewMessage(
+			message.WithID("pending-"+strconv.Itoa(i)),
+			message.WithRoutingKey("bench"),
+			message.WithScheduledAt(base.Add(time.Duration(i)*time.Millisecond)),
+		))
+		if len(batch) == cap(batch) {
+			if _, err := s.Store(ctx, batch); err != nil {
+				b.Fatal(err)
+			}
+			batch = batch[:0]
+		}
+	}
+
+	return s
+}
+
+// BenchmarkStore измеряет сохранение одного сообщения при pendingMessages ожидающих.
+func BenchmarkStore(b *testing.B) {
+	s := newBenchStorage(b)
+	ctx := context.Background()
+	scheduledAt := time.Now().Add(time.Hour)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := range b.N {
+		msg := message.NewMessage(
+			message.WithID("store-"+strconv.Itoa(i)),
+			message.WithRoutingKey("bench"),
+			message.WithScheduledAt(scheduledAt),
+		)
+		if _, err := s.Store(ctx, []*message.Message{msg}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkStoreParallel измеряет сохранение сообщений из нескольких горутин,
+// которые распределяются по shard'ам и не конкурируют за одну блокировку.
+func BenchmarkStoreParallel(b *testing.B) {
+	s := newBenchStorage(b)
+	ctx := context.Background()
+	scheduledAt := time.Now().Add(time.Hour)
+	var seq atomic.Int64
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			msg := message.NewMessage(
+				message.WithID("parallel-"+strconv.FormatInt(seq.Add(1), 10)),
+				message.WithRoutingKey("bench"),
+				message.WithScheduledAt(scheduledAt),
+			)
+			if _, err := s.Store(ctx, []*message.Message{msg}); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+// BenchmarkRelease измеряет поиск наступивших сообщений, их выпуск и подтверждение
+// при pendingMessages ожидающих. Каждая итерация выпускает одно сообщение.
+func BenchmarkRelease(b *testing.B) {
+	s := newBenchStorage(b)
+	ctx := context.Background()
+	now := time.Now()
+	const batchSize = 100
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for released := 0; released < b.N; released += batchSize {
+		b.StopTimer()
+		due := make([]*message.Message, 0, batchSize)
+		ids := make([]string, 0, batchSize)
+		for i := range batchSize {
+			msg := message.NewMessage(
+				message.WithID("due-"+strconv.Itoa(released+i)),
+				message.WithRoutingKey("bench"),
+			)
+			due = append(due, msg)
+			ids = append(ids, msg.ID)
+		}
+		if _, err := s.Store(ctx, due); err != nil {
+			b.Fatal(err)
+		}
+		b.StartTimer()
+
+		if err := s.moveExpiredToInflight(ctx); err != nil {
+			b.Fatal(err)
+		}
+		for _, sh := range s.shards {
+			sh.claimUnsent(now, s.cfg.VisibilityTimeout, batchSize)
+		}
+		if err := s.Acknowledge(ctx, ids); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.StopTimer()
+	if n, _ := s.Count(ctx); n != pendingMessages {
+		b.Fatalf("expected %d pending messages, got %d", pendingMessages, n)
+	}
+}
@@ -0,0 +1,36 @@
+package inmemory
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+)
+
+func TestStoreDetectsDuplicates(t *testing.T) {
+	s := NewInMemoryStorage()
+	s.initState(NewBuilder().WithShards(4).Build())
+
+	msg := message.NewMessage(message.WithID("a"), message.WithPayload([]byte("payload")))
+	changed := message.NewMessage(message.WithID("a"), message.WithPayload([]byte("other")))
+	generated := &message.Message{Payload: []byte("generated")}
+
+	results, err := s.Store(context.Background(), []*message.Message{msg, msg, changed, generated})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if results[0].Err != nil || results[0].Duplicate {
+		t.Fatalf("expected first message to be stored, got %+v", results[0])
+	}
+	if results[1].Err != nil || !results[1].Duplicate {
+		t.Fatalf("expected redelivery to be a duplicate, got %+v", results[1])
+	}
+	if !errors.Is(results[2].Err, ErrAlreadyExists) {
+		t.Fatalf("expected ErrAlreadyExists for changed content, got %+v", results[2])
+	}
+	if results[3].Err != nil || results[3].ID == "" || generated.ID != "" {
+		t.Fatalf("expected generated ID without changing caller message, got %+v", results[3])
+	}
+}
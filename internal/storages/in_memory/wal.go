@@ -0,0 +1,428 @@
+package inmemory
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+	"github.com/Alexey-zaliznuak/orbital/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// Политики сброса WAL на диск.
+const (
+	// WALFsyncAlways — fsync после каждой записи.
+	WALFsyncAlways = "always"
+	// WALFsyncInterval — fsync раз в WALFsyncInterval.
+	WALFsyncInterval = "interval"
+	// WALFsyncNever — fsync не вызывается, сброс на диск остаётся за ОС.
+	WALFsyncNever = "never"
+)
+
+const (
+	walSegmentExt = ".wal"
+	// walHeaderSize — размер заголовка записи: длина payload и его CRC32.
+	walHeaderSize = 8
+	// walMaxRecordSize — верхняя граница payload, защищает от выделения памяти
+	// по повреждённому заголовку.
+	walMaxRecordSize = 256 << 20
+)
+
+var (
+	errWALClosed  = errors.New("wal closed")
+	errWALCorrupt = errors.New("wal record corrupted")
+)
+
+// walOp — тип операции, записанной в WAL.
+type walOp uint8
+
+const (
+	walOpStore walOp = iota + 1
+	walOpAck
+	walOpCancel
+	// walOpFail — сообщения отклонены без повторной постановки.
+	walOpFail
+)
+
+// walRecord — одна операция над хранилищем.
+// Для walOpStore заполнено Messages, для остальных операций — IDs.
+type walRecord struct {
+	Op       walOp              `json:"op"`
+	Messages []*message.Message `json:"messages,omitempty"`
+	IDs      []string           `json:"ids,omitempty"`
+}
+
+// walFile — открытый для записи сегмент журнала.
+type walFile interface {
+	io.Writer
+	Sync() error
+	Close() error
+	Truncate(size int64) error
+}
+
+// wal — append-only журнал операций in-memory хранилища, разбитый на сегменты.
+//
+// Формат записи: uint32 длина payload, uint32 CRC32 payload (little endian), JSON walRecord.
+// Сегменты называются по возрастающему номеру; при открытии журнала все существующие
+// сегменты проигрываются, а запись продолжается в новый сегмент.
+type wal struct {
+	mu sync.Mutex
+
+	dir         string
+	fsync       string
+	segmentSize int64
+
+	file  walFile
+	seq   uint64
+	size  int64
+	dirty bool
+	// torn — после неудачной записи в конце сегмента остался обрывок записи,
+	// который не удалось обрезать. Сегмент обрезается до size перед следующей записью.
+	torn bool
+}
+
+// openWAL проигрывает сегменты из dir через apply и открывает новый сегмент для записи.
+// Недописанная запись в конце последнего сегмента (падение во время записи) отбрасывается.
+func openWAL(dir, fsync string, segmentSize int64, apply func(*walRecord)) (*wal, error) {
+	switch fsync {
+	case WALFsyncAlways, WALFsyncInterval, WALFsyncNever:
+	default:
+		return nil, fmt.Errorf("unknown wal fsync policy %q", fsync)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("wal mkdir %s: %w", dir, err)
+	}
+
+	segments, err := listSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &wal{
+		dir:         dir,
+		fsync:       fsync,
+		segmentSize: segmentSize,
+	}
+
+	for i, seq := range segments {
+		last := i == len(segments)-1
+		if err := w.replaySegment(seq, last, apply); err != nil {
+			return nil, err
+		}
+		w.seq = seq
+	}
+
+	if err := w.openSegment(w.seq + 1); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// append записывает операцию в журнал. При политике WALFsyncAlways возвращается
+// только после fsync.
+func (w *wal) append(rec *walRecord) error {
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("wal marshal: %w", err)
+	}
+
+	buf := make([]byte, walHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(payload))
+	copy(buf[walHeaderSize:], payload)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return errWALClosed
+	}
+
+	if err := w.repairLocked(); err != nil {
+		return err
+	}
+
+	if w.size > 0 && w.size+int64(len(buf)) > w.segmentSize {
+		// Текущий сегмент остаётся открытым: запись продолжится в него до следующей попытки.
+		if err := w.rotateLocked(); err != nil {
+			logger.Log.Warn("Failed to rotate wal segment", zap.Uint64("segment", w.seq), zap.Error(err))
+		}
+	}
+
+	if _, err := w.file.Write(buf); err != nil {
+		// Обрывок записи посреди сегмента сорвал бы проигрывание всех записей после него.
+		w.torn = true
+		if rerr := w.repairLocked(); rerr != nil {
+			logger.Log.Error("Failed to truncate torn wal record", zap.Uint64("segment", w.seq), zap.Error(rerr))
+		}
+		return fmt.Errorf("wal write: %w", err)
+	}
+	w.size += int64(len(buf))
+
+	if w.fsync == WALFsyncAlways {
+		if err := w.file.Sync(); err != nil {
+			return fmt.Errorf("wal fsync: %w", err)
+		}
+		return nil
+	}
+
+	w.dirty = true
+	return nil
+}
+
+// sync сбрасывает на диск записи, сделанные после предыдущего fsync.
+func (w *wal) sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil || !w.dirty {
+		return nil
+	}
+
+	if err := w.file.Sync(); err != nil {
+		return fmt.Errorf("wal fsync: %w", err)
+	}
+	w.dirty = false
+
+	return nil
+}
+
+// rotate закрывает текущий сегмент и начинает новый. Возвращает номер нового сегмента:
+// все операции из сегментов с меньшими номерами уже записаны.
+func (w *wal) rotate() (uint64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return 0, errWALClosed
+	}
+
+	if err := w.rotateLocked(); err != nil {
+		return 0, err
+	}
+
+	return w.seq, nil
+}
+
+// removeBefore удаляет сегменты с номерами меньше seq.
+func (w *wal) removeBefore(seq uint64) error {
+	segments, err := listSegments(w.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range segments {
+		if s >= seq {
+			break
+		}
+		if err := os.Remove(w.segmentPath(s)); err != nil {
+			return fmt.Errorf("wal remove segment %d: %w", s, err)
+		}
+	}
+
+	return nil
+}
+
+// close сбрасывает журнал на диск и закрывает текущий сегмент.
+func (w *wal) close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+
+	err := w.closeLocked()
+	w.file = nil
+
+	return err
+}
+
+// repairLocked обрезает текущий сегмент до последней целой записи, если в его конце
+// остался обрывок неудачной записи. Сегмент открыт с O_APPEND, поэтому следующая
+// запись идёт с новой границы файла.
+func (w *wal) repairLocked() error {
+	if !w.torn {
+		return nil
+	}
+	if err := w.file.Truncate(w.size); err != nil {
+		return fmt.Errorf("wal truncate segment %d: %w", w.seq, err)
+	}
+	w.torn = false
+	return nil
+}
+
+// rotateLocked начинает новый сегмент. Текущий закрывается только после того,
+// как новый открыт: при ошибке журнал продолжает писать в текущий сегмент.
+func (w *wal) rotateLocked() error {
+	// Сегмент с обрывком записи в середине журнала не проиграется при старте.
+	if err := w.repairLocked(); err != nil {
+		return err
+	}
+	if err := w.file.Sync(); err != nil {
+		return fmt.Errorf("wal fsync: %w", err)
+	}
+	w.dirty = false
+
+	next, err := w.createSegment(w.seq + 1)
+	if err != nil {
+		return err
+	}
+
+	prev, prevSeq := w.file, w.seq
+	w.file, w.seq, w.size = next, w.seq+1, 0
+
+	// Записи предыдущего сегмента уже на диске, ошибка закрытия их не теряет.
+	if err := prev.Close(); err != nil {
+		logger.Log.Warn("Failed to close wal segment", zap.Uint64("segment", prevSeq), zap.Error(err))
+	}
+
+	return nil
+}
+
+func (w *wal) closeLocked() error {
+	// Обрывок в конце последнего сегмента отбросится при проигрывании, ошибка не критична.
+	if err := w.repairLocked(); err != nil {
+		logger.Log.Warn("Failed to truncate torn wal record", zap.Uint64("segment", w.seq), zap.Error(err))
+	}
+	if err := w.file.Sync(); err != nil {
+		return fmt.Errorf("wal fsync: %w", err)
+	}
+	if err := w.file.Close(); err != nil {
+		return fmt.Errorf("wal close segment %d: %w", w.seq, err)
+	}
+	w.dirty = false
+	return nil
+}
+
+func (w *wal) openSegment(seq uint64) error {
+	file, err := w.createSegment(seq)
+	if err != nil {
+		return err
+	}
+
+	w.file = file
+	w.seq = seq
+	w.size = 0
+
+	return nil
+}
+
+func (w *wal) createSegment(seq uint64) (*os.File, error) {
+	file, err := os.OpenFile(w.segmentPath(seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("wal open segment %d: %w", seq, err)
+	}
+	return file, nil
+}
+
+func (w *wal) replaySegment(seq uint64, last bool, apply func(*walRecord)) error {
+	path := w.segmentPath(seq)
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("wal open segment %d: %w", seq, err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var offset int64
+
+	for {
+		rec, n, err := readRecord(reader)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			if !last {
+				return fmt.Errorf("wal segment %d at offset %d: %w", seq, offset, err)
+			}
+
+			logger.Log.Warn("Truncating torn wal tail", zap.Uint64("segment", seq), zap.Int64("offset", offset), zap.Error(err))
+			if err := os.Truncate(path, offset); err != nil {
+				return fmt.Errorf("wal truncate segment %d: %w", seq, err)
+			}
+			return nil
+		}
+
+		apply(rec)
+		offset += n
+	}
+}
+
+// readRecord читает одну запись и возвращает её размер в байтах.
+// io.EOF возвращается, только если поток закончился ровно на границе записи.
+func readRecord(r io.Reader) (*walRecord, int64, error) {
+	header := make([]byte, walHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, 0, err
+	}
+
+	length := binary.LittleEndian.Uint32(header[0:4])
+	checksum := binary.LittleEndian.Uint32(header[4:8])
+
+	if length > walMaxRecordSize {
+		return nil, 0, errWALCorrupt
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, 0, err
+	}
+
+	if crc32.ChecksumIEEE(payload) != checksum {
+		return nil, 0, errWALCorrupt
+	}
+
+	var rec walRecord
+	if err := json.Unmarshal(payload, &rec); err != nil {
+		return nil, 0, fmt.Errorf("%w: %w", errWALCorrupt, err)
+	}
+
+	return &rec, int64(walHeaderSize + len(payload)), nil
+}
+
+func (w *wal) segmentPath(seq uint64) string {
+	return filepath.Join(w.dir, fmt.Sprintf("%020d%s", seq, walSegmentExt))
+}
+
+// listSegments возвращает номера сегментов в dir по возрастанию.
+func listSegments(dir string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("wal read dir %s: %w", dir, err)
+	}
+
+	segments := make([]uint64, 0, len(entries))
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), walSegmentExt)
+		if !ok || entry.IsDir() {
+			continue
+		}
+
+		seq, err := strconv.ParseUint(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, seq)
+	}
+
+	slices.Sort(segments)
+	return segments, nil
+}
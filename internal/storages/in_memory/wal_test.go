@@ -0,0 +1,342 @@
+package inmemory
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+)
+
+// replayWAL открывает журнал в dir и возвращает проигранные записи.
+func replayWAL(t *testing.T, dir string, segmentSize int64) (*wal, []*walRecord) {
+	t.Helper()
+
+	var records []*walRecord
+	w, err := openWAL(dir, WALFsyncNever, segmentSize, func(rec *walRecord) { records = append(records, rec) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { w.close() })
+
+	return w, records
+}
+
+// recordIDs возвращает ID сообщений или ID операций записей по порядку.
+func recordIDs(records []*walRecord) []string {
+	var ids []string
+	for _, rec := range records {
+		for _, msg := range rec.Messages {
+			ids = append(ids, msg.ID)
+		}
+		ids = append(ids, rec.IDs...)
+	}
+	return ids
+}
+
+func appendRecords(t *testing.T, w *wal, ids ...string) {
+	t.Helper()
+
+	for _, id := range ids {
+		rec := &walRecord{Op: walOpStore, Messages: []*message.Message{message.NewMessage(message.WithID(id))}}
+		if err := w.append(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWALReplay(t *testing.T) {
+	dir := t.TempDir()
+
+	w, records := replayWAL(t, dir, 1<<20)
+	if len(records) != 0 {
+		t.Fatalf("expected empty wal, got %d records", len(records))
+	}
+	appendRecords(t, w, "a", "b")
+	if err := w.append(&walRecord{Op: walOpAck, IDs: []string{"a"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, records = replayWAL(t, dir, 1<<20)
+	if len(records) != 3 || records[2].Op != walOpAck || !slices.Equal(recordIDs(records), []string{"a", "b", "a"}) {
+		t.Fatalf("unexpected replay %v", recordIDs(records))
+	}
+}
+
+func TestWALTruncatesTornTail(t *testing.T) {
+	dir := t.TempDir()
+
+	w, _ := replayWAL(t, dir, 1<<20)
+	appendRecords(t, w, "a", "b")
+	path := w.segmentPath(w.seq)
+	if err := w.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Падение во время записи: заголовок и часть payload третьей записи.
+	full, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Write(full[:walHeaderSize+3]); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	w, records := replayWAL(t, dir, 1<<20)
+	if !slices.Equal(recordIDs(records), []string{"a", "b"}) {
+		t.Fatalf("expected complete records to be replayed, got %v", recordIDs(records))
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() != int64(len(full)) {
+		t.Fatalf("expected torn tail to be truncated, got %v, %v", info, err)
+	}
+
+	appendRecords(t, w, "c")
+	if err := w.close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, records := replayWAL(t, dir, 1<<20); !slices.Equal(recordIDs(records), []string{"a", "b", "c"}) {
+		t.Fatalf("unexpected replay after truncation %v", recordIDs(records))
+	}
+}
+
+func TestWALRejectsCorruptRecordMidLog(t *testing.T) {
+	dir := t.TempDir()
+
+	w, _ := replayWAL(t, dir, 1<<20)
+	appendRecords(t, w, "a", "b")
+	corrupted := w.segmentPath(w.seq)
+	if _, err := w.rotate(); err != nil {
+		t.Fatal(err)
+	}
+	appendRecords(t, w, "c")
+	if err := w.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Повреждение не последнего сегмента — не обрыв записи, а потеря данных.
+	data, err := os.ReadFile(corrupted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[walHeaderSize+1] ^= 0xff
+	if err := os.WriteFile(corrupted, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = openWAL(dir, WALFsyncNever, 1<<20, func(*walRecord) {})
+	if !errors.Is(err, errWALCorrupt) {
+		t.Fatalf("expected errWALCorrupt, got %v", err)
+	}
+}
+
+func TestWALRotateAndRemoveBefore(t *testing.T) {
+	dir := t.TempDir()
+
+	// Сегмент меньше двух записей: запись переходит в новый сегмент сама.
+	w, _ := replayWAL(t, dir, 64)
+	appendRecords(t, w, "a", "b", "c")
+	if segments, _ := listSegments(dir); len(segments) != 3 {
+		t.Fatalf("expected a segment per record, got %v", segments)
+	}
+
+	seq, err := w.rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendRecords(t, w, "d")
+	if err := w.removeBefore(seq); err != nil {
+		t.Fatal(err)
+	}
+	if segments, _ := listSegments(dir); segments[0] != seq {
+		t.Fatalf("expected segments before %d to be removed, got %v", seq, segments)
+	}
+	if err := w.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, records := replayWAL(t, dir, 64); !slices.Equal(recordIDs(records), []string{"d"}) {
+		t.Fatalf("expected only records after rotation, got %v", recordIDs(records))
+	}
+}
+
+func TestWALRotateKeepsSegmentOnOpenFailure(t *testing.T) {
+	dir := t.TempDir()
+
+	w, _ := replayWAL(t, dir, 1<<20)
+	appendRecords(t, w, "a")
+
+	// Следующий сегмент не открыть: на его месте каталог.
+	blocked := w.segmentPath(w.seq + 1)
+	if err := os.Mkdir(blocked, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	seq := w.seq
+	if _, err := w.rotate(); err == nil {
+		t.Fatal("expected rotation error")
+	}
+	if w.seq != seq {
+		t.Fatalf("expected to keep segment %d, got %d", seq, w.seq)
+	}
+
+	appendRecords(t, w, "b")
+	if err := w.close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(blocked); err != nil {
+		t.Fatal(err)
+	}
+	if _, records := replayWAL(t, dir, 1<<20); !slices.Equal(recordIDs(records), []string{"a", "b"}) {
+		t.Fatalf("expected writes to continue in current segment, got %v", recordIDs(records))
+	}
+}
+
+// shortWriteFile записывает в сегмент только половину буфера и возвращает ошибку,
+// как при переполнении диска.
+type shortWriteFile struct {
+	walFile
+}
+
+func (f shortWriteFile) Write(p []byte) (int, error) {
+	n, _ := f.walFile.Write(p[:len(p)/2])
+	return n, errors.New("no space left on device")
+}
+
+func TestWALTruncatesFailedWrite(t *testing.T) {
+	dir := t.TempDir()
+
+	w, _ := replayWAL(t, dir, 1<<20)
+	appendRecords(t, w, "a")
+
+	file := w.file
+	w.file = shortWriteFile{file}
+	if err := w.append(&walRecord{Op: walOpAck, IDs: []string{"lost"}}); err == nil {
+		t.Fatal("expected write error")
+	}
+	w.file = file
+
+	// Запись после ошибки продолжается с границы последней целой записи.
+	appendRecords(t, w, "b")
+	if _, err := w.rotate(); err != nil {
+		t.Fatal(err)
+	}
+	appendRecords(t, w, "c")
+	if err := w.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, records := replayWAL(t, dir, 1<<20); !slices.Equal(recordIDs(records), []string{"a", "b", "c"}) {
+		t.Fatalf("expected records around failed write, got %v", recordIDs(records))
+	}
+}
+
+// openWALStorage создаёт хранилище со снимком и WAL в dir и восстанавливает его состояние.
+func openWALStorage(t *testing.T, dir string) (*InMemoryStorage, error) {
+	t.Helper()
+
+	s := NewInMemoryStorage()
+	s.initState(NewBuilder().
+		WithDumpFile(dir+"/dump").
+		WithWAL(dir+"/wal").
+		WithWALFsync(WALFsyncAlways, 0).
+		WithWALSegmentSize(1 << 20).
+		Build())
+
+	return s, s.restore(context.Background())
+}
+
+func TestWALRestoresStorageAfterCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	s, err := openWALStorage(t, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Store(ctx, []*message.Message{message.NewMessage(message.WithID("a")), message.NewMessage(message.WithID("b"))}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	// Операции после checkpoint есть только в WAL.
+	if err := s.Cancel(ctx, []string{"a"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Store(ctx, []*message.Message{message.NewMessage(message.WithID("c"))}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.wal.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := openWALStorage(t, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.wal.close()
+
+	if n, _ := restored.Count(ctx); n != 2 {
+		t.Fatalf("expected 2 messages after restore, got %d", n)
+	}
+	if _, err := restored.GetByID(ctx, "a"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected cancelled message to stay removed, got %v", err)
+	}
+}
+
+func TestCorruptDumpIsNotOverwritten(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := openWALStorage(t, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Store(context.Background(), []*message.Message{message.NewMessage(message.WithID("a"))}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.wal.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Обрезанный снимок не разбирается.
+	data, err := os.ReadFile(dir + "/dump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupt := data[:len(data)-1]
+	if err := os.WriteFile(dir+"/dump", corrupt, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := openWALStorage(t, dir); err == nil {
+		t.Fatal("expected error for corrupt dump")
+	}
+
+	after, err := os.ReadFile(dir + "/dump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(after, corrupt) {
+		t.Fatal("corrupt dump was overwritten")
+	}
+}
+
+func TestWALFsyncDefaultsToAlways(t *testing.T) {
+	// Сообщения подтверждаются в шине сразу после записи в журнал.
+	if cfg := NewBuilder().FromEnv().Build(); cfg.WALFsync != WALFsyncAlways {
+		t.Fatalf("expected fsync before ack by default, got %q", cfg.WALFsync)
+	}
+}
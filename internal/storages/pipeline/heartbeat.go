@@ -0,0 +1,91 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	coordinatorapi "github.com/Alexey-zaliznuak/orbital/pkg/coordinator/api"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/node"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+	"github.com/Alexey-zaliznuak/orbital/pkg/logger"
+	"github.com/Alexey-zaliznuak/orbital/pkg/sdk/coordinator"
+	"go.uber.org/zap"
+)
+
+// ReportFunc возвращает текущее состояние инстанса хранилища для heartbeat: статус,
+// ёмкость и нагрузку. Address заполняет RunHeartbeat.
+type ReportFunc func(ctx context.Context) storage.Heartbeat
+
+// MeterReport — ReportFunc хранилищ без лимита ёмкости, которые не сообщают
+// о перегрузке: статус всегда Active, нагрузку измеряет meter.
+func MeterReport(meter *LoadMeter) ReportFunc {
+	return func(ctx context.Context) storage.Heartbeat {
+		return storage.Heartbeat{Status: node.NodeStatusActive, Load: meter.Measure(ctx)}
+	}
+}
+
+// RunHeartbeat регистрирует инстанс хранилища в координаторе и каждые HeartbeatInterval
+// сообщает ему состояние инстанса. Если координатор забыл хранилище или инстанс,
+// инстанс регистрируется заново.
+// Без Address регистрация невозможна, и RunHeartbeat сразу возвращается; так же
+// при неположительном HeartbeatInterval.
+// Блокируется до отмены ctx.
+func RunHeartbeat(ctx context.Context, client *coordinator.Client, cfg *storage.BaseStorageConfig, report ReportFunc) {
+	if cfg.Address == "" {
+		logger.Log.Warn("STORAGE_ADDRESS is not set, storage will not register in coordinator")
+		return
+	}
+	if cfg.HeartbeatInterval <= 0 {
+		logger.Log.Warn("HEARTBEAT_INTERVAL is not positive, storage heartbeat is disabled")
+		return
+	}
+
+	registration := coordinatorapi.RegisterStorageRequest{
+		ID:       cfg.ID,
+		Address:  cfg.Address,
+		MinDelay: cfg.MinDelay.String(),
+		MaxDelay: cfg.MaxDelay.String(),
+		Version:  cfg.Version,
+	}
+
+	registered := false
+	lastStatus := node.NodeStatusActive
+
+	ticker := time.NewTicker(cfg.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		if !registered {
+			if err := client.RegisterStorage(ctx, registration); err != nil {
+				logger.Log.Error("Failed to register storage", zap.Error(err))
+			} else {
+				registered = true
+				logger.Log.Info("Storage registered in coordinator", zap.String("address", cfg.Address))
+			}
+		}
+
+		if registered {
+			hb := report(ctx)
+			hb.Address = cfg.Address
+			current := hb.Status
+			err := client.StorageHeartbeat(ctx, cfg.ID, hb)
+			switch {
+			case errors.Is(err, coordinator.ErrStorageNotRegistered):
+				registered = false
+				logger.Log.Warn("Storage is not registered in coordinator, will register again")
+			case err != nil:
+				logger.Log.Error("Failed to send storage heartbeat", zap.Error(err))
+			case current != lastStatus:
+				logger.Log.Info("Storage status changed", zap.String("status", current.String()))
+				lastStatus = current
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
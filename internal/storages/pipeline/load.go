@@ -0,0 +1,92 @@
+package pipeline
+
+import (
+	"context"
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/clock"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+	"github.com/Alexey-zaliznuak/orbital/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// LoadProber — необязательный дешёвый замер нагрузки хранилища. Без него LoadMeter
+// находит опоздание выпуска через FetchExpiring, читая самое раннее наступившее
+// сообщение целиком, и не знает числа сообщений в полёте.
+type LoadProber interface {
+	// ProbeLoad возвращает момент, с которого ждёт выпуска самое раннее наступившее
+	// к now ожидающее сообщение (нулевое время — таких нет), и число сообщений,
+	// выпущенных в gateway и ещё не подтверждённых.
+	ProbeLoad(ctx context.Context, now time.Time) (earliestDue time.Time, inFlight int64, err error)
+}
+
+// LoadMeter измеряет нагрузку инстанса хранилища для heartbeat одинаково для всех
+// реализаций MessageStorage: число хранимых сообщений, скорость приёма из шины
+// и опоздание выпуска; число сообщений в полёте — если хранилище реализует
+// LoadProber. Bytes хранилище дополняет само, если их считает.
+// Не предназначен для параллельных вызовов Measure.
+type LoadMeter struct {
+	store storage.MessageStorage
+	subs  *Subscriptions
+	clock clock.Clock
+
+	lastIngested int64
+	lastAt       time.Time
+}
+
+// NewLoadMeter создаёт измеритель нагрузки store. subs — подписки хранилища на шину,
+// по которым считается скорость приёма; nil — скорость не считается. clk == nil — системные часы.
+func NewLoadMeter(store storage.MessageStorage, subs *Subscriptions, clk clock.Clock) *LoadMeter {
+	return &LoadMeter{store: store, subs: subs, clock: clock.OrSystem(clk)}
+}
+
+// Measure возвращает нагрузку инстанса. IngestRate считается с прошлого вызова,
+// первый вызов возвращает нулевую скорость. Ошибки хранилища не прерывают измерение:
+// соответствующие показатели остаются нулевыми, а без числа сообщений нагрузка
+// не считается измеренной (Measured).
+func (m *LoadMeter) Measure(ctx context.Context) storage.Load {
+	now := m.clock.Now()
+
+	var load storage.Load
+
+	pending, err := m.store.Count(ctx)
+	if err != nil {
+		logger.Log.Warn("Failed to count messages for heartbeat", zap.Error(err))
+	}
+	load.Pending = pending
+	load.Measured = err == nil
+
+	// Самое раннее ожидающее сообщение, срок которого наступил, ещё не выпущено в gateway.
+	earliestDue, inFlight, err := m.probe(ctx, now)
+	if err != nil {
+		logger.Log.Warn("Failed to measure release lag for heartbeat", zap.Error(err))
+	}
+	if !earliestDue.IsZero() {
+		load.ReleaseLag = max(now.Sub(earliestDue), 0)
+	}
+	load.InFlight = inFlight
+
+	if m.subs != nil {
+		ingested := m.subs.Ingested()
+		if elapsed := now.Sub(m.lastAt); !m.lastAt.IsZero() && elapsed > 0 {
+			load.IngestRate = float64(ingested-m.lastIngested) / elapsed.Seconds()
+		}
+		m.lastIngested, m.lastAt = ingested, now
+	}
+
+	return load
+}
+
+// probe замеряет опоздание выпуска и число сообщений в полёте через LoadProber,
+// а без него — опоздание через FetchExpiring.
+func (m *LoadMeter) probe(ctx context.Context, now time.Time) (time.Time, int64, error) {
+	if prober, ok := m.store.(LoadProber); ok {
+		return prober.ProbeLoad(ctx, now)
+	}
+
+	due, err := m.store.FetchExpiring(ctx, 0, 1)
+	if err != nil || len(due) == 0 {
+		return time.Time{}, 0, err
+	}
+	return due[0].ScheduledAt, 0, nil
+}
@@ -0,0 +1,100 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/clock"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+)
+
+// loadStore отвечает на запросы LoadMeter заданными значениями.
+type loadStore struct {
+	storage.MessageStorage
+	count int64
+	due   []*storage.StoredMessage
+}
+
+func (s *loadStore) Count(context.Context) (int64, error) {
+	return s.count, nil
+}
+
+func (s *loadStore) FetchExpiring(_ context.Context, threshold time.Duration, limit int) ([]*storage.StoredMessage, error) {
+	if threshold != 0 || limit != 1 {
+		return nil, nil
+	}
+	return s.due, nil
+}
+
+// probedStore отвечает на ProbeLoad и не позволяет читать сообщения.
+type probedStore struct {
+	loadStore
+	earliestDue time.Time
+	inFlight    int64
+}
+
+func (s *probedStore) FetchExpiring(context.Context, time.Duration, int) ([]*storage.StoredMessage, error) {
+	return nil, errors.New("unexpected FetchExpiring")
+}
+
+func (s *probedStore) ProbeLoad(context.Context, time.Time) (time.Time, int64, error) {
+	return s.earliestDue, s.inFlight, nil
+}
+
+// failingCountStore не может посчитать сообщения.
+type failingCountStore struct {
+	loadStore
+}
+
+func (s *failingCountStore) Count(context.Context) (int64, error) {
+	return 0, errors.New("count failed")
+}
+
+func TestLoadMeter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(now)
+	store := &loadStore{count: 42}
+	subs := &Subscriptions{}
+	meter := NewLoadMeter(store, subs, clk)
+	ctx := context.Background()
+
+	subs.ingested.Add(100)
+	if load := meter.Measure(ctx); load != (storage.Load{Measured: true, Pending: 42}) {
+		t.Fatalf("unexpected first measurement %+v", load)
+	}
+
+	subs.ingested.Add(50)
+	clk.Advance(5 * time.Second)
+	store.due = []*storage.StoredMessage{{Message: message.NewMessage(message.WithScheduledAt(now.Add(2 * time.Second)))}}
+
+	load := meter.Measure(ctx)
+	if load.IngestRate != 10 || load.ReleaseLag != 3*time.Second {
+		t.Fatalf("unexpected measurement %+v", load)
+	}
+
+	// Без подписок скорость приёма не считается.
+	store.due = nil
+	if load := NewLoadMeter(store, nil, clk).Measure(ctx); load != (storage.Load{Measured: true, Pending: 42}) {
+		t.Fatalf("unexpected measurement without subscriptions %+v", load)
+	}
+}
+
+func TestLoadMeterUsesProber(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := &probedStore{loadStore: loadStore{count: 7}, earliestDue: now.Add(-time.Second), inFlight: 3}
+
+	load := NewLoadMeter(store, nil, clock.NewFake(now)).Measure(context.Background())
+	if load != (storage.Load{Measured: true, Pending: 7, InFlight: 3, ReleaseLag: time.Second}) {
+		t.Fatalf("unexpected measurement %+v", load)
+	}
+}
+
+func TestLoadMeterUnknownWithoutCount(t *testing.T) {
+	store := &failingCountStore{}
+	if load := NewLoadMeter(store, nil, nil).Measure(context.Background()); load.Measured {
+		t.Fatalf("expected load to be unknown when count fails, got %+v", load)
+	}
+}
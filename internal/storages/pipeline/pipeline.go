@@ -0,0 +1,265 @@
+// Package pipeline связывает реализации MessageStorage с шиной Orbital:
+// подключение к кластеру, приём новых сообщений и подтверждений от gateway,
+// выпуск сообщений в gateway и их продвижение в более горячие хранилища.
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/bus"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+	"github.com/Alexey-zaliznuak/orbital/pkg/logger"
+	natsclient "github.com/Alexey-zaliznuak/orbital/pkg/nats"
+	"github.com/Alexey-zaliznuak/orbital/pkg/sdk/coordinator"
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+)
+
+// AcknowledgeFunc удаляет сообщения, доставку которых подтвердил gateway
+// или сохранение которых подтвердило принявшее их хранилище.
+type AcknowledgeFunc func(ctx context.Context, ids []string) error
+
+// Connect получает конфигурацию кластера у координатора, подключается к NATS
+// и создаёт streams шины.
+func Connect(ctx context.Context, clusterAddress string) (*bus.Client, error) {
+	coordinatorClient := coordinator.NewClient(coordinator.ClientConfig{
+		BaseURL: clusterAddress,
+	})
+
+	clusterCfg, err := coordinatorClient.GetClusterConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cluster config: %w", err)
+	}
+
+	natsClient, err := natsclient.New(natsclient.Config{
+		URL: clusterCfg.NatsAddress,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+
+	busClient := bus.New(natsClient)
+
+	if err := busClient.Provision(clusterCfg); err != nil {
+		return nil, fmt.Errorf("failed to provision NATS streams: %w", err)
+	}
+
+	return busClient, nil
+}
+
+// Subscriptions — подписки хранилища на шину, созданные Subscribe.
+type Subscriptions struct {
+	messages *nats.Subscription
+	promoted *nats.Subscription
+	acks     *nats.Subscription
+
+	// ingested — сколько новых сообщений сохранено из шины.
+	ingested atomic.Int64
+}
+
+// Ingested возвращает, сколько новых сообщений хранилище сохранило из шины с момента
+// подписки. Дубликаты и отклонённые сообщения не учитываются.
+func (s *Subscriptions) Ingested() int64 {
+	return s.ingested.Load()
+}
+
+// countingStore считает новые сообщения, сохранённые через Store.
+type countingStore struct {
+	storage.MessageStorage
+	stored *atomic.Int64
+}
+
+func (c countingStore) Store(ctx context.Context, msgs []*message.Message) ([]storage.StoreResult, error) {
+	results, err := c.MessageStorage.Store(ctx, msgs)
+	for _, result := range results {
+		if result.Err == nil && !result.Duplicate {
+			c.stored.Add(1)
+		}
+	}
+	return results, err
+}
+
+// StopIntake прекращает приём новых и продвинутых сообщений: уже полученные
+// обрабатываются, а следующие достаются другим инстансам хранилища.
+// Подтверждения продолжают приниматься до Close.
+func (s *Subscriptions) StopIntake() error {
+	if err := s.messages.Drain(); err != nil {
+		return fmt.Errorf("failed to drain storage messages subscription: %w", err)
+	}
+	if err := s.promoted.Drain(); err != nil {
+		return fmt.Errorf("failed to drain promoted messages subscription: %w", err)
+	}
+	return nil
+}
+
+// Close отписывается от подтверждений. Вызывается после StopIntake.
+func (s *Subscriptions) Close() error {
+	return s.acks.Unsubscribe()
+}
+
+// Subscribe подписывает хранилище storageID на новые и продвинутые из других хранилищ
+// сообщения и на подтверждения от gateway и принимающих хранилищ.
+func Subscribe(busClient *bus.Client, storageID string, store storage.MessageStorage, acknowledge AcknowledgeFunc, nakDelay time.Duration) (*Subscriptions, error) {
+	var (
+		subs = &Subscriptions{}
+		err  error
+	)
+	store = countingStore{MessageStorage: store, stored: &subs.ingested}
+
+	if subs.messages, err = busClient.NewHandlerOnStorageMessages(storageID, NewMessagesHandler(store, busClient, storageID, nakDelay)); err != nil {
+		return nil, fmt.Errorf("failed to subscribe to storage messages: %w", err)
+	}
+
+	if subs.promoted, err = busClient.NewHandlerOnPromotedMessages(storageID, NewPromotedHandler(store, busClient, storageID, nakDelay)); err != nil {
+		return nil, fmt.Errorf("failed to subscribe to promoted messages: %w", err)
+	}
+
+	if subs.acks, err = busClient.NewHandlerOnStorageAcks(storageID, NewAcksHandler(acknowledge)); err != nil {
+		return nil, fmt.Errorf("failed to subscribe to storage acks: %w", err)
+	}
+
+	return subs, nil
+}
+
+// NewMessagesHandler сохраняет пачки сообщений, полученные из orbital.storage.{ID}.
+// Сообщения, которые нельзя сохранить (ID занят другим содержимым), уходят в dead letter.
+// При временной ошибке пачка возвращается в JetStream с задержкой nakDelay: уже
+// сохранённые сообщения при повторной доставке распознаются как дубликаты.
+// Сообщение шины подтверждается только когда каждое сообщение пачки сохранено
+// или отправлено в dead letter.
+func NewMessagesHandler(store storage.MessageStorage, busClient *bus.Client, storageID string, nakDelay time.Duration) nats.MsgHandler {
+	return newStoreHandler(store, busClient, storageID, nakDelay, nil)
+}
+
+// NewPromotedHandler сохраняет пачки сообщений, продвинутые из более холодного хранилища
+// через orbital.promote.{ID}, как NewMessagesHandler, и после сохранения подтверждает
+// их хранилищу-отправителю: только тогда оно удаляет их у себя. Потерянное подтверждение
+// приводит к повторному продвижению, которое распознаётся как дубликат.
+func NewPromotedHandler(store storage.MessageStorage, busClient *bus.Client, storageID string, nakDelay time.Duration) nats.MsgHandler {
+	return newStoreHandler(store, busClient, storageID, nakDelay, func(msg *nats.Msg, ids []string) error {
+		source := msg.Header.Get(bus.HeaderStorageID)
+		if source == "" {
+			logger.Log.Warn("Promoted messages without source storage")
+			return nil
+		}
+		return busClient.AckToStorage(source, ids)
+	})
+}
+
+// deadLetterSender публикует сообщения, которые хранилище не может принять.
+// Реализуется bus.Client.
+type deadLetterSender interface {
+	SendToDeadLetter(storageID string, msgs []*message.Message) error
+}
+
+// newStoreHandler сохраняет пачки сообщений шины. Если задан onStored, он вызывается
+// с ID всех обработанных сообщений пачки перед подтверждением сообщения шины.
+func newStoreHandler(
+	store storage.MessageStorage,
+	deadLetter deadLetterSender,
+	storageID string,
+	nakDelay time.Duration,
+	onStored func(msg *nats.Msg, ids []string) error,
+) nats.MsgHandler {
+	nak := func(msg *nats.Msg, cause error) {
+		logger.Log.Warn("Failed to store messages, will be redelivered", zap.Error(cause))
+		if err := msg.NakWithDelay(nakDelay); err != nil {
+			logger.Log.Error("Failed to nak bus message", zap.Error(err))
+		}
+	}
+
+	return func(msg *nats.Msg) {
+		msgs := make([]*message.Message, 0)
+
+		if err := json.Unmarshal(msg.Data, &msgs); err != nil {
+			logger.Log.Error("Received messages unmarshal error", zap.Error(err))
+			if err := msg.Term(); err != nil {
+				logger.Log.Error("Failed to terminate bus message", zap.Error(err))
+			}
+			return
+		}
+
+		ids, err := storeBatch(context.Background(), store, deadLetter, storageID, msgs)
+		if err != nil {
+			nak(msg, err)
+			return
+		}
+
+		if onStored != nil {
+			if err := onStored(msg, ids); err != nil {
+				nak(msg, err)
+				return
+			}
+		}
+
+		if err := msg.Ack(); err != nil {
+			logger.Log.Error("Failed to ack bus message", zap.Error(err))
+		}
+	}
+}
+
+// storeBatch сохраняет пачку и отправляет в dead letter сообщения, ID которых занят
+// другим содержимым. Возвращает ID всех обработанных сообщений пачки. Ошибка означает,
+// что пачку нужно доставить повторно: временная ошибка хранилища хотя бы для одного
+// сообщения или сбой отправки в dead letter.
+func storeBatch(
+	ctx context.Context,
+	store storage.MessageStorage,
+	deadLetter deadLetterSender,
+	storageID string,
+	msgs []*message.Message,
+) ([]string, error) {
+	results, err := store.Store(ctx, msgs)
+	if err != nil {
+		return nil, err
+	}
+
+	rejected := make([]*message.Message, 0)
+	for i, result := range results {
+		if result.Err == nil {
+			continue
+		}
+		if !errors.Is(result.Err, storage.ErrAlreadyExists) {
+			return nil, result.Err
+		}
+
+		logger.Log.Error("Message rejected, sending to dead letter", zap.String("id", result.ID), zap.Error(result.Err))
+		rejected = append(rejected, msgs[i])
+	}
+
+	if len(rejected) > 0 {
+		if err := deadLetter.SendToDeadLetter(storageID, rejected); err != nil {
+			return nil, err
+		}
+	}
+
+	ids := make([]string, len(results))
+	for i, result := range results {
+		ids[i] = result.ID
+	}
+	return ids, nil
+}
+
+// NewAcksHandler удаляет сообщения, обработку которых подтвердил gateway
+// или принявшее их хранилище.
+func NewAcksHandler(acknowledge AcknowledgeFunc) nats.MsgHandler {
+	return func(msg *nats.Msg) {
+		var ids []string
+
+		if err := json.Unmarshal(msg.Data, &ids); err != nil {
+			logger.Log.Error("Received acks unmarshal error", zap.Error(err))
+			return
+		}
+
+		if err := acknowledge(context.Background(), ids); err != nil {
+			logger.Log.Error("Failed to acknowledge messages", zap.Error(err))
+		}
+	}
+}
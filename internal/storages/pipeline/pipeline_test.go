@@ -0,0 +1,93 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+)
+
+// resultStore отвечает на Store заданными результатами по ID сообщений.
+type resultStore struct {
+	storage.MessageStorage
+	errs map[string]error
+	dups map[string]bool
+}
+
+func (s *resultStore) Store(_ context.Context, msgs []*message.Message) ([]storage.StoreResult, error) {
+	results := make([]storage.StoreResult, len(msgs))
+	for i, msg := range msgs {
+		results[i] = storage.StoreResult{ID: msg.ID, Duplicate: s.dups[msg.ID], Err: s.errs[msg.ID]}
+	}
+	return results, nil
+}
+
+// recordingDeadLetter запоминает сообщения, отправленные в dead letter.
+type recordingDeadLetter struct {
+	sent []string
+	err  error
+}
+
+func (d *recordingDeadLetter) SendToDeadLetter(_ string, msgs []*message.Message) error {
+	if d.err != nil {
+		return d.err
+	}
+	for _, msg := range msgs {
+		d.sent = append(d.sent, msg.ID)
+	}
+	return nil
+}
+
+func batch(ids ...string) []*message.Message {
+	msgs := make([]*message.Message, len(ids))
+	for i, id := range ids {
+		msgs[i] = message.NewMessage(message.WithID(id))
+	}
+	return msgs
+}
+
+func TestStoreBatchPartialSuccess(t *testing.T) {
+	store := &resultStore{
+		errs: map[string]error{"conflict": storage.ErrAlreadyExists},
+		dups: map[string]bool{"dup": true},
+	}
+	dlq := &recordingDeadLetter{}
+
+	ids, err := storeBatch(context.Background(), store, dlq, "hot", batch("new", "dup", "conflict"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Сохранённые, дубликаты и отправленные в dead letter сообщения считаются обработанными.
+	if !slices.Equal(ids, []string{"new", "dup", "conflict"}) {
+		t.Fatalf("unexpected processed IDs %v", ids)
+	}
+	if !slices.Equal(dlq.sent, []string{"conflict"}) {
+		t.Fatalf("expected only conflicting message in dead letter, got %v", dlq.sent)
+	}
+}
+
+func TestStoreBatchRedeliversOnTransientError(t *testing.T) {
+	transient := errors.New("disk full")
+	store := &resultStore{errs: map[string]error{"conflict": storage.ErrAlreadyExists, "failed": transient}}
+	dlq := &recordingDeadLetter{}
+
+	if _, err := storeBatch(context.Background(), store, dlq, "hot", batch("new", "conflict", "failed")); !errors.Is(err, transient) {
+		t.Fatalf("expected transient error, got %v", err)
+	}
+	// Пачка будет доставлена повторно целиком: в dead letter ничего не уходит.
+	if len(dlq.sent) != 0 {
+		t.Fatalf("expected nothing in dead letter, got %v", dlq.sent)
+	}
+}
+
+func TestStoreBatchRedeliversOnDeadLetterFailure(t *testing.T) {
+	store := &resultStore{errs: map[string]error{"conflict": storage.ErrAlreadyExists}}
+	dlq := &recordingDeadLetter{err: errors.New("bus unavailable")}
+
+	if _, err := storeBatch(context.Background(), store, dlq, "hot", batch("new", "conflict")); err == nil {
+		t.Fatal("expected error when dead letter is unavailable")
+	}
+}
@@ -0,0 +1,156 @@
+package pipeline
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+	"github.com/Alexey-zaliznuak/orbital/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// storagesRefreshInterval — как часто Promoter обновляет список хранилищ у координатора.
+const storagesRefreshInterval = 5 * time.Second
+
+// Sender публикует выпущенные хранилищем сообщения. Реализуется bus.Client.
+type Sender interface {
+	SendToGateway(storageID string, msgs []*message.Message) error
+	Promote(fromStorageID, toStorageID string, msgs []*message.Message) error
+}
+
+// ListStoragesFunc возвращает зарегистрированные в кластере хранилища.
+type ListStoragesFunc func(ctx context.Context) ([]*storage.Info, error)
+
+// Promoter выпускает сообщения хранилища: наступившие — в gateway, а те, чья
+// оставшаяся задержка через PromoteLeadTime станет меньше MinDelay, — в более
+// горячее хранилище через orbital.promote.{ID}. Более горячими считаются хранилища
+// с MaxDelay не больше MinDelay этого хранилища, поэтому сообщения не могут ходить
+// по кругу.
+type Promoter struct {
+	sender       Sender
+	listStorages ListStoragesFunc
+
+	storageID string
+	minDelay  time.Duration
+	leadTime  time.Duration
+
+	mu          sync.Mutex
+	hotter      []*storage.Info
+	refreshedAt time.Time
+}
+
+// NewPromoter создаёт Promoter хранилища с параметрами cfg.
+func NewPromoter(sender Sender, listStorages ListStoragesFunc, cfg *storage.BaseStorageConfig) *Promoter {
+	return &Promoter{
+		sender:       sender,
+		listStorages: listStorages,
+		storageID:    cfg.ID,
+		minDelay:     cfg.MinDelay,
+		leadTime:     cfg.PromoteLeadTime,
+	}
+}
+
+// Horizon возвращает момент, сообщения с ScheduledAt до которого хранилище должно
+// выпускать на момент now. Без более горячих хранилищ это сам now.
+func (p *Promoter) Horizon(ctx context.Context, now time.Time) time.Time {
+	if len(p.targets(ctx, now)) == 0 {
+		return now
+	}
+	return now.Add(p.minDelay + p.leadTime)
+}
+
+// Release отправляет наступившие на момент now сообщения в gateway, а остальные —
+// в более горячие хранилища. Сообщения остаются у хранилища до подтверждения
+// через orbital.ack.{ID}; если подходящего хранилища не нашлось, они будут
+// выпущены повторно после VisibilityTimeout.
+func (p *Promoter) Release(ctx context.Context, msgs []*message.Message, now time.Time) error {
+	var ready []*message.Message
+	promoted := make(map[string][]*message.Message)
+
+	targets := p.targets(ctx, now)
+
+	for _, msg := range msgs {
+		remaining := msg.ScheduledAt.Sub(now)
+		if remaining <= 0 {
+			ready = append(ready, msg)
+			continue
+		}
+
+		target := chooseTarget(targets, remaining-p.leadTime)
+		if target == "" {
+			logger.Log.Warn("No storage to promote message to", zap.String("id", msg.ID), zap.Duration("remaining", remaining))
+			continue
+		}
+		promoted[target] = append(promoted[target], msg)
+	}
+
+	if len(ready) > 0 {
+		if err := p.sender.SendToGateway(p.storageID, ready); err != nil {
+			return err
+		}
+	}
+
+	for target, batch := range promoted {
+		if err := p.sender.Promote(p.storageID, target, batch); err != nil {
+			return err
+		}
+		logger.Log.Debug("Messages promoted", zap.String("to", target), zap.Int("count", len(batch)))
+	}
+
+	return nil
+}
+
+// targets возвращает более горячие хранилища, обновляя список не чаще storagesRefreshInterval.
+// При ошибке координатора используется ранее полученный список.
+func (p *Promoter) targets(ctx context.Context, now time.Time) []*storage.Info {
+	if p.minDelay <= 0 {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.refreshedAt.IsZero() && now.Sub(p.refreshedAt) < storagesRefreshInterval {
+		return p.hotter
+	}
+
+	storages, err := p.listStorages(ctx)
+	if err != nil {
+		logger.Log.Warn("Failed to refresh storages for promotion", zap.Error(err))
+		return p.hotter
+	}
+
+	hotter := make([]*storage.Info, 0, len(storages))
+	for _, info := range storages {
+		if info.ID != p.storageID && info.MaxDelay > 0 && info.MaxDelay <= p.minDelay {
+			hotter = append(hotter, info)
+		}
+	}
+
+	p.hotter = hotter
+	p.refreshedAt = now
+	return hotter
+}
+
+// chooseTarget возвращает хранилище, принимающее задержку delay, а если такого нет —
+// ближайшее по диапазону (с наибольшим MaxDelay).
+func chooseTarget(targets []*storage.Info, delay time.Duration) string {
+	delay = max(delay, 0)
+
+	var nearest *storage.Info
+	for _, info := range targets {
+		if info.AcceptsDelay(delay) {
+			return info.ID
+		}
+		if nearest == nil || info.MaxDelay > nearest.MaxDelay {
+			nearest = info
+		}
+	}
+
+	if nearest == nil {
+		return ""
+	}
+	return nearest.ID
+}
@@ -0,0 +1,87 @@
+package pipeline
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+)
+
+// recordingSender запоминает выпущенные сообщения.
+type recordingSender struct {
+	gateway  []*message.Message
+	promoted map[string][]*message.Message
+}
+
+func (s *recordingSender) SendToGateway(_ string, msgs []*message.Message) error {
+	s.gateway = append(s.gateway, msgs...)
+	return nil
+}
+
+func (s *recordingSender) Promote(_, toStorageID string, msgs []*message.Message) error {
+	s.promoted[toStorageID] = append(s.promoted[toStorageID], msgs...)
+	return nil
+}
+
+// testTiers — горячий (до минуты), тёплый (минута–час) и холодный (от часа) слои.
+var testTiers = []*storage.Info{
+	{ID: "hot", MaxDelay: time.Minute},
+	{ID: "warm", MinDelay: time.Minute, MaxDelay: time.Hour},
+	{ID: "cold", MinDelay: time.Hour},
+}
+
+func newTestPromoter(id string, minDelay, lead time.Duration) (*Promoter, *recordingSender) {
+	sender := &recordingSender{promoted: make(map[string][]*message.Message)}
+	listStorages := func(context.Context) ([]*storage.Info, error) { return testTiers, nil }
+
+	cfg := &storage.BaseStorageConfig{ID: id, MinDelay: minDelay, PromoteLeadTime: lead}
+	return NewPromoter(sender, listStorages, cfg), sender
+}
+
+func TestHorizon(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	warm, _ := newTestPromoter("warm", time.Minute, 10*time.Second)
+	if got := warm.Horizon(ctx, now); !got.Equal(now.Add(70 * time.Second)) {
+		t.Fatalf("expected horizon MinDelay+lead ahead, got %v", got.Sub(now))
+	}
+
+	hot, _ := newTestPromoter("hot", 0, 10*time.Second)
+	if got := hot.Horizon(ctx, now); !got.Equal(now) {
+		t.Fatalf("expected no promotion for hottest tier, got %v", got.Sub(now))
+	}
+}
+
+func TestReleasePromotesToFittingTier(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	p, sender := newTestPromoter("cold", time.Hour, time.Minute)
+
+	msgs := []*message.Message{
+		message.NewMessage(message.WithID("due"), message.WithScheduledAt(now.Add(-time.Second))),
+		message.NewMessage(message.WithID("warm"), message.WithScheduledAt(now.Add(30*time.Minute))),
+		message.NewMessage(message.WithID("lead"), message.WithScheduledAt(now.Add(time.Hour+30*time.Second))),
+		message.NewMessage(message.WithID("hot"), message.WithScheduledAt(now.Add(30*time.Second))),
+	}
+
+	if err := p.Release(ctx, msgs, now); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sender.gateway) != 1 || sender.gateway[0].ID != "due" {
+		t.Fatalf("expected due message in gateway, got %v", sender.gateway)
+	}
+	if warm := sender.promoted["warm"]; len(warm) != 2 {
+		t.Fatalf("expected 2 messages promoted to warm, got %d", len(warm))
+	}
+	// Горячий слой тоже горячее cold, и сообщение уже в его диапазоне.
+	if hot := sender.promoted["hot"]; len(hot) != 1 || hot[0].ID != "hot" {
+		t.Fatalf("expected message promoted to hot, got %v", hot)
+	}
+	if len(sender.promoted["cold"]) != 0 {
+		t.Fatal("storage must not promote to itself")
+	}
+}
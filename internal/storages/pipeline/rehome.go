@@ -0,0 +1,43 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+)
+
+// ErrNoBus — хранилище не подключено к шине.
+var ErrNoBus = errors.New("storage is not connected to bus")
+
+// RehomeSender передаёт сообщения gateway для повторного выбора хранилища. Реализуется bus.Client.
+type RehomeSender interface {
+	Rehome(storageID string, msgs []*message.Message) error
+	Evacuate(storageID string, msgs []*message.Message) error
+}
+
+// Rehome передаёт gateway сообщения msgs хранилища storageID пачками по batchSize
+// и возвращает число переданных. С evacuate инстанс покидает кластер со своими данными,
+// и gateway может вернуть сообщения в storageID, чтобы их забрали другие инстансы.
+// Сообщения остаются в хранилище, пока gateway не подтвердит их через orbital.ack.{ID}.
+func Rehome(sender RehomeSender, storageID string, msgs []*message.Message, batchSize int, evacuate bool) (int, error) {
+	if sender == nil {
+		return 0, ErrNoBus
+	}
+
+	send := sender.Rehome
+	if evacuate {
+		send = sender.Evacuate
+	}
+
+	sent := 0
+	for batch := range slices.Chunk(msgs, max(batchSize, 1)) {
+		if err := send(storageID, batch); err != nil {
+			return sent, fmt.Errorf("failed to rehome messages: %w", err)
+		}
+		sent += len(batch)
+	}
+
+	return sent, nil
+}
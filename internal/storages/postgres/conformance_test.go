@@ -0,0 +1,27 @@
+package postgresstorage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Alexey-zaliznuak/orbital/internal/storages/storagetest"
+	"github.com/Alexey-zaliznuak/orbital/pkg/clock"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T, clk clock.Clock) *storagetest.Instance {
+		s := newClockedTestStorage(t, clk)
+
+		return &storagetest.Instance{
+			Storage: s,
+			Reopen: func(t *testing.T) storage.MessageStorage {
+				reopened := NewPostgresStorage()
+				if err := reopened.initState(context.Background(), s.cfg, s.pool); err != nil {
+					t.Fatal(err)
+				}
+				return reopened
+			},
+		}
+	})
+}
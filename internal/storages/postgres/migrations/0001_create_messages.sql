@@ -0,0 +1,35 @@
+-- Уникальность ID сообщения в пределах хранилища. Первичный ключ orbital_messages
+-- включает ключ секционирования scheduled_at, который зависит от момента сохранения,
+-- поэтому одно и то же сообщение, сохранённое повторно, не конфликтует с первой копией.
+-- Сообщение удаляется вместе со своей строкой в orbital_message_ids.
+CREATE TABLE IF NOT EXISTS orbital_message_ids (
+    storage_id text NOT NULL,
+    id         text NOT NULL,
+    PRIMARY KEY (storage_id, id)
+);
+
+-- Сообщения всех PostgreSQL-хранилищ кластера, различаются по storage_id.
+-- Таблица секционирована по scheduled_at: опустевшие секции прошлых интервалов
+-- удаляются целиком вместо построчной очистки.
+CREATE TABLE IF NOT EXISTS orbital_messages (
+    storage_id      text        NOT NULL,
+    id              text        NOT NULL,
+    -- Ключ секционирования: ScheduledAt сообщения, но не раньше момента сохранения.
+    scheduled_at    timestamptz NOT NULL,
+    -- Момент, начиная с которого сообщение можно забрать к отправке:
+    -- сначала scheduled_at, после отправки — срок ожидания подтверждения.
+    visible_at      timestamptz NOT NULL,
+    -- Явное состояние сообщения: после Reject с повторной постановкой сообщение
+    -- снова ожидает, хотя attempts > 0, а отклонённое без постановки больше не выдаётся.
+    status          text        NOT NULL DEFAULT 'pending',
+    attempts        integer     NOT NULL DEFAULT 0,
+    last_attempt_at timestamptz,
+    body            jsonb       NOT NULL,
+    PRIMARY KEY (storage_id, scheduled_at, id),
+    CONSTRAINT orbital_messages_id_fkey FOREIGN KEY (storage_id, id)
+        REFERENCES orbital_message_ids (storage_id, id) ON DELETE CASCADE
+) PARTITION BY RANGE (scheduled_at);
+
+CREATE INDEX IF NOT EXISTS orbital_messages_visible_idx ON orbital_messages (storage_id, visible_at);
+CREATE INDEX IF NOT EXISTS orbital_messages_id_idx ON orbital_messages (storage_id, id);
+CREATE INDEX IF NOT EXISTS orbital_messages_status_idx ON orbital_messages (storage_id, status, visible_at);
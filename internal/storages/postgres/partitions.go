@@ -0,0 +1,169 @@
+package postgresstorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/logger"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+const (
+	partitionPrefix = "orbital_messages_p"
+	// partitionTimeLayout — формат начала интервала в имени секции (UTC).
+	partitionTimeLayout = "20060102t1504"
+)
+
+// partitions создаёт секции orbital_messages по scheduled_at и удаляет опустевшие.
+//
+// Сообщения никогда не попадают в секции прошлых интервалов: ключ секционирования
+// не раньше момента сохранения (см. Store). Поэтому секция, интервал которой
+// закончился, может только опустеть, и её безопасно удалить целиком.
+type partitions struct {
+	pool     *pgxpool.Pool
+	interval time.Duration
+
+	mu sync.Mutex
+	// known — начала интервалов, секции которых точно существуют.
+	known map[time.Time]struct{}
+}
+
+func newPartitions(pool *pgxpool.Pool, interval time.Duration) *partitions {
+	return &partitions{
+		pool:     pool,
+		interval: interval,
+		known:    make(map[time.Time]struct{}),
+	}
+}
+
+// bucket возвращает начало интервала секции, содержащей t.
+func (p *partitions) bucket(t time.Time) time.Time {
+	return t.UTC().Truncate(p.interval)
+}
+
+// ensure создаёт секции для всех моментов times, если их ещё нет.
+func (p *partitions) ensure(ctx context.Context, times ...time.Time) error {
+	for _, t := range times {
+		start := p.bucket(t)
+
+		p.mu.Lock()
+		_, ok := p.known[start]
+		p.mu.Unlock()
+
+		if ok {
+			continue
+		}
+
+		if err := p.create(ctx, start); err != nil {
+			return err
+		}
+
+		p.mu.Lock()
+		p.known[start] = struct{}{}
+		p.mu.Unlock()
+	}
+
+	return nil
+}
+
+func (p *partitions) create(ctx context.Context, start time.Time) error {
+	name := partitionPrefix + start.Format(partitionTimeLayout)
+	end := start.Add(p.interval)
+
+	sql := fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s PARTITION OF orbital_messages FOR VALUES FROM ('%s') TO ('%s')",
+		name, start.Format(time.RFC3339), end.Format(time.RFC3339),
+	)
+
+	_, err := p.pool.Exec(ctx, sql)
+
+	// Секцию мог одновременно создать другой инстанс.
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && (pgErr.Code == "42P07" || pgErr.Code == "23505") {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("create partition %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// maintain создаёт секции на ahead интервалов вперёд и удаляет опустевшие секции,
+// интервал которых закончился раньше, чем один интервал назад.
+func (p *partitions) maintain(ctx context.Context, now time.Time, ahead int) error {
+	upcoming := make([]time.Time, 0, ahead+1)
+	for i := 0; i <= ahead; i++ {
+		upcoming = append(upcoming, now.Add(time.Duration(i)*p.interval))
+	}
+
+	if err := p.ensure(ctx, upcoming...); err != nil {
+		return err
+	}
+
+	return p.dropDrained(ctx, p.bucket(now).Add(-p.interval))
+}
+
+func (p *partitions) dropDrained(ctx context.Context, before time.Time) error {
+	rows, err := p.pool.Query(ctx, `
+		SELECT c.relname
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		JOIN pg_class parent ON parent.oid = i.inhparent
+		WHERE parent.relname = 'orbital_messages'`)
+	if err != nil {
+		return fmt.Errorf("list partitions: %w", err)
+	}
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan partition: %w", err)
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("list partitions: %w", err)
+	}
+
+	for _, name := range names {
+		suffix, ok := strings.CutPrefix(name, partitionPrefix)
+		if !ok {
+			continue
+		}
+
+		start, err := time.Parse(partitionTimeLayout, suffix)
+		if err != nil || start.Add(p.interval).After(before) {
+			continue
+		}
+
+		var hasRows bool
+		if err := p.pool.QueryRow(ctx, fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s)", name)).Scan(&hasRows); err != nil {
+			return fmt.Errorf("check partition %s: %w", name, err)
+		}
+		if hasRows {
+			continue
+		}
+
+		if _, err := p.pool.Exec(ctx, fmt.Sprintf("DROP TABLE IF EXISTS %s", name)); err != nil {
+			return fmt.Errorf("drop partition %s: %w", name, err)
+		}
+
+		p.mu.Lock()
+		delete(p.known, start)
+		p.mu.Unlock()
+
+		logger.Log.Info("Partition dropped", zap.String("partition", name))
+	}
+
+	return nil
+}
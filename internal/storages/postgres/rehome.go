@@ -0,0 +1,116 @@
+package postgresstorage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/internal/storages/pipeline"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+	"github.com/jackc/pgx/v5"
+)
+
+// Rehome передаёт gateway ожидающие сообщения, которые не подходят под диапазон query.
+// Интервалы query.Ranges просматриваются страницами по MaxOutputBatchSize в порядке
+// (scheduled_at, id); у будущих сообщений ключ секционирования scheduled_at совпадает
+// со ScheduledAt, поэтому запрос затрагивает только нужные секции. Данные общие для всех
+// инстансов, поэтому сообщения, для которых gateway снова выберет это хранилище,
+// остаются на месте.
+func (s *PostgresStorage) Rehome(ctx context.Context, query storage.RehomeQuery) (*storage.RehomeResult, error) {
+	if err := s.checkReady(); err != nil {
+		return nil, err
+	}
+	if s.rehomeVia == nil {
+		return nil, pipeline.ErrNoBus
+	}
+
+	now := s.clock.Now()
+	result := &storage.RehomeResult{}
+
+	for _, r := range query.Ranges(now) {
+		var to *time.Time
+		if !r.To.IsZero() {
+			to = &r.To
+		}
+
+		var (
+			afterAt = r.From
+			afterID string
+		)
+		for {
+			page, err := s.pendingPage(ctx, r.From, to, afterAt, afterID)
+			if err != nil {
+				return result, err
+			}
+			if len(page) == 0 {
+				break
+			}
+			result.Scanned += len(page)
+
+			last := page[len(page)-1]
+			afterAt, afterID = last.scheduledAt, last.msg.ID
+
+			misplaced := make([]*message.Message, 0, len(page))
+			for _, row := range page {
+				if query.Misplaced(row.msg.ScheduledAt.Sub(now)) {
+					misplaced = append(misplaced, row.msg)
+				}
+			}
+
+			sent, err := pipeline.Rehome(s.rehomeVia, s.cfg.ID, misplaced, s.cfg.MaxOutputBatchSize, false)
+			result.Resubmitted += sent
+			if err != nil {
+				return result, err
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// pendingRow — ожидающее сообщение и его ключ секционирования.
+type pendingRow struct {
+	msg         *message.Message
+	scheduledAt time.Time
+}
+
+// pendingPage возвращает до MaxOutputBatchSize ожидающих сообщений с scheduled_at
+// в [from, to), следующих за (afterAt, afterID); to == nil — без верхней границы.
+func (s *PostgresStorage) pendingPage(ctx context.Context, from time.Time, to *time.Time, afterAt time.Time, afterID string) ([]pendingRow, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT scheduled_at, body
+		FROM orbital_messages
+		WHERE storage_id = $1 AND status = 'pending'
+			AND scheduled_at >= $2 AND ($3::timestamptz IS NULL OR scheduled_at < $3)
+			AND (scheduled_at, id) > ($4, $5)
+		ORDER BY scheduled_at, id
+		LIMIT $6`,
+		s.cfg.ID, from, to, afterAt, afterID, s.cfg.MaxOutputBatchSize,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("postgres rehome: %w", err)
+	}
+
+	page, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (pendingRow, error) {
+		var (
+			pending pendingRow
+			body    []byte
+		)
+		if err := row.Scan(&pending.scheduledAt, &body); err != nil {
+			return pendingRow{}, err
+		}
+
+		pending.msg = &message.Message{}
+		if err := json.Unmarshal(body, pending.msg); err != nil {
+			return pendingRow{}, fmt.Errorf("unmarshal stored message: %w", err)
+		}
+		return pending, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("postgres rehome: %w", err)
+	}
+
+	return page, nil
+}
@@ -0,0 +1,669 @@
+// Package postgresstorage реализует тёплый слой хранения сообщений на PostgreSQL.
+//
+// Сообщения всех PostgreSQL-хранилищ лежат в секционированной таблице orbital_messages
+// (см. migrations). Наступившие сообщения забираются через FOR UPDATE SKIP LOCKED,
+// поэтому несколько инстансов могут работать с одной таблицей, не мешая друг другу.
+package postgresstorage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/internal/storages/pipeline"
+	"github.com/Alexey-zaliznuak/orbital/pkg/bus"
+	"github.com/Alexey-zaliznuak/orbital/pkg/clock"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+	"github.com/Alexey-zaliznuak/orbital/pkg/logger"
+	"github.com/Alexey-zaliznuak/orbital/pkg/sdk/coordinator"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+type PostgresStorage struct {
+	mu sync.RWMutex
+
+	initOnce sync.Once
+
+	pool       *pgxpool.Pool
+	partitions *partitions
+	busClient  *bus.Client
+	promoter   *pipeline.Promoter
+	// rehomeVia передаёт gateway сообщения вне диапазона задержек.
+	rehomeVia pipeline.RehomeSender
+
+	cfg   *PostgresStorageConfig
+	clock clock.Clock
+	ready bool
+}
+
+func NewPostgresStorage() *PostgresStorage {
+	return &PostgresStorage{}
+}
+
+func (s *PostgresStorage) Initialize(ctx context.Context, rawConfig any) error {
+	var err error
+
+	s.initOnce.Do(func() {
+		err = s.initialize(ctx, rawConfig)
+		if err != nil {
+			logger.Log.Error("failed to initialize storage", zap.Error(err))
+		}
+	})
+
+	return err
+}
+
+func (s *PostgresStorage) initialize(ctx context.Context, rawConfig any) error {
+	cfg, ok := rawConfig.(*PostgresStorageConfig)
+
+	if !ok {
+		return fmt.Errorf("expected *PostgresStorageConfig, got %T", rawConfig)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pool, err := pgxpool.New(ctx, cfg.DSN)
+	if err != nil {
+		return fmt.Errorf("failed to create Postgres pool: %w", err)
+	}
+
+	if err := s.initState(ctx, cfg, pool); err != nil {
+		pool.Close()
+		return err
+	}
+
+	busClient, err := pipeline.Connect(ctx, cfg.ClusterAddress)
+	if err != nil {
+		return err
+	}
+	s.busClient = busClient
+	s.rehomeVia = busClient
+
+	coordinatorClient := coordinator.NewClient(coordinator.ClientConfig{
+		BaseURL: cfg.ClusterAddress,
+	})
+	s.promoter = pipeline.NewPromoter(busClient, coordinatorClient.ListStorages, &cfg.BaseStorageConfig)
+
+	subscriptions, err := pipeline.Subscribe(s.busClient, cfg.ID, s, s.Acknowledge, cfg.NakDelay)
+	if err != nil {
+		return err
+	}
+
+	go s.runReleaseWorker(ctx)
+	go s.runMaintenance(ctx)
+	meter := pipeline.NewLoadMeter(s, subscriptions, cfg.Clock)
+	go pipeline.RunHeartbeat(ctx, coordinatorClient, &cfg.BaseStorageConfig, pipeline.MeterReport(meter))
+
+	return nil
+}
+
+// initState применяет миграции и создаёт ближайшие секции.
+func (s *PostgresStorage) initState(ctx context.Context, cfg *PostgresStorageConfig, pool *pgxpool.Pool) error {
+	if err := pool.Ping(ctx); err != nil {
+		return fmt.Errorf("failed to connect to Postgres: %w", err)
+	}
+
+	if err := migrate(ctx, pool); err != nil {
+		return fmt.Errorf("failed to migrate: %w", err)
+	}
+
+	parts := newPartitions(pool, cfg.PartitionInterval)
+	if err := parts.maintain(ctx, clock.OrSystem(cfg.Clock).Now(), cfg.PartitionsAhead); err != nil {
+		return fmt.Errorf("failed to prepare partitions: %w", err)
+	}
+
+	s.cfg = cfg
+	s.clock = clock.OrSystem(cfg.Clock)
+	s.pool = pool
+	s.partitions = parts
+	s.ready = true
+
+	return nil
+}
+
+// runReleaseWorker периодически забирает наступившие сообщения и отправляет их в gateway.
+func (s *PostgresStorage) runReleaseWorker(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.SendExpiredInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.processMessages(ctx); err != nil {
+				logger.Log.Error("failed to process expired messages", zap.Error(err))
+			}
+		}
+	}
+}
+
+// runMaintenance создаёт секции заранее и удаляет опустевшие.
+func (s *PostgresStorage) runMaintenance(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.MaintenanceInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.partitions.maintain(ctx, s.clock.Now(), s.cfg.PartitionsAhead); err != nil {
+				logger.Log.Error("failed to maintain partitions", zap.Error(err))
+			}
+		}
+	}
+}
+
+func (s *PostgresStorage) HealthCheck(ctx context.Context) (storage.StorageHealth, error) {
+	if err := s.checkReady(); err != nil {
+		return storage.StorageHealthDisconnect, err
+	}
+
+	if err := s.pool.Ping(ctx); err != nil {
+		return storage.StorageHealthDisconnect, err
+	}
+
+	return storage.StorageHealthOK, nil
+}
+
+// Store сохраняет пачку сообщений в одной транзакции: сообщение с уже занятым ID
+// и идентичным содержимым считается дубликатом, с отличающимся — получает ErrAlreadyExists.
+// ID сначала занимается в orbital_message_ids: одновременная вставка того же ID другим
+// инстансом ждёт завершения этой транзакции, поэтому сообщение сохраняется не больше одного раза.
+func (s *PostgresStorage) Store(ctx context.Context, msgs []*message.Message) ([]storage.StoreResult, error) {
+	if err := s.checkReady(); err != nil {
+		return nil, err
+	}
+
+	if len(msgs) == 0 {
+		return nil, nil
+	}
+
+	msgs = storage.WithIDs(msgs)
+	now := s.clock.Now()
+	results := make([]storage.StoreResult, len(msgs))
+	keys := make([]time.Time, len(msgs))
+
+	for i, msg := range msgs {
+		results[i].ID = msg.ID
+		keys[i] = partitionKey(msg.ScheduledAt, now)
+	}
+
+	if err := s.partitions.ensure(ctx, keys...); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("postgres begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Повтор ID внутри одной пачки сравнивается с первым вхождением.
+	first := make(map[string]int, len(msgs))
+	for i, msg := range msgs {
+		if j, ok := first[msg.ID]; ok {
+			results[i] = compareStored(msg, msgs[j])
+			continue
+		}
+		first[msg.ID] = i
+	}
+
+	unique := make([]string, 0, len(first))
+	for id := range first {
+		unique = append(unique, id)
+	}
+	// Одинаковый порядок блокировок у одновременных транзакций исключает взаимоблокировку.
+	slices.Sort(unique)
+
+	rows, err := tx.Query(ctx, `
+		INSERT INTO orbital_message_ids (storage_id, id)
+		SELECT $1, unnest($2::text[])
+		ON CONFLICT DO NOTHING
+		RETURNING id`,
+		s.cfg.ID, unique,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("postgres insert ids: %w", err)
+	}
+
+	claimed, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("postgres insert ids: %w", err)
+	}
+
+	var (
+		insertIDs    []string
+		insertKeys   []time.Time
+		insertBodies []string
+	)
+
+	for _, id := range claimed {
+		i := first[id]
+		delete(first, id)
+
+		body, err := json.Marshal(msgs[i])
+		if err != nil {
+			return nil, fmt.Errorf("marshal message %s: %w", id, err)
+		}
+
+		insertIDs = append(insertIDs, id)
+		insertKeys = append(insertKeys, keys[i])
+		insertBodies = append(insertBodies, string(body))
+	}
+
+	if len(insertIDs) > 0 {
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO orbital_messages (storage_id, id, scheduled_at, visible_at, body)
+			SELECT $1, u.id, u.at, u.at, u.body::jsonb
+			FROM unnest($2::text[], $3::timestamptz[], $4::text[]) AS u(id, at, body)`,
+			s.cfg.ID, insertIDs, insertKeys, insertBodies,
+		); err != nil {
+			return nil, fmt.Errorf("postgres insert: %w", err)
+		}
+	}
+
+	// Остальные ID уже заняты: сообщение сохранено раньше или другим инстансом.
+	if len(first) > 0 {
+		taken := make([]string, 0, len(first))
+		for id := range first {
+			taken = append(taken, id)
+		}
+
+		stored, err := s.loadBodies(ctx, tx, taken)
+		if err != nil {
+			return nil, err
+		}
+
+		for id, i := range first {
+			if existing, ok := stored[id]; ok {
+				results[i] = compareStored(msgs[i], existing)
+			} else {
+				results[i].Err = fmt.Errorf("message %s was not stored", id)
+			}
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("postgres commit: %w", err)
+	}
+
+	return results, nil
+}
+
+// loadBodies возвращает сохранённые сообщения этого хранилища с идентификаторами ids.
+func (s *PostgresStorage) loadBodies(ctx context.Context, q pgx.Tx, ids []string) (map[string]*message.Message, error) {
+	rows, err := q.Query(ctx,
+		"SELECT body FROM orbital_messages WHERE storage_id = $1 AND id = ANY($2)",
+		s.cfg.ID, ids,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("postgres select: %w", err)
+	}
+
+	bodies, err := pgx.CollectRows(rows, pgx.RowTo[[]byte])
+	if err != nil {
+		return nil, fmt.Errorf("postgres select: %w", err)
+	}
+
+	result := make(map[string]*message.Message, len(bodies))
+	for _, body := range bodies {
+		var msg message.Message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			return nil, fmt.Errorf("unmarshal stored message: %w", err)
+		}
+		result[msg.ID] = &msg
+	}
+
+	return result, nil
+}
+
+// processMessages забирает наступившие и подлежащие продвижению сообщения и выпускает их.
+// Если отправка не удалась, сообщения будут забраны повторно после VisibilityTimeout.
+func (s *PostgresStorage) processMessages(ctx context.Context) error {
+	now := s.clock.Now()
+
+	claimed, err := s.claim(ctx, now, s.promoter.Horizon(ctx, now), s.cfg.MaxOutputBatchSize)
+	if err != nil {
+		return err
+	}
+
+	if len(claimed) == 0 {
+		return nil
+	}
+
+	msgs := make([]*message.Message, len(claimed))
+	for i, stored := range claimed {
+		msgs[i] = stored.Message
+	}
+
+	return s.promoter.Release(ctx, msgs, now)
+}
+
+// claim забирает до limit ожидающих сообщений с ScheduledAt не позже horizon
+// и выпущенных, но не подтверждённых к моменту now, и откладывает их повторный
+// выпуск на VisibilityTimeout. Строки, заблокированные другим инстансом, пропускаются.
+func (s *PostgresStorage) claim(ctx context.Context, now, horizon time.Time, limit int) ([]*storage.StoredMessage, error) {
+	if err := s.checkReady(); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.pool.Query(ctx, `
+		WITH due AS (
+			SELECT scheduled_at, id
+			FROM orbital_messages
+			WHERE storage_id = $1
+				AND ((status = 'pending' AND visible_at <= $5)
+					OR (status = 'in_flight' AND visible_at <= $2 AND scheduled_at <= $5))
+			ORDER BY visible_at
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE orbital_messages m
+		SET visible_at = $4, status = 'in_flight', attempts = m.attempts + 1, last_attempt_at = $2
+		FROM due
+		WHERE m.storage_id = $1 AND m.scheduled_at = due.scheduled_at AND m.id = due.id
+		RETURNING m.body, m.status, m.attempts, m.last_attempt_at`,
+		s.cfg.ID, now, limit, now.Add(s.cfg.VisibilityTimeout), horizon,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("postgres claim: %w", err)
+	}
+
+	claimed, err := collectStored(rows)
+	if err != nil {
+		return nil, fmt.Errorf("postgres claim: %w", err)
+	}
+
+	return claimed, nil
+}
+
+// FetchExpiring возвращает до limit ожидающих сообщений с ScheduledAt в пределах threshold.
+func (s *PostgresStorage) FetchExpiring(ctx context.Context, threshold time.Duration, limit int) ([]*storage.StoredMessage, error) {
+	if err := s.checkReady(); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT body, status, attempts, last_attempt_at
+		FROM orbital_messages
+		WHERE storage_id = $1 AND status = 'pending' AND visible_at <= $2
+		ORDER BY visible_at, id
+		LIMIT $3`,
+		s.cfg.ID, s.clock.Now().Add(threshold), limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("postgres fetch expiring: %w", err)
+	}
+
+	expiring, err := collectStored(rows)
+	if err != nil {
+		return nil, fmt.Errorf("postgres fetch expiring: %w", err)
+	}
+
+	return expiring, nil
+}
+
+// FetchReady выдаёт до limit наступивших сообщений, включая не подтверждённые
+// в течение VisibilityTimeout.
+func (s *PostgresStorage) FetchReady(ctx context.Context, limit int) ([]*storage.StoredMessage, error) {
+	if limit <= 0 {
+		return nil, s.checkReady()
+	}
+
+	now := s.clock.Now()
+
+	claimed, err := s.claim(ctx, now, now, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(claimed, func(a, b *storage.StoredMessage) int {
+		if c := a.ScheduledAt.Compare(b.ScheduledAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	return claimed, nil
+}
+
+// Reject возвращает выданное сообщение в ожидание с исходным сроком
+// или переводит его в failed.
+func (s *PostgresStorage) Reject(ctx context.Context, id string, requeue bool) error {
+	if err := s.checkReady(); err != nil {
+		return err
+	}
+
+	status := "failed"
+	if requeue {
+		status = "pending"
+	}
+
+	tag, err := s.pool.Exec(ctx, `
+		UPDATE orbital_messages
+		SET status = $3, visible_at = scheduled_at
+		WHERE storage_id = $1 AND id = $2 AND status = 'in_flight'`,
+		s.cfg.ID, id, status,
+	)
+	if err != nil {
+		return fmt.Errorf("postgres reject: %w", err)
+	}
+
+	if tag.RowsAffected() > 0 {
+		return nil
+	}
+
+	if _, err := s.GetByID(ctx, id); err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: %s", storage.ErrNotInFlight, id)
+}
+
+// Delete удаляет сообщение в любом состоянии.
+func (s *PostgresStorage) Delete(ctx context.Context, id string) error {
+	if err := s.checkReady(); err != nil {
+		return err
+	}
+
+	tag, err := s.pool.Exec(ctx,
+		"DELETE FROM orbital_message_ids WHERE storage_id = $1 AND id = $2",
+		s.cfg.ID, id,
+	)
+	if err != nil {
+		return fmt.Errorf("postgres delete: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w: %s", storage.ErrNotFound, id)
+	}
+
+	return nil
+}
+
+// Acknowledge удаляет сообщения, доставку которых подтвердил gateway,
+// сохранение которых подтвердило более горячее хранилище или обработку
+// которых подтвердил клиент FetchReady.
+func (s *PostgresStorage) Acknowledge(ctx context.Context, ids []string) error {
+	if err := s.checkReady(); err != nil {
+		return err
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	if _, err := s.pool.Exec(ctx,
+		"DELETE FROM orbital_message_ids WHERE storage_id = $1 AND id = ANY($2)",
+		s.cfg.ID, ids,
+	); err != nil {
+		return fmt.Errorf("postgres acknowledge: %w", err)
+	}
+
+	return nil
+}
+
+// Get возвращает сообщение вместе с его состоянием.
+func (s *PostgresStorage) Get(ctx context.Context, id string) (*storage.StoredMessage, error) {
+	if err := s.checkReady(); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT body, status, attempts, last_attempt_at
+		FROM orbital_messages
+		WHERE storage_id = $1 AND id = $2
+		LIMIT 1`,
+		s.cfg.ID, id,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("postgres get %s: %w", id, err)
+	}
+
+	stored, err := collectStored(rows)
+	if err != nil {
+		return nil, fmt.Errorf("postgres get %s: %w", id, err)
+	}
+	if len(stored) == 0 {
+		return nil, fmt.Errorf("%w: %s", storage.ErrNotFound, id)
+	}
+
+	return stored[0], nil
+}
+
+// collectStored читает строки (body, status, attempts, last_attempt_at).
+func collectStored(rows pgx.Rows) ([]*storage.StoredMessage, error) {
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (*storage.StoredMessage, error) {
+		var (
+			body          []byte
+			status        string
+			attempts      int
+			lastAttemptAt *time.Time
+		)
+		if err := row.Scan(&body, &status, &attempts, &lastAttemptAt); err != nil {
+			return nil, err
+		}
+
+		stored := &storage.StoredMessage{
+			Message:  &message.Message{},
+			Status:   storage.MessageStatus(status),
+			Attempts: attempts,
+		}
+		if err := json.Unmarshal(body, stored.Message); err != nil {
+			return nil, fmt.Errorf("unmarshal stored message: %w", err)
+		}
+		if lastAttemptAt != nil {
+			stored.LastAttemptAt = *lastAttemptAt
+		}
+
+		return stored, nil
+	})
+}
+
+func (s *PostgresStorage) GetByID(ctx context.Context, id string) (*message.Message, error) {
+	if err := s.checkReady(); err != nil {
+		return nil, err
+	}
+
+	var body []byte
+	err := s.pool.QueryRow(ctx,
+		"SELECT body FROM orbital_messages WHERE storage_id = $1 AND id = $2 LIMIT 1",
+		s.cfg.ID, id,
+	).Scan(&body)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", storage.ErrNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("postgres get %s: %w", id, err)
+	}
+
+	var msg message.Message
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, fmt.Errorf("unmarshal message %s: %w", id, err)
+	}
+
+	return &msg, nil
+}
+
+func (s *PostgresStorage) Count(ctx context.Context) (int64, error) {
+	if err := s.checkReady(); err != nil {
+		return 0, err
+	}
+
+	var n int64
+	if err := s.pool.QueryRow(ctx,
+		"SELECT count(*) FROM orbital_messages WHERE storage_id = $1",
+		s.cfg.ID,
+	).Scan(&n); err != nil {
+		return 0, fmt.Errorf("postgres count: %w", err)
+	}
+
+	return n, nil
+}
+
+// ProbeLoad реализует pipeline.LoadProber: наименьший visible_at наступивших ожидающих
+// сообщений и число сообщений в полёте, по индексу (storage_id, status, visible_at)
+// без чтения тел.
+func (s *PostgresStorage) ProbeLoad(ctx context.Context, now time.Time) (time.Time, int64, error) {
+	if err := s.checkReady(); err != nil {
+		return time.Time{}, 0, err
+	}
+
+	var (
+		earliestDue *time.Time
+		inFlight    int64
+	)
+	if err := s.pool.QueryRow(ctx, `
+		SELECT
+			(SELECT min(visible_at) FROM orbital_messages
+				WHERE storage_id = $1 AND status = 'pending' AND visible_at <= $2),
+			(SELECT count(*) FROM orbital_messages
+				WHERE storage_id = $1 AND status = 'in_flight')`,
+		s.cfg.ID, now,
+	).Scan(&earliestDue, &inFlight); err != nil {
+		return time.Time{}, 0, fmt.Errorf("postgres probe load: %w", err)
+	}
+
+	if earliestDue == nil {
+		return time.Time{}, inFlight, nil
+	}
+	return *earliestDue, inFlight, nil
+}
+
+// partitionKey возвращает ключ секционирования сообщения: ScheduledAt, но не раньше now.
+// Так сообщения никогда не попадают в секции прошедших интервалов.
+func partitionKey(scheduledAt, now time.Time) time.Time {
+	if scheduledAt.Before(now) {
+		return now
+	}
+	return scheduledAt
+}
+
+func compareStored(msg, stored *message.Message) storage.StoreResult {
+	if stored.Equal(msg) {
+		return storage.StoreResult{ID: msg.ID, Duplicate: true}
+	}
+	return storage.StoreResult{ID: msg.ID, Err: fmt.Errorf("%w: %s", storage.ErrAlreadyExists, msg.ID)}
+}
+
+func (s *PostgresStorage) checkReady() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if !s.ready {
+		return storage.ErrNotInitialized
+	}
+	return nil
+}
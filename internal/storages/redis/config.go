@@ -0,0 +1,92 @@
+package redisstorage
+
+import (
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/clock"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+	"github.com/caarlos0/env/v11"
+)
+
+type RedisStorageConfig struct {
+	storage.BaseStorageConfig
+
+	RedisAddress  string `env:"REDIS_ADDR" envDefault:"localhost:6379"`
+	RedisPassword string `env:"REDIS_PASSWORD" envDefault:""`
+	RedisDB       int    `env:"REDIS_DB" envDefault:"0"`
+
+	// KeyPrefix общий префикс ключей. Ключи разных хранилищ различаются по ID,
+	// поэтому несколько хранилищ могут использовать один Redis.
+	KeyPrefix string `env:"REDIS_KEY_PREFIX" envDefault:"orbital"`
+}
+
+type RedisStorageConfigBuilder struct {
+	cfg *RedisStorageConfig
+}
+
+func NewBuilder() *RedisStorageConfigBuilder {
+	return &RedisStorageConfigBuilder{
+		cfg: &RedisStorageConfig{},
+	}
+}
+
+func (b *RedisStorageConfigBuilder) WithID(id string) *RedisStorageConfigBuilder {
+	b.cfg.ID = id
+	return b
+}
+
+func (b *RedisStorageConfigBuilder) WithAddress(addr string) *RedisStorageConfigBuilder {
+	b.cfg.Address = addr
+	return b
+}
+
+func (b *RedisStorageConfigBuilder) WithClusterAddress(addr string) *RedisStorageConfigBuilder {
+	b.cfg.ClusterAddress = addr
+	return b
+}
+
+func (b *RedisStorageConfigBuilder) WithRedis(addr, password string, db int) *RedisStorageConfigBuilder {
+	b.cfg.RedisAddress = addr
+	b.cfg.RedisPassword = password
+	b.cfg.RedisDB = db
+	return b
+}
+
+func (b *RedisStorageConfigBuilder) WithKeyPrefix(prefix string) *RedisStorageConfigBuilder {
+	b.cfg.KeyPrefix = prefix
+	return b
+}
+
+func (b *RedisStorageConfigBuilder) WithSendExpiredInterval(d time.Duration) *RedisStorageConfigBuilder {
+	b.cfg.SendExpiredInterval = d
+	return b
+}
+
+func (b *RedisStorageConfigBuilder) WithMaxOutputBatchSize(size int) *RedisStorageConfigBuilder {
+	b.cfg.MaxOutputBatchSize = size
+	return b
+}
+
+func (b *RedisStorageConfigBuilder) WithNakDelay(d time.Duration) *RedisStorageConfigBuilder {
+	b.cfg.NakDelay = d
+	return b
+}
+
+func (b *RedisStorageConfigBuilder) WithVisibilityTimeout(d time.Duration) *RedisStorageConfigBuilder {
+	b.cfg.VisibilityTimeout = d
+	return b
+}
+
+func (b *RedisStorageConfigBuilder) WithClock(c clock.Clock) *RedisStorageConfigBuilder {
+	b.cfg.Clock = c
+	return b
+}
+
+func (b *RedisStorageConfigBuilder) FromEnv() *RedisStorageConfigBuilder {
+	env.Parse(b.cfg)
+	return b
+}
+
+func (b *RedisStorageConfigBuilder) Build() *RedisStorageConfig {
+	return b.cfg
+}
@@ -0,0 +1,25 @@
+package redisstorage
+
+import (
+	"testing"
+
+	"github.com/Alexey-zaliznuak/orbital/internal/storages/storagetest"
+	"github.com/Alexey-zaliznuak/orbital/pkg/clock"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T, clk clock.Clock) *storagetest.Instance {
+		s := newClockedTestStorage(t, clk)
+
+		return &storagetest.Instance{
+			Storage: s,
+			// Состояние целиком в Redis: новый экземпляр поверх тех же ключей.
+			Reopen: func(t *testing.T) storage.MessageStorage {
+				reopened := NewRedisStorage()
+				reopened.initState(s.cfg, s.client)
+				return reopened
+			},
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package redisstorage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/internal/storages/pipeline"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+	"github.com/redis/go-redis/v9"
+)
+
+// Rehome передаёт gateway ожидающие сообщения, которые не подходят под диапазон query.
+// Просматриваются только интервалы расписания из query.Ranges; выпущенные и отклонённые
+// сообщения в расписании не лежат. Данные общие для всех инстансов, поэтому сообщения,
+// для которых gateway снова выберет это хранилище, остаются на месте.
+func (s *RedisStorage) Rehome(ctx context.Context, query storage.RehomeQuery) (*storage.RehomeResult, error) {
+	if err := s.checkReady(); err != nil {
+		return nil, err
+	}
+	if s.rehomeVia == nil {
+		return nil, pipeline.ErrNoBus
+	}
+
+	now := s.clock.Now()
+	result := &storage.RehomeResult{}
+
+	for _, r := range query.Ranges(now) {
+		// Score хранит миллисекунды, поэтому границы берутся с запасом,
+		// а сообщения на краях отсеивает Misplaced.
+		rangeBy := &redis.ZRangeBy{Min: strconv.FormatInt(r.From.UnixMilli(), 10), Max: "+inf"}
+		if !r.To.IsZero() {
+			rangeBy.Max = strconv.FormatInt(r.To.UnixMilli(), 10)
+		}
+
+		ids, err := s.client.ZRangeByScore(ctx, s.keys.schedule, rangeBy).Result()
+		if err != nil {
+			return result, fmt.Errorf("redis rehome: %w", err)
+		}
+
+		for len(ids) > 0 {
+			batch := ids[:min(len(ids), s.cfg.MaxOutputBatchSize)]
+			ids = ids[len(batch):]
+
+			misplaced, err := s.misplaced(ctx, batch, query, now)
+			if err != nil {
+				return result, err
+			}
+			result.Scanned += len(batch)
+
+			sent, err := pipeline.Rehome(s.rehomeVia, s.cfg.ID, misplaced, s.cfg.MaxOutputBatchSize, false)
+			result.Resubmitted += sent
+			if err != nil {
+				return result, err
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// misplaced читает сообщения ids и возвращает те, что не подходят под query.
+// Удалённые за время просмотра сообщения пропускаются.
+func (s *RedisStorage) misplaced(ctx context.Context, ids []string, query storage.RehomeQuery, now time.Time) ([]*message.Message, error) {
+	bodies, err := s.client.HMGet(ctx, s.keys.messages, ids...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis rehome: %w", err)
+	}
+
+	msgs := make([]*message.Message, 0, len(bodies))
+	for i, body := range bodies {
+		raw, ok := body.(string)
+		if !ok {
+			continue
+		}
+
+		var msg message.Message
+		if err := json.Unmarshal([]byte(raw), &msg); err != nil {
+			return nil, fmt.Errorf("unmarshal message %s: %w", ids[i], err)
+		}
+		if query.Misplaced(msg.ScheduledAt.Sub(now)) {
+			msgs = append(msgs, &msg)
+		}
+	}
+
+	return msgs, nil
+}
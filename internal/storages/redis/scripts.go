@@ -0,0 +1,94 @@
+package redisstorage
+
+import "github.com/redis/go-redis/v9"
+
+// storeScript сохраняет пачку сообщений, если их ID ещё не заняты.
+//
+//	KEYS: messages, schedule, scores
+//	ARGV: тройки id, body, score
+//
+// Возвращает для каждого сообщения false (сохранено) или тело уже сохранённого
+// сообщения с тем же ID — сравнение содержимого выполняет вызывающий.
+var storeScript = redis.NewScript(`
+local result = {}
+for i = 1, #ARGV, 3 do
+	local id = ARGV[i]
+	local existing = redis.call('HGET', KEYS[1], id)
+	if existing then
+		table.insert(result, existing)
+	else
+		redis.call('HSET', KEYS[1], id, ARGV[i + 1])
+		redis.call('ZADD', KEYS[2], ARGV[i + 2], id)
+		redis.call('HSET', KEYS[3], id, ARGV[i + 2])
+		table.insert(result, false)
+	end
+end
+return result
+`)
+
+// claimScript атомарно забирает до limit сообщений к выпуску: сначала inflight-сообщения
+// с истёкшим visibility timeout, затем сообщения из расписания до horizon (наступившие
+// и подлежащие продвижению). Inflight-сообщения со ScheduledAt позже horizon остаются
+// на месте. Забранные сообщения получают новый срок deadline, поэтому несколько
+// инстансов с одним Redis не отправят одно сообщение дважды.
+//
+//	KEYS: schedule, inflight, messages, scores, attempts, attempted
+//	ARGV: now, deadline, limit, horizon
+//
+// Возвращает пары: тело забранного сообщения и число его выдач.
+var claimScript = redis.NewScript(`
+local limit = tonumber(ARGV[3])
+local horizon = tonumber(ARGV[4])
+local ids = {}
+local expired = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', ARGV[1], 'LIMIT', 0, limit)
+for _, id in ipairs(expired) do
+	if tonumber(redis.call('HGET', KEYS[4], id) or '0') <= horizon then
+		table.insert(ids, id)
+	end
+end
+if #ids < limit then
+	local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[4], 'LIMIT', 0, limit - #ids)
+	for _, id in ipairs(due) do
+		redis.call('ZREM', KEYS[1], id)
+		table.insert(ids, id)
+	end
+end
+local result = {}
+for _, id in ipairs(ids) do
+	local body = redis.call('HGET', KEYS[3], id)
+	if body then
+		redis.call('ZADD', KEYS[2], ARGV[2], id)
+		local attempts = redis.call('HINCRBY', KEYS[5], id, 1)
+		redis.call('HSET', KEYS[6], id, ARGV[1])
+		table.insert(result, body)
+		table.insert(result, tostring(attempts))
+	else
+		redis.call('ZREM', KEYS[2], id)
+	end
+end
+return result
+`)
+
+// rejectScript возвращает выданное сообщение в расписание с исходным score или
+// переносит его в failed.
+//
+//	KEYS: messages, inflight, schedule, scores, failed
+//	ARGV: id, requeue (1 или 0)
+//
+// Возвращает 0, если сообщения нет, 1 — если оно не в inflight, 2 — если отклонено.
+var rejectScript = redis.NewScript(`
+local id = ARGV[1]
+if redis.call('HEXISTS', KEYS[1], id) == 0 then
+	return 0
+end
+if not redis.call('ZSCORE', KEYS[2], id) then
+	return 1
+end
+redis.call('ZREM', KEYS[2], id)
+if ARGV[2] == '1' then
+	redis.call('ZADD', KEYS[3], redis.call('HGET', KEYS[4], id) or '0', id)
+else
+	redis.call('SADD', KEYS[5], id)
+end
+return 2
+`)
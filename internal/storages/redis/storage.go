@@ -0,0 +1,582 @@
+// Package redisstorage реализует горячий слой хранения сообщений на Redis.
+//
+// Тела сообщений хранятся в hash {prefix}:{id}:messages, расписание — в sorted set
+// {prefix}:{id}:schedule со ScheduledAt в миллисекундах в качестве score.
+// Выпущенные в gateway сообщения переносятся в sorted set {prefix}:{id}:inflight
+// со сроком повторной отправки и удаляются после подтверждения от gateway.
+// Hash {prefix}:{id}:scores хранит исходный score каждого сообщения, hash-и
+// attempts и attempted — число и время (мс) последней выдачи, set failed —
+// сообщения, отклонённые без повторной постановки.
+package redisstorage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/internal/storages/pipeline"
+	"github.com/Alexey-zaliznuak/orbital/pkg/bus"
+	"github.com/Alexey-zaliznuak/orbital/pkg/clock"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+	"github.com/Alexey-zaliznuak/orbital/pkg/logger"
+	"github.com/Alexey-zaliznuak/orbital/pkg/sdk/coordinator"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// keys — ключи Redis одного хранилища. ID хранилища взят в hash tag,
+// чтобы в Redis Cluster все ключи попадали в один слот и были доступны из Lua.
+type keys struct {
+	messages  string
+	schedule  string
+	inflight  string
+	scores    string
+	attempts  string
+	attempted string
+	failed    string
+}
+
+func newKeys(prefix, storageID string) keys {
+	base := fmt.Sprintf("%s:{%s}", prefix, storageID)
+	return keys{
+		messages:  base + ":messages",
+		schedule:  base + ":schedule",
+		inflight:  base + ":inflight",
+		scores:    base + ":scores",
+		attempts:  base + ":attempts",
+		attempted: base + ":attempted",
+		failed:    base + ":failed",
+	}
+}
+
+// all возвращает все ключи хранилища.
+func (k keys) all() []string {
+	return []string{k.messages, k.schedule, k.inflight, k.scores, k.attempts, k.attempted, k.failed}
+}
+
+type RedisStorage struct {
+	mu sync.RWMutex
+
+	initOnce sync.Once
+
+	client    *redis.Client
+	busClient *bus.Client
+	promoter  *pipeline.Promoter
+	// rehomeVia передаёт gateway сообщения вне диапазона задержек.
+	rehomeVia pipeline.RehomeSender
+
+	cfg   *RedisStorageConfig
+	clock clock.Clock
+	keys  keys
+	ready bool
+}
+
+func NewRedisStorage() *RedisStorage {
+	return &RedisStorage{}
+}
+
+func (s *RedisStorage) Initialize(ctx context.Context, rawConfig any) error {
+	var err error
+
+	s.initOnce.Do(func() {
+		err = s.initialize(ctx, rawConfig)
+		if err != nil {
+			logger.Log.Error("failed to initialize storage", zap.Error(err))
+		}
+	})
+
+	return err
+}
+
+func (s *RedisStorage) initialize(ctx context.Context, rawConfig any) error {
+	cfg, ok := rawConfig.(*RedisStorageConfig)
+
+	if !ok {
+		return fmt.Errorf("expected *RedisStorageConfig, got %T", rawConfig)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.RedisAddress,
+		Password: cfg.RedisPassword,
+		DB:       cfg.RedisDB,
+	})
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+
+	busClient, err := pipeline.Connect(ctx, cfg.ClusterAddress)
+	if err != nil {
+		return err
+	}
+	s.busClient = busClient
+	s.rehomeVia = busClient
+
+	coordinatorClient := coordinator.NewClient(coordinator.ClientConfig{
+		BaseURL: cfg.ClusterAddress,
+	})
+	s.promoter = pipeline.NewPromoter(busClient, coordinatorClient.ListStorages, &cfg.BaseStorageConfig)
+
+	s.initState(cfg, client)
+
+	subscriptions, err := pipeline.Subscribe(s.busClient, cfg.ID, s, s.Acknowledge, cfg.NakDelay)
+	if err != nil {
+		return err
+	}
+
+	go s.runReleaseWorker(ctx)
+	meter := pipeline.NewLoadMeter(s, subscriptions, cfg.Clock)
+	go pipeline.RunHeartbeat(ctx, coordinatorClient, &cfg.BaseStorageConfig, pipeline.MeterReport(meter))
+
+	return nil
+}
+
+// initState подготавливает хранилище поверх подключённого клиента Redis.
+func (s *RedisStorage) initState(cfg *RedisStorageConfig, client *redis.Client) {
+	s.cfg = cfg
+	s.clock = clock.OrSystem(cfg.Clock)
+	s.client = client
+	s.keys = newKeys(cfg.KeyPrefix, cfg.ID)
+	s.ready = true
+}
+
+// runReleaseWorker периодически забирает наступившие сообщения и отправляет их в gateway.
+func (s *RedisStorage) runReleaseWorker(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.SendExpiredInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.processMessages(ctx); err != nil {
+				logger.Log.Error("failed to process expired messages", zap.Error(err))
+			}
+		}
+	}
+}
+
+func (s *RedisStorage) HealthCheck(ctx context.Context) (storage.StorageHealth, error) {
+	if err := s.checkReady(); err != nil {
+		return storage.StorageHealthDisconnect, err
+	}
+
+	if err := s.client.Ping(ctx).Err(); err != nil {
+		return storage.StorageHealthDisconnect, err
+	}
+
+	return storage.StorageHealthOK, nil
+}
+
+// Store сохраняет пачку сообщений одним Lua-скриптом: сообщение с уже занятым ID
+// и идентичным содержимым считается дубликатом, с отличающимся — получает ErrAlreadyExists.
+func (s *RedisStorage) Store(ctx context.Context, msgs []*message.Message) ([]storage.StoreResult, error) {
+	if err := s.checkReady(); err != nil {
+		return nil, err
+	}
+
+	if len(msgs) == 0 {
+		return nil, nil
+	}
+
+	msgs = storage.WithIDs(msgs)
+
+	args := make([]any, 0, len(msgs)*3)
+	for _, msg := range msgs {
+		body, err := json.Marshal(msg)
+		if err != nil {
+			return nil, fmt.Errorf("marshal message %s: %w", msg.ID, err)
+		}
+
+		args = append(args, msg.ID, body, score(msg.ScheduledAt))
+	}
+
+	replies, err := storeScript.Run(ctx, s.client, []string{s.keys.messages, s.keys.schedule, s.keys.scores}, args...).Slice()
+	if err != nil {
+		return nil, fmt.Errorf("redis store: %w", err)
+	}
+
+	results := make([]storage.StoreResult, len(msgs))
+	for i, msg := range msgs {
+		results[i].ID = msg.ID
+
+		existing, ok := replies[i].(string)
+		if !ok {
+			continue
+		}
+
+		var stored message.Message
+		if err := json.Unmarshal([]byte(existing), &stored); err != nil {
+			results[i].Err = fmt.Errorf("unmarshal stored message %s: %w", msg.ID, err)
+			continue
+		}
+
+		if stored.Equal(msg) {
+			results[i].Duplicate = true
+		} else {
+			results[i].Err = fmt.Errorf("%w: %s", storage.ErrAlreadyExists, msg.ID)
+		}
+	}
+
+	return results, nil
+}
+
+// processMessages забирает наступившие и подлежащие продвижению сообщения и выпускает их.
+// Если отправка не удалась, сообщения будут забраны повторно после VisibilityTimeout.
+func (s *RedisStorage) processMessages(ctx context.Context) error {
+	now := s.clock.Now()
+
+	claimed, err := s.claim(ctx, now, s.promoter.Horizon(ctx, now), s.cfg.MaxOutputBatchSize)
+	if err != nil {
+		return err
+	}
+
+	if len(claimed) == 0 {
+		return nil
+	}
+
+	msgs := make([]*message.Message, len(claimed))
+	for i, stored := range claimed {
+		msgs[i] = stored.Message
+	}
+
+	return s.promoter.Release(ctx, msgs, now)
+}
+
+// claim атомарно забирает до limit сообщений с ScheduledAt не позже horizon
+// и сообщений, не подтверждённых в течение VisibilityTimeout на момент now.
+func (s *RedisStorage) claim(ctx context.Context, now, horizon time.Time, limit int) ([]*storage.StoredMessage, error) {
+	if err := s.checkReady(); err != nil {
+		return nil, err
+	}
+
+	deadline := now.Add(s.cfg.VisibilityTimeout)
+
+	replies, err := claimScript.Run(
+		ctx,
+		s.client,
+		[]string{s.keys.schedule, s.keys.inflight, s.keys.messages, s.keys.scores, s.keys.attempts, s.keys.attempted},
+		now.UnixMilli(), deadline.UnixMilli(), limit, horizon.UnixMilli(),
+	).StringSlice()
+	if err != nil {
+		return nil, fmt.Errorf("redis claim: %w", err)
+	}
+
+	claimed := make([]*storage.StoredMessage, 0, len(replies)/2)
+	for i := 0; i+1 < len(replies); i += 2 {
+		var msg message.Message
+		if err := json.Unmarshal([]byte(replies[i]), &msg); err != nil {
+			logger.Log.Error("Failed to unmarshal stored message", zap.Error(err))
+			continue
+		}
+
+		attempts, _ := strconv.Atoi(replies[i+1])
+		claimed = append(claimed, &storage.StoredMessage{
+			Message:       &msg,
+			Status:        storage.MessageStatusInFlight,
+			Attempts:      attempts,
+			LastAttemptAt: time.UnixMilli(now.UnixMilli()),
+		})
+	}
+
+	return claimed, nil
+}
+
+// FetchExpiring возвращает до limit ещё не выпускавшихся сообщений с ScheduledAt
+// в пределах threshold в порядке расписания.
+func (s *RedisStorage) FetchExpiring(ctx context.Context, threshold time.Duration, limit int) ([]*storage.StoredMessage, error) {
+	if err := s.checkReady(); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	ids, err := s.client.ZRangeByScore(ctx, s.keys.schedule, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(s.clock.Now().Add(threshold).UnixMilli(), 10),
+		Count: int64(limit),
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis fetch expiring: %w", err)
+	}
+
+	expiring := make([]*storage.StoredMessage, 0, len(ids))
+	for _, id := range ids {
+		stored, err := s.Get(ctx, id)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		expiring = append(expiring, stored)
+	}
+
+	return expiring, nil
+}
+
+// FetchReady выдаёт до limit наступивших сообщений, включая не подтверждённые
+// в течение VisibilityTimeout.
+func (s *RedisStorage) FetchReady(ctx context.Context, limit int) ([]*storage.StoredMessage, error) {
+	if limit <= 0 {
+		return nil, s.checkReady()
+	}
+
+	now := s.clock.Now()
+
+	claimed, err := s.claim(ctx, now, now, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(claimed, func(a, b *storage.StoredMessage) int {
+		if c := a.ScheduledAt.Compare(b.ScheduledAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	return claimed, nil
+}
+
+// Reject возвращает выданное сообщение в расписание или переносит его в failed.
+func (s *RedisStorage) Reject(ctx context.Context, id string, requeue bool) error {
+	if err := s.checkReady(); err != nil {
+		return err
+	}
+
+	flag := "0"
+	if requeue {
+		flag = "1"
+	}
+
+	code, err := rejectScript.Run(
+		ctx,
+		s.client,
+		[]string{s.keys.messages, s.keys.inflight, s.keys.schedule, s.keys.scores, s.keys.failed},
+		id, flag,
+	).Int()
+	if err != nil {
+		return fmt.Errorf("redis reject: %w", err)
+	}
+
+	switch code {
+	case 0:
+		return fmt.Errorf("%w: %s", storage.ErrNotFound, id)
+	case 1:
+		return fmt.Errorf("%w: %s", storage.ErrNotInFlight, id)
+	}
+
+	return nil
+}
+
+// Delete удаляет сообщение в любом состоянии.
+func (s *RedisStorage) Delete(ctx context.Context, id string) error {
+	if err := s.checkReady(); err != nil {
+		return err
+	}
+
+	removed, err := s.remove(ctx, []string{id})
+	if err != nil {
+		return fmt.Errorf("redis delete: %w", err)
+	}
+	if removed == 0 {
+		return fmt.Errorf("%w: %s", storage.ErrNotFound, id)
+	}
+
+	return nil
+}
+
+// Acknowledge удаляет сообщения, доставку которых подтвердил gateway,
+// сохранение которых подтвердило более горячее хранилище или обработку
+// которых подтвердил клиент FetchReady.
+func (s *RedisStorage) Acknowledge(ctx context.Context, ids []string) error {
+	if err := s.checkReady(); err != nil {
+		return err
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	if _, err := s.remove(ctx, ids); err != nil {
+		return fmt.Errorf("redis acknowledge: %w", err)
+	}
+
+	return nil
+}
+
+// remove удаляет сообщения ids из всех ключей одной транзакцией
+// и возвращает число удалённых тел сообщений.
+func (s *RedisStorage) remove(ctx context.Context, ids []string) (int64, error) {
+	members := make([]any, len(ids))
+	for i, id := range ids {
+		members[i] = id
+	}
+
+	var removed *redis.IntCmd
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		removed = pipe.HDel(ctx, s.keys.messages, ids...)
+		pipe.ZRem(ctx, s.keys.schedule, members...)
+		pipe.ZRem(ctx, s.keys.inflight, members...)
+		pipe.HDel(ctx, s.keys.scores, ids...)
+		pipe.HDel(ctx, s.keys.attempts, ids...)
+		pipe.HDel(ctx, s.keys.attempted, ids...)
+		pipe.SRem(ctx, s.keys.failed, members...)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return removed.Val(), nil
+}
+
+// Get возвращает сообщение вместе с его состоянием.
+func (s *RedisStorage) Get(ctx context.Context, id string) (*storage.StoredMessage, error) {
+	if err := s.checkReady(); err != nil {
+		return nil, err
+	}
+
+	var (
+		body      *redis.StringCmd
+		failed    *redis.BoolCmd
+		inflight  *redis.FloatCmd
+		attempts  *redis.StringCmd
+		attempted *redis.StringCmd
+	)
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		body = pipe.HGet(ctx, s.keys.messages, id)
+		failed = pipe.SIsMember(ctx, s.keys.failed, id)
+		inflight = pipe.ZScore(ctx, s.keys.inflight, id)
+		attempts = pipe.HGet(ctx, s.keys.attempts, id)
+		attempted = pipe.HGet(ctx, s.keys.attempted, id)
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("redis get %s: %w", id, err)
+	}
+
+	if errors.Is(body.Err(), redis.Nil) {
+		return nil, fmt.Errorf("%w: %s", storage.ErrNotFound, id)
+	}
+
+	stored := &storage.StoredMessage{Message: &message.Message{}, Status: storage.MessageStatusPending}
+	if err := json.Unmarshal([]byte(body.Val()), stored.Message); err != nil {
+		return nil, fmt.Errorf("unmarshal message %s: %w", id, err)
+	}
+
+	switch {
+	case failed.Val():
+		stored.Status = storage.MessageStatusFailed
+	case inflight.Err() == nil:
+		stored.Status = storage.MessageStatusInFlight
+	}
+
+	if n, err := attempts.Int(); err == nil {
+		stored.Attempts = n
+	}
+	if ms, err := attempted.Int64(); err == nil {
+		stored.LastAttemptAt = time.UnixMilli(ms)
+	}
+
+	return stored, nil
+}
+
+func (s *RedisStorage) GetByID(ctx context.Context, id string) (*message.Message, error) {
+	if err := s.checkReady(); err != nil {
+		return nil, err
+	}
+
+	body, err := s.client.HGet(ctx, s.keys.messages, id).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("%w: %s", storage.ErrNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("redis get %s: %w", id, err)
+	}
+
+	var msg message.Message
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, fmt.Errorf("unmarshal message %s: %w", id, err)
+	}
+
+	return &msg, nil
+}
+
+func (s *RedisStorage) Count(ctx context.Context) (int64, error) {
+	if err := s.checkReady(); err != nil {
+		return 0, err
+	}
+
+	n, err := s.client.HLen(ctx, s.keys.messages).Result()
+	if err != nil {
+		return 0, fmt.Errorf("redis count: %w", err)
+	}
+
+	return n, nil
+}
+
+// ProbeLoad реализует pipeline.LoadProber: самое раннее наступившее сообщение
+// расписания и размер sorted set inflight, без чтения тел сообщений. Сообщения
+// без ScheduledAt (score 0) не опаздывают и не учитываются.
+func (s *RedisStorage) ProbeLoad(ctx context.Context, now time.Time) (time.Time, int64, error) {
+	if err := s.checkReady(); err != nil {
+		return time.Time{}, 0, err
+	}
+
+	var (
+		due      *redis.ZSliceCmd
+		inflight *redis.IntCmd
+	)
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		due = pipe.ZRangeByScoreWithScores(ctx, s.keys.schedule, &redis.ZRangeBy{
+			Min:   "(0",
+			Max:   strconv.FormatInt(now.UnixMilli(), 10),
+			Count: 1,
+		})
+		inflight = pipe.ZCard(ctx, s.keys.inflight)
+		return nil
+	})
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("redis probe load: %w", err)
+	}
+
+	var earliestDue time.Time
+	if first := due.Val(); len(first) > 0 {
+		earliestDue = time.UnixMilli(int64(first[0].Score))
+	}
+
+	return earliestDue, inflight.Val(), nil
+}
+
+// score возвращает score расписания: ScheduledAt в миллисекундах,
+// 0 для сообщений без ScheduledAt (доставляются немедленно).
+func score(scheduledAt time.Time) string {
+	if scheduledAt.IsZero() {
+		return "0"
+	}
+	return strconv.FormatInt(scheduledAt.UnixMilli(), 10)
+}
+
+func (s *RedisStorage) checkReady() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if !s.ready {
+		return storage.ErrNotInitialized
+	}
+	return nil
+}
@@ -0,0 +1,275 @@
+package redisstorage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/clock"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestStorage создаёт хранилище без подключения к кластеру. Если задан
+// ORBITAL_TEST_REDIS_ADDR, используется настоящий Redis, иначе — miniredis.
+// Ключи каждого теста изолированы по ID хранилища.
+func newTestStorage(t *testing.T) *RedisStorage {
+	t.Helper()
+
+	return newClockedTestStorage(t, clock.System{})
+}
+
+// newClockedTestStorage создаёт тестовое хранилище, планирующее по часам clk.
+func newClockedTestStorage(t *testing.T, clk clock.Clock) *RedisStorage {
+	t.Helper()
+
+	addr := os.Getenv("ORBITAL_TEST_REDIS_ADDR")
+	if addr == "" {
+		addr = miniredis.RunT(t).Addr()
+	}
+
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	t.Cleanup(func() { client.Close() })
+
+	cfg := NewBuilder().
+		WithID("test-" + time.Now().Format("150405.000000000")).
+		WithKeyPrefix("orbital-test").
+		WithMaxOutputBatchSize(10).
+		WithVisibilityTimeout(time.Minute).
+		WithClock(clk).
+		Build()
+
+	s := NewRedisStorage()
+	s.initState(cfg, client)
+
+	t.Cleanup(func() {
+		client.Del(context.Background(), s.keys.all()...)
+	})
+
+	return s
+}
+
+func TestStoreAndGet(t *testing.T) {
+	s := newTestStorage(t)
+	ctx := context.Background()
+
+	msg := message.NewMessage(
+		message.WithID("a"),
+		message.WithRoutingKey("rk"),
+		message.WithPayload([]byte("payload")),
+		message.WithMetadataValue("k", "v"),
+		message.WithScheduledAt(time.Now().Add(time.Hour)),
+	)
+
+	results, err := s.Store(ctx, []*message.Message{msg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Err != nil || results[0].Duplicate {
+		t.Fatalf("unexpected result %+v", results[0])
+	}
+
+	got, err := s.GetByID(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(msg) {
+		t.Fatalf("stored message differs: %+v", got)
+	}
+
+	if _, err := s.GetByID(ctx, "missing"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	if n, _ := s.Count(ctx); n != 1 {
+		t.Fatalf("expected 1 message, got %d", n)
+	}
+}
+
+func TestStoreDuplicateAndConflict(t *testing.T) {
+	s := newTestStorage(t)
+	ctx := context.Background()
+
+	msg := message.NewMessage(message.WithID("a"), message.WithPayload([]byte("v1")))
+	if _, err := s.Store(ctx, []*message.Message{msg}); err != nil {
+		t.Fatal(err)
+	}
+
+	conflict := *msg
+	conflict.Payload = []byte("v2")
+
+	results, err := s.Store(ctx, []*message.Message{msg, &conflict})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !results[0].Duplicate || results[0].Err != nil {
+		t.Fatalf("expected duplicate, got %+v", results[0])
+	}
+	if !errors.Is(results[1].Err, storage.ErrAlreadyExists) {
+		t.Fatalf("expected ErrAlreadyExists, got %+v", results[1])
+	}
+}
+
+func TestClaimReleasesDueMessagesOnce(t *testing.T) {
+	s := newTestStorage(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	msgs := []*message.Message{
+		message.NewMessage(message.WithID("due")),
+		message.NewMessage(message.WithID("past"), message.WithScheduledAt(now.Add(-time.Second))),
+		message.NewMessage(message.WithID("future"), message.WithScheduledAt(now.Add(time.Hour))),
+	}
+	if _, err := s.Store(ctx, msgs); err != nil {
+		t.Fatal(err)
+	}
+
+	claimed, err := s.claim(ctx, now, now, s.cfg.MaxOutputBatchSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed) != 2 {
+		t.Fatalf("expected 2 due messages, got %d", len(claimed))
+	}
+
+	// Второй инстанс не должен получить уже забранные сообщения.
+	again, err := s.claim(ctx, now, now, s.cfg.MaxOutputBatchSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again) != 0 {
+		t.Fatalf("expected no messages, got %d", len(again))
+	}
+
+	// После visibility timeout неподтверждённые сообщения забираются повторно.
+	redelivered, err := s.claim(ctx, now.Add(2*time.Minute), now.Add(2*time.Minute), s.cfg.MaxOutputBatchSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(redelivered) != 2 {
+		t.Fatalf("expected 2 redelivered messages, got %d", len(redelivered))
+	}
+}
+
+func TestAcknowledge(t *testing.T) {
+	s := newTestStorage(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	if _, err := s.Store(ctx, []*message.Message{message.NewMessage(message.WithID("a"))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.claim(ctx, now, now, s.cfg.MaxOutputBatchSize); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Acknowledge(ctx, []string{"a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, _ := s.Count(ctx); n != 0 {
+		t.Fatalf("expected no messages, got %d", n)
+	}
+
+	claimed, err := s.claim(ctx, now.Add(2*time.Minute), now.Add(2*time.Minute), s.cfg.MaxOutputBatchSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed) != 0 {
+		t.Fatalf("expected acknowledged message not to be redelivered, got %d", len(claimed))
+	}
+}
+
+func TestClaimUntilHorizon(t *testing.T) {
+	s := newTestStorage(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	msgs := []*message.Message{
+		message.NewMessage(message.WithID("soon"), message.WithScheduledAt(now.Add(time.Minute))),
+		message.NewMessage(message.WithID("later"), message.WithScheduledAt(now.Add(time.Hour))),
+	}
+	if _, err := s.Store(ctx, msgs); err != nil {
+		t.Fatal(err)
+	}
+
+	horizon := now.Add(5 * time.Minute)
+
+	claimed, err := s.claim(ctx, now, horizon, s.cfg.MaxOutputBatchSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed) != 1 || claimed[0].ID != "soon" {
+		t.Fatalf("expected message before horizon to be claimed, got %v", claimed)
+	}
+
+	// Выпущенное сообщение не забирается повторно до истечения VisibilityTimeout,
+	// даже если срок видимости раньше horizon.
+	again, err := s.claim(ctx, now, horizon, s.cfg.MaxOutputBatchSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again) != 0 {
+		t.Fatalf("expected no messages, got %d", len(again))
+	}
+}
+
+// recordingRehome запоминает сообщения, переданные gateway.
+type recordingRehome struct {
+	ids      []string
+	evacuate bool
+}
+
+func (r *recordingRehome) Rehome(_ string, msgs []*message.Message) error {
+	for _, msg := range msgs {
+		r.ids = append(r.ids, msg.ID)
+	}
+	return nil
+}
+
+func (r *recordingRehome) Evacuate(storageID string, msgs []*message.Message) error {
+	r.evacuate = true
+	return r.Rehome(storageID, msgs)
+}
+
+func TestRehome(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := newClockedTestStorage(t, clock.NewFake(now))
+	sent := &recordingRehome{}
+	s.rehomeVia = sent
+	ctx := context.Background()
+
+	msgs := []*message.Message{
+		message.NewMessage(message.WithID("due"), message.WithScheduledAt(now.Add(-time.Minute))),
+		message.NewMessage(message.WithID("too-soon"), message.WithScheduledAt(now.Add(time.Minute))),
+		message.NewMessage(message.WithID("claimed"), message.WithScheduledAt(now.Add(30*time.Second))),
+		message.NewMessage(message.WithID("fits"), message.WithScheduledAt(now.Add(time.Hour))),
+		message.NewMessage(message.WithID("too-far"), message.WithScheduledAt(now.Add(48*time.Hour))),
+	}
+	if _, err := s.Store(ctx, msgs); err != nil {
+		t.Fatal(err)
+	}
+	// Выпущенные сообщения не передаются.
+	if _, err := s.claim(ctx, now, now.Add(45*time.Second), s.cfg.MaxOutputBatchSize); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := s.Rehome(ctx, storage.RehomeQuery{MinDelay: 5 * time.Minute, MaxDelay: 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Resubmitted != 2 || sent.evacuate ||
+		!slices.Equal(sent.ids, []string{"too-soon", "too-far"}) {
+		t.Fatalf("unexpected rehome %+v: %v", result, sent.ids)
+	}
+
+	// Сообщения удаляются только после подтверждения gateway.
+	if n, _ := s.Count(ctx); n != int64(len(msgs)) {
+		t.Fatalf("expected rehomed messages to stay until acknowledged, got %d", n)
+	}
+}
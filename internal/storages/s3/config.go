@@ -0,0 +1,114 @@
+package s3storage
+
+import (
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/clock"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+	"github.com/caarlos0/env/v11"
+)
+
+type S3StorageConfig struct {
+	storage.BaseStorageConfig
+
+	S3Endpoint  string `env:"S3_ENDPOINT" envDefault:"localhost:9000"`
+	S3AccessKey string `env:"S3_ACCESS_KEY" envDefault:""`
+	S3SecretKey string `env:"S3_SECRET_KEY" envDefault:""`
+	S3Bucket    string `env:"S3_BUCKET" envDefault:"orbital"`
+	S3UseSSL    bool   `env:"S3_USE_SSL" envDefault:"false"`
+	// FSRoot если задан, объекты хранятся в этом каталоге вместо S3.
+	FSRoot string `env:"S3_FS_ROOT" envDefault:""`
+
+	// TimeBucket ширина временного интервала: сообщения одного интервала
+	// хранятся в объектах одного префикса и передаются дальше вместе.
+	TimeBucket time.Duration `env:"TIME_BUCKET" envDefault:"1m"`
+	// LoadAhead за сколько до начала интервала его сообщения передаются следующему слою.
+	LoadAhead time.Duration `env:"LOAD_AHEAD" envDefault:"5m"`
+	// HandoffInterval период проверки наступивших интервалов и компактизации.
+	HandoffInterval time.Duration `env:"HANDOFF_INTERVAL" envDefault:"10s"`
+	// CompactSegments количество сегментов интервала, после которого они объединяются в один.
+	CompactSegments int `env:"COMPACT_SEGMENTS" envDefault:"8"`
+}
+
+type S3StorageConfigBuilder struct {
+	cfg *S3StorageConfig
+}
+
+func NewBuilder() *S3StorageConfigBuilder {
+	return &S3StorageConfigBuilder{
+		cfg: &S3StorageConfig{},
+	}
+}
+
+func (b *S3StorageConfigBuilder) WithID(id string) *S3StorageConfigBuilder {
+	b.cfg.ID = id
+	return b
+}
+
+func (b *S3StorageConfigBuilder) WithAddress(addr string) *S3StorageConfigBuilder {
+	b.cfg.Address = addr
+	return b
+}
+
+func (b *S3StorageConfigBuilder) WithClusterAddress(addr string) *S3StorageConfigBuilder {
+	b.cfg.ClusterAddress = addr
+	return b
+}
+
+func (b *S3StorageConfigBuilder) WithS3(endpoint, accessKey, secretKey, bucket string, useSSL bool) *S3StorageConfigBuilder {
+	b.cfg.S3Endpoint = endpoint
+	b.cfg.S3AccessKey = accessKey
+	b.cfg.S3SecretKey = secretKey
+	b.cfg.S3Bucket = bucket
+	b.cfg.S3UseSSL = useSSL
+	return b
+}
+
+func (b *S3StorageConfigBuilder) WithFSRoot(root string) *S3StorageConfigBuilder {
+	b.cfg.FSRoot = root
+	return b
+}
+
+func (b *S3StorageConfigBuilder) WithTimeBucket(d time.Duration) *S3StorageConfigBuilder {
+	b.cfg.TimeBucket = d
+	return b
+}
+
+func (b *S3StorageConfigBuilder) WithLoadAhead(d time.Duration) *S3StorageConfigBuilder {
+	b.cfg.LoadAhead = d
+	return b
+}
+
+func (b *S3StorageConfigBuilder) WithHandoffInterval(d time.Duration) *S3StorageConfigBuilder {
+	b.cfg.HandoffInterval = d
+	return b
+}
+
+func (b *S3StorageConfigBuilder) WithCompactSegments(n int) *S3StorageConfigBuilder {
+	b.cfg.CompactSegments = n
+	return b
+}
+
+func (b *S3StorageConfigBuilder) WithNakDelay(d time.Duration) *S3StorageConfigBuilder {
+	b.cfg.NakDelay = d
+	return b
+}
+
+func (b *S3StorageConfigBuilder) WithVisibilityTimeout(d time.Duration) *S3StorageConfigBuilder {
+	b.cfg.VisibilityTimeout = d
+	return b
+}
+
+func (b *S3StorageConfigBuilder) WithClock(c clock.Clock) *S3StorageConfigBuilder {
+	b.cfg.Clock = c
+	return b
+}
+
+func (b *S3StorageConfigBuilder) FromEnv() *S3StorageConfigBuilder {
+	env.Parse(b.cfg)
+	return b
+}
+
+func (b *S3StorageConfigBuilder) Build() *S3StorageConfig {
+	return b.cfg
+}
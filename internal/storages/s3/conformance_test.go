@@ -0,0 +1,34 @@
+package s3storage
+
+import (
+	"testing"
+
+	"github.com/Alexey-zaliznuak/orbital/internal/storages/storagetest"
+	"github.com/Alexey-zaliznuak/orbital/pkg/clock"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T, clk clock.Clock) *storagetest.Instance {
+		objects := newFSStore(t)
+
+		open := func(t *testing.T) *S3Storage {
+			cfg := newTestConfig()
+			cfg.Clock = clk
+
+			fwd := &recordingForwarder{storages: make(map[string][]*message.Message)}
+			s := NewS3Storage()
+			if err := s.initState(t.Context(), cfg, objects, fwd, listTestTiers); err != nil {
+				t.Fatal(err)
+			}
+			return s
+		}
+
+		return &storagetest.Instance{
+			Storage: open(t),
+			// Индекс восстанавливается по объектам хранилища.
+			Reopen: func(t *testing.T) storage.MessageStorage { return open(t) },
+		}
+	})
+}
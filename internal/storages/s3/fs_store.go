@@ -0,0 +1,98 @@
+package s3storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fsTempSuffix — суффикс временных файлов, которые ещё не стали объектами.
+const fsTempSuffix = ".tmp"
+
+// FSObjectStore хранит объекты файлами в каталоге root; ключ объекта — путь
+// относительно root. Используется для разработки и тестов без S3.
+type FSObjectStore struct {
+	root string
+}
+
+func NewFSObjectStore(root string) (*FSObjectStore, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("object store mkdir %s: %w", root, err)
+	}
+	return &FSObjectStore{root: root}, nil
+}
+
+func (s *FSObjectStore) Put(_ context.Context, key string, data []byte) error {
+	path := s.path(key)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("object store mkdir %s: %w", key, err)
+	}
+
+	tmp := path + fsTempSuffix
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("object store write %s: %w", key, err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("object store rename %s: %w", key, err)
+	}
+
+	return nil
+}
+
+func (s *FSObjectStore) Get(_ context.Context, key string) ([]byte, error) {
+	data, err := os.ReadFile(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("object store read %s: %w", key, err)
+	}
+	return data, nil
+}
+
+func (s *FSObjectStore) List(_ context.Context, prefix string) ([]string, error) {
+	var keys []string
+
+	err := filepath.WalkDir(s.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(path, fsTempSuffix) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.root, path)
+		if err != nil {
+			return err
+		}
+
+		key := filepath.ToSlash(rel)
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("object store list %s: %w", prefix, err)
+	}
+
+	return keys, nil
+}
+
+func (s *FSObjectStore) Delete(_ context.Context, key string) error {
+	err := os.Remove(s.path(key))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("object store delete %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *FSObjectStore) path(key string) string {
+	return filepath.Join(s.root, filepath.FromSlash(key))
+}
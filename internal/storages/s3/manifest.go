@@ -0,0 +1,193 @@
+package s3storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+)
+
+// bucketManifest — манифест интервала: его сегменты и дайджесты его сообщений.
+// Сегменты, не попавшие в манифест (например, после сбоя между записью сегмента
+// и манифеста), не читаются.
+type bucketManifest struct {
+	Segments []string          `json:"segments"`
+	IDs      map[string]string `json:"ids"`
+}
+
+// lockManifest захватывает manifestMu интервала start, создавая его индекс при
+// необходимости, и возвращает индекс.
+func (s *S3Storage) lockManifest(start int64) *bucketIndex {
+	for {
+		s.indexMu.Lock()
+		b := s.bucket(start)
+		s.indexMu.Unlock()
+
+		b.manifestMu.Lock()
+
+		s.indexMu.Lock()
+		current := s.buckets[start] == b
+		s.indexMu.Unlock()
+
+		if current {
+			return b
+		}
+		// Интервал удалили, пока ждали manifestMu, — создаём его заново.
+		b.manifestMu.Unlock()
+	}
+}
+
+// updateManifest применяет mutate к копии манифеста интервала, записывает результат
+// в хранилище и только после этого переносит его в локальный индекс. Манифест без
+// сегментов удаляется вместе с интервалом. Возвращает false, если mutate отказался
+// от изменения или интервал уже удалён. Вызывающий удерживает b.manifestMu.
+func (s *S3Storage) updateManifest(ctx context.Context, bucket int64, b *bucketIndex, mutate func(m *bucketManifest) bool) (bool, error) {
+	s.indexMu.Lock()
+	current := s.buckets[bucket] == b
+	s.indexMu.Unlock()
+
+	if !current {
+		return false, nil
+	}
+
+	next := &bucketManifest{
+		Segments: slices.Clone(b.segments),
+		IDs:      maps.Clone(b.ids),
+	}
+	if next.IDs == nil {
+		next.IDs = make(map[string]string)
+	}
+	if !mutate(next) {
+		return false, nil
+	}
+
+	if err := s.writeManifest(ctx, bucket, next); err != nil {
+		s.indexMu.Lock()
+		if len(b.segments) == 0 {
+			delete(s.buckets, bucket)
+		}
+		s.indexMu.Unlock()
+		return false, err
+	}
+
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	for id := range b.ids {
+		if _, ok := next.IDs[id]; !ok && s.ids[id] == bucket {
+			delete(s.ids, id)
+			delete(s.forwarded, id)
+		}
+	}
+	for id := range next.IDs {
+		s.ids[id] = bucket
+	}
+
+	b.segments, b.ids = next.Segments, next.IDs
+	if len(b.segments) == 0 {
+		delete(s.buckets, bucket)
+	}
+
+	return true, nil
+}
+
+// writeManifest сохраняет манифест интервала; манифест без сегментов удаляется.
+func (s *S3Storage) writeManifest(ctx context.Context, bucket int64, m *bucketManifest) error {
+	key := s.manifestKey(bucket)
+	if len(m.Segments) == 0 {
+		return s.objects.Delete(ctx, key)
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("marshal manifest: %w", err)
+	}
+
+	return s.objects.Put(ctx, key, data)
+}
+
+func (s *S3Storage) readManifest(ctx context.Context, key string) (*bucketManifest, error) {
+	data, err := s.objects.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	var m bucketManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("unmarshal manifest %s: %w", key, err)
+	}
+	if m.IDs == nil {
+		m.IDs = make(map[string]string)
+	}
+
+	return &m, nil
+}
+
+func (s *S3Storage) manifestPrefix() string {
+	return s.prefix() + "manifests/"
+}
+
+func (s *S3Storage) manifestKey(bucket int64) string {
+	return s.manifestPrefix() + strconv.FormatInt(bucket, 10) + ".json"
+}
+
+// parseManifest извлекает начало интервала из ключа {storage_id}/manifests/{start}.json.
+func (s *S3Storage) parseManifest(key string) (int64, bool) {
+	rest, ok := strings.CutPrefix(key, s.manifestPrefix())
+	if !ok {
+		return 0, false
+	}
+
+	start, ok := strings.CutSuffix(rest, ".json")
+	if !ok {
+		return 0, false
+	}
+
+	bucket, err := strconv.ParseInt(start, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return bucket, true
+}
+
+// messageDigest возвращает дайджест содержимого сообщения: у сообщений, равных
+// по message.Equal, дайджесты совпадают.
+func messageDigest(msg *message.Message) string {
+	h := sha256.New()
+
+	writeBytes := func(b []byte) {
+		h.Write(binary.BigEndian.AppendUint64(nil, uint64(len(b))))
+		h.Write(b)
+	}
+	writeMap := func(m map[string]string) {
+		h.Write(binary.BigEndian.AppendUint64(nil, uint64(len(m))))
+		for _, k := range slices.Sorted(maps.Keys(m)) {
+			writeBytes([]byte(k))
+			writeBytes([]byte(m[k]))
+		}
+	}
+	writeTime := func(t time.Time) {
+		h.Write(binary.BigEndian.AppendUint64(nil, uint64(t.Unix())))
+		h.Write(binary.BigEndian.AppendUint32(nil, uint32(t.Nanosecond())))
+	}
+
+	writeBytes([]byte(msg.ID))
+	writeBytes([]byte(msg.RoutingKey))
+	writeMap(msg.RoutingSettings)
+	writeBytes(msg.Payload)
+	writeMap(msg.Metadata)
+	writeTime(msg.CreatedAt)
+	writeTime(msg.ScheduledAt)
+
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
@@ -0,0 +1,127 @@
+package s3storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+)
+
+// countingStore считает чтения сегментов — объектов вне манифестов.
+type countingStore struct {
+	ObjectStore
+
+	mu            sync.Mutex
+	segmentReads  int
+	manifestReads int
+}
+
+func (c *countingStore) Get(ctx context.Context, key string) ([]byte, error) {
+	c.mu.Lock()
+	if strings.Contains(key, "/manifests/") {
+		c.manifestReads++
+	} else {
+		c.segmentReads++
+	}
+	c.mu.Unlock()
+	return c.ObjectStore.Get(ctx, key)
+}
+
+func (c *countingStore) reads() (segments, manifests int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.segmentReads, c.manifestReads
+}
+
+func TestRestartReadsOnlyManifests(t *testing.T) {
+	fs := newFSStore(t)
+	s, _ := newTestStorage(t, fs)
+	ctx := context.Background()
+	at := time.Now().Add(2 * time.Hour).Truncate(time.Minute)
+
+	msgs := []*message.Message{
+		message.NewMessage(message.WithID("a"), message.WithScheduledAt(at)),
+		message.NewMessage(message.WithID("b"), message.WithScheduledAt(at.Add(time.Minute))),
+	}
+	for _, msg := range msgs {
+		if _, err := s.Store(ctx, []*message.Message{msg}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Сегмент, не попавший в манифест, при старте не учитывается.
+	if _, err := s.writeSegment(ctx, s.bucketStart(at), []*message.Message{message.NewMessage(message.WithID("orphan"), message.WithScheduledAt(at))}); err != nil {
+		t.Fatal(err)
+	}
+
+	objects := &countingStore{ObjectStore: fs}
+	restarted, _ := newTestStorage(t, objects)
+
+	if n, _ := restarted.Count(ctx); n != 2 {
+		t.Fatalf("expected 2 messages after restart, got %d", n)
+	}
+	if segments, manifests := objects.reads(); segments != 0 || manifests != 2 {
+		t.Fatalf("expected restart to read 2 manifests and no segments, got %d manifests and %d segments", manifests, segments)
+	}
+
+	// Повторы и конфликты распознаются по манифесту, без чтения сегментов.
+	conflict := *msgs[1]
+	conflict.Payload = []byte("changed")
+	results, err := restarted.Store(ctx, []*message.Message{msgs[0], &conflict})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !results[0].Duplicate || !errors.Is(results[1].Err, storage.ErrAlreadyExists) {
+		t.Fatalf("unexpected results after restart %+v", results)
+	}
+	if segments, _ := objects.reads(); segments != 0 {
+		t.Fatalf("expected duplicate check not to read segments, got %d reads", segments)
+	}
+
+	if err := restarted.Delete(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	again, _ := newTestStorage(t, fs)
+	if _, err := again.GetByID(ctx, "a"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected deleted message to stay deleted after restart, got %v", err)
+	}
+	if n, _ := again.Count(ctx); n != 1 {
+		t.Fatalf("expected 1 message after delete and restart, got %d", n)
+	}
+}
+
+func TestMessageDigestMatchesEqual(t *testing.T) {
+	at := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	msg := message.NewMessage(
+		message.WithID("a"),
+		message.WithPayload([]byte("payload")),
+		message.WithCreatedAt(at),
+		message.WithScheduledAt(at.Add(time.Hour)),
+	)
+
+	// Тот же момент в другой зоне и пустые map вместо nil не меняют содержимое.
+	same := *msg
+	same.CreatedAt = at.In(time.FixedZone("UTC+3", 3*60*60))
+	same.Metadata = map[string]string{}
+	if !msg.Equal(&same) || messageDigest(msg) != messageDigest(&same) {
+		t.Fatal("expected equal messages to have equal digests")
+	}
+
+	changed := []func(m *message.Message){
+		func(m *message.Message) { m.Payload = []byte("other") },
+		func(m *message.Message) { m.RoutingKey = "other" },
+		func(m *message.Message) { m.Metadata = map[string]string{"k": "v"} },
+		func(m *message.Message) { m.ScheduledAt = m.ScheduledAt.Add(time.Nanosecond) },
+	}
+	for i, change := range changed {
+		other := *msg
+		change(&other)
+		if messageDigest(msg) == messageDigest(&other) {
+			t.Fatalf("change %d: expected different digests", i)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package s3storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// MinioObjectStore хранит объекты в bucket S3-совместимого хранилища (AWS S3, MinIO).
+type MinioObjectStore struct {
+	client *minio.Client
+	bucket string
+}
+
+// NewMinioObjectStore подключается к endpoint и создаёт bucket, если его ещё нет.
+func NewMinioObjectStore(ctx context.Context, endpoint, accessKey, secretKey, bucket string, useSSL bool) (*MinioObjectStore, error) {
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure: useSSL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client: %w", err)
+	}
+
+	exists, err := client.BucketExists(ctx, bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check bucket %s: %w", bucket, err)
+	}
+
+	if !exists {
+		if err := client.MakeBucket(ctx, bucket, minio.MakeBucketOptions{}); err != nil {
+			return nil, fmt.Errorf("failed to create bucket %s: %w", bucket, err)
+		}
+	}
+
+	return &MinioObjectStore{client: client, bucket: bucket}, nil
+}
+
+func (s *MinioObjectStore) Put(ctx context.Context, key string, data []byte) error {
+	_, err := s.client.PutObject(ctx, s.bucket, key, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+		ContentType: "application/json",
+	})
+	if err != nil {
+		return fmt.Errorf("object store put %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *MinioObjectStore) Get(ctx context.Context, key string) ([]byte, error) {
+	obj, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("object store get %s: %w", key, err)
+	}
+	defer obj.Close()
+
+	data, err := io.ReadAll(obj)
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("object store get %s: %w", key, err)
+	}
+
+	return data, nil
+}
+
+func (s *MinioObjectStore) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return nil, fmt.Errorf("object store list %s: %w", prefix, obj.Err)
+		}
+		keys = append(keys, obj.Key)
+	}
+
+	return keys, nil
+}
+
+func (s *MinioObjectStore) Delete(ctx context.Context, key string) error {
+	if err := s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("object store delete %s: %w", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package s3storage
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrObjectNotFound = errors.New("object not found")
+
+// ObjectStore — минимальное S3-совместимое хранилище объектов.
+// Реализации: FSObjectStore (локальная файловая система) и MinioObjectStore (S3, MinIO).
+type ObjectStore interface {
+	// Put атомарно записывает объект целиком.
+	Put(ctx context.Context, key string, data []byte) error
+	// Get возвращает содержимое объекта или ErrObjectNotFound.
+	Get(ctx context.Context, key string) ([]byte, error)
+	// List возвращает ключи всех объектов с префиксом prefix.
+	List(ctx context.Context, prefix string) ([]string, error)
+	// Delete удаляет объект; отсутствие объекта не считается ошибкой.
+	Delete(ctx context.Context, key string) error
+}
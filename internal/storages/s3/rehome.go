@@ -0,0 +1,67 @@
+package s3storage
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/internal/storages/pipeline"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+)
+
+// Rehome передаёт gateway сообщения, которые не подходят под диапазон query.
+// Читаются только интервалы, пересекающие query.Ranges; сообщения, переданные
+// следующему слою и ещё не подтверждённые им, пропускаются, а переданные gateway
+// отмечаются так же: handoff не передаёт их повторно, пока не истечёт VisibilityTimeout.
+// Данные общие для всех инстансов, поэтому сообщения, для которых gateway снова
+// выберет это хранилище, остаются на месте.
+func (s *S3Storage) Rehome(ctx context.Context, query storage.RehomeQuery) (*storage.RehomeResult, error) {
+	if err := s.checkReady(); err != nil {
+		return nil, err
+	}
+	if s.rehomeVia == nil {
+		return nil, pipeline.ErrNoBus
+	}
+
+	now := s.clock.Now()
+	ranges := query.Ranges(now)
+	candidates := s.snapshotBuckets(func(start int64, _ *bucketIndex) bool {
+		return slices.ContainsFunc(ranges, func(r storage.ScheduleRange) bool {
+			return s.bucketOverlaps(start, r)
+		})
+	})
+
+	result := &storage.RehomeResult{}
+
+	for _, bucket := range slices.Sorted(maps.Keys(candidates)) {
+		msgs, err := s.readSegments(ctx, candidates[bucket])
+		if err != nil {
+			return result, err
+		}
+
+		msgs = s.unforwarded(msgs, now)
+		result.Scanned += len(msgs)
+
+		misplaced := slices.DeleteFunc(msgs, func(msg *message.Message) bool {
+			return !query.Misplaced(msg.ScheduledAt.Sub(now))
+		})
+
+		sent, err := pipeline.Rehome(s.rehomeVia, s.cfg.ID, misplaced, s.cfg.MaxOutputBatchSize, false)
+		s.markForwarded(misplaced[:sent], now)
+		result.Resubmitted += sent
+		if err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// bucketOverlaps сообщает, пересекается ли интервал start с диапазоном r.
+func (s *S3Storage) bucketOverlaps(start int64, r storage.ScheduleRange) bool {
+	from := time.Unix(start, 0)
+	to := from.Add(s.cfg.TimeBucket)
+	return to.After(r.From) && (r.To.IsZero() || from.Before(r.To))
+}
@@ -0,0 +1,871 @@
+// Package s3storage реализует холодный слой хранения сообщений в S3-совместимом
+// хранилище объектов.
+//
+// Сообщения группируются по временным интервалам ScheduledAt (TimeBucket). Каждый
+// вызов Store дописывает в интервал новый сегмент — объект {storage_id}/{start}/{uuid}.json
+// с JSON-массивом сообщений; сегменты интервала периодически объединяются. Состав
+// интервала — список его сегментов и дайджесты его сообщений — хранится в манифесте
+// {storage_id}/manifests/{start}.json: при старте читаются только манифесты, а повторы
+// сообщений распознаются по дайджестам без чтения сегментов.
+// За LoadAhead до начала интервала его сообщения передаются следующему слою
+// (хранилищу, принимающему оставшуюся задержку) и удаляются из S3, когда тот
+// подтвердит их через orbital.ack.{ID}.
+package s3storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/internal/storages/pipeline"
+	"github.com/Alexey-zaliznuak/orbital/pkg/clock"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+	"github.com/Alexey-zaliznuak/orbital/pkg/logger"
+	"github.com/Alexey-zaliznuak/orbital/pkg/sdk/coordinator"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// forwarder передаёт сообщения следующему слою. Реализуется bus.Client.
+type forwarder interface {
+	Promote(fromStorageID, toStorageID string, msgs []*message.Message) error
+	SendToGateway(storageID string, msgs []*message.Message) error
+}
+
+// bucketIndex — локальный индекс одного временного интервала, копия его манифеста.
+type bucketIndex struct {
+	// mu упорядочивает переписывание сегментов интервала: компактизацию и удаление
+	// сообщений. Store только дописывает сегменты и mu не берёт.
+	mu sync.Mutex
+	// manifestMu упорядочивает запись манифеста интервала. segments и ids меняются
+	// только под manifestMu и indexMu, поэтому под manifestMu их можно читать без indexMu.
+	// Берётся после mu.
+	manifestMu sync.Mutex
+	segments   []string
+	// ids — дайджесты сообщений интервала по их ID (см. messageDigest).
+	ids map[string]string
+}
+
+type S3Storage struct {
+	mu sync.RWMutex
+
+	initOnce sync.Once
+
+	objects      ObjectStore
+	forwarder    forwarder
+	listStorages func(ctx context.Context) ([]*storage.Info, error)
+	// rehomeVia передаёт gateway сообщения вне диапазона задержек.
+	rehomeVia pipeline.RehomeSender
+
+	// indexMu защищает локальный индекс. Тела сообщений в памяти не хранятся:
+	// только ID и дайджесты из манифестов.
+	indexMu sync.Mutex
+	buckets map[int64]*bucketIndex
+	ids     map[string]int64
+	// storing — сообщения, сегменты которых записываются в S3. Резервирует их ID,
+	// пока запись идёт без indexMu.
+	storing map[string]*message.Message
+	// forwarded — момент передачи следующему слою сообщений, ещё не подтверждённых им.
+	// Не сохраняется: после перезапуска неподтверждённые сообщения передаются повторно.
+	forwarded map[string]time.Time
+
+	cfg   *S3StorageConfig
+	clock clock.Clock
+	ready bool
+}
+
+func NewS3Storage() *S3Storage {
+	return &S3Storage{}
+}
+
+func (s *S3Storage) Initialize(ctx context.Context, rawConfig any) error {
+	var err error
+
+	s.initOnce.Do(func() {
+		err = s.initialize(ctx, rawConfig)
+		if err != nil {
+			logger.Log.Error("failed to initialize storage", zap.Error(err))
+		}
+	})
+
+	return err
+}
+
+func (s *S3Storage) initialize(ctx context.Context, rawConfig any) error {
+	cfg, ok := rawConfig.(*S3StorageConfig)
+
+	if !ok {
+		return fmt.Errorf("expected *S3StorageConfig, got %T", rawConfig)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	objects, err := newObjectStore(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	busClient, err := pipeline.Connect(ctx, cfg.ClusterAddress)
+	if err != nil {
+		return err
+	}
+
+	coordinatorClient := coordinator.NewClient(coordinator.ClientConfig{
+		BaseURL: cfg.ClusterAddress,
+	})
+
+	if err := s.initState(ctx, cfg, objects, busClient, coordinatorClient.ListStorages); err != nil {
+		return err
+	}
+	s.rehomeVia = busClient
+
+	subscriptions, err := pipeline.Subscribe(busClient, cfg.ID, s, s.Acknowledge, cfg.NakDelay)
+	if err != nil {
+		return err
+	}
+
+	go s.runHandoffWorker(ctx)
+	meter := pipeline.NewLoadMeter(s, subscriptions, cfg.Clock)
+	go pipeline.RunHeartbeat(ctx, coordinatorClient, &cfg.BaseStorageConfig, pipeline.MeterReport(meter))
+
+	return nil
+}
+
+func newObjectStore(ctx context.Context, cfg *S3StorageConfig) (ObjectStore, error) {
+	if cfg.FSRoot != "" {
+		return NewFSObjectStore(cfg.FSRoot)
+	}
+	return NewMinioObjectStore(ctx, cfg.S3Endpoint, cfg.S3AccessKey, cfg.S3SecretKey, cfg.S3Bucket, cfg.S3UseSSL)
+}
+
+// initState восстанавливает локальный индекс по манифестам интервалов, не читая сегменты.
+func (s *S3Storage) initState(
+	ctx context.Context,
+	cfg *S3StorageConfig,
+	objects ObjectStore,
+	fwd forwarder,
+	listStorages func(ctx context.Context) ([]*storage.Info, error),
+) error {
+	s.cfg = cfg
+	s.clock = clock.OrSystem(cfg.Clock)
+	s.objects = objects
+	s.forwarder = fwd
+	s.listStorages = listStorages
+	s.buckets = make(map[int64]*bucketIndex)
+	s.ids = make(map[string]int64)
+	s.storing = make(map[string]*message.Message)
+	s.forwarded = make(map[string]time.Time)
+
+	keys, err := objects.List(ctx, s.manifestPrefix())
+	if err != nil {
+		return fmt.Errorf("failed to list manifests: %w", err)
+	}
+
+	for _, key := range keys {
+		bucket, ok := s.parseManifest(key)
+		if !ok {
+			continue
+		}
+
+		manifest, err := s.readManifest(ctx, key)
+		if err != nil {
+			return err
+		}
+		if len(manifest.Segments) == 0 {
+			continue
+		}
+
+		s.buckets[bucket] = &bucketIndex{segments: manifest.Segments, ids: manifest.IDs}
+		for id := range manifest.IDs {
+			s.ids[id] = bucket
+		}
+	}
+
+	s.ready = true
+	return nil
+}
+
+// runHandoffWorker периодически передаёт наступающие интервалы следующему слою
+// и объединяет сегменты интервалов.
+func (s *S3Storage) runHandoffWorker(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.HandoffInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.handoff(ctx, s.clock.Now()); err != nil {
+				logger.Log.Error("failed to hand off buckets", zap.Error(err))
+			}
+			if err := s.compact(ctx); err != nil {
+				logger.Log.Error("failed to compact buckets", zap.Error(err))
+			}
+		}
+	}
+}
+
+func (s *S3Storage) HealthCheck(_ context.Context) (storage.StorageHealth, error) {
+	if err := s.checkReady(); err != nil {
+		return storage.StorageHealthDisconnect, err
+	}
+	return storage.StorageHealthOK, nil
+}
+
+// Store записывает по одному сегменту в каждый затронутый интервал и добавляет его
+// в манифест интервала: сообщение с уже занятым ID и идентичным содержимым считается
+// дубликатом, с отличающимся — получает ErrAlreadyExists. Содержимое сравнивается
+// по дайджестам из манифеста. Ошибка записи сегмента или манифеста возвращается
+// в результатах его сообщений. Сегменты записываются без indexMu: ID резервируются
+// в storing, а индекс обновляется после записи манифеста.
+func (s *S3Storage) Store(ctx context.Context, msgs []*message.Message) ([]storage.StoreResult, error) {
+	if err := s.checkReady(); err != nil {
+		return nil, err
+	}
+
+	msgs = storage.WithIDs(msgs)
+	results := make([]storage.StoreResult, len(msgs))
+	byBucket := make(map[int64][]int)
+
+	s.indexMu.Lock()
+	for i, msg := range msgs {
+		results[i].ID = msg.ID
+
+		// Повтор ещё записываемого сообщения — дубликат: если запись не удастся,
+		// первый Store вернёт ошибку и сообщение будет доставлено повторно.
+		if reserved, ok := s.storing[msg.ID]; ok {
+			if reserved.Equal(msg) {
+				results[i].Duplicate = true
+			} else {
+				results[i].Err = fmt.Errorf("%w: %s", storage.ErrAlreadyExists, msg.ID)
+			}
+			continue
+		}
+		if bucket, ok := s.ids[msg.ID]; ok {
+			if s.buckets[bucket].ids[msg.ID] == messageDigest(msg) {
+				results[i].Duplicate = true
+			} else {
+				results[i].Err = fmt.Errorf("%w: %s", storage.ErrAlreadyExists, msg.ID)
+			}
+			continue
+		}
+
+		s.storing[msg.ID] = msg
+		bucket := s.bucketStart(msg.ScheduledAt)
+		byBucket[bucket] = append(byBucket[bucket], i)
+	}
+	s.indexMu.Unlock()
+
+	for bucket, idx := range byBucket {
+		segment := make([]*message.Message, len(idx))
+		for j, i := range idx {
+			segment[j] = msgs[i]
+		}
+
+		err := s.appendSegment(ctx, bucket, segment)
+
+		s.indexMu.Lock()
+		for _, msg := range segment {
+			delete(s.storing, msg.ID)
+		}
+		s.indexMu.Unlock()
+
+		if err != nil {
+			for _, i := range idx {
+				results[i].Err = err
+			}
+		}
+	}
+
+	return results, nil
+}
+
+// appendSegment записывает сообщения msgs новым сегментом интервала bucket и добавляет
+// его в манифест. Если манифест записать не удалось, сегмент удаляется.
+func (s *S3Storage) appendSegment(ctx context.Context, bucket int64, msgs []*message.Message) error {
+	key, err := s.writeSegment(ctx, bucket, msgs)
+	if err != nil {
+		return err
+	}
+
+	b := s.lockManifest(bucket)
+	defer b.manifestMu.Unlock()
+
+	_, err = s.updateManifest(ctx, bucket, b, func(m *bucketManifest) bool {
+		m.Segments = append(m.Segments, key)
+		for _, msg := range msgs {
+			m.IDs[msg.ID] = messageDigest(msg)
+		}
+		return true
+	})
+	if err != nil {
+		if delErr := s.objects.Delete(ctx, key); delErr != nil {
+			logger.Log.Warn("Failed to delete segment missing from manifest", zap.String("key", key), zap.Error(delErr))
+		}
+		return err
+	}
+
+	return nil
+}
+
+// handoff передаёт следующему слою интервалы, начинающиеся не позже now+LoadAhead.
+// Сообщения остаются в S3 до подтверждения через orbital.ack.{ID} (Acknowledge);
+// не подтверждённые за VisibilityTimeout передаются повторно.
+func (s *S3Storage) handoff(ctx context.Context, now time.Time) error {
+	if err := s.checkReady(); err != nil {
+		return err
+	}
+
+	limit := now.Add(s.cfg.LoadAhead).Unix()
+	due := s.snapshotBuckets(func(start int64, _ *bucketIndex) bool { return start <= limit })
+	if len(due) == 0 {
+		return nil
+	}
+
+	storages, err := s.listStorages(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list storages: %w", err)
+	}
+
+	for bucket, segments := range due {
+		msgs, err := s.readSegments(ctx, segments)
+		if err != nil {
+			return err
+		}
+
+		msgs = s.unforwarded(msgs, now)
+		if len(msgs) == 0 {
+			continue
+		}
+
+		forwarded, err := s.forward(msgs, storages, now)
+		if err != nil {
+			return err
+		}
+		if !forwarded {
+			continue
+		}
+
+		s.markForwarded(msgs, now)
+
+		logger.Log.Debug("Bucket handed off", zap.Int64("bucket", bucket), zap.Int("messages", len(msgs)))
+	}
+
+	return nil
+}
+
+// markForwarded отмечает сообщения msgs, ещё хранящиеся в S3, переданными в момент now.
+func (s *S3Storage) markForwarded(msgs []*message.Message, now time.Time) {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	for _, msg := range msgs {
+		if _, ok := s.ids[msg.ID]; ok {
+			s.forwarded[msg.ID] = now
+		}
+	}
+}
+
+// unforwarded возвращает сообщения msgs, которые ещё не передавались следующему слою
+// или не подтверждены им за VisibilityTimeout.
+func (s *S3Storage) unforwarded(msgs []*message.Message, now time.Time) []*message.Message {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	return slices.DeleteFunc(msgs, func(msg *message.Message) bool {
+		at, ok := s.forwarded[msg.ID]
+		return ok && now.Sub(at) < s.cfg.VisibilityTimeout
+	})
+}
+
+// forward продвигает каждое сообщение через orbital.promote.{ID} в хранилище,
+// принимающее его оставшуюся задержку, а наступившие сообщения отправляет в gateway.
+// Если для ещё не наступившего сообщения нет подходящего хранилища, интервал
+// остаётся в S3 до следующей попытки.
+func (s *S3Storage) forward(msgs []*message.Message, storages []*storage.Info, now time.Time) (bool, error) {
+	byTarget := make(map[string][]*message.Message)
+	var ready []*message.Message
+
+	for _, msg := range msgs {
+		delay := msg.ScheduledAt.Sub(now)
+		if delay <= 0 {
+			ready = append(ready, msg)
+			continue
+		}
+
+		target := ""
+		for _, info := range storages {
+			if info.ID != s.cfg.ID && info.AcceptsDelay(delay) {
+				target = info.ID
+				break
+			}
+		}
+		if target == "" {
+			logger.Log.Warn("No storage accepts message delay, keeping bucket", zap.String("id", msg.ID), zap.Duration("delay", delay))
+			return false, nil
+		}
+
+		byTarget[target] = append(byTarget[target], msg)
+	}
+
+	for target, batch := range byTarget {
+		if err := s.forwarder.Promote(s.cfg.ID, target, batch); err != nil {
+			return false, fmt.Errorf("failed to forward to %s: %w", target, err)
+		}
+	}
+
+	if len(ready) > 0 {
+		if err := s.forwarder.SendToGateway(s.cfg.ID, ready); err != nil {
+			return false, fmt.Errorf("failed to send ready messages: %w", err)
+		}
+	}
+
+	return true, nil
+}
+
+// compact объединяет сегменты интервалов, где их больше CompactSegments, в один сегмент.
+func (s *S3Storage) compact(ctx context.Context) error {
+	if err := s.checkReady(); err != nil {
+		return err
+	}
+
+	crowded := s.snapshotBuckets(func(_ int64, b *bucketIndex) bool { return len(b.segments) > s.cfg.CompactSegments })
+
+	for bucket := range crowded {
+		if err := s.compactBucket(ctx, bucket); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// compactBucket объединяет сегменты интервала bucket в один сегмент.
+func (s *S3Storage) compactBucket(ctx context.Context, bucket int64) error {
+	b := s.lockBucket(bucket)
+	if b == nil {
+		return nil
+	}
+	defer b.mu.Unlock()
+
+	segments := s.segmentsOf(b)
+	if len(segments) <= s.cfg.CompactSegments {
+		return nil
+	}
+
+	msgs, err := s.readSegments(ctx, segments)
+	if err != nil {
+		return err
+	}
+
+	key, err := s.writeSegment(ctx, bucket, msgs)
+	if err != nil {
+		return err
+	}
+
+	return s.replaceSegments(ctx, bucket, b, segments, key, nil)
+}
+
+// FetchExpiring возвращает до limit сообщений с ScheduledAt в пределах threshold,
+// читая сегменты подходящих интервалов.
+func (s *S3Storage) FetchExpiring(ctx context.Context, threshold time.Duration, limit int) ([]*storage.StoredMessage, error) {
+	if err := s.checkReady(); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	until := s.clock.Now().Add(threshold)
+	due := s.snapshotBuckets(func(start int64, _ *bucketIndex) bool { return start <= until.Unix() })
+
+	var expiring []*message.Message
+	for _, segments := range due {
+		msgs, err := s.readSegments(ctx, segments)
+		if err != nil {
+			return nil, err
+		}
+		for _, msg := range msgs {
+			if !msg.ScheduledAt.After(until) {
+				expiring = append(expiring, msg)
+			}
+		}
+	}
+
+	slices.SortFunc(expiring, func(a, b *message.Message) int {
+		if c := a.ScheduledAt.Compare(b.ScheduledAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	if len(expiring) > limit {
+		expiring = expiring[:limit]
+	}
+
+	result := make([]*storage.StoredMessage, len(expiring))
+	for i, msg := range expiring {
+		result[i] = &storage.StoredMessage{Message: msg, Status: storage.MessageStatusPending}
+	}
+
+	return result, nil
+}
+
+// FetchReady не поддерживается: холодный слой не выдаёт сообщения клиентам,
+// а передаёт их следующему слою до наступления.
+func (s *S3Storage) FetchReady(_ context.Context, _ int) ([]*storage.StoredMessage, error) {
+	return nil, fmt.Errorf("s3 fetch ready: %w", storage.ErrNotSupported)
+}
+
+// Reject не поддерживается: сообщения S3 никогда не бывают выданными.
+func (s *S3Storage) Reject(_ context.Context, _ string, _ bool) error {
+	return fmt.Errorf("s3 reject: %w", storage.ErrNotSupported)
+}
+
+// Acknowledge удаляет сообщения из S3, переписывая сегменты их интервалов. Вызывается
+// и по подтверждениям orbital.ack.{ID} от gateway или хранилища, принявшего переданные
+// сообщения. Неизвестные ID пропускаются.
+func (s *S3Storage) Acknowledge(ctx context.Context, ids []string) error {
+	if err := s.checkReady(); err != nil {
+		return err
+	}
+
+	byBucket := make(map[int64]map[string]struct{})
+
+	s.indexMu.Lock()
+	for _, id := range ids {
+		bucket, ok := s.ids[id]
+		if !ok {
+			continue
+		}
+		if byBucket[bucket] == nil {
+			byBucket[bucket] = make(map[string]struct{})
+		}
+		byBucket[bucket][id] = struct{}{}
+	}
+	s.indexMu.Unlock()
+
+	for bucket, drop := range byBucket {
+		if err := s.rewriteBucket(ctx, bucket, drop); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete удаляет сообщение из S3.
+func (s *S3Storage) Delete(ctx context.Context, id string) error {
+	if err := s.checkReady(); err != nil {
+		return err
+	}
+
+	s.indexMu.Lock()
+	bucket, ok := s.ids[id]
+	s.indexMu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("%w: %s", storage.ErrNotFound, id)
+	}
+
+	return s.rewriteBucket(ctx, bucket, map[string]struct{}{id: {}})
+}
+
+// Get возвращает сообщение; сообщения S3 всегда ожидают передачи.
+func (s *S3Storage) Get(ctx context.Context, id string) (*storage.StoredMessage, error) {
+	msg, err := s.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &storage.StoredMessage{Message: msg, Status: storage.MessageStatusPending}, nil
+}
+
+func (s *S3Storage) GetByID(ctx context.Context, id string) (*message.Message, error) {
+	if err := s.checkReady(); err != nil {
+		return nil, err
+	}
+
+	s.indexMu.Lock()
+	bucket, ok := s.ids[id]
+	var segments []string
+	if ok {
+		segments = append(segments, s.buckets[bucket].segments...)
+	}
+	s.indexMu.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", storage.ErrNotFound, id)
+	}
+
+	msgs, err := s.readSegments(ctx, segments)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, msg := range msgs {
+		if msg.ID == id {
+			return msg, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", storage.ErrNotFound, id)
+}
+
+func (s *S3Storage) Count(_ context.Context) (int64, error) {
+	if err := s.checkReady(); err != nil {
+		return 0, err
+	}
+
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	return int64(len(s.ids)), nil
+}
+
+// ProbeLoad реализует pipeline.LoadProber по локальному индексу, не читая сегменты.
+// Опоздание считается от конца самого раннего интервала, целиком наступившего, но ещё
+// не удалённого из S3, — нижняя граница опоздания его сообщений. В полёте — переданные
+// следующему слою и ещё не подтверждённые им сообщения.
+func (s *S3Storage) ProbeLoad(_ context.Context, now time.Time) (time.Time, int64, error) {
+	if err := s.checkReady(); err != nil {
+		return time.Time{}, 0, err
+	}
+
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	var earliestDue time.Time
+	for start := range s.buckets {
+		end := time.Unix(start, 0).Add(s.cfg.TimeBucket)
+		if !end.After(now) && (earliestDue.IsZero() || end.Before(earliestDue)) {
+			earliestDue = end
+		}
+	}
+
+	return earliestDue, int64(len(s.forwarded)), nil
+}
+
+// snapshotBuckets возвращает копии списков сегментов интервалов, удовлетворяющих match.
+func (s *S3Storage) snapshotBuckets(match func(start int64, b *bucketIndex) bool) map[int64][]string {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	result := make(map[int64][]string)
+	for start, b := range s.buckets {
+		if match(start, b) {
+			result[start] = append([]string(nil), b.segments...)
+		}
+	}
+
+	return result
+}
+
+// lockBucket захватывает mu интервала start и возвращает его индекс или nil, если
+// интервала нет. Интервал удаляется из индекса только под его mu, поэтому, пока mu
+// удерживается, индекс остаётся в s.buckets.
+func (s *S3Storage) lockBucket(start int64) *bucketIndex {
+	s.indexMu.Lock()
+	b, ok := s.buckets[start]
+	s.indexMu.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	b.mu.Lock()
+
+	s.indexMu.Lock()
+	current := s.buckets[start] == b
+	s.indexMu.Unlock()
+
+	if !current {
+		b.mu.Unlock()
+		return nil
+	}
+
+	return b
+}
+
+// segmentsOf возвращает копию списка сегментов интервала.
+func (s *S3Storage) segmentsOf(b *bucketIndex) []string {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	return append([]string(nil), b.segments...)
+}
+
+// replaceSegments заменяет в манифесте снимок segments интервала сегментом key (пустой
+// key — без замены), убирает из него сообщения dropped и удаляет сегменты снимка
+// из хранилища. Вызывающий удерживает b.mu. Если интервал изменился с момента снимка
+// не только дописанными сегментами, замена пропускается, а сегмент key удаляется:
+// иначе вернулись бы сообщения, удалённые после снимка.
+func (s *S3Storage) replaceSegments(ctx context.Context, bucket int64, b *bucketIndex, segments []string, key string, dropped []*message.Message) error {
+	b.manifestMu.Lock()
+	replaced, err := s.updateManifest(ctx, bucket, b, func(m *bucketManifest) bool {
+		if !slices.Equal(m.Segments[:min(len(segments), len(m.Segments))], segments) {
+			return false
+		}
+
+		appended := m.Segments[len(segments):]
+		m.Segments = make([]string, 0, len(appended)+1)
+		if key != "" {
+			m.Segments = append(m.Segments, key)
+		}
+		m.Segments = append(m.Segments, appended...)
+
+		for _, msg := range dropped {
+			delete(m.IDs, msg.ID)
+		}
+		return true
+	})
+	b.manifestMu.Unlock()
+
+	if err != nil || !replaced {
+		if !replaced && err == nil {
+			logger.Log.Warn("Bucket changed while rewriting segments, skipping", zap.Int64("bucket", bucket))
+		}
+		if key == "" {
+			return err
+		}
+		if delErr := s.objects.Delete(ctx, key); delErr != nil && err == nil {
+			err = delErr
+		}
+		return err
+	}
+
+	for _, segment := range segments {
+		if err := s.objects.Delete(ctx, segment); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *S3Storage) writeSegment(ctx context.Context, bucket int64, msgs []*message.Message) (string, error) {
+	data, err := json.Marshal(msgs)
+	if err != nil {
+		return "", fmt.Errorf("marshal segment: %w", err)
+	}
+
+	key := fmt.Sprintf("%s%d/%s.json", s.prefix(), bucket, uuid.NewString())
+	if err := s.objects.Put(ctx, key, data); err != nil {
+		return "", err
+	}
+
+	return key, nil
+}
+
+func (s *S3Storage) readSegment(ctx context.Context, key string) ([]*message.Message, error) {
+	data, err := s.objects.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	var msgs []*message.Message
+	if err := json.Unmarshal(data, &msgs); err != nil {
+		return nil, fmt.Errorf("unmarshal segment %s: %w", key, err)
+	}
+
+	return msgs, nil
+}
+
+// readSegments читает сегменты интервала и убирает повторы сообщений, которые
+// могли остаться после прерванной компактизации.
+func (s *S3Storage) readSegments(ctx context.Context, keys []string) ([]*message.Message, error) {
+	seen := make(map[string]struct{})
+	var result []*message.Message
+
+	for _, key := range keys {
+		msgs, err := s.readSegment(ctx, key)
+		if errors.Is(err, ErrObjectNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, msg := range msgs {
+			if _, ok := seen[msg.ID]; ok {
+				continue
+			}
+			seen[msg.ID] = struct{}{}
+			result = append(result, msg)
+		}
+	}
+
+	return result, nil
+}
+
+// rewriteBucket заменяет сегменты интервала одним сегментом без сообщений drop.
+// Сегменты, дописанные в интервал после снимка, остаются.
+func (s *S3Storage) rewriteBucket(ctx context.Context, bucket int64, drop map[string]struct{}) error {
+	b := s.lockBucket(bucket)
+	if b == nil {
+		return nil
+	}
+	defer b.mu.Unlock()
+
+	segments := s.segmentsOf(b)
+	msgs, err := s.readSegments(ctx, segments)
+	if err != nil {
+		return err
+	}
+
+	kept := make([]*message.Message, 0, len(msgs))
+	var dropped []*message.Message
+	for _, msg := range msgs {
+		if _, ok := drop[msg.ID]; ok {
+			dropped = append(dropped, msg)
+			continue
+		}
+		kept = append(kept, msg)
+	}
+
+	key := ""
+	if len(kept) > 0 {
+		if key, err = s.writeSegment(ctx, bucket, kept); err != nil {
+			return err
+		}
+	}
+
+	return s.replaceSegments(ctx, bucket, b, segments, key, dropped)
+}
+
+// bucket возвращает индекс интервала start, создавая его при необходимости.
+// Вызывающий удерживает indexMu.
+func (s *S3Storage) bucket(start int64) *bucketIndex {
+	b, ok := s.buckets[start]
+	if !ok {
+		b = &bucketIndex{}
+		s.buckets[start] = b
+	}
+	return b
+}
+
+// bucketStart возвращает начало интервала (unix-секунды), содержащего scheduledAt.
+func (s *S3Storage) bucketStart(scheduledAt time.Time) int64 {
+	return scheduledAt.Truncate(s.cfg.TimeBucket).Unix()
+}
+
+func (s *S3Storage) prefix() string {
+	return s.cfg.ID + "/"
+}
+
+func (s *S3Storage) checkReady() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if !s.ready {
+		return storage.ErrNotInitialized
+	}
+	return nil
+}
@@ -0,0 +1,614 @@
+package s3storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/clock"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+)
+
+// recordingForwarder запоминает сообщения, переданные следующему слою.
+type recordingForwarder struct {
+	mu       sync.Mutex
+	storages map[string][]*message.Message
+	gateway  []*message.Message
+}
+
+func (f *recordingForwarder) Promote(_, toStorageID string, msgs []*message.Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.storages[toStorageID] = append(f.storages[toStorageID], msgs...)
+	return nil
+}
+
+func (f *recordingForwarder) SendToGateway(_ string, msgs []*message.Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.gateway = append(f.gateway, msgs...)
+	return nil
+}
+
+// testTiers — хранилища кластера: само S3-хранилище и горячий слой до часа.
+var testTiers = []*storage.Info{
+	{ID: "cold", MinDelay: time.Hour},
+	{ID: "hot", MaxDelay: time.Hour},
+}
+
+func listTestTiers(context.Context) ([]*storage.Info, error) {
+	return testTiers, nil
+}
+
+func newTestConfig() *S3StorageConfig {
+	return NewBuilder().
+		WithID("cold").
+		WithTimeBucket(time.Minute).
+		WithLoadAhead(5 * time.Minute).
+		WithCompactSegments(2).
+		WithVisibilityTimeout(time.Minute).
+		Build()
+}
+
+// newTestStorage создаёт хранилище поверх objects без подключения к кластеру.
+func newTestStorage(t *testing.T, objects ObjectStore) (*S3Storage, *recordingForwarder) {
+	t.Helper()
+
+	fwd := &recordingForwarder{storages: make(map[string][]*message.Message)}
+	s := NewS3Storage()
+	if err := s.initState(context.Background(), newTestConfig(), objects, fwd, listTestTiers); err != nil {
+		t.Fatal(err)
+	}
+
+	return s, fwd
+}
+
+// segmentKeys возвращает ключи сегментов хранилища без манифестов.
+func segmentKeys(t *testing.T, s *S3Storage) []string {
+	t.Helper()
+
+	keys, err := s.objects.List(context.Background(), s.prefix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return slices.DeleteFunc(keys, func(key string) bool { return strings.HasPrefix(key, s.manifestPrefix()) })
+}
+
+func newFSStore(t *testing.T) ObjectStore {
+	t.Helper()
+
+	objects, err := NewFSObjectStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return objects
+}
+
+func TestStoreAndGet(t *testing.T) {
+	s, _ := newTestStorage(t, newFSStore(t))
+	ctx := context.Background()
+
+	msg := message.NewMessage(
+		message.WithID("a"),
+		message.WithRoutingKey("rk"),
+		message.WithPayload([]byte("payload")),
+		message.WithMetadataValue("k", "v"),
+		message.WithScheduledAt(time.Now().Add(2*time.Hour)),
+	)
+
+	results, err := s.Store(ctx, []*message.Message{msg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Err != nil || results[0].Duplicate {
+		t.Fatalf("unexpected result %+v", results[0])
+	}
+
+	got, err := s.GetByID(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(msg) {
+		t.Fatalf("stored message differs: %+v", got)
+	}
+
+	if _, err := s.GetByID(ctx, "missing"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	if n, _ := s.Count(ctx); n != 1 {
+		t.Fatalf("expected 1 message, got %d", n)
+	}
+}
+
+func TestStoreDuplicateAndConflict(t *testing.T) {
+	s, _ := newTestStorage(t, newFSStore(t))
+	ctx := context.Background()
+
+	msg := message.NewMessage(message.WithID("a"), message.WithPayload([]byte("v1")))
+	if _, err := s.Store(ctx, []*message.Message{msg}); err != nil {
+		t.Fatal(err)
+	}
+
+	conflict := *msg
+	conflict.Payload = []byte("v2")
+
+	results, err := s.Store(ctx, []*message.Message{msg, &conflict})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !results[0].Duplicate || results[0].Err != nil {
+		t.Fatalf("expected duplicate, got %+v", results[0])
+	}
+	if !errors.Is(results[1].Err, storage.ErrAlreadyExists) {
+		t.Fatalf("expected ErrAlreadyExists, got %+v", results[1])
+	}
+}
+
+// blockingStore задерживает запись сегментов, пока не закрыт release. Манифесты
+// записываются сразу.
+type blockingStore struct {
+	ObjectStore
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingStore) Put(ctx context.Context, key string, data []byte) error {
+	if strings.Contains(key, "/manifests/") {
+		return b.ObjectStore.Put(ctx, key, data)
+	}
+	b.started <- struct{}{}
+	<-b.release
+	return b.ObjectStore.Put(ctx, key, data)
+}
+
+func TestStoreUploadsWithoutIndexLock(t *testing.T) {
+	objects := &blockingStore{ObjectStore: newFSStore(t), started: make(chan struct{}), release: make(chan struct{})}
+	s, _ := newTestStorage(t, objects)
+	ctx := context.Background()
+
+	msg := message.NewMessage(message.WithID("a"), message.WithPayload([]byte("v1")))
+	done := make(chan []storage.StoreResult)
+	go func() {
+		results, err := s.Store(ctx, []*message.Message{msg})
+		if err != nil {
+			t.Error(err)
+		}
+		done <- results
+	}()
+	<-objects.started
+
+	// Пока сегмент записывается, индекс доступен, а повтор сообщения распознаётся.
+	if n, _ := s.Count(ctx); n != 0 {
+		t.Fatalf("expected message not to be indexed before upload, got %d", n)
+	}
+	conflict := *msg
+	conflict.Payload = []byte("v2")
+	results, err := s.Store(ctx, []*message.Message{msg, &conflict})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !results[0].Duplicate || !errors.Is(results[1].Err, storage.ErrAlreadyExists) {
+		t.Fatalf("unexpected results while uploading %+v", results)
+	}
+
+	close(objects.release)
+	if results := <-done; results[0].Err != nil || results[0].Duplicate {
+		t.Fatalf("unexpected store result %+v", results[0])
+	}
+	if n, _ := s.Count(ctx); n != 1 {
+		t.Fatalf("expected 1 message, got %d", n)
+	}
+}
+
+func TestIndexRebuiltOnRestart(t *testing.T) {
+	objects := newFSStore(t)
+	s, _ := newTestStorage(t, objects)
+	ctx := context.Background()
+
+	msgs := []*message.Message{
+		message.NewMessage(message.WithID("a"), message.WithScheduledAt(time.Now().Add(2*time.Hour))),
+		message.NewMessage(message.WithID("b"), message.WithScheduledAt(time.Now().Add(3*time.Hour))),
+	}
+	if _, err := s.Store(ctx, msgs); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted, _ := newTestStorage(t, objects)
+
+	if n, _ := restarted.Count(ctx); n != 2 {
+		t.Fatalf("expected 2 messages after restart, got %d", n)
+	}
+
+	results, err := restarted.Store(ctx, msgs[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !results[0].Duplicate {
+		t.Fatalf("expected duplicate after restart, got %+v", results[0])
+	}
+}
+
+func TestHandoffForwardsUpcomingBuckets(t *testing.T) {
+	s, fwd := newTestStorage(t, newFSStore(t))
+	ctx := context.Background()
+	now := time.Now()
+
+	msgs := []*message.Message{
+		message.NewMessage(message.WithID("due"), message.WithScheduledAt(now.Add(-time.Second))),
+		message.NewMessage(message.WithID("soon"), message.WithScheduledAt(now.Add(3*time.Minute))),
+		message.NewMessage(message.WithID("later"), message.WithScheduledAt(now.Add(2*time.Hour))),
+	}
+	if _, err := s.Store(ctx, msgs); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.handoff(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(fwd.gateway) != 1 || fwd.gateway[0].ID != "due" {
+		t.Fatalf("expected due message to go to gateway, got %v", fwd.gateway)
+	}
+	if hot := fwd.storages["hot"]; len(hot) != 1 || hot[0].ID != "soon" {
+		t.Fatalf("expected upcoming message to go to hot tier, got %v", hot)
+	}
+	if len(fwd.storages["cold"]) != 0 {
+		t.Fatal("storage must not forward messages to itself")
+	}
+
+	// До подтверждения сообщения остаются в S3 и повторно не передаются.
+	if n, _ := s.Count(ctx); n != 3 {
+		t.Fatalf("expected messages to stay until acknowledged, got %d", n)
+	}
+	if err := s.handoff(ctx, now.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if len(fwd.gateway) != 1 || len(fwd.storages["hot"]) != 1 {
+		t.Fatal("expected unacknowledged messages not to be forwarded again before visibility timeout")
+	}
+
+	if err := s.Acknowledge(ctx, []string{"due", "soon"}); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := s.Count(ctx); n != 1 {
+		t.Fatalf("expected only later message to remain, got %d", n)
+	}
+	if _, err := s.GetByID(ctx, "soon"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected acknowledged message to be removed, got %v", err)
+	}
+
+	keys := segmentKeys(t, s)
+	if len(keys) != 1 {
+		t.Fatalf("expected 1 remaining segment, got %d", len(keys))
+	}
+}
+
+func TestProbeLoad(t *testing.T) {
+	s, _ := newTestStorage(t, newFSStore(t))
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Minute)
+
+	msgs := []*message.Message{
+		message.NewMessage(message.WithID("stuck"), message.WithScheduledAt(now.Add(-90*time.Second))),
+		message.NewMessage(message.WithID("current"), message.WithScheduledAt(now.Add(10*time.Second))),
+	}
+	if _, err := s.Store(ctx, msgs); err != nil {
+		t.Fatal(err)
+	}
+
+	// Опоздание считается от конца интервала, целиком оставшегося в прошлом.
+	due, inFlight, err := s.ProbeLoad(ctx, now.Add(20*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !due.Equal(now.Add(-time.Minute)) || inFlight != 0 {
+		t.Fatalf("unexpected probe before handoff: %v, %d", due, inFlight)
+	}
+
+	if err := s.handoff(ctx, now.Add(20*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, inFlight, _ := s.ProbeLoad(ctx, now.Add(20*time.Second)); inFlight != 2 {
+		t.Fatalf("expected handed off messages to be in flight, got %d", inFlight)
+	}
+}
+
+func TestHandoffRedeliversUnacknowledged(t *testing.T) {
+	s, fwd := newTestStorage(t, newFSStore(t))
+	ctx := context.Background()
+	now := time.Now()
+
+	if _, err := s.Store(ctx, []*message.Message{
+		message.NewMessage(message.WithID("soon"), message.WithScheduledAt(now.Add(3*time.Minute))),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.handoff(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+	// Подтверждение потеряно: по истечении VisibilityTimeout сообщение передаётся снова.
+	if err := s.handoff(ctx, now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if hot := fwd.storages["hot"]; len(hot) != 2 {
+		t.Fatalf("expected message to be forwarded twice, got %d", len(hot))
+	}
+
+	// После перезапуска неподтверждённое сообщение тоже передаётся повторно.
+	restarted, fwd := newTestStorage(t, s.objects)
+	if err := restarted.handoff(ctx, now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if len(fwd.storages["hot"]) != 1 {
+		t.Fatal("expected message to be forwarded after restart")
+	}
+}
+
+// recordingRehome запоминает сообщения, переданные gateway.
+type recordingRehome struct {
+	ids      []string
+	evacuate bool
+}
+
+func (r *recordingRehome) Rehome(_ string, msgs []*message.Message) error {
+	for _, msg := range msgs {
+		r.ids = append(r.ids, msg.ID)
+	}
+	return nil
+}
+
+func (r *recordingRehome) Evacuate(storageID string, msgs []*message.Message) error {
+	r.evacuate = true
+	return r.Rehome(storageID, msgs)
+}
+
+func TestRehome(t *testing.T) {
+	s, _ := newTestStorage(t, newFSStore(t))
+	sent := &recordingRehome{}
+	s.rehomeVia = sent
+	ctx := context.Background()
+	now := time.Now()
+	s.clock = clock.NewFake(now)
+
+	msgs := []*message.Message{
+		message.NewMessage(message.WithID("forwarded"), message.WithScheduledAt(now.Add(3*time.Minute))),
+		message.NewMessage(message.WithID("too-soon"), message.WithScheduledAt(now.Add(30*time.Minute))),
+		message.NewMessage(message.WithID("fits"), message.WithScheduledAt(now.Add(2*time.Hour))),
+	}
+	if _, err := s.Store(ctx, msgs); err != nil {
+		t.Fatal(err)
+	}
+	// Сообщения, переданные следующему слою, не передаются gateway.
+	if err := s.handoff(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+
+	query := storage.RehomeQuery{MinDelay: time.Hour}
+	result, err := s.Rehome(ctx, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Resubmitted != 1 || sent.evacuate || !slices.Equal(sent.ids, []string{"too-soon"}) {
+		t.Fatalf("unexpected rehome %+v: %v", result, sent.ids)
+	}
+
+	// До подтверждения gateway сообщение остаётся в S3 и повторно не передаётся.
+	if _, err := s.GetByID(ctx, "too-soon"); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := s.Rehome(ctx, query); err != nil || result.Resubmitted != 0 {
+		t.Fatalf("expected rehomed message not to be sent again, got %+v, %v", result, err)
+	}
+}
+
+func TestHandoffKeepsBucketWithoutTarget(t *testing.T) {
+	s, fwd := newTestStorage(t, newFSStore(t))
+	s.listStorages = func(context.Context) ([]*storage.Info, error) { return testTiers[:1], nil }
+	ctx := context.Background()
+	now := time.Now()
+
+	if _, err := s.Store(ctx, []*message.Message{
+		message.NewMessage(message.WithID("soon"), message.WithScheduledAt(now.Add(3*time.Minute))),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.handoff(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(fwd.storages) != 0 || len(fwd.gateway) != 0 {
+		t.Fatal("expected bucket to stay in storage")
+	}
+	if n, _ := s.Count(ctx); n != 1 {
+		t.Fatalf("expected message to remain, got %d", n)
+	}
+}
+
+func TestCompactMergesSegments(t *testing.T) {
+	s, _ := newTestStorage(t, newFSStore(t))
+	ctx := context.Background()
+	at := time.Now().Add(2 * time.Hour).Truncate(time.Minute)
+
+	for _, id := range []string{"a", "b", "c"} {
+		msg := message.NewMessage(message.WithID(id), message.WithScheduledAt(at))
+		if _, err := s.Store(ctx, []*message.Message{msg}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.compact(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := segmentKeys(t, s)
+	if len(keys) != 1 {
+		t.Fatalf("expected 1 segment after compaction, got %d", len(keys))
+	}
+
+	for _, id := range []string{"a", "b", "c"} {
+		if _, err := s.GetByID(ctx, id); err != nil {
+			t.Fatalf("message %s lost after compaction: %v", id, err)
+		}
+	}
+}
+
+func TestCompactSerializesWithAcknowledge(t *testing.T) {
+	fs := newFSStore(t)
+	seed, _ := newTestStorage(t, fs)
+	ctx := context.Background()
+	at := time.Now().Add(2 * time.Hour).Truncate(time.Minute)
+
+	for _, id := range []string{"a", "b", "c"} {
+		msg := message.NewMessage(message.WithID(id), message.WithScheduledAt(at))
+		if _, err := seed.Store(ctx, []*message.Message{msg}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	objects := &blockingStore{ObjectStore: fs, started: make(chan struct{}), release: make(chan struct{})}
+	s, _ := newTestStorage(t, objects)
+
+	compacted := make(chan error)
+	go func() { compacted <- s.compact(ctx) }()
+	<-objects.started
+	go func() {
+		for range objects.started {
+		}
+	}()
+
+	// Подтверждение приходит, пока объединённый сегмент записывается.
+	acked := make(chan error)
+	go func() { acked <- s.Acknowledge(ctx, []string{"a"}) }()
+	// Без блокировки интервала подтверждение успело бы прочитать сегменты до компактизации.
+	time.Sleep(50 * time.Millisecond)
+
+	close(objects.release)
+	if err := <-compacted; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-acked; err != nil {
+		t.Fatal(err)
+	}
+	close(objects.started)
+
+	for _, st := range []*S3Storage{s, func() *S3Storage { restarted, _ := newTestStorage(t, fs); return restarted }()} {
+		if _, err := st.GetByID(ctx, "a"); !errors.Is(err, storage.ErrNotFound) {
+			t.Fatalf("expected acknowledged message to stay deleted, got %v", err)
+		}
+		if n, _ := st.Count(ctx); n != 2 {
+			t.Fatalf("expected 2 messages, got %d", n)
+		}
+	}
+}
+
+func TestLifecycle(t *testing.T) {
+	s, _ := newTestStorage(t, newFSStore(t))
+	ctx := context.Background()
+	at := time.Now().Add(2 * time.Hour).Truncate(time.Minute)
+
+	for _, id := range []string{"a", "b", "c"} {
+		msg := message.NewMessage(message.WithID(id), message.WithScheduledAt(at))
+		if _, err := s.Store(ctx, []*message.Message{msg}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expiring, err := s.FetchExpiring(ctx, 3*time.Hour, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expiring) != 2 || expiring[0].ID != "a" || expiring[1].ID != "b" {
+		t.Fatalf("unexpected expiring messages %+v", expiring)
+	}
+
+	if none, _ := s.FetchExpiring(ctx, time.Hour, 10); len(none) != 0 {
+		t.Fatalf("expected no expiring messages, got %d", len(none))
+	}
+
+	if err := s.Delete(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Acknowledge(ctx, []string{"b", "missing"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Get(ctx, "a"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	stored, err := s.Get(ctx, "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != storage.MessageStatusPending {
+		t.Fatalf("expected pending status, got %s", stored.Status)
+	}
+
+	keys := segmentKeys(t, s)
+	if len(keys) != 1 {
+		t.Fatalf("expected 1 segment after deletes, got %d", len(keys))
+	}
+
+	if _, err := s.FetchReady(ctx, 10); !errors.Is(err, storage.ErrNotSupported) {
+		t.Fatalf("expected ErrNotSupported, got %v", err)
+	}
+	if err := s.Reject(ctx, "c", true); !errors.Is(err, storage.ErrNotSupported) {
+		t.Fatalf("expected ErrNotSupported, got %v", err)
+	}
+}
+
+// TestMinioObjectStore проверяет реализацию поверх настоящего S3-совместимого
+// хранилища. Без ORBITAL_TEST_S3_ENDPOINT тест пропускается.
+func TestMinioObjectStore(t *testing.T) {
+	endpoint := os.Getenv("ORBITAL_TEST_S3_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("ORBITAL_TEST_S3_ENDPOINT is not set")
+	}
+
+	ctx := context.Background()
+
+	objects, err := NewMinioObjectStore(
+		ctx,
+		endpoint,
+		os.Getenv("ORBITAL_TEST_S3_ACCESS_KEY"),
+		os.Getenv("ORBITAL_TEST_S3_SECRET_KEY"),
+		"orbital-test",
+		false,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, fwd := newTestStorage(t, objects)
+	s.cfg.ID = "test-" + time.Now().Format("150405.000000000")
+
+	now := time.Now()
+	if _, err := s.Store(ctx, []*message.Message{
+		message.NewMessage(message.WithID("due"), message.WithScheduledAt(now.Add(-time.Second))),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.GetByID(ctx, "due"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.handoff(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+	if len(fwd.gateway) != 1 {
+		t.Fatalf("expected message to go to gateway, got %d", len(fwd.gateway))
+	}
+
+	if _, err := objects.Get(ctx, "missing"); !errors.Is(err, ErrObjectNotFound) {
+		t.Fatalf("expected ErrObjectNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,484 @@
+// Package storagetest — общий набор проверок реализаций storage.MessageStorage.
+//
+// Реализация подключает его из своего теста:
+//
+//	func TestConformance(t *testing.T) {
+//		storagetest.Run(t, func(t *testing.T, clk clock.Clock) *storagetest.Instance {
+//			...
+//		})
+//	}
+//
+// Хранилища планируют по переданным часам, поэтому проверки не ждут реального времени.
+// Проверки FetchReady и Reject пропускаются, если реализация возвращает ErrNotSupported,
+// проверка LoadProbe — если реализация не реализует pipeline.LoadProber.
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/internal/storages/pipeline"
+	"github.com/Alexey-zaliznuak/orbital/pkg/clock"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+)
+
+// VisibilityTimeout — VisibilityTimeout, с которым Factory должна настраивать хранилище.
+const VisibilityTimeout = time.Minute
+
+// Instance — хранилище под проверкой.
+type Instance struct {
+	Storage storage.MessageStorage
+
+	// Reopen имитирует падение процесса: бросает Storage без корректной остановки
+	// (без финального снимка и т. п.) и открывает новое хранилище поверх того же
+	// состояния и тех же часов. nil — проверки перезапуска пропускаются.
+	Reopen func(t *testing.T) storage.MessageStorage
+}
+
+// Factory создаёт пустое инициализированное хранилище, планирующее по часам clk,
+// с VisibilityTimeout, равным storagetest.VisibilityTimeout.
+type Factory func(t *testing.T, clk clock.Clock) *Instance
+
+// Run запускает все проверки для хранилищ, создаваемых factory.
+func Run(t *testing.T, factory Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, env *env)
+	}{
+		{"ExpiringOrder", testExpiringOrder},
+		{"ReadyOrder", testReadyOrder},
+		{"ExactlyOnceUnderConcurrency", testExactlyOnce},
+		{"Redelivery", testRedelivery},
+		{"Duplicates", testDuplicates},
+		{"GeneratedID", testGeneratedID},
+		{"Delete", testDelete},
+		{"Reject", testReject},
+		{"Reopen", testReopen},
+		{"LoadProbe", testLoadProbe},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Миллисекунды — общая точность всех реализаций.
+			clk := clock.NewFake(time.Now().Truncate(time.Millisecond))
+			inst := factory(t, clk)
+			tt.fn(t, &env{Instance: inst, clk: clk, ctx: context.Background()})
+		})
+	}
+}
+
+type env struct {
+	*Instance
+	clk *clock.Fake
+	ctx context.Context
+}
+
+// at возвращает сообщение id, наступающее через d от текущего времени часов.
+func (e *env) at(id string, d time.Duration) *message.Message {
+	return message.NewMessage(
+		message.WithID(id),
+		message.WithRoutingKey("rk"),
+		message.WithPayload([]byte("payload-"+id)),
+		message.WithCreatedAt(e.clk.Now()),
+		message.WithScheduledAt(e.clk.Now().Add(d)),
+	)
+}
+
+func (e *env) store(t *testing.T, msgs ...*message.Message) {
+	t.Helper()
+
+	results, err := e.Storage.Store(e.ctx, msgs)
+	if err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+	for i, r := range results {
+		if r.Err != nil {
+			t.Fatalf("Store %s: %v", msgs[i].ID, r.Err)
+		}
+	}
+}
+
+// fetchReady вызывает FetchReady и пропускает тест, если реализация его не поддерживает.
+func (e *env) fetchReady(t *testing.T, limit int) []*storage.StoredMessage {
+	t.Helper()
+
+	msgs, err := e.Storage.FetchReady(e.ctx, limit)
+	if errors.Is(err, storage.ErrNotSupported) {
+		t.Skip("FetchReady is not supported")
+	}
+	if err != nil {
+		t.Fatalf("FetchReady: %v", err)
+	}
+	return msgs
+}
+
+func (e *env) expectStatus(t *testing.T, id string, status storage.MessageStatus) *storage.StoredMessage {
+	t.Helper()
+
+	stored, err := e.Storage.Get(e.ctx, id)
+	if err != nil {
+		t.Fatalf("Get %s: %v", id, err)
+	}
+	if stored.Status != status {
+		t.Fatalf("expected %s to be %s, got %s", id, status, stored.Status)
+	}
+	return stored
+}
+
+func ids(msgs []*storage.StoredMessage) []string {
+	result := make([]string, len(msgs))
+	for i, m := range msgs {
+		result[i] = m.ID
+	}
+	return result
+}
+
+func expectIDs(t *testing.T, msgs []*storage.StoredMessage, want ...string) {
+	t.Helper()
+
+	if got := ids(msgs); !slices.Equal(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func testExpiringOrder(t *testing.T, e *env) {
+	msgs := []*message.Message{
+		e.at("c", 3*time.Second),
+		e.at("a", time.Second),
+		e.at("late", time.Hour),
+		e.at("b", 2*time.Second),
+	}
+	e.store(t, msgs...)
+
+	expiring, err := e.Storage.FetchExpiring(e.ctx, 10*time.Second, 10)
+	if err != nil {
+		t.Fatalf("FetchExpiring: %v", err)
+	}
+	expectIDs(t, expiring, "a", "b", "c")
+	for _, m := range expiring {
+		if m.Status != storage.MessageStatusPending {
+			t.Fatalf("expected pending %s, got %s", m.ID, m.Status)
+		}
+	}
+
+	limited, err := e.Storage.FetchExpiring(e.ctx, 10*time.Second, 2)
+	if err != nil {
+		t.Fatalf("FetchExpiring: %v", err)
+	}
+	expectIDs(t, limited, "a", "b")
+}
+
+func testReadyOrder(t *testing.T, e *env) {
+	e.store(t,
+		e.at("m3", 3*time.Second),
+		e.at("m1", time.Second),
+		e.at("m5", 5*time.Second),
+		e.at("m2", 2*time.Second),
+		e.at("m4", 4*time.Second),
+	)
+
+	expectIDs(t, e.fetchReady(t, 10))
+
+	e.clk.Advance(3 * time.Second)
+	first := e.fetchReady(t, 2)
+	expectIDs(t, first, "m1", "m2")
+	for _, m := range first {
+		if m.Status != storage.MessageStatusInFlight || m.Attempts != 1 || !m.LastAttemptAt.Equal(e.clk.Now()) {
+			t.Fatalf("unexpected state of %s: status=%s attempts=%d last=%v", m.ID, m.Status, m.Attempts, m.LastAttemptAt)
+		}
+	}
+	expectIDs(t, e.fetchReady(t, 10), "m3")
+
+	e.clk.Advance(10 * time.Second)
+	expectIDs(t, e.fetchReady(t, 10), "m4", "m5")
+}
+
+func testExactlyOnce(t *testing.T, e *env) {
+	const (
+		total   = 200
+		workers = 8
+	)
+
+	msgs := make([]*message.Message, total)
+	for i := range msgs {
+		msgs[i] = e.at(fmt.Sprintf("m-%03d", i), time.Duration(rand.IntN(1000))*time.Millisecond)
+	}
+	e.store(t, msgs...)
+	e.clk.Advance(time.Second)
+
+	var (
+		mu        sync.Mutex
+		delivered = make(map[string]int)
+		wg        sync.WaitGroup
+		errs      = make(chan error, workers)
+	)
+
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				batch, err := e.Storage.FetchReady(e.ctx, 7)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if len(batch) == 0 {
+					return
+				}
+
+				mu.Lock()
+				for _, m := range batch {
+					delivered[m.ID]++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if errors.Is(err, storage.ErrNotSupported) {
+			t.Skip("FetchReady is not supported")
+		}
+		t.Fatalf("FetchReady: %v", err)
+	}
+
+	if len(delivered) != total {
+		t.Fatalf("expected %d delivered messages, got %d", total, len(delivered))
+	}
+	for id, n := range delivered {
+		if n != 1 {
+			t.Fatalf("message %s delivered %d times", id, n)
+		}
+	}
+}
+
+func testRedelivery(t *testing.T, e *env) {
+	e.store(t, e.at("acked", 0), e.at("lost", 0))
+
+	expectIDs(t, e.fetchReady(t, 10), "acked", "lost")
+	if err := e.Storage.Acknowledge(e.ctx, []string{"acked", "missing"}); err != nil {
+		t.Fatalf("Acknowledge: %v", err)
+	}
+
+	e.clk.Advance(VisibilityTimeout - time.Second)
+	expectIDs(t, e.fetchReady(t, 10))
+
+	e.clk.Advance(2 * time.Second)
+	redelivered := e.fetchReady(t, 10)
+	expectIDs(t, redelivered, "lost")
+	if redelivered[0].Attempts != 2 {
+		t.Fatalf("expected 2 attempts, got %d", redelivered[0].Attempts)
+	}
+
+	if _, err := e.Storage.Get(e.ctx, "acked"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for acknowledged message, got %v", err)
+	}
+}
+
+func testDuplicates(t *testing.T, e *env) {
+	msg := e.at("a", time.Minute)
+	e.store(t, msg)
+
+	again := *msg
+	results, err := e.Storage.Store(e.ctx, []*message.Message{&again})
+	if err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+	if results[0].Err != nil || !results[0].Duplicate {
+		t.Fatalf("expected duplicate result, got %+v", results[0])
+	}
+
+	conflict := *msg
+	conflict.Payload = []byte("other")
+	results, err = e.Storage.Store(e.ctx, []*message.Message{&conflict})
+	if err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+	if !errors.Is(results[0].Err, storage.ErrAlreadyExists) {
+		t.Fatalf("expected ErrAlreadyExists, got %v", results[0].Err)
+	}
+
+	stored := e.expectStatus(t, "a", storage.MessageStatusPending)
+	if !stored.Message.Equal(msg) {
+		t.Fatalf("stored message was overwritten: %+v", stored.Message)
+	}
+	if n, err := e.Storage.Count(e.ctx); err != nil || n != 1 {
+		t.Fatalf("expected 1 message, got %d (%v)", n, err)
+	}
+}
+
+func testGeneratedID(t *testing.T, e *env) {
+	msg := e.at("", time.Minute)
+	batch := []*message.Message{msg}
+
+	results, err := e.Storage.Store(e.ctx, batch)
+	if err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+	if results[0].Err != nil || results[0].ID == "" {
+		t.Fatalf("expected generated ID, got %+v", results[0])
+	}
+	// Пачка и сообщения вызывающего не меняются.
+	if batch[0] != msg || msg.ID != "" {
+		t.Fatalf("Store modified caller batch: %+v", batch[0])
+	}
+
+	stored := e.expectStatus(t, results[0].ID, storage.MessageStatusPending)
+	if stored.ID != results[0].ID || !slices.Equal(stored.Payload, msg.Payload) {
+		t.Fatalf("unexpected stored message %+v", stored.Message)
+	}
+}
+
+func testDelete(t *testing.T, e *env) {
+	e.store(t, e.at("a", time.Second), e.at("b", time.Second))
+
+	if err := e.Storage.Delete(e.ctx, "a"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := e.Storage.Delete(e.ctx, "a"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound on second Delete, got %v", err)
+	}
+	if _, err := e.Storage.Get(e.ctx, "a"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	expiring, err := e.Storage.FetchExpiring(e.ctx, time.Minute, 10)
+	if err != nil {
+		t.Fatalf("FetchExpiring: %v", err)
+	}
+	expectIDs(t, expiring, "b")
+
+	e.clk.Advance(time.Minute)
+	expectIDs(t, e.fetchReady(t, 10), "b")
+}
+
+func testReject(t *testing.T, e *env) {
+	e.store(t, e.at("a", 0), e.at("b", 0))
+
+	err := e.Storage.Reject(e.ctx, "a", true)
+	if errors.Is(err, storage.ErrNotSupported) {
+		t.Skip("Reject is not supported")
+	}
+	if !errors.Is(err, storage.ErrNotInFlight) {
+		t.Fatalf("expected ErrNotInFlight for pending message, got %v", err)
+	}
+	if err := e.Storage.Reject(e.ctx, "missing", false); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	expectIDs(t, e.fetchReady(t, 10), "a", "b")
+
+	if err := e.Storage.Reject(e.ctx, "a", true); err != nil {
+		t.Fatalf("Reject requeue: %v", err)
+	}
+	e.expectStatus(t, "a", storage.MessageStatusPending)
+
+	if err := e.Storage.Reject(e.ctx, "b", false); err != nil {
+		t.Fatalf("Reject: %v", err)
+	}
+	e.expectStatus(t, "b", storage.MessageStatusFailed)
+
+	requeued := e.fetchReady(t, 10)
+	expectIDs(t, requeued, "a")
+	if requeued[0].Attempts != 2 {
+		t.Fatalf("expected 2 attempts, got %d", requeued[0].Attempts)
+	}
+
+	e.clk.Advance(2 * VisibilityTimeout)
+	expectIDs(t, e.fetchReady(t, 10), "a")
+	e.expectStatus(t, "b", storage.MessageStatusFailed)
+
+	if err := e.Storage.Delete(e.ctx, "b"); err != nil {
+		t.Fatalf("Delete failed message: %v", err)
+	}
+}
+
+func testReopen(t *testing.T, e *env) {
+	if e.Reopen == nil {
+		t.Skip("storage has no persistent state")
+	}
+
+	e.store(t, e.at("pending", time.Hour), e.at("inflight", 0), e.at("failed", 0), e.at("acked", 0))
+
+	_, fetchErr := e.Storage.FetchReady(e.ctx, 10)
+	supportsFetch := !errors.Is(fetchErr, storage.ErrNotSupported)
+	if fetchErr != nil && supportsFetch {
+		t.Fatalf("FetchReady: %v", fetchErr)
+	}
+	if supportsFetch {
+		if err := e.Storage.Reject(e.ctx, "failed", false); err != nil {
+			t.Fatalf("Reject: %v", err)
+		}
+	}
+	if err := e.Storage.Acknowledge(e.ctx, []string{"acked"}); err != nil {
+		t.Fatalf("Acknowledge: %v", err)
+	}
+
+	e.Storage = e.Reopen(t)
+
+	if _, err := e.Storage.Get(e.ctx, "acked"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("acknowledged message restored: %v", err)
+	}
+	e.expectStatus(t, "pending", storage.MessageStatusPending)
+
+	if !supportsFetch {
+		if _, err := e.Storage.Get(e.ctx, "inflight"); err != nil {
+			t.Fatalf("Get inflight: %v", err)
+		}
+		return
+	}
+
+	e.expectStatus(t, "failed", storage.MessageStatusFailed)
+
+	// Выданное до падения и не подтверждённое сообщение выдаётся повторно
+	// не позже VisibilityTimeout.
+	e.clk.Advance(VisibilityTimeout + time.Second)
+	expectIDs(t, e.fetchReady(t, 10), "inflight")
+	if err := e.Storage.Acknowledge(e.ctx, []string{"inflight"}); err != nil {
+		t.Fatalf("Acknowledge: %v", err)
+	}
+
+	e.clk.Advance(time.Hour)
+	expectIDs(t, e.fetchReady(t, 10), "pending")
+}
+
+func testLoadProbe(t *testing.T, e *env) {
+	prober, ok := e.Storage.(pipeline.LoadProber)
+	if !ok {
+		t.Skip("storage does not implement LoadProber")
+	}
+	// Хранилища без FetchReady выпускают сообщения по-своему и по-своему считают опоздание.
+	expectIDs(t, e.fetchReady(t, 1))
+
+	probe := func(wantDue time.Time, wantInFlight int64) {
+		t.Helper()
+
+		due, inFlight, err := prober.ProbeLoad(e.ctx, e.clk.Now())
+		if err != nil {
+			t.Fatalf("ProbeLoad: %v", err)
+		}
+		if !due.Equal(wantDue) || inFlight != wantInFlight {
+			t.Fatalf("expected due %v and %d in flight, got %v and %d", wantDue, wantInFlight, due, inFlight)
+		}
+	}
+
+	first := e.at("first", time.Second)
+	e.store(t, first, e.at("second", 2*time.Second), e.at("late", time.Hour))
+	probe(time.Time{}, 0)
+
+	e.clk.Advance(3 * time.Second)
+	probe(first.ScheduledAt, 0)
+
+	expectIDs(t, e.fetchReady(t, 1), "first")
+	probe(first.ScheduledAt.Add(time.Second), 1)
+}
@@ -4,9 +4,14 @@ package bus
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
+	"unicode"
 
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/coordinator"
 	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
 	natsclient "github.com/Alexey-zaliznuak/orbital/pkg/nats"
 	"github.com/nats-io/nats.go"
 )
@@ -14,10 +19,66 @@ import (
 // Subject-константы — единственное место определения топологии NATS subjects.
 const (
 	subjectStoragePrefix = "orbital.storage."
+	subjectPromotePrefix = "orbital.promote."
 	subjectPusherPrefix  = "orbital.push."
 	subjectGateway       = "orbital.gateway"
+	subjectDeadLetter    = "orbital.dlq."
+
+	// Подтверждения обработки сообщений, выпущенных хранилищем. Идут через core NATS:
+	// потерянное подтверждение приводит к повторной отправке после visibility timeout.
+	subjectAckPrefix = "orbital.ack."
+
+	// Subjects доставки push-consumer'ов. Не входят ни в один stream.
+	subjectDeliverStoragePrefix = "orbital.deliver.storage."
+	subjectDeliverPromotePrefix = "orbital.deliver.promote."
+	subjectDeliverGateway       = "orbital.deliver.gateway"
+)
+
+// Durable consumer (и queue group) всех инстансов gateway.
+const consumerGateway = "gateway"
+
+// HeaderStorageID — заголовок с ID хранилища, выпустившего сообщения в orbital.gateway
+// или orbital.promote.{ID}.
+const HeaderStorageID = "Orbital-Storage-Id"
+
+// HeaderRehome — заголовок пачки orbital.gateway, которую хранилище передаёт для
+// повторного выбора хранилища, а не для отправки в пушеры.
+const HeaderRehome = "Orbital-Rehome"
+
+// HeaderEvacuate — заголовок пачки HeaderRehome от инстанса, который покидает кластер
+// вместе со своими данными: gateway может выбрать для её сообщений и исходное
+// хранилище, чтобы их забрали другие его инстансы.
+const HeaderEvacuate = "Orbital-Evacuate"
+
+// Streams JetStream, покрывающие subjects выше.
+const (
+	streamStorage = "ORBITAL_STORAGE"
+	streamPromote = "ORBITAL_PROMOTE"
+	streamGateway = "ORBITAL_GATEWAY"
+	streamPusher  = "ORBITAL_PUSH"
+	streamDLQ     = "ORBITAL_DLQ"
 )
 
+// ErrInvalidStorageID возвращается для ID хранилища, который нельзя использовать
+// как токен subject и имя durable consumer.
+var ErrInvalidStorageID = errors.New("invalid storage ID")
+
+// ValidateStorageID проверяет, что storageID — один токен subject и допустимое имя
+// consumer JetStream: непустой, без '.', '*', '>', разделителей пути, пробельных
+// и непечатаемых символов. Иначе orbital.storage.{ID} совпал бы с subjects других
+// хранилищ или consumer не удалось бы создать.
+func ValidateStorageID(storageID string) error {
+	if storageID == "" {
+		return fmt.Errorf("%w: empty", ErrInvalidStorageID)
+	}
+	for _, r := range storageID {
+		if strings.ContainsRune(".*>/\\", r) || unicode.IsSpace(r) || !unicode.IsPrint(r) {
+			return fmt.Errorf("%w: %q contains %q", ErrInvalidStorageID, storageID, r)
+		}
+	}
+	return nil
+}
+
 // Client шина сообщений на базе NATS.
 type Client struct {
 	nats *natsclient.Client
@@ -28,14 +89,71 @@ func New(nats *natsclient.Client) *Client {
 	return &Client{nats: nats}
 }
 
+// Provision создаёт streams для всех subjects Orbital с параметрами из конфигурации кластера.
+// Идемпотентен: каждый компонент вызывает его при старте.
+func (c *Client) Provision(cfg *coordinator.ClusterConfig) error {
+	return c.nats.EnsureStreams(
+		natsclient.StreamsConfig{
+			Retention: cfg.StreamRetention,
+			Replicas:  cfg.StreamReplicas,
+			MaxAge:    cfg.StreamMaxAge,
+			MaxBytes:  cfg.StreamMaxBytes,
+		},
+		natsclient.Stream{Name: streamStorage, Subjects: []string{subjectStoragePrefix + ">"}},
+		natsclient.Stream{Name: streamPromote, Subjects: []string{subjectPromotePrefix + ">"}},
+		natsclient.Stream{Name: streamGateway, Subjects: []string{subjectGateway}},
+		natsclient.Stream{Name: streamPusher, Subjects: []string{subjectPusherPrefix + ">"}},
+		natsclient.Stream{Name: streamDLQ, Subjects: []string{subjectDeadLetter + ">"}},
+	)
+}
+
 // SendToStorage публикует сообщение в NATS subject orbital.storage.{storageID}.
+// Сообщения без ID публикуются с назначенным ID: повторные доставки пачки из JetStream
+// несут те же ID, и хранилище распознаёт уже сохранённые сообщения как дубликаты.
 func (c *Client) SendToStorage(storageID string, msgs []*message.Message) error {
-	return c.publish(subjectStoragePrefix+storageID, msgs)
+	return c.publish(subjectStoragePrefix+storageID, storage.WithIDs(msgs))
+}
+
+// Promote публикует сообщения хранилища fromStorageID в NATS subject orbital.promote.{toStorageID}.
+// Принимающее хранилище подтверждает их сохранение через AckToStorage.
+func (c *Client) Promote(fromStorageID, toStorageID string, msgs []*message.Message) error {
+	return c.publishFrom(subjectPromotePrefix+toStorageID, fromStorageID, msgs)
+}
+
+// SendToGateway публикует сообщения хранилища storageID в NATS subject orbital.gateway.
+// Gateway подтверждает их обработку через AckToStorage.
+func (c *Client) SendToGateway(storageID string, msgs []*message.Message) error {
+	return c.publishFrom(subjectGateway, storageID, msgs)
+}
+
+// Rehome публикует ожидающие сообщения хранилища storageID в orbital.gateway для повторного
+// выбора хранилища. Gateway подтверждает через AckToStorage сообщения, переданные
+// в другое хранилище или в пушеры.
+func (c *Client) Rehome(storageID string, msgs []*message.Message) error {
+	return c.rehome(storageID, msgs, false)
 }
 
-// SendToGateway публикует сообщение в NATS subject orbital.gateway
-func (c *Client) SendToGateway(msgs []*message.Message) error {
-	return c.publish(subjectGateway, msgs)
+// Evacuate публикует сообщения инстанса хранилища storageID, покидающего кластер,
+// как Rehome, но gateway может передать их и в orbital.storage.{storageID}.
+func (c *Client) Evacuate(storageID string, msgs []*message.Message) error {
+	return c.rehome(storageID, msgs, true)
+}
+
+func (c *Client) rehome(storageID string, msgs []*message.Message, evacuate bool) error {
+	data, err := json.Marshal(msgs)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	msg := nats.NewMsg(subjectGateway)
+	msg.Header.Set(HeaderStorageID, storageID)
+	msg.Header.Set(HeaderRehome, "true")
+	if evacuate {
+		msg.Header.Set(HeaderEvacuate, "true")
+	}
+	msg.Data = data
+
+	return c.nats.PublishMsg(msg)
 }
 
 // SendToPusher публикует сообщение в NATS subject orbital.push.{pusherID}.
@@ -43,8 +161,107 @@ func (c *Client) SendToPusher(pusherID string, msgs []*message.Message) error {
 	return c.publish(subjectPusherPrefix+pusherID, msgs)
 }
 
-func (c *Client) NewHandlerOnStorageMessages(storageId string, handler nats.MsgHandler) (*nats.Subscription, error) {
-	return c.nats.Subscribe(subjectStoragePrefix+storageId, handler)
+// SendToDeadLetter публикует сообщения, которые хранилище storageID не может принять,
+// в NATS subject orbital.dlq.{storageID}.
+func (c *Client) SendToDeadLetter(storageID string, msgs []*message.Message) error {
+	return c.publish(subjectDeadLetter+storageID, msgs)
+}
+
+// AckToStorage подтверждает хранилищу storageID обработку (gateway) или сохранение
+// (хранилище, принявшее продвинутые сообщения) сообщений с идентификаторами ids.
+func (c *Client) AckToStorage(storageID string, ids []string) error {
+	data, err := json.Marshal(ids)
+	if err != nil {
+		return fmt.Errorf("failed to marshal ids: %w", err)
+	}
+
+	return c.nats.PublishCore(subjectAckPrefix+storageID, data)
+}
+
+// NewHandlerOnStorageMessages подписывает handler на orbital.storage.{storageID}.
+// Все инстансы хранилища с одним ID входят в одну queue group с durable
+// consumer'ом storageID, поэтому каждое сообщение обрабатывает ровно один инстанс.
+// Подтверждение ручное: handler обязан вызвать Ack, Nak или Term.
+func (c *Client) NewHandlerOnStorageMessages(storageID string, handler nats.MsgHandler) (*nats.Subscription, error) {
+	if err := ValidateStorageID(storageID); err != nil {
+		return nil, err
+	}
+
+	err := c.nats.EnsureConsumer(streamStorage, &nats.ConsumerConfig{
+		Durable:        storageID,
+		FilterSubject:  subjectStoragePrefix + storageID,
+		DeliverSubject: subjectDeliverStoragePrefix + storageID,
+		DeliverGroup:   storageID,
+		DeliverPolicy:  nats.DeliverAllPolicy,
+		AckPolicy:      nats.AckExplicitPolicy,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return c.nats.QueueSubscribe(
+		subjectStoragePrefix+storageID, storageID, handler,
+		nats.Bind(streamStorage, storageID), nats.ManualAck(),
+	)
+}
+
+// NewHandlerOnPromotedMessages подписывает handler на orbital.promote.{storageID}.
+// Как и в NewHandlerOnStorageMessages, все инстансы хранилища входят в одну queue group.
+// Подтверждение ручное: handler обязан вызвать Ack, Nak или Term.
+func (c *Client) NewHandlerOnPromotedMessages(storageID string, handler nats.MsgHandler) (*nats.Subscription, error) {
+	if err := ValidateStorageID(storageID); err != nil {
+		return nil, err
+	}
+
+	err := c.nats.EnsureConsumer(streamPromote, &nats.ConsumerConfig{
+		Durable:        storageID,
+		FilterSubject:  subjectPromotePrefix + storageID,
+		DeliverSubject: subjectDeliverPromotePrefix + storageID,
+		DeliverGroup:   storageID,
+		DeliverPolicy:  nats.DeliverAllPolicy,
+		AckPolicy:      nats.AckExplicitPolicy,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return c.nats.QueueSubscribe(
+		subjectPromotePrefix+storageID, storageID, handler,
+		nats.Bind(streamPromote, storageID), nats.ManualAck(),
+	)
+}
+
+// NewHandlerOnGatewayMessages подписывает handler на orbital.gateway.
+// Все инстансы gateway делят один durable consumer.
+// Подтверждение ручное: handler обязан вызвать Ack, Nak или Term.
+func (c *Client) NewHandlerOnGatewayMessages(handler nats.MsgHandler) (*nats.Subscription, error) {
+	err := c.nats.EnsureConsumer(streamGateway, &nats.ConsumerConfig{
+		Durable:        consumerGateway,
+		FilterSubject:  subjectGateway,
+		DeliverSubject: subjectDeliverGateway,
+		DeliverGroup:   consumerGateway,
+		DeliverPolicy:  nats.DeliverAllPolicy,
+		AckPolicy:      nats.AckExplicitPolicy,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return c.nats.QueueSubscribe(
+		subjectGateway, consumerGateway, handler,
+		nats.Bind(streamGateway, consumerGateway), nats.ManualAck(),
+	)
+}
+
+// NewHandlerOnStorageAcks подписывает handler на подтверждения для хранилища storageID.
+// Подтверждения получают все инстансы хранилища; каждый применяет только известные ему ID.
+// Тело сообщения — JSON-массив идентификаторов.
+func (c *Client) NewHandlerOnStorageAcks(storageID string, handler nats.MsgHandler) (*nats.Subscription, error) {
+	if err := ValidateStorageID(storageID); err != nil {
+		return nil, err
+	}
+
+	return c.nats.SubscribeCore(subjectAckPrefix+storageID, handler)
 }
 
 func (c *Client) publish(subject string, msgs []*message.Message) error {
@@ -55,3 +272,17 @@ func (c *Client) publish(subject string, msgs []*message.Message) error {
 
 	return c.nats.Publish(subject, data)
 }
+
+// publishFrom публикует сообщения с заголовком HeaderStorageID, указывающим хранилище-отправителя.
+func (c *Client) publishFrom(subject, storageID string, msgs []*message.Message) error {
+	data, err := json.Marshal(msgs)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	msg := nats.NewMsg(subject)
+	msg.Header.Set(HeaderStorageID, storageID)
+	msg.Data = data
+
+	return c.nats.PublishMsg(msg)
+}
@@ -0,0 +1,35 @@
+package bus
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateStorageID(t *testing.T) {
+	for _, id := range []string{"hot", "hot-l1", "warm_2", "хранилище"} {
+		if err := ValidateStorageID(id); err != nil {
+			t.Fatalf("expected %q to be valid, got %v", id, err)
+		}
+	}
+
+	for _, id := range []string{"", "hot.l1", "hot*", "hot>", "hot l1", "hot\t", "a/b", `a\b`, "hot\x00"} {
+		if err := ValidateStorageID(id); !errors.Is(err, ErrInvalidStorageID) {
+			t.Fatalf("expected ErrInvalidStorageID for %q, got %v", id, err)
+		}
+	}
+}
+
+func TestHandlersRejectInvalidStorageID(t *testing.T) {
+	// ID проверяется до обращения к NATS.
+	c := New(nil)
+
+	if _, err := c.NewHandlerOnStorageMessages("hot.>", nil); !errors.Is(err, ErrInvalidStorageID) {
+		t.Fatalf("expected ErrInvalidStorageID, got %v", err)
+	}
+	if _, err := c.NewHandlerOnPromotedMessages("hot *", nil); !errors.Is(err, ErrInvalidStorageID) {
+		t.Fatalf("expected ErrInvalidStorageID, got %v", err)
+	}
+	if _, err := c.NewHandlerOnStorageAcks("", nil); !errors.Is(err, ErrInvalidStorageID) {
+		t.Fatalf("expected ErrInvalidStorageID, got %v", err)
+	}
+}
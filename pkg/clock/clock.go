@@ -0,0 +1,60 @@
+// Package clock абстрагирует текущее время, чтобы зависящее от времени поведение
+// можно было проверять без реальных ожиданий.
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock — источник текущего времени.
+type Clock interface {
+	Now() time.Time
+}
+
+// System — системные часы.
+type System struct{}
+
+func (System) Now() time.Time {
+	return time.Now()
+}
+
+// OrSystem возвращает c, а для nil — системные часы.
+func OrSystem(c Clock) Clock {
+	if c == nil {
+		return System{}
+	}
+	return c
+}
+
+// Fake — часы, время которых меняется только явно через Advance и Set.
+// Безопасны для конкурентного использования.
+type Fake struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFake создаёт часы, показывающие now.
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Advance переводит часы вперёд на d.
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+}
+
+// Set устанавливает текущее время часов.
+func (f *Fake) Set(now time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = now
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/Alexey-zaliznuak/orbital/pkg/entities/pusher"
 	routingrule "github.com/Alexey-zaliznuak/orbital/pkg/entities/routing_rule"
 	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+	storageapi "github.com/Alexey-zaliznuak/orbital/pkg/sdk/storage/api"
 )
 
 // ErrorResponse стандартный ответ при ошибке.
@@ -70,18 +71,81 @@ func GatewayToResponse(g *gateway.Info) GatewayResponse {
 type RegisterStorageRequest struct {
 	ID       string `json:"id"`
 	Address  string `json:"address"`
-	MinDelay string `json:"min_delay"` // e.g. "0s", "1m", "1h"
-	MaxDelay string `json:"max_delay"` // e.g. "1m", "1h", "0" (unlimited)
+	MinDelay string `json:"min_delay"`         // e.g. "0s", "1m", "1h"
+	MaxDelay string `json:"max_delay"`         // e.g. "1m", "1h", "0" (unlimited)
+	Version  string `json:"version,omitempty"` // версия инстанса, например тег образа
+}
+
+// StorageLoad — нагрузка инстанса Storage.
+type StorageLoad struct {
+	Measured   bool    `json:"measured"`                              // нагрузка измерена; false — показатели неизвестны
+	Pending    int64   `json:"pending"`                               // сколько сообщений хранит инстанс
+	Bytes      int64   `json:"bytes"`                                 // размер их payload, 0 — не считается
+	InFlight   int64   `json:"in_flight"`                             // выпущено в gateway и не подтверждено
+	IngestRate float64 `json:"ingest_rate"`                           // сообщений в секунду, сохранённых из шины
+	ReleaseLag string  `json:"release_lag,omitempty" example:"250ms"` // опоздание выпуска наступивших сообщений
+}
+
+// StorageHeartbeatRequest — heartbeat инстанса Storage.
+type StorageHeartbeatRequest struct {
+	Address  string `json:"address"`          // адрес инстанса, указанный при регистрации
+	Status   string `json:"status,omitempty"` // "Active" (по умолчанию) или "Degraded"
+	Capacity int64  `json:"capacity"`         // лимит числа сообщений, 0 — без ограничения
+	StorageLoad
+}
+
+// StorageInstanceResponse — инстанс Storage.
+type StorageInstanceResponse struct {
+	Address       string `json:"address"`
+	Status        string `json:"status"`
+	Version       string `json:"version,omitempty"`
+	Capacity      int64  `json:"capacity"`
+	RegisteredAt  string `json:"registered_at"`
+	LastHeartbeat string `json:"last_heartbeat"`
+	StorageLoad
+}
+
+// LoadToResponse конвертирует storage.Load в DTO.
+func LoadToResponse(l storage.Load) StorageLoad {
+	return StorageLoad{
+		Measured:   l.Measured,
+		Pending:    l.Pending,
+		Bytes:      l.Bytes,
+		InFlight:   l.InFlight,
+		IngestRate: l.IngestRate,
+		ReleaseLag: l.ReleaseLag.String(),
+	}
+}
+
+// ParseLoad парсит StorageLoad в storage.Load; пустой release_lag — нулевое опоздание.
+func ParseLoad(l StorageLoad) (storage.Load, error) {
+	var lag time.Duration
+	if l.ReleaseLag != "" {
+		var err error
+		if lag, err = time.ParseDuration(l.ReleaseLag); err != nil {
+			return storage.Load{}, err
+		}
+	}
+	return storage.Load{
+		Measured:   l.Measured,
+		Pending:    l.Pending,
+		Bytes:      l.Bytes,
+		InFlight:   l.InFlight,
+		IngestRate: l.IngestRate,
+		ReleaseLag: lag,
+	}, nil
 }
 
 type StorageResponse struct {
-	ID            string   `json:"id"`
-	Addresses     []string `json:"addresses"`
-	MinDelay      string   `json:"min_delay"`
-	MaxDelay      string   `json:"max_delay"`
-	Status        string   `json:"status"`
-	RegisteredAt  string   `json:"registered_at"`
-	LastHeartbeat string   `json:"last_heartbeat"`
+	ID string `json:"id"`
+	// Addresses — адреса Instances, для клиентов, которым не нужны данные инстансов.
+	Addresses     []string                  `json:"addresses"`
+	Instances     []StorageInstanceResponse `json:"instances"`
+	MinDelay      string                    `json:"min_delay"`
+	MaxDelay      string                    `json:"max_delay"`
+	Status        string                    `json:"status"`
+	RegisteredAt  string                    `json:"registered_at"`
+	LastHeartbeat string                    `json:"last_heartbeat"`
 }
 
 func StorageToResponse(s *storage.Info) StorageResponse {
@@ -89,9 +153,24 @@ func StorageToResponse(s *storage.Info) StorageResponse {
 	if s.MaxDelay == 0 {
 		maxDelay = "unlimited"
 	}
+
+	instances := make([]StorageInstanceResponse, len(s.Instances))
+	for i, inst := range s.Instances {
+		instances[i] = StorageInstanceResponse{
+			Address:       inst.Address,
+			Status:        inst.Status.String(),
+			Version:       inst.Version,
+			Capacity:      inst.Capacity,
+			RegisteredAt:  inst.RegisteredAt.Format(time.RFC3339),
+			LastHeartbeat: inst.LastHeartbeat.Format(time.RFC3339),
+			StorageLoad:   LoadToResponse(inst.Load),
+		}
+	}
+
 	return StorageResponse{
 		ID:            s.ID,
-		Addresses:     s.Addresses,
+		Addresses:     s.Addresses(),
+		Instances:     instances,
 		MinDelay:      s.MinDelay.String(),
 		MaxDelay:      maxDelay,
 		Status:        s.Status.String(),
@@ -100,6 +179,106 @@ func StorageToResponse(s *storage.Info) StorageResponse {
 	}
 }
 
+// DelayRangeResponse — полуинтервал задержек [from, to).
+type DelayRangeResponse struct {
+	From string `json:"from" example:"1h"`
+	To   string `json:"to" example:"unlimited"`
+}
+
+// CoverageOverlapResponse — интервал задержек, который принимают несколько Storages.
+type CoverageOverlapResponse struct {
+	DelayRangeResponse
+	StorageIDs []string `json:"storage_ids"`
+}
+
+// CoverageResponse — покрытие задержек [0, ∞) диапазонами зарегистрированных Storages.
+type CoverageResponse struct {
+	// Complete — у любой задержки есть Storage.
+	Complete bool                      `json:"complete"`
+	Gaps     []DelayRangeResponse      `json:"gaps"`
+	Overlaps []CoverageOverlapResponse `json:"overlaps"`
+}
+
+// DelayRangeToResponse конвертирует storage.DelayRange в DTO.
+func DelayRangeToResponse(r storage.DelayRange) DelayRangeResponse {
+	to := r.To.String()
+	if r.To == 0 {
+		to = "unlimited"
+	}
+	return DelayRangeResponse{From: r.From.String(), To: to}
+}
+
+// CoverageToResponse конвертирует storage.Coverage в DTO.
+func CoverageToResponse(c storage.Coverage) CoverageResponse {
+	resp := CoverageResponse{
+		Complete: c.Complete(),
+		Gaps:     make([]DelayRangeResponse, len(c.Gaps)),
+		Overlaps: make([]CoverageOverlapResponse, len(c.Overlaps)),
+	}
+	for i, gap := range c.Gaps {
+		resp.Gaps[i] = DelayRangeToResponse(gap)
+	}
+	for i, overlap := range c.Overlaps {
+		resp.Overlaps[i] = CoverageOverlapResponse{
+			DelayRangeResponse: DelayRangeToResponse(overlap.DelayRange),
+			StorageIDs:         overlap.StorageIDs,
+		}
+	}
+	return resp
+}
+
+// StorageForecastResponse — вклад одного инстанса Storage в прогноз нагрузки.
+type StorageForecastResponse struct {
+	ID      string `json:"id"`
+	Address string `json:"address"`
+	// Total — число ожидающих сообщений инстанса на горизонте прогноза.
+	Total     int64 `json:"total"`
+	Truncated bool  `json:"truncated,omitempty"`
+	Shared    bool  `json:"shared,omitempty"`
+	// Skipped — инстанс ответил, но его данные уже учтены через другой инстанс
+	// того же Storage с общими данными.
+	Skipped bool `json:"skipped,omitempty"`
+	// Error — инстанс не ответил, и его сообщения не вошли в прогноз.
+	Error string `json:"error,omitempty"`
+}
+
+// ForecastResponse — прогноз нагрузки кластера: гистограмма ожидающих сообщений
+// всех Storages и вклад каждого инстанса.
+type ForecastResponse struct {
+	Histogram storageapi.HistogramResponse `json:"histogram"`
+	Storages  []StorageForecastResponse    `json:"storages"`
+}
+
+// RebalanceRequest — запуск перебалансировки сообщений между Storages.
+type RebalanceRequest struct {
+	// Evacuate — адреса инстансов Storages, удалённых из кластера: они передают
+	// все свои ожидающие сообщения.
+	Evacuate []string `json:"evacuate,omitempty"`
+}
+
+// StorageRebalanceResponse — ход перебалансировки одного инстанса Storage.
+type StorageRebalanceResponse struct {
+	// ID — пустой у эвакуируемых инстансов, не зарегистрированных в координаторе.
+	ID       string `json:"id,omitempty"`
+	Address  string `json:"address"`
+	Evacuate bool   `json:"evacuate,omitempty"`
+	State    string `json:"state" example:"done" enums:"pending,running,done,skipped,failed"`
+	// Scanned — сколько ожидающих сообщений инстанс просмотрел.
+	Scanned int `json:"scanned"`
+	// Resubmitted — сколько сообщений инстанс передал gateway для повторного выбора хранилища.
+	Resubmitted int    `json:"resubmitted"`
+	Error       string `json:"error,omitempty"`
+}
+
+// RebalanceResponse — ход последней перебалансировки.
+type RebalanceResponse struct {
+	State       string                     `json:"state" example:"running" enums:"idle,running,done"`
+	StartedAt   time.Time                  `json:"started_at,omitempty"`
+	FinishedAt  time.Time                  `json:"finished_at,omitempty"`
+	Resubmitted int                        `json:"resubmitted"`
+	Storages    []StorageRebalanceResponse `json:"storages"`
+}
+
 // ParseStorageResponse парсит StorageResponse в доменную модель storage.Info.
 func ParseStorageResponse(r *StorageResponse) (*storage.Info, error) {
 	minDelay, err := time.ParseDuration(r.MinDelay)
@@ -118,22 +297,48 @@ func ParseStorageResponse(r *StorageResponse) (*storage.Info, error) {
 	registeredAt, _ := time.Parse(time.RFC3339, r.RegisteredAt)
 	lastHeartbeat, _ := time.Parse(time.RFC3339, r.LastHeartbeat)
 
-	status := node.NodeStatusActive
-	if r.Status != "Active" {
-		status = node.NodeStatusRemoved
+	instances := make([]storage.Instance, len(r.Instances))
+	for i, inst := range r.Instances {
+		load, err := ParseLoad(inst.StorageLoad)
+		if err != nil {
+			return nil, err
+		}
+		instRegisteredAt, _ := time.Parse(time.RFC3339, inst.RegisteredAt)
+		instLastHeartbeat, _ := time.Parse(time.RFC3339, inst.LastHeartbeat)
+		instances[i] = storage.Instance{
+			Address:       inst.Address,
+			Status:        parseNodeStatus(inst.Status),
+			Version:       inst.Version,
+			Capacity:      inst.Capacity,
+			Load:          load,
+			RegisteredAt:  instRegisteredAt,
+			LastHeartbeat: instLastHeartbeat,
+		}
 	}
 
 	return &storage.Info{
 		ID:            r.ID,
-		Addresses:     r.Addresses,
+		Instances:     instances,
 		MinDelay:      minDelay,
 		MaxDelay:      maxDelay,
-		Status:        status,
+		Status:        parseNodeStatus(r.Status),
 		RegisteredAt:  registeredAt,
 		LastHeartbeat: lastHeartbeat,
 	}, nil
 }
 
+// parseNodeStatus парсит статус Storage или его инстанса; неизвестный статус — Removed.
+func parseNodeStatus(s string) node.NodeStatus {
+	switch s {
+	case node.NodeStatusActive.String():
+		return node.NodeStatusActive
+	case node.NodeStatusDegraded.String():
+		return node.NodeStatusDegraded
+	default:
+		return node.NodeStatusRemoved
+	}
+}
+
 // === Pushers ===
 
 type RegisterPusherRequest struct {
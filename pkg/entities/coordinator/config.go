@@ -15,8 +15,22 @@ type CoordinatorConfig struct {
 
 	// Логирование
 	LogLevel string `env:"LOG_LEVEL" envDefault:"info"`
+
+	// StrictStorageCoverage — отклонять регистрацию Storage, после которой часть задержек,
+	// принимавшихся раньше, не примет ни один Storage.
+	StrictStorageCoverage bool `env:"STRICT_STORAGE_COVERAGE" envDefault:"false"`
+
+	// StorageInstanceTTL — сколько инстанс Storage может не присылать heartbeat, прежде чем
+	// координатор удалит его и gateway перестанет направлять ему сообщения; 0 — не удалять.
+	StorageInstanceTTL time.Duration `env:"STORAGE_INSTANCE_TTL" envDefault:"30s"`
 }
 
 type ClusterConfig struct {
 	NatsAddress string `json:"nats_address" env:"NATS_URL" envDefault:"localhost:4222"`
+
+	// JetStream streams (orbital.storage.>, orbital.gateway, orbital.push.>)
+	StreamRetention string        `json:"stream_retention" env:"NATS_STREAM_RETENTION" envDefault:"workqueue"` // limits | interest | workqueue
+	StreamReplicas  int           `json:"stream_replicas"  env:"NATS_STREAM_REPLICAS"  envDefault:"1"`
+	StreamMaxAge    time.Duration `json:"stream_max_age"   env:"NATS_STREAM_MAX_AGE"   envDefault:"0"`  // 0 — без ограничения
+	StreamMaxBytes  int64         `json:"stream_max_bytes" env:"NATS_STREAM_MAX_BYTES" envDefault:"-1"` // -1 — без ограничения
 }
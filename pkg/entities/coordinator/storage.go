@@ -29,8 +29,13 @@ type CoordinatorStorage interface {
 	RegisterStorage(ctx context.Context, st *storage.Info) error
 	GetStorage(ctx context.Context, storageID string) (*storage.Info, error)
 	ListStorages(ctx context.Context) ([]*storage.Info, error)
-	UpdateStorageHeartbeat(ctx context.Context, storageID string) error
+	// UpdateStorageHeartbeat обновляет heartbeat, статус и нагрузку инстанса hb.Address
+	// Storage. Незарегистрированный инстанс — ErrNotFound, как и отсутствующий Storage.
+	UpdateStorageHeartbeat(ctx context.Context, storageID string, hb storage.Heartbeat) error
 	UnregisterStorage(ctx context.Context, storageID string) error
+	// UnregisterStorageAddress удаляет инстанс из Storage; Storage без инстансов
+	// удаляется целиком. Отсутствующий адрес не считается ошибкой.
+	UnregisterStorageAddress(ctx context.Context, storageID, address string) error
 
 	// === Pushers ===
 	RegisterPusher(ctx context.Context, p *pusher.Info) error
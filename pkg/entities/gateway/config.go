@@ -1,5 +1,11 @@
 package gateway
 
+import (
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/clock"
+)
+
 type GatewayConfig struct {
 	ClusterAddress string `json:"cluster_address" env:"COORDINATOR_ADDR" envDefault:""`
 
@@ -7,4 +13,15 @@ type GatewayConfig struct {
 	GRPCAddr string `json:"grpc_addr" env:"GRPC_ADDR" envDefault:":9090"`
 
 	LogLevel string `json:"log_level" env:"LOG_LEVEL" envDefault:"info"`
+
+	// Задержка повторной доставки сообщения из orbital.gateway после ошибки отправки в пушер.
+	NakDelay time.Duration `json:"nak_delay" env:"NAK_DELAY" envDefault:"1s"`
+
+	// Опоздание выпуска сообщений, начиная с которого gateway обходит хранилище, пока
+	// есть другие подходящие; 0 — не учитывать опоздание.
+	MaxReleaseLag time.Duration `json:"max_release_lag" env:"MAX_RELEASE_LAG" envDefault:"5s"`
+
+	// Clock — источник текущего времени для маршрутизации по задержке; nil — системные часы.
+	// Задаётся только из кода, например в тестах.
+	Clock clock.Clock `json:"-" env:"-"`
 }
@@ -26,6 +26,7 @@ type Gateway interface {
 	// Запускает фоновые задачи:
 	//
 	// - Обновление информации по хранилищам
-	Start(ctx context.Context)
+	// - Обработка сообщений, выпущенных хранилищами
+	Start(ctx context.Context) error
 	GetConfig() *GatewayConfig
 }
@@ -1,8 +1,11 @@
 package message
 
 import (
+	"bytes"
+	"maps"
 	"time"
 
+	"github.com/Alexey-zaliznuak/orbital/pkg/clock"
 	"github.com/google/uuid"
 )
 
@@ -28,21 +31,43 @@ type Message struct {
 
 	// Если не задано (zero value), сообщение доставляется немедленно.
 	ScheduledAt time.Time `json:"scheduled_at"`
+
+	// delay — задержка WithDelay, которую NewMessage отсчитывает от CreatedAt
+	// после применения всех опций.
+	delay *time.Duration
 }
 
 // NewMessage создаёт новое сообщение с применением переданных опций.
 // По умолчанию ID генерируется автоматически, CreatedAt устанавливается на текущее время.
+// Задержка WithDelay отсчитывается от итогового CreatedAt независимо от порядка опций.
 func NewMessage(options ...MessageOption) *Message {
-	message := &Message{
+	m := &Message{
 		ID:        GenerateID(),
 		CreatedAt: time.Now(),
 	}
 
 	for _, option := range options {
-		option(message)
+		option(m)
+	}
+
+	if m.delay != nil {
+		m.ScheduledAt = m.CreatedAt.Add(*m.delay)
+		m.delay = nil
 	}
 
-	return message
+	return m
+}
+
+// Equal сообщает, совпадает ли содержимое сообщений, включая ID и временные метки.
+// Используется для распознавания повторной доставки одного и того же сообщения.
+func (m *Message) Equal(other *Message) bool {
+	return m.ID == other.ID &&
+		m.RoutingKey == other.RoutingKey &&
+		maps.Equal(m.RoutingSettings, other.RoutingSettings) &&
+		bytes.Equal(m.Payload, other.Payload) &&
+		maps.Equal(m.Metadata, other.Metadata) &&
+		m.CreatedAt.Equal(other.CreatedAt) &&
+		m.ScheduledAt.Equal(other.ScheduledAt)
 }
 
 // GenerateID генерирует временно-упорядоченный идентификатор UUIDv6.
@@ -111,15 +136,26 @@ func WithCreatedAt(t time.Time) MessageOption {
 }
 
 // WithScheduledAt устанавливает точное время доставки сообщения.
+// Отменяет указанный раньше WithDelay.
 func WithScheduledAt(t time.Time) MessageOption {
 	return func(m *Message) {
 		m.ScheduledAt = t
+		m.delay = nil
 	}
 }
 
-// WithDelay устанавливает задержку доставки относительно текущего времени.
+// WithDelay устанавливает задержку доставки относительно CreatedAt — по умолчанию
+// момента создания сообщения, иначе заданного WithCreatedAt или WithClock в любом
+// месте списка опций. Отменяет указанный раньше WithScheduledAt.
 func WithDelay(d time.Duration) MessageOption {
 	return func(m *Message) {
-		m.ScheduledAt = time.Now().Add(d)
+		m.delay = &d
+	}
+}
+
+// WithClock берёт CreatedAt из часов c.
+func WithClock(c clock.Clock) MessageOption {
+	return func(m *Message) {
+		m.CreatedAt = c.Now()
 	}
 }
@@ -0,0 +1,40 @@
+package message
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWithDelayIsOrderIndependent(t *testing.T) {
+	created := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	before := NewMessage(WithDelay(time.Minute), WithCreatedAt(created))
+	after := NewMessage(WithCreatedAt(created), WithDelay(time.Minute))
+
+	for _, m := range []*Message{before, after} {
+		if !m.ScheduledAt.Equal(created.Add(time.Minute)) {
+			t.Fatalf("expected delay from final CreatedAt, got %v", m.ScheduledAt)
+		}
+	}
+
+	// Последняя из WithDelay и WithScheduledAt отменяет предыдущую.
+	if m := NewMessage(WithCreatedAt(created), WithDelay(time.Minute), WithScheduledAt(created)); !m.ScheduledAt.Equal(created) {
+		t.Fatalf("expected WithScheduledAt to cancel delay, got %v", m.ScheduledAt)
+	}
+	if m := NewMessage(WithCreatedAt(created), WithScheduledAt(created), WithDelay(time.Hour)); !m.ScheduledAt.Equal(created.Add(time.Hour)) {
+		t.Fatalf("expected WithDelay to cancel scheduled time, got %v", m.ScheduledAt)
+	}
+}
+
+func TestCustomOption(t *testing.T) {
+	withTenant := func(tenant string) MessageOption {
+		return func(m *Message) {
+			m.RoutingKey = tenant + "." + m.RoutingKey
+		}
+	}
+
+	m := NewMessage(WithRoutingKey("orders"), withTenant("acme"))
+	if m.RoutingKey != "acme.orders" {
+		t.Fatalf("unexpected routing key %q", m.RoutingKey)
+	}
+}
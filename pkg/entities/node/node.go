@@ -9,6 +9,9 @@ const (
 	NodeStatusConnecting NodeStatus = iota
 	NodeStatusActive
 	NodeStatusRemoved
+	// NodeStatusDegraded — узел работает, но перегружен: новые данные ему лучше
+	// направлять, только если других вариантов нет.
+	NodeStatusDegraded
 )
 
 func (status NodeStatus) String() string {
@@ -19,6 +22,8 @@ func (status NodeStatus) String() string {
 		return "Active"
 	case NodeStatusRemoved:
 		return "Removed"
+	case NodeStatusDegraded:
+		return "Degraded"
 	default:
 		return "Unknown"
 	}
@@ -43,6 +48,8 @@ func (status *NodeStatus) UnmarshalJSON(data []byte) error {
 		*status = NodeStatusActive
 	case "Removed":
 		*status = NodeStatusRemoved
+	case "Degraded":
+		*status = NodeStatusDegraded
 	default:
 		*status = NodeStatusRemoved
 	}
@@ -1,21 +1,46 @@
 package storage
 
-import "time"
+import (
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/clock"
+)
 
 type BaseStorageConfig struct {
-	ID       string        `env:"STORAGE_ID"        envDefault:"in-memory"`
+	ID string `env:"STORAGE_ID"        envDefault:"in-memory"`
 
 	ClusterAddress string `json:"cluster_address" env:"COORDINATOR_ADDR" envDefault:""`
 
 	// Поставляяется в координатор
-	Address  string        `env:"STORAGE_ADDRESS"   envDefault:""`
+	Address string `env:"STORAGE_ADDRESS"   envDefault:""`
+
+	// Версия инстанса, например тег образа; сообщается координатору при регистрации.
+	Version string `env:"STORAGE_VERSION" envDefault:""`
 
 	MinDelay time.Duration `env:"STORAGE_MIN_DELAY" envDefault:"0"`
 	MaxDelay time.Duration `env:"STORAGE_MAX_DELAY" envDefault:"0"`
 
-	FetchInterval time.Duration `env:"FETCH_NEW_MESSAGES_INTERVAL" envDefault:"10ms"`
+	FetchInterval       time.Duration `env:"FETCH_NEW_MESSAGES_INTERVAL" envDefault:"10ms"`
 	FindExpiredInterval time.Duration `env:"FIND_EXPIRED_INTERVAL" envDefault:"10ms"`
 	SendExpiredInterval time.Duration `env:"SEND_EXPIRED_INTERVAL" envDefault:"10ms"`
 
 	MaxOutputBatchSize int `env:"MAX_OUTPUT_BATCH_SIZE" envDefault:"100"`
+
+	// Задержка повторной доставки входящего сообщения после временной ошибки сохранения.
+	NakDelay time.Duration `env:"NAK_DELAY" envDefault:"1s"`
+	// Время ожидания подтверждения от gateway, после которого выпущенное сообщение отправляется повторно.
+	VisibilityTimeout time.Duration `env:"VISIBILITY_TIMEOUT" envDefault:"30s"`
+
+	// За сколько до того, как оставшаяся задержка сообщения станет меньше MinDelay,
+	// передавать его более горячему хранилищу через orbital.promote.{ID}.
+	// Продвижение выключено, если MinDelay равен нулю или более горячих хранилищ нет.
+	PromoteLeadTime time.Duration `env:"PROMOTE_LEAD_TIME" envDefault:"10s"`
+
+	// Интервал heartbeat в координатор. Хранилище регистрируется при старте,
+	// если задан Address, и сообщает свой статус (Active или Degraded).
+	HeartbeatInterval time.Duration `env:"HEARTBEAT_INTERVAL" envDefault:"5s"`
+
+	// Clock — источник текущего времени для планирования; nil — системные часы.
+	// Задаётся только из кода, например в тестах.
+	Clock clock.Clock `env:"-" json:"-"`
 }
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"math"
+	"slices"
+	"time"
+)
+
+// unlimited — конец диапазона без верхнего ограничения во внутренних вычислениях.
+const unlimited = time.Duration(math.MaxInt64)
+
+// DelayRange — полуинтервал задержек [From, To); To == 0 — без верхнего ограничения.
+type DelayRange struct {
+	From time.Duration
+	To   time.Duration
+}
+
+func (r DelayRange) end() time.Duration {
+	if r.To == 0 {
+		return unlimited
+	}
+	return r.To
+}
+
+// CoverageOverlap — интервал задержек, который принимают сразу несколько хранилищ.
+type CoverageOverlap struct {
+	DelayRange
+	StorageIDs []string
+}
+
+// Coverage — покрытие задержек [0, ∞) диапазонами зарегистрированных хранилищ.
+// Сообщения с задержкой из разрыва gateway не может сохранить ни в одно хранилище.
+type Coverage struct {
+	Gaps     []DelayRange
+	Overlaps []CoverageOverlap
+}
+
+// Complete сообщает, принимает ли какое-нибудь хранилище любую задержку.
+func (c Coverage) Complete() bool {
+	return len(c.Gaps) == 0
+}
+
+// ComputeCoverage находит разрывы и пересечения диапазонов storages в порядке задержек.
+// Хранилища с пустым диапазоном (MaxDelay не больше MinDelay) ничего не покрывают.
+func ComputeCoverage(storages []*Info) Coverage {
+	bounds := []time.Duration{0}
+	for _, info := range storages {
+		bounds = append(bounds, info.MinDelay)
+		if info.MaxDelay > 0 {
+			bounds = append(bounds, info.MaxDelay)
+		}
+	}
+	slices.Sort(bounds)
+	bounds = slices.Compact(bounds)
+
+	var coverage Coverage
+	for i, from := range bounds {
+		// На отрезке между соседними границами набор принимающих хранилищ не меняется.
+		segment := DelayRange{From: from}
+		if i+1 < len(bounds) {
+			segment.To = bounds[i+1]
+		}
+
+		var ids []string
+		for _, info := range storages {
+			if info.AcceptsDelay(from) {
+				ids = append(ids, info.ID)
+			}
+		}
+		slices.Sort(ids)
+
+		switch {
+		case len(ids) == 0:
+			if n := len(coverage.Gaps); n > 0 && coverage.Gaps[n-1].To == segment.From {
+				coverage.Gaps[n-1].To = segment.To
+			} else {
+				coverage.Gaps = append(coverage.Gaps, segment)
+			}
+		case len(ids) > 1:
+			if n := len(coverage.Overlaps); n > 0 && coverage.Overlaps[n-1].To == segment.From &&
+				slices.Equal(coverage.Overlaps[n-1].StorageIDs, ids) {
+				coverage.Overlaps[n-1].To = segment.To
+			} else {
+				coverage.Overlaps = append(coverage.Overlaps, CoverageOverlap{DelayRange: segment, StorageIDs: ids})
+			}
+		}
+	}
+
+	return coverage
+}
+
+// NewGaps возвращает части разрывов c, которые покрыты в prev: задержки, которые
+// перестали принимать после перехода от prev к c.
+func (c Coverage) NewGaps(prev Coverage) []DelayRange {
+	var uncovered []DelayRange
+
+	for _, gap := range c.Gaps {
+		from := gap.From
+		for _, old := range prev.Gaps {
+			if old.end() <= from || old.From >= gap.end() {
+				continue
+			}
+			if old.From > from {
+				uncovered = append(uncovered, DelayRange{From: from, To: old.From})
+			}
+			from = old.end()
+			if from >= gap.end() {
+				break
+			}
+		}
+		if from < gap.end() {
+			uncovered = append(uncovered, DelayRange{From: from, To: gap.To})
+		}
+	}
+
+	return uncovered
+}
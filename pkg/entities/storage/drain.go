@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// DrainState — стадия вывода инстанса хранилища из кластера.
+type DrainState string
+
+const (
+	// Инстанс работает в обычном режиме.
+	DrainStateIdle DrainState = "idle"
+	// Инстанс не принимает сообщения и передаёт свои другим инстансам.
+	DrainStateDraining DrainState = "draining"
+	// Все сообщения переданы, инстанс можно останавливать.
+	DrainStateDone DrainState = "done"
+	// Передача прервана ошибкой; непереданные сообщения остаются в инстансе.
+	DrainStateFailed DrainState = "failed"
+)
+
+// DrainStatus — ход вывода инстанса из кластера.
+type DrainStatus struct {
+	State DrainState
+	// Target — хранилище, в которое передаются сообщения.
+	Target     string
+	StartedAt  time.Time
+	FinishedAt time.Time
+	// Pending — сколько сообщений осталось передать.
+	Pending int
+	// InFlight — сколько выпущенных сообщений ждут подтверждения от gateway.
+	InFlight int
+	// Republished — сколько сообщений уже передано.
+	Republished int
+	Error       string
+}
+
+// Drainer — необязательная возможность инстанса хранилища перед остановкой передать
+// свои сообщения другим инстансам того же или другого хранилища.
+type Drainer interface {
+	// Drain переводит инстанс в режим вывода и блокируется до его завершения.
+	// Повторный вызов ждёт завершения уже начатого вывода, а после неудачного
+	// (DrainStateFailed) — запускает его снова. Отмена ctx прекращает
+	// ожидание, но не вывод: так его можно запустить без ожидания.
+	Drain(ctx context.Context) error
+	// DrainStatus возвращает текущий ход вывода.
+	DrainStatus() DrainStatus
+}
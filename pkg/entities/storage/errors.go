@@ -0,0 +1,22 @@
+package storage
+
+import "errors"
+
+// Ошибки, общие для всех реализаций MessageStorage.
+// HTTP API хранилищ отображает их в коды ответа.
+var (
+	ErrNotFound       = errors.New("message not found")
+	ErrNotInitialized = errors.New("storage not initialized")
+	ErrAlreadyExists  = errors.New("message with this ID already exists")
+	// ErrCapacityExceeded — хранилище достигло жёсткого лимита и не может принять сообщение.
+	// Ошибка временная: сообщение можно повторить позже или отправить в другое хранилище.
+	ErrCapacityExceeded = errors.New("storage capacity exceeded")
+	// ErrNotInFlight — операция требует выданного и ещё не подтверждённого сообщения.
+	ErrNotInFlight = errors.New("message is not in flight")
+	// ErrNotSupported — операция не поддерживается этой реализацией.
+	ErrNotSupported = errors.New("operation is not supported by this storage")
+	// ErrDraining — инстанс выводится из кластера и не принимает новые сообщения.
+	ErrDraining = errors.New("storage is draining")
+	// ErrInvalidCursor — курсор страницы повреждён или получен не из ListPage.NextCursor.
+	ErrInvalidCursor = errors.New("invalid list cursor")
+)
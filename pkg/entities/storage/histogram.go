@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MaxHistogramBuckets — наибольшее число интервалов в одной гистограмме.
+const MaxHistogramBuckets = 10_000
+
+// HistogramQuery — параметры гистограммы ожидающих сообщений по ScheduledAt.
+type HistogramQuery struct {
+	// From — начало первого интервала. Zero value — текущее время хранилища,
+	// округлённое вниз до Bucket. Координатор передаёт общее From всем хранилищам,
+	// чтобы интервалы совпадали.
+	From time.Time
+	// Bucket — ширина интервала.
+	Bucket time.Duration
+	// Horizon — длина прогноза от From; сообщения позже From+Horizon не учитываются.
+	Horizon time.Duration
+	// GroupDepth — число первых сегментов routing key (через "."), по которым
+	// сообщения группируются внутри интервала; 0 — без группировки.
+	GroupDepth int
+}
+
+// Validate проверяет параметры запроса.
+func (q HistogramQuery) Validate() error {
+	if q.Bucket <= 0 {
+		return errors.New("bucket must be positive")
+	}
+	if q.Horizon < q.Bucket {
+		return errors.New("horizon must not be less than bucket")
+	}
+	if n := q.Horizon / q.Bucket; n > MaxHistogramBuckets {
+		return fmt.Errorf("too many buckets: %d, max %d", n, MaxHistogramBuckets)
+	}
+	if q.GroupDepth < 0 {
+		return errors.New("group depth must not be negative")
+	}
+	return nil
+}
+
+// HistogramBucket — число ожидающих сообщений с ScheduledAt в [Start, Start+Bucket).
+type HistogramBucket struct {
+	Start time.Time
+	Count int64
+	// Groups — Count с разбивкой по префиксу routing key; nil без группировки.
+	Groups map[string]int64
+}
+
+// Histogram — прогноз нагрузки: сколько ожидающих сообщений наступит в каждом интервале.
+type Histogram struct {
+	From       time.Time
+	Bucket     time.Duration
+	GroupDepth int
+	// Buckets покрывают [From, From+Horizon) без пропусков. Просроченные сообщения
+	// (ScheduledAt раньше From) попадают в первый интервал: они будут выпущены сразу.
+	Buckets []HistogramBucket
+	// Truncated — хранилище учло не все сообщения горизонта.
+	Truncated bool
+	// Shared — данные хранилища общие для всех его инстансов, и гистограммы разных
+	// инстансов описывают одни и те же сообщения.
+	Shared bool
+}
+
+// HistogramProvider — необязательная возможность хранилища строить гистограмму
+// ожидающих сообщений без выборки самих сообщений.
+type HistogramProvider interface {
+	ScheduledHistogram(ctx context.Context, query HistogramQuery) (*Histogram, error)
+}
+
+// NewHistogram создаёт пустую гистограмму; zero From заменяется на now, округлённое до Bucket.
+// Запрос должен быть проверен через Validate.
+func NewHistogram(query HistogramQuery, now time.Time) *Histogram {
+	from := query.From
+	if from.IsZero() {
+		from = now.Truncate(query.Bucket)
+	}
+
+	n := int((query.Horizon + query.Bucket - 1) / query.Bucket)
+	h := &Histogram{
+		From:       from,
+		Bucket:     query.Bucket,
+		GroupDepth: query.GroupDepth,
+		Buckets:    make([]HistogramBucket, n),
+	}
+	for i := range h.Buckets {
+		h.Buckets[i].Start = from.Add(time.Duration(i) * query.Bucket)
+	}
+
+	return h
+}
+
+// Add учитывает сообщение с временем scheduledAt и ключом routingKey.
+// Сообщения за горизонтом пропускаются.
+func (h *Histogram) Add(scheduledAt time.Time, routingKey string) {
+	i := 0
+	if offset := scheduledAt.Sub(h.From); offset > 0 {
+		i = int(offset / h.Bucket)
+	}
+	if i >= len(h.Buckets) {
+		return
+	}
+
+	b := &h.Buckets[i]
+	b.Count++
+	if h.GroupDepth > 0 {
+		if b.Groups == nil {
+			b.Groups = make(map[string]int64)
+		}
+		b.Groups[RoutingKeyGroup(routingKey, h.GroupDepth)]++
+	}
+}
+
+// Merge прибавляет к h гистограмму other. Интервалы сопоставляются по Start:
+// интервалы other, которых нет в h, пропускаются.
+func (h *Histogram) Merge(other *Histogram) {
+	h.Truncated = h.Truncated || other.Truncated
+
+	for _, ob := range other.Buckets {
+		offset := ob.Start.Sub(h.From)
+		if offset < 0 || offset%h.Bucket != 0 {
+			continue
+		}
+		i := int(offset / h.Bucket)
+		if i >= len(h.Buckets) {
+			continue
+		}
+
+		b := &h.Buckets[i]
+		b.Count += ob.Count
+		for group, count := range ob.Groups {
+			if b.Groups == nil {
+				b.Groups = make(map[string]int64)
+			}
+			b.Groups[group] += count
+		}
+	}
+}
+
+// RoutingKeyGroup возвращает первые depth сегментов routing key, разделённых ".".
+func RoutingKeyGroup(routingKey string, depth int) string {
+	parts := strings.SplitN(routingKey, ".", depth+1)
+	if len(parts) <= depth {
+		return routingKey
+	}
+	return strings.Join(parts[:depth], ".")
+}
@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"slices"
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/node"
+)
+
+// Instance — инстанс (воркер) хранилища, зарегистрированный в координаторе.
+type Instance struct {
+	// Address — HTTP-адрес инстанса, уникальный в пределах хранилища.
+	Address string
+	// Status — статус по последнему heartbeat: Active или Degraded.
+	Status node.NodeStatus
+	// Version — версия инстанса, сообщённая при регистрации.
+	Version string
+	// Capacity — лимит числа сообщений инстанса; 0 — без ограничения.
+	Capacity int64
+	// Load — нагрузка инстанса по последнему heartbeat.
+	Load
+
+	RegisteredAt  time.Time
+	LastHeartbeat time.Time
+}
+
+// Load — нагрузка инстанса хранилища.
+type Load struct {
+	// Measured — инстанс сообщил измеренную нагрузку. Пока он не прислал heartbeat
+	// или не смог посчитать сообщения, нулевые показатели означают «неизвестно»,
+	// а не «не загружен».
+	Measured bool
+	// Pending — сколько сообщений хранит инстанс.
+	Pending int64
+	// Bytes — суммарный размер payload хранимых сообщений; 0 — хранилище его не считает.
+	Bytes int64
+	// InFlight — сколько сообщений выпущено в gateway и ждёт подтверждения;
+	// 0 — хранилище их не считает.
+	InFlight int64
+	// IngestRate — сколько сообщений в секунду инстанс сохранял из шины с прошлого heartbeat.
+	IngestRate float64
+	// ReleaseLag — насколько опаздывает самое раннее ожидающее сообщение, срок которого
+	// наступил: инстанс не успевает выпускать сообщения в gateway.
+	ReleaseLag time.Duration
+}
+
+// Heartbeat — состояние, которое инстанс хранилища периодически сообщает координатору.
+type Heartbeat struct {
+	// Address — адрес инстанса, к которому относится heartbeat. Пустой адрес присылают
+	// инстансы, не сообщающие свой адрес и нагрузку: такой heartbeat относится ко всем
+	// инстансам хранилища.
+	Address  string
+	Status   node.NodeStatus
+	Capacity int64
+	Load
+}
+
+// Addresses возвращает адреса инстансов хранилища в порядке регистрации.
+func (s *Info) Addresses() []string {
+	addresses := make([]string, len(s.Instances))
+	for i, inst := range s.Instances {
+		addresses[i] = inst.Address
+	}
+	return addresses
+}
+
+// Instance возвращает инстанс с адресом address или nil, если такого нет.
+func (s *Info) Instance(address string) *Instance {
+	i := slices.IndexFunc(s.Instances, func(inst Instance) bool { return inst.Address == address })
+	if i < 0 {
+		return nil
+	}
+	return &s.Instances[i]
+}
+
+// AddInstance добавляет инстанс. Повторная регистрация адреса заменяет данные инстанса,
+// сохраняя время его первой регистрации.
+func (s *Info) AddInstance(inst Instance) {
+	if existing := s.Instance(inst.Address); existing != nil {
+		inst.RegisteredAt = existing.RegisteredAt
+		*existing = inst
+	} else {
+		s.Instances = append(s.Instances, inst)
+	}
+	s.summarize()
+}
+
+// RemoveInstance удаляет инстанс с адресом address и сообщает, был ли он зарегистрирован.
+func (s *Info) RemoveInstance(address string) bool {
+	n := len(s.Instances)
+	s.Instances = slices.DeleteFunc(s.Instances, func(inst Instance) bool { return inst.Address == address })
+	if len(s.Instances) == n {
+		return false
+	}
+	s.summarize()
+	return true
+}
+
+// ApplyHeartbeat обновляет инстанс hb.Address по heartbeat, полученному в момент now.
+// Возвращает false, если такой инстанс не зарегистрирован. Heartbeat без адреса обновляет
+// статус и время heartbeat всех инстансов, не меняя их ёмкость и нагрузку.
+func (s *Info) ApplyHeartbeat(hb Heartbeat, now time.Time) bool {
+	if hb.Address == "" {
+		if len(s.Instances) == 0 {
+			return false
+		}
+		for i := range s.Instances {
+			s.Instances[i].Status = hb.Status
+			s.Instances[i].LastHeartbeat = now
+		}
+		s.summarize()
+		return true
+	}
+
+	inst := s.Instance(hb.Address)
+	if inst == nil {
+		return false
+	}
+
+	inst.Status = hb.Status
+	inst.Capacity = hb.Capacity
+	inst.Load = hb.Load
+	inst.LastHeartbeat = now
+
+	s.summarize()
+	return true
+}
+
+// RemoveStaleInstances удаляет инстансы, последний heartbeat которых был раньше cutoff,
+// и возвращает их число.
+func (s *Info) RemoveStaleInstances(cutoff time.Time) int {
+	n := len(s.Instances)
+	s.Instances = slices.DeleteFunc(s.Instances, func(inst Instance) bool { return inst.LastHeartbeat.Before(cutoff) })
+	if removed := n - len(s.Instances); removed > 0 {
+		s.summarize()
+		return removed
+	}
+	return 0
+}
+
+// Load возвращает нагрузку самого загруженного инстанса: наибольшее значение каждого
+// показателя. Нагрузка измерена, только если её измерили все инстансы. Инстансы Storage
+// делят поток сообщений из шины, поэтому хранилище перегружено, когда перегружен хотя бы
+// один инстанс; у хранилищ с общими данными все инстансы сообщают одни и те же числа,
+// и суммировать их нельзя.
+func (s *Info) Load() Load {
+	load := Load{Measured: len(s.Instances) > 0}
+	for _, inst := range s.Instances {
+		load.Measured = load.Measured && inst.Measured
+		load.Pending = max(load.Pending, inst.Pending)
+		load.Bytes = max(load.Bytes, inst.Bytes)
+		load.InFlight = max(load.InFlight, inst.InFlight)
+		load.IngestRate = max(load.IngestRate, inst.IngestRate)
+		load.ReleaseLag = max(load.ReleaseLag, inst.ReleaseLag)
+	}
+	return load
+}
+
+// summarize пересчитывает сводные Status, RegisteredAt и LastHeartbeat хранилища.
+// Хранилище Active, пока хотя бы один инстанс Active: сообщения, которые не принял
+// перегруженный инстанс, NATS доставляет повторно, в том числе другим инстансам.
+func (s *Info) summarize() {
+	if len(s.Instances) == 0 {
+		return
+	}
+
+	s.Status = node.NodeStatusDegraded
+	s.RegisteredAt = s.Instances[0].RegisteredAt
+	s.LastHeartbeat = s.Instances[0].LastHeartbeat
+	for _, inst := range s.Instances {
+		if inst.Status == node.NodeStatusActive {
+			s.Status = node.NodeStatusActive
+		}
+		if inst.RegisteredAt.Before(s.RegisteredAt) {
+			s.RegisteredAt = inst.RegisteredAt
+		}
+		if inst.LastHeartbeat.After(s.LastHeartbeat) {
+			s.LastHeartbeat = inst.LastHeartbeat
+		}
+	}
+}
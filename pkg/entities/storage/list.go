@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+)
+
+// ListFilter — условия отбора сообщений при перечислении. Пустые поля выборку не ограничивают.
+type ListFilter struct {
+	// RoutingKeyPrefix — routing key начинается с этой строки.
+	RoutingKeyPrefix string
+	// Metadata — все пары ключ-значение присутствуют в Metadata сообщения.
+	Metadata map[string]string
+	// ScheduledFrom и ScheduledTo — полуинтервал [ScheduledFrom, ScheduledTo) для ScheduledAt.
+	ScheduledFrom time.Time
+	ScheduledTo   time.Time
+	Status        MessageStatus
+}
+
+// Match сообщает, удовлетворяет ли сообщение msg в состоянии status фильтру.
+func (f *ListFilter) Match(msg *message.Message, status MessageStatus) bool {
+	if f.Status != "" && f.Status != status {
+		return false
+	}
+	if !strings.HasPrefix(msg.RoutingKey, f.RoutingKeyPrefix) {
+		return false
+	}
+	if !f.ScheduledFrom.IsZero() && msg.ScheduledAt.Before(f.ScheduledFrom) {
+		return false
+	}
+	if !f.ScheduledTo.IsZero() && !msg.ScheduledAt.Before(f.ScheduledTo) {
+		return false
+	}
+	for k, v := range f.Metadata {
+		if value, ok := msg.Metadata[k]; !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
+
+// ListQuery — запрос страницы сообщений.
+type ListQuery struct {
+	Filter ListFilter
+	// Cursor — NextCursor предыдущей страницы; пустой — первая страница.
+	Cursor string
+	Limit  int
+}
+
+// ListPage — страница сообщений в порядке (ScheduledAt, ID).
+type ListPage struct {
+	Messages []*StoredMessage
+	// NextCursor — курсор следующей страницы; пустой, если страница последняя.
+	NextCursor string
+}
+
+// MessageLister — необязательная возможность хранилища перечислять сообщения
+// с фильтрами и курсорной пагинацией. Порядок (ScheduledAt, ID) стабилен: сообщения,
+// сохранённые между запросами страниц, не сдвигают уже выданные.
+type MessageLister interface {
+	List(ctx context.Context, query ListQuery) (*ListPage, error)
+}
+
+// MessageExporter — необязательная возможность хранилища выгрузить все сообщения,
+// удовлетворяющие фильтру, за один проход в порядке (ScheduledAt, ID). В отличие
+// от страниц List, выгрузка не просматривает хранилище заново для каждой страницы.
+// Ошибка emit прерывает выгрузку и возвращается из Export.
+type MessageExporter interface {
+	Export(ctx context.Context, filter ListFilter, emit func(*StoredMessage) error) error
+}
+
+// ListCursor — позиция в порядке (ScheduledAt, ID): последнее выданное сообщение.
+type ListCursor struct {
+	ScheduledAt time.Time
+	ID          string
+}
+
+// CursorAfter возвращает курсор, указывающий на сообщение msg.
+func CursorAfter(msg *message.Message) ListCursor {
+	return ListCursor{ScheduledAt: msg.ScheduledAt, ID: msg.ID}
+}
+
+// Encode кодирует курсор в непрозрачную строку для API.
+func (c ListCursor) Encode() string {
+	raw := c.ScheduledAt.UTC().Format(time.RFC3339Nano) + "|" + c.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// Precedes сообщает, идёт ли сообщение msg строго после курсора.
+func (c ListCursor) Precedes(msg *message.Message) bool {
+	if cmp := c.ScheduledAt.Compare(msg.ScheduledAt); cmp != 0 {
+		return cmp < 0
+	}
+	return c.ID < msg.ID
+}
+
+// ParseListCursor разбирает строку, полученную из Encode.
+func ParseListCursor(s string) (ListCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return ListCursor{}, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+
+	at, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return ListCursor{}, ErrInvalidCursor
+	}
+
+	scheduledAt, err := time.Parse(time.RFC3339Nano, at)
+	if err != nil {
+		return ListCursor{}, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+
+	return ListCursor{ScheduledAt: scheduledAt, ID: id}, nil
+}
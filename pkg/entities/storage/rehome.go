@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// RehomeQuery — какие ожидающие сообщения хранилище передаёт gateway для повторного
+// выбора хранилища.
+type RehomeQuery struct {
+	// MinDelay и MaxDelay — диапазон задержек хранилища по данным координатора;
+	// MaxDelay == 0 — без верхнего ограничения.
+	MinDelay time.Duration
+	MaxDelay time.Duration
+	// All — передать все ожидающие сообщения, например у хранилища, удалённого из кластера.
+	All bool
+}
+
+// Misplaced сообщает, нужно ли передать сообщение, до отправки которого осталось remaining.
+// Наступившие сообщения не передаются: хранилище и так выпускает их в gateway.
+func (q RehomeQuery) Misplaced(remaining time.Duration) bool {
+	if remaining <= 0 {
+		return false
+	}
+	if q.All {
+		return true
+	}
+	return !(&Info{MinDelay: q.MinDelay, MaxDelay: q.MaxDelay}).AcceptsDelay(remaining)
+}
+
+// ScheduleRange — полуинтервал ScheduledAt [From, To); нулевой To — без верхней границы.
+type ScheduleRange struct {
+	From time.Time
+	To   time.Time
+}
+
+// Ranges возвращает интервалы ScheduledAt, в которых на момент now лежат все сообщения,
+// подлежащие передаче. Хранилища с индексом по ScheduledAt просматривают только их
+// и проверяют каждое сообщение через Misplaced.
+func (q RehomeQuery) Ranges(now time.Time) []ScheduleRange {
+	// Наступившие сообщения не передаются.
+	from := now.Add(time.Nanosecond)
+	if q.All {
+		return []ScheduleRange{{From: from}}
+	}
+
+	var ranges []ScheduleRange
+	if q.MinDelay > 0 {
+		ranges = append(ranges, ScheduleRange{From: from, To: now.Add(q.MinDelay)})
+	}
+	if q.MaxDelay > 0 {
+		ranges = append(ranges, ScheduleRange{From: now.Add(q.MaxDelay)})
+	}
+	return ranges
+}
+
+// RehomeResult — итог передачи сообщений gateway.
+type RehomeResult struct {
+	// Scanned — сколько ожидающих сообщений просмотрено.
+	Scanned int
+	// Resubmitted — сколько сообщений передано gateway. Хранилище удаляет их, когда
+	// gateway подтвердит, что выбрал для них другое хранилище.
+	Resubmitted int
+	// Shared — данные общие для всех инстансов хранилища.
+	Shared bool
+}
+
+// Rehomer — необязательная возможность хранилища передать gateway ожидающие сообщения,
+// которые больше не подходят под его диапазон задержек. Инстанс с собственными данными
+// (in-memory, bbolt) при query.All покидает кластер: перестаёт принимать сообщения из шины,
+// а gateway может вернуть его сообщения в то же хранилище — другим инстансам. Инстансы
+// с общими данными (Redis, PostgreSQL, S3) передают только сообщения, которым подходит
+// другое хранилище.
+type Rehomer interface {
+	Rehome(ctx context.Context, query RehomeQuery) (*RehomeResult, error)
+}
@@ -13,6 +13,8 @@ type StorageHealth string
 const (
 	// Хранилище работает нормально.
 	StorageHealthOK StorageHealth = "ok"
+	// Хранилище работает, но близко к лимиту ёмкости.
+	StorageHealthDegraded StorageHealth = "degraded"
 	// Хранилище недоступно.
 	StorageHealthDisconnect StorageHealth = "disconnect"
 	// Произошла ошибка при проверке состояния хранилища.
@@ -27,10 +29,10 @@ type Info struct {
 	// Должен содержать только строчные латинские буквы, цифры и дефис.
 	ID string
 
-	// Addresses — список HTTP-адресов всех инстансов (воркеров) данного типа хранилища.
-	// Каждый инстанс регистрируется со своим адресом; координатор хранит все адреса.
+	// Instances — инстансы (воркеры) данного типа хранилища в порядке регистрации.
+	// Каждый инстанс регистрируется со своим адресом и шлёт свой heartbeat.
 	// Повторная регистрация с уже существующим адресом — идемпотентна.
-	Addresses []string
+	Instances []Instance
 
 	// DelayRange определяет диапазон задержек сообщений, которые хранит это хранилище.
 	// Сообщение направляется в это хранилище если:
@@ -43,6 +45,7 @@ type Info struct {
 	MinDelay time.Duration
 	MaxDelay time.Duration // 0 означает без верхнего ограничения
 
+	// Status, RegisteredAt и LastHeartbeat — сводные данные по инстансам (см. summarize).
 	Status        node.NodeStatus
 	RegisteredAt  time.Time
 	LastHeartbeat time.Time
@@ -60,13 +63,89 @@ func (s *Info) AcceptsDelay(delay time.Duration) bool {
 	return true
 }
 
+// StoreResult — результат сохранения одного сообщения из пачки.
+type StoreResult struct {
+	// ID — идентификатор сохранённого сообщения (сгенерированный, если во входном сообщении он пуст).
+	ID string
+	// Duplicate — сообщение с таким ID и идентичным содержимым уже было сохранено.
+	// Считается успешным сохранением: повторная доставка пачки идемпотентна.
+	Duplicate bool
+	// Err — ошибка сохранения этого сообщения; nil означает успех.
+	Err error
+}
+
+// WithIDs возвращает пачку для сохранения: сообщения без ID заменены копиями
+// со сгенерированным ID. Срез и сообщения вызывающего не изменяются.
+func WithIDs(msgs []*message.Message) []*message.Message {
+	result := make([]*message.Message, len(msgs))
+	for i, msg := range msgs {
+		if msg.ID == "" {
+			copied := *msg
+			copied.ID = message.GenerateID()
+			msg = &copied
+		}
+		result[i] = msg
+	}
+	return result
+}
+
+// MessageStatus — состояние сообщения в хранилище.
+type MessageStatus string
+
+const (
+	// Сообщение ожидает наступления ScheduledAt или повторной выдачи после Reject с requeue.
+	MessageStatusPending MessageStatus = "pending"
+	// Сообщение выдано (FetchReady или выпуском в gateway) и ожидает Acknowledge
+	// или Reject. Без ответа в течение VisibilityTimeout оно выдаётся повторно.
+	MessageStatusInFlight MessageStatus = "in_flight"
+	// Сообщение отклонено без повторной постановки: больше не выдаётся
+	// и хранится до Delete.
+	MessageStatusFailed MessageStatus = "failed"
+)
+
+// StoredMessage — сообщение вместе с его состоянием в хранилище.
+type StoredMessage struct {
+	*message.Message
+
+	Status MessageStatus
+	// Attempts — сколько раз сообщение выдавалось.
+	Attempts int
+	// LastAttemptAt — время последней выдачи; zero value — ещё не выдавалось.
+	LastAttemptAt time.Time
+}
+
 type MessageStorage interface {
 	Initialize(ctx context.Context, config any) error
 
 	// -- Required methods --
-	Store(ctx context.Context, msgs []*message.Message) error
+
+	// Store сохраняет пачку сообщений и возвращает результат для каждого из них
+	// в том же порядке. Ошибка сохранения одного сообщения не прерывает остальные;
+	// error возвращается, только если не удалось обработать пачку целиком.
+	Store(ctx context.Context, msgs []*message.Message) ([]StoreResult, error)
 
 	HealthCheck(ctx context.Context) (StorageHealth, error)
+
+	// -- Lifecycle methods --
+
+	// FetchExpiring возвращает до limit ожидающих сообщений, ScheduledAt которых наступит
+	// в течение threshold, в порядке ScheduledAt. Состояние сообщений не меняется.
+	FetchExpiring(ctx context.Context, threshold time.Duration, limit int) ([]*StoredMessage, error)
+	// FetchReady выдаёт до limit наступивших сообщений в порядке ScheduledAt, включая
+	// не подтверждённые в течение VisibilityTimeout. Выданные сообщения переходят
+	// в InFlight, их Attempts увеличивается.
+	FetchReady(ctx context.Context, limit int) ([]*StoredMessage, error)
+	// Acknowledge удаляет обработанные сообщения. Отсутствующие идентификаторы пропускаются.
+	Acknowledge(ctx context.Context, ids []string) error
+	// Reject возвращает выданное сообщение: с requeue — в Pending для немедленной
+	// повторной выдачи, без него — в Failed. Для сообщения не в InFlight
+	// возвращает ErrNotInFlight.
+	Reject(ctx context.Context, msgID string, requeue bool) error
+	// Delete удаляет сообщение в любом состоянии.
+	Delete(ctx context.Context, msgID string) error
+	// Get возвращает сообщение вместе с его состоянием.
+	Get(ctx context.Context, msgID string) (*StoredMessage, error)
+
 	// -- Optional methods --
 	GetByID(ctx context.Context, msgID string) (*message.Message, error)
 	Count(ctx context.Context) (int64, error)
@@ -19,6 +19,12 @@ type Server interface {
 // Run запускает сервер и блокируется до получения сигнала остановки (SIGINT/SIGTERM).
 // После сигнала выполняет graceful shutdown с указанным таймаутом.
 func Run(server Server, shutdownTimeout time.Duration) {
+	RunWithDrain(server, nil, shutdownTimeout)
+}
+
+// RunWithDrain работает как Run, но после сигнала остановки и до shutdown вызывает
+// drain, если он задан. Сервер продолжает обслуживать запросы, пока drain не вернётся.
+func RunWithDrain(server Server, drain func(), shutdownTimeout time.Duration) {
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 
@@ -29,6 +35,12 @@ func Run(server Server, shutdownTimeout time.Duration) {
 	}()
 
 	<-done
+
+	if drain != nil {
+		log.Printf("Draining...")
+		drain()
+	}
+
 	log.Printf("Shutting down...")
 
 	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
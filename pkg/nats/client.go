@@ -83,11 +83,60 @@ func (c *Client) Publish(subject string, data []byte) error {
 	return nil
 }
 
+// PublishMsg публикует сообщение с заголовками в NATS через JetStream.
+func (c *Client) PublishMsg(msg *nats.Msg) error {
+	_, err := c.js.PublishMsg(msg)
+	if err != nil {
+		return fmt.Errorf("failed to publish to %s: %w", msg.Subject, err)
+	}
+	return nil
+}
+
+// PublishCore публикует сообщение через core NATS, минуя JetStream.
+// Доставка не гарантируется: используйте только для сигналов, потеря которых допустима.
+func (c *Client) PublishCore(subject string, data []byte) error {
+	if err := c.conn.Publish(subject, data); err != nil {
+		return fmt.Errorf("failed to publish to %s: %w", subject, err)
+	}
+	return nil
+}
+
+// SubscribeCore подписывается на subject через core NATS, минуя JetStream.
+func (c *Client) SubscribeCore(subject string, handler nats.MsgHandler) (*nats.Subscription, error) {
+	sub, err := c.conn.Subscribe(subject, handler)
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to %s: %w", subject, err)
+	}
+
+	logger.Log.Info("Subject subscribed", zap.String("subject", subject), zap.String("client", c.conn.Opts.Name))
+	return sub, nil
+}
+
 func (c *Client) Subscribe(subject string, handler nats.MsgHandler) (*nats.Subscription, error) {
 	logger.Log.Info("Subject subscribed", zap.String("subject", subject), zap.String("client", c.conn.Opts.Name))
 	return c.js.Subscribe(subject, handler)
 }
 
+// QueueSubscribe подписывается на subject через durable JetStream consumer
+// с группой доставки queue. Все подписчики с одинаковым queue делят один
+// consumer, поэтому каждое сообщение получает ровно один из них.
+func (c *Client) QueueSubscribe(subject, queue string, handler nats.MsgHandler, opts ...nats.SubOpt) (*nats.Subscription, error) {
+	opts = append([]nats.SubOpt{nats.Durable(queue)}, opts...)
+
+	sub, err := c.js.QueueSubscribe(subject, queue, handler, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to %s (queue %s): %w", subject, queue, err)
+	}
+
+	logger.Log.Info("Subject subscribed",
+		zap.String("subject", subject),
+		zap.String("queue", queue),
+		zap.String("client", c.conn.Opts.Name),
+	)
+
+	return sub, nil
+}
+
 // Close закрывает соединение с NATS.
 func (c *Client) Close() {
 	if c.conn != nil {
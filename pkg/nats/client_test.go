@@ -0,0 +1,97 @@
+package natsclient
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+// runServer запускает встроенный NATS сервер с JetStream и подключает к нему клиента.
+func runServer(t *testing.T) *Client {
+	t.Helper()
+
+	srv, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Start()
+	t.Cleanup(srv.Shutdown)
+
+	if !srv.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server is not ready")
+	}
+
+	c, err := New(Config{URL: srv.ClientURL(), Name: t.Name()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+
+	return c
+}
+
+func TestQueueSubscribeDeliversEachMessageOnce(t *testing.T) {
+	c := runServer(t)
+
+	if _, err := c.JetStream().AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"test.>"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	const total = 50
+
+	var (
+		mu       sync.Mutex
+		received = make(map[string]int)
+		done     = make(chan struct{})
+	)
+	handler := func(msg *nats.Msg) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		received[string(msg.Data)]++
+		if len(received) == total {
+			close(done)
+		}
+	}
+
+	// Два инстанса с одним ID делят durable consumer.
+	for range 2 {
+		if _, err := c.QueueSubscribe("test.storage", "storage", handler); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := range total {
+		if err := c.Publish("test.storage", fmt.Appendf(nil, "%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("not all messages delivered")
+	}
+
+	// Даём время прийти лишним доставкам, если consumer не общий.
+	time.Sleep(100 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	for data, n := range received {
+		if n != 1 {
+			t.Fatalf("message %s delivered %d times", data, n)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package natsclient
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/logger"
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+)
+
+// ErrRetentionMismatch возвращается, если существующий stream создан с другой политикой
+// хранения: JetStream не меняет её у существующего stream.
+var ErrRetentionMismatch = errors.New("stream retention cannot be changed")
+
+// StreamsConfig общие параметры streams, создаваемых при старте компонентов.
+type StreamsConfig struct {
+	// Retention политика хранения: "limits", "interest" или "workqueue".
+	Retention string
+	// Replicas количество реплик stream в кластере NATS.
+	Replicas int
+	// MaxAge максимальный возраст сообщения в stream (0 — без ограничения).
+	MaxAge time.Duration
+	// MaxBytes максимальный размер stream в байтах (-1 — без ограничения).
+	MaxBytes int64
+}
+
+// Stream описывает stream, который должен существовать в JetStream.
+type Stream struct {
+	Name     string
+	Subjects []string
+}
+
+// ParseRetention преобразует строковое имя политики хранения в nats.RetentionPolicy.
+// Пустая строка трактуется как "workqueue".
+func ParseRetention(s string) (nats.RetentionPolicy, error) {
+	switch s {
+	case "", "workqueue":
+		return nats.WorkQueuePolicy, nil
+	case "limits":
+		return nats.LimitsPolicy, nil
+	case "interest":
+		return nats.InterestPolicy, nil
+	default:
+		return 0, fmt.Errorf("unknown stream retention %q", s)
+	}
+}
+
+// retentionName возвращает имя политики хранения в том виде, в котором её принимает ParseRetention.
+func retentionName(p nats.RetentionPolicy) string {
+	switch p {
+	case nats.LimitsPolicy:
+		return "limits"
+	case nats.InterestPolicy:
+		return "interest"
+	case nats.WorkQueuePolicy:
+		return "workqueue"
+	default:
+		return p.String()
+	}
+}
+
+// EnsureStreams создаёт streams или приводит конфигурацию существующих к cfg.
+// Безопасно вызывать при каждом старте компонента. Политику хранения существующего
+// stream JetStream не меняет: при расхождении возвращается ErrRetentionMismatch.
+func (c *Client) EnsureStreams(cfg StreamsConfig, streams ...Stream) error {
+	retention, err := ParseRetention(cfg.Retention)
+	if err != nil {
+		return err
+	}
+
+	replicas := cfg.Replicas
+	if replicas <= 0 {
+		replicas = 1
+	}
+
+	maxBytes := cfg.MaxBytes
+	if maxBytes == 0 {
+		maxBytes = -1
+	}
+
+	for _, stream := range streams {
+		streamCfg := &nats.StreamConfig{
+			Name:      stream.Name,
+			Subjects:  stream.Subjects,
+			Retention: retention,
+			Replicas:  replicas,
+			MaxAge:    cfg.MaxAge,
+			MaxBytes:  maxBytes,
+			Storage:   nats.FileStorage,
+		}
+
+		if err := c.ensureStream(streamCfg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) ensureStream(cfg *nats.StreamConfig) error {
+	info, err := c.js.StreamInfo(cfg.Name)
+	switch {
+	case errors.Is(err, nats.ErrStreamNotFound):
+		if _, err := c.js.AddStream(cfg); err != nil {
+			return fmt.Errorf("failed to create stream %s: %w", cfg.Name, err)
+		}
+		logger.Log.Info("Stream created", zap.String("stream", cfg.Name), zap.Strings("subjects", cfg.Subjects))
+	case err != nil:
+		return fmt.Errorf("failed to get stream %s info: %w", cfg.Name, err)
+	case info.Config.Retention != cfg.Retention:
+		return fmt.Errorf(
+			"%w: stream %s has retention %s, configured %s; keep NATS_STREAM_RETENTION=%s "+
+				"or migrate manually: stop all components, drain the stream and delete it "+
+				"(nats stream rm %s), then start them to recreate it",
+			ErrRetentionMismatch, cfg.Name, retentionName(info.Config.Retention), retentionName(cfg.Retention),
+			retentionName(info.Config.Retention), cfg.Name,
+		)
+	default:
+		if _, err := c.js.UpdateStream(cfg); err != nil {
+			return fmt.Errorf("failed to update stream %s: %w", cfg.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// EnsureConsumer создаёт durable consumer в stream или обновляет существующий.
+// Безопасно вызывать из каждого инстанса, разделяющего consumer.
+func (c *Client) EnsureConsumer(stream string, cfg *nats.ConsumerConfig) error {
+	_, err := c.js.ConsumerInfo(stream, cfg.Durable)
+	switch {
+	case errors.Is(err, nats.ErrConsumerNotFound):
+		if _, err := c.js.AddConsumer(stream, cfg); err != nil {
+			return fmt.Errorf("failed to create consumer %s in %s: %w", cfg.Durable, stream, err)
+		}
+		logger.Log.Info("Consumer created", zap.String("stream", stream), zap.String("consumer", cfg.Durable))
+	case err != nil:
+		return fmt.Errorf("failed to get consumer %s info: %w", cfg.Durable, err)
+	default:
+		if _, err := c.js.UpdateConsumer(stream, cfg); err != nil {
+			return fmt.Errorf("failed to update consumer %s in %s: %w", cfg.Durable, stream, err)
+		}
+	}
+
+	return nil
+}
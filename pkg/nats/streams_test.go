@@ -0,0 +1,129 @@
+package natsclient
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestEnsureStreamsAppliesConfig(t *testing.T) {
+	c := runServer(t)
+
+	cfg := StreamsConfig{Retention: "interest", Replicas: 1, MaxAge: time.Hour}
+	streams := []Stream{
+		{Name: "ORBITAL_STORAGE", Subjects: []string{"orbital.storage.>"}},
+		{Name: "ORBITAL_GATEWAY", Subjects: []string{"orbital.gateway"}},
+	}
+
+	if err := c.EnsureStreams(cfg, streams...); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, stream := range streams {
+		info, err := c.JetStream().StreamInfo(stream.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Config.Retention != nats.InterestPolicy ||
+			!slices.Equal(info.Config.Subjects, stream.Subjects) ||
+			info.Config.MaxAge != time.Hour ||
+			info.Config.MaxBytes != -1 ||
+			info.Config.Storage != nats.FileStorage {
+			t.Fatalf("unexpected stream %s config %+v", stream.Name, info.Config)
+		}
+	}
+
+	// Повторный вызов приводит существующие streams к новой конфигурации.
+	cfg.MaxAge = 2 * time.Hour
+	cfg.MaxBytes = 1 << 20
+	if err := c.EnsureStreams(cfg, streams...); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := c.JetStream().StreamInfo("ORBITAL_STORAGE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Config.MaxAge != 2*time.Hour || info.Config.MaxBytes != 1<<20 {
+		t.Fatalf("stream config not updated: %+v", info.Config)
+	}
+}
+
+func TestEnsureStreamsDefaultsToWorkQueue(t *testing.T) {
+	c := runServer(t)
+
+	if err := c.EnsureStreams(StreamsConfig{}, Stream{Name: "ORBITAL_PUSH", Subjects: []string{"orbital.push.>"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := c.JetStream().StreamInfo("ORBITAL_PUSH")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Config.Retention != nats.WorkQueuePolicy || info.Config.Replicas != 1 {
+		t.Fatalf("unexpected stream config %+v", info.Config)
+	}
+}
+
+func TestEnsureStreamsRejectsUnknownRetention(t *testing.T) {
+	c := runServer(t)
+
+	if err := c.EnsureStreams(StreamsConfig{Retention: "forever"}, Stream{Name: "S", Subjects: []string{"s"}}); err == nil {
+		t.Fatal("expected error for unknown retention")
+	}
+}
+
+func TestEnsureConsumerIsIdempotent(t *testing.T) {
+	c := runServer(t)
+
+	if err := c.EnsureStreams(StreamsConfig{}, Stream{Name: "ORBITAL_STORAGE", Subjects: []string{"orbital.storage.>"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &nats.ConsumerConfig{
+		Durable:        "hot",
+		FilterSubject:  "orbital.storage.hot",
+		DeliverSubject: "orbital.deliver.storage.hot",
+		DeliverGroup:   "hot",
+		AckPolicy:      nats.AckExplicitPolicy,
+	}
+	for range 2 {
+		if err := c.EnsureConsumer("ORBITAL_STORAGE", cfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	info, err := c.JetStream().ConsumerInfo("ORBITAL_STORAGE", "hot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Config.FilterSubject != cfg.FilterSubject || info.Config.DeliverGroup != cfg.DeliverGroup {
+		t.Fatalf("unexpected consumer config %+v", info.Config)
+	}
+}
+
+func TestEnsureStreamsRejectsRetentionChange(t *testing.T) {
+	c := runServer(t)
+	stream := Stream{Name: "ORBITAL_STORAGE", Subjects: []string{"orbital.storage.>"}}
+
+	if err := c.EnsureStreams(StreamsConfig{Retention: "workqueue"}, stream); err != nil {
+		t.Fatal(err)
+	}
+
+	err := c.EnsureStreams(StreamsConfig{Retention: "interest"}, stream)
+	if !errors.Is(err, ErrRetentionMismatch) || !strings.Contains(err.Error(), "ORBITAL_STORAGE") {
+		t.Fatalf("expected ErrRetentionMismatch naming the stream, got %v", err)
+	}
+
+	info, err := c.JetStream().StreamInfo(stream.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Config.Retention != nats.WorkQueuePolicy {
+		t.Fatalf("stream retention changed to %v", info.Config.Retention)
+	}
+}
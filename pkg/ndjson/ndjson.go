@@ -0,0 +1,222 @@
+// Package ndjson читает и пишет потоки сообщений в формате NDJSON: по одному
+// JSON-объекту message.Message на строку. Формат используется для экспорта
+// и импорта сообщений хранилищ и gateway; ID и ScheduledAt сохраняются как есть.
+package ndjson
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+)
+
+// ContentType — MIME-тип потока сообщений.
+const ContentType = "application/x-ndjson"
+
+// MaxLineSize — наибольший размер одной строки потока в байтах.
+const MaxLineSize = 16 << 20
+
+// maxImportErrors — сколько ошибок отдельных сообщений попадает в ImportResult.
+const maxImportErrors = 100
+
+// Encoder пишет сообщения в поток.
+type Encoder struct {
+	enc *json.Encoder
+}
+
+// NewEncoder создаёт Encoder, пишущий в w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{enc: json.NewEncoder(w)}
+}
+
+// Encode записывает сообщение отдельной строкой.
+func (e *Encoder) Encode(msg *message.Message) error {
+	return e.enc.Encode(msg)
+}
+
+// Decoder читает сообщения из потока. Пустые строки пропускаются.
+type Decoder struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+// NewDecoder создаёт Decoder, читающий из r.
+func NewDecoder(r io.Reader) *Decoder {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), MaxLineSize)
+	return &Decoder{scanner: scanner}
+}
+
+// Line возвращает номер последней прочитанной строки, начиная с 1.
+func (d *Decoder) Line() int {
+	return d.line
+}
+
+// Next читает следующее сообщение; в конце потока возвращает io.EOF.
+// Ошибка разбора строки оборачивается в *LineError, и чтение можно продолжить;
+// прочие ошибки означают, что поток прочитать нельзя.
+func (d *Decoder) Next() (*message.Message, error) {
+	for d.scanner.Scan() {
+		d.line++
+
+		raw := bytes.TrimSpace(d.scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+
+		var msg message.Message
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			return nil, &LineError{Line: d.line, Err: err}
+		}
+		return &msg, nil
+	}
+
+	if err := d.scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read line %d: %w", d.line+1, err)
+	}
+	return nil, io.EOF
+}
+
+// LineError — строка потока не является сообщением.
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// ImportError — сообщение, которое не удалось импортировать.
+type ImportError struct {
+	Line  int    `json:"line"`
+	ID    string `json:"id,omitempty"`
+	Error string `json:"error"`
+}
+
+// ImportResult — итог импорта потока.
+type ImportResult struct {
+	// Imported — сколько сообщений сохранено, включая дубликаты.
+	Imported int `json:"imported"`
+	// Duplicates — сколько сообщений уже были сохранены с тем же содержимым.
+	Duplicates int `json:"duplicates"`
+	// Failed — сколько строк не удалось разобрать или сохранить.
+	Failed int `json:"failed"`
+	// Errors — первые ошибки отдельных строк.
+	Errors []ImportError `json:"errors,omitempty"`
+}
+
+func (r *ImportResult) fail(line int, id string, err error) {
+	r.Failed++
+	if len(r.Errors) < maxImportErrors {
+		r.Errors = append(r.Errors, ImportError{Line: line, ID: id, Error: err.Error()})
+	}
+}
+
+// StoreFunc сохраняет пачку сообщений и возвращает результат для каждого из них.
+type StoreFunc func(msgs []*message.Message) ([]storage.StoreResult, error)
+
+// Import читает поток из r и сохраняет сообщения пачками по batchSize через store.
+// Ошибки отдельных строк и сообщений собираются в ImportResult; error возвращается,
+// если поток прочитать нельзя или store не обработал пачку целиком. В этом случае
+// ImportResult содержит итог по уже обработанным строкам.
+func Import(r io.Reader, batchSize int, store StoreFunc) (*ImportResult, error) {
+	result := &ImportResult{}
+	dec := NewDecoder(r)
+
+	// Ошибки разбора копятся сразу, ошибки сохранения — при записи пачки.
+	defer func() {
+		slices.SortFunc(result.Errors, func(a, b ImportError) int { return a.Line - b.Line })
+	}()
+
+	batch := make([]*message.Message, 0, batchSize)
+	lines := make([]int, 0, batchSize)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		results, err := store(batch)
+		if err != nil {
+			return err
+		}
+		for i, res := range results {
+			switch {
+			case res.Err != nil:
+				result.fail(lines[i], batch[i].ID, res.Err)
+			case res.Duplicate:
+				result.Imported++
+				result.Duplicates++
+			default:
+				result.Imported++
+			}
+		}
+
+		batch, lines = batch[:0], lines[:0]
+		return nil
+	}
+
+	for {
+		msg, err := dec.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		var lineErr *LineError
+		if errors.As(err, &lineErr) {
+			result.fail(lineErr.Line, "", lineErr.Err)
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+
+		batch = append(batch, msg)
+		lines = append(lines, dec.Line())
+		if len(batch) == batchSize {
+			if err := flush(); err != nil {
+				return result, err
+			}
+		}
+	}
+
+	return result, flush()
+}
+
+// RequestBody возвращает тело запроса, распаковывая его при Content-Encoding: gzip.
+func RequestBody(r *http.Request) (io.ReadCloser, error) {
+	if !strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip") {
+		return r.Body, nil
+	}
+
+	gz, err := gzip.NewReader(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gzip body: %w", err)
+	}
+	return gz, nil
+}
+
+// AcceptsGzip сообщает, принимает ли клиент ответ, сжатый gzip.
+func AcceptsGzip(r *http.Request) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, _, _ := strings.Cut(strings.TrimSpace(enc), ";")
+		if strings.EqualFold(name, "gzip") {
+			return true
+		}
+	}
+	return false
+}
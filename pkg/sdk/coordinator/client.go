@@ -2,10 +2,13 @@
 package coordinator
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"time"
 
 	coordinatorapi "github.com/Alexey-zaliznuak/orbital/pkg/coordinator/api"
@@ -17,6 +20,10 @@ import (
 
 const apiPrefix = "/api/v1"
 
+// ErrStorageNotRegistered возвращается из StorageHeartbeat и UnregisterStorageAddress,
+// если координатор не знает storage.
+var ErrStorageNotRegistered = errors.New("storage is not registered")
+
 // Client HTTP клиент для взаимодействия с координатором.
 type Client struct {
 	baseURL    string
@@ -78,6 +85,95 @@ func (c *Client) ListStorages(ctx context.Context) ([]*storage.Info, error) {
 	return storages, nil
 }
 
+// RegisterStorage регистрирует инстанс storage в координаторе.
+// Повторная регистрация с тем же адресом идемпотентна.
+func (c *Client) RegisterStorage(ctx context.Context, registration coordinatorapi.RegisterStorageRequest) error {
+	body, err := json.Marshal(registration)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+apiPrefix+"/storages", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to register storage: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// StorageHeartbeat отправляет heartbeat инстанса storage hb.Address с его текущим
+// статусом (Active или Degraded) и нагрузкой. Если координатор не знает
+// storage или инстанс, возвращает ErrStorageNotRegistered.
+func (c *Client) StorageHeartbeat(ctx context.Context, storageID string, hb storage.Heartbeat) error {
+	body, err := json.Marshal(coordinatorapi.StorageHeartbeatRequest{
+		Address:     hb.Address,
+		Status:      hb.Status.String(),
+		Capacity:    hb.Capacity,
+		StorageLoad: coordinatorapi.LoadToResponse(hb.Load),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.baseURL+apiPrefix+"/storages/"+storageID+"/heartbeat", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send heartbeat: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrStorageNotRegistered
+	}
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// UnregisterStorageAddress удаляет адрес инстанса storage из координатора.
+// Если координатор не знает storage, возвращает ErrStorageNotRegistered.
+func (c *Client) UnregisterStorageAddress(ctx context.Context, storageID, address string) error {
+	target := c.baseURL + apiPrefix + "/storages/" + storageID + "/addresses?" + url.Values{"address": {address}}.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, target, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to unregister storage address: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrStorageNotRegistered
+	}
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
 // === Cluster Config ===
 
 // GetClusterConfig получает конфигурацию кластера от координатора.
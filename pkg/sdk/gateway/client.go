@@ -6,10 +6,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"time"
 
 	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+	"github.com/Alexey-zaliznuak/orbital/pkg/ndjson"
 	gatewayapi "github.com/Alexey-zaliznuak/orbital/pkg/sdk/gateway/api"
 )
 
@@ -19,6 +21,9 @@ const apiPrefix = "/api/v1"
 type Client struct {
 	baseURL    string
 	httpClient *http.Client
+	// streamClient передаёт потоки импорта: их длительность ограничивается
+	// только контекстом запроса.
+	streamClient *http.Client
 }
 
 // ClientConfig конфигурация клиента gateway.
@@ -39,6 +44,7 @@ func NewClient(cfg ClientConfig) *Client {
 		httpClient: &http.Client{
 			Timeout: timeout,
 		},
+		streamClient: &http.Client{},
 	}
 }
 
@@ -103,6 +109,34 @@ func (c *Client) Send(ctx context.Context, msg *message.Message) (*message.Messa
 	return newMessageResponseToMessage(result), nil
 }
 
+// Import направляет сообщения из потока NDJSON body через gateway: каждое сообщение
+// попадает в хранилище по оставшейся задержке или сразу в пушер, как при Send.
+// ID и ScheduledAt сообщений сохраняются.
+func (c *Client) Import(ctx context.Context, body io.Reader) (*ndjson.ImportResult, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url("/messages/import"), body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", ndjson.ContentType)
+
+	resp, err := c.streamClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to import messages: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.decodeError(resp)
+	}
+
+	var result ndjson.ImportResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &result, nil
+}
+
 // url формирует полный URL для эндпоинта.
 func (c *Client) url(path string) string {
 	return c.baseURL + apiPrefix + path
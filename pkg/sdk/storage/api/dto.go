@@ -1,9 +1,11 @@
 package storageapi
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
 )
 
 // ErrorResponse стандартный ответ при ошибке.
@@ -59,3 +61,241 @@ func MessageResponseFromMessage(m *message.Message) MessageResponse {
 type CountResponse struct {
 	Count int64 `json:"count"`
 }
+
+// ToMessage преобразует ответ в доменную модель Message.
+func (r MessageResponse) ToMessage() *message.Message {
+	return message.NewMessage(
+		message.WithID(r.ID),
+		message.WithRoutingKey(r.RoutingKey),
+		message.WithRoutingSettings(r.RoutingSettings),
+		message.WithPayload(r.Payload),
+		message.WithMetadata(r.Metadata),
+		message.WithCreatedAt(r.CreatedAt),
+		message.WithScheduledAt(r.ScheduledAt),
+	)
+}
+
+// StoredMessageResponse представляет сообщение вместе с его состоянием в хранилище.
+type StoredMessageResponse struct {
+	MessageResponse
+	Status        string    `json:"status" example:"pending" enums:"pending,in_flight,failed"`
+	Attempts      int       `json:"attempts"`
+	LastAttemptAt time.Time `json:"last_attempt_at,omitempty"`
+}
+
+// StoredMessageResponseFromStored создаёт ответ из StoredMessage.
+func StoredMessageResponseFromStored(m *storage.StoredMessage) StoredMessageResponse {
+	return StoredMessageResponse{
+		MessageResponse: MessageResponseFromMessage(m.Message),
+		Status:          string(m.Status),
+		Attempts:        m.Attempts,
+		LastAttemptAt:   m.LastAttemptAt,
+	}
+}
+
+// ToStoredMessage преобразует ответ в StoredMessage.
+func (r StoredMessageResponse) ToStoredMessage() *storage.StoredMessage {
+	return &storage.StoredMessage{
+		Message:       r.MessageResponse.ToMessage(),
+		Status:        storage.MessageStatus(r.Status),
+		Attempts:      r.Attempts,
+		LastAttemptAt: r.LastAttemptAt,
+	}
+}
+
+// FetchMessagesResponse ответ со списком выданных или истекающих сообщений.
+type FetchMessagesResponse struct {
+	Messages []StoredMessageResponse `json:"messages"`
+}
+
+// FetchMessagesResponseFromStored создаёт ответ из списка StoredMessage.
+func FetchMessagesResponseFromStored(msgs []*storage.StoredMessage) FetchMessagesResponse {
+	result := FetchMessagesResponse{Messages: make([]StoredMessageResponse, len(msgs))}
+	for i, m := range msgs {
+		result.Messages[i] = StoredMessageResponseFromStored(m)
+	}
+	return result
+}
+
+// AcknowledgeRequest запрос на подтверждение обработки сообщений.
+type AcknowledgeRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// RejectRequest запрос на отклонение выданного сообщения.
+type RejectRequest struct {
+	// Requeue — вернуть сообщение в ожидание; иначе оно переводится в failed.
+	Requeue bool `json:"requeue"`
+}
+
+// ListMessagesResponse страница сообщений в порядке (scheduled_at, id).
+type ListMessagesResponse struct {
+	Messages []StoredMessageResponse `json:"messages"`
+	// NextCursor передаётся в параметре cursor для получения следующей страницы;
+	// отсутствует на последней странице.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// ListMessagesResponseFromPage создаёт ответ из страницы ListPage.
+func ListMessagesResponseFromPage(page *storage.ListPage) ListMessagesResponse {
+	return ListMessagesResponse{
+		Messages:   FetchMessagesResponseFromStored(page.Messages).Messages,
+		NextCursor: page.NextCursor,
+	}
+}
+
+// HistogramBucketResponse — число ожидающих сообщений в интервале [start, start+bucket).
+type HistogramBucketResponse struct {
+	Start  time.Time        `json:"start"`
+	Count  int64            `json:"count"`
+	Groups map[string]int64 `json:"groups,omitempty"`
+}
+
+// HistogramResponse гистограмма ожидающих сообщений по scheduled_at.
+type HistogramResponse struct {
+	From       time.Time                 `json:"from"`
+	Bucket     string                    `json:"bucket"` // e.g. "15m"
+	GroupDepth int                       `json:"group_depth,omitempty"`
+	Buckets    []HistogramBucketResponse `json:"buckets"`
+	// Truncated — учтены не все сообщения горизонта.
+	Truncated bool `json:"truncated,omitempty"`
+	// Shared — данные общие для всех инстансов хранилища.
+	Shared bool `json:"shared,omitempty"`
+}
+
+// HistogramResponseFromHistogram создаёт ответ из гистограммы.
+func HistogramResponseFromHistogram(h *storage.Histogram) HistogramResponse {
+	buckets := make([]HistogramBucketResponse, len(h.Buckets))
+	for i, b := range h.Buckets {
+		buckets[i] = HistogramBucketResponse{Start: b.Start, Count: b.Count, Groups: b.Groups}
+	}
+
+	return HistogramResponse{
+		From:       h.From,
+		Bucket:     h.Bucket.String(),
+		GroupDepth: h.GroupDepth,
+		Buckets:    buckets,
+		Truncated:  h.Truncated,
+		Shared:     h.Shared,
+	}
+}
+
+// ToHistogram преобразует ответ в доменную модель.
+func (r HistogramResponse) ToHistogram() (*storage.Histogram, error) {
+	bucket, err := time.ParseDuration(r.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &storage.Histogram{
+		From:       r.From,
+		Bucket:     bucket,
+		GroupDepth: r.GroupDepth,
+		Buckets:    make([]storage.HistogramBucket, len(r.Buckets)),
+		Truncated:  r.Truncated,
+		Shared:     r.Shared,
+	}
+	for i, b := range r.Buckets {
+		h.Buckets[i] = storage.HistogramBucket{Start: b.Start, Count: b.Count, Groups: b.Groups}
+	}
+
+	return h, nil
+}
+
+// DrainStatusResponse ход вывода инстанса хранилища из кластера.
+type DrainStatusResponse struct {
+	State       string    `json:"state" example:"draining" enums:"idle,draining,done,failed"`
+	Target      string    `json:"target,omitempty"`
+	StartedAt   time.Time `json:"started_at,omitempty"`
+	FinishedAt  time.Time `json:"finished_at,omitempty"`
+	Pending     int       `json:"pending"`
+	InFlight    int       `json:"in_flight"`
+	Republished int       `json:"republished"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// DrainStatusResponseFromStatus создаёт ответ из хода вывода.
+func DrainStatusResponseFromStatus(status storage.DrainStatus) DrainStatusResponse {
+	return DrainStatusResponse{
+		State:       string(status.State),
+		Target:      status.Target,
+		StartedAt:   status.StartedAt,
+		FinishedAt:  status.FinishedAt,
+		Pending:     status.Pending,
+		InFlight:    status.InFlight,
+		Republished: status.Republished,
+		Error:       status.Error,
+	}
+}
+
+// ToDrainStatus преобразует ответ в доменную модель.
+func (r DrainStatusResponse) ToDrainStatus() storage.DrainStatus {
+	return storage.DrainStatus{
+		State:       storage.DrainState(r.State),
+		Target:      r.Target,
+		StartedAt:   r.StartedAt,
+		FinishedAt:  r.FinishedAt,
+		Pending:     r.Pending,
+		InFlight:    r.InFlight,
+		Republished: r.Republished,
+		Error:       r.Error,
+	}
+}
+
+// RehomeRequest запрос на передачу gateway сообщений вне диапазона задержек.
+type RehomeRequest struct {
+	MinDelay string `json:"min_delay" example:"1m"` // e.g. "0s", "1m", "1h"
+	MaxDelay string `json:"max_delay" example:"1h"` // e.g. "1h", "0" (unlimited)
+	// All — передать все ожидающие сообщения независимо от диапазона.
+	All bool `json:"all,omitempty"`
+}
+
+// RehomeRequestFromQuery создаёт запрос из RehomeQuery.
+func RehomeRequestFromQuery(q storage.RehomeQuery) RehomeRequest {
+	return RehomeRequest{MinDelay: q.MinDelay.String(), MaxDelay: q.MaxDelay.String(), All: q.All}
+}
+
+// ToQuery преобразует запрос в RehomeQuery. Пустые задержки считаются нулевыми.
+func (r RehomeRequest) ToQuery() (storage.RehomeQuery, error) {
+	minDelay, err := parseDelay("min_delay", r.MinDelay)
+	if err != nil {
+		return storage.RehomeQuery{}, err
+	}
+
+	maxDelay, err := parseDelay("max_delay", r.MaxDelay)
+	if err != nil {
+		return storage.RehomeQuery{}, err
+	}
+
+	return storage.RehomeQuery{MinDelay: minDelay, MaxDelay: maxDelay, All: r.All}, nil
+}
+
+// parseDelay разбирает неотрицательную задержку параметра name; "" и "0" — нулевая задержка.
+func parseDelay(name, raw string) (time.Duration, error) {
+	if raw == "" || raw == "0" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(raw)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid %s: %q", name, raw)
+	}
+	return d, nil
+}
+
+// RehomeResponse итог передачи сообщений gateway.
+type RehomeResponse struct {
+	Scanned     int  `json:"scanned"`
+	Resubmitted int  `json:"resubmitted"`
+	Shared      bool `json:"shared,omitempty"`
+}
+
+// RehomeResponseFromResult создаёт ответ из RehomeResult.
+func RehomeResponseFromResult(r *storage.RehomeResult) RehomeResponse {
+	return RehomeResponse{Scanned: r.Scanned, Resubmitted: r.Resubmitted, Shared: r.Shared}
+}
+
+// ToResult преобразует ответ в доменную модель.
+func (r RehomeResponse) ToResult() *storage.RehomeResult {
+	return &storage.RehomeResult{Scanned: r.Scanned, Resubmitted: r.Resubmitted, Shared: r.Shared}
+}
@@ -0,0 +1,63 @@
+package storageapi
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+)
+
+// Параметры гистограммы по умолчанию: сутки интервалами по 15 минут.
+const (
+	DefaultHistogramBucket  = 15 * time.Minute
+	DefaultHistogramHorizon = 24 * time.Hour
+)
+
+// ParseHistogramQuery читает параметры гистограммы bucket, horizon, group_depth и from
+// из query-строки. Одни и те же параметры принимают хранилища и координатор.
+func ParseHistogramQuery(values url.Values) (storage.HistogramQuery, error) {
+	query := storage.HistogramQuery{
+		Bucket:  DefaultHistogramBucket,
+		Horizon: DefaultHistogramHorizon,
+	}
+
+	var err error
+	if raw := values.Get("bucket"); raw != "" {
+		if query.Bucket, err = time.ParseDuration(raw); err != nil {
+			return query, fmt.Errorf("invalid bucket: %w", err)
+		}
+	}
+	if raw := values.Get("horizon"); raw != "" {
+		if query.Horizon, err = time.ParseDuration(raw); err != nil {
+			return query, fmt.Errorf("invalid horizon: %w", err)
+		}
+	}
+	if raw := values.Get("group_depth"); raw != "" {
+		if query.GroupDepth, err = strconv.Atoi(raw); err != nil {
+			return query, fmt.Errorf("invalid group_depth: %w", err)
+		}
+	}
+	if raw := values.Get("from"); raw != "" {
+		if query.From, err = time.Parse(time.RFC3339Nano, raw); err != nil {
+			return query, fmt.Errorf("invalid from: %w", err)
+		}
+	}
+
+	return query, query.Validate()
+}
+
+// HistogramQueryValues кодирует параметры гистограммы в query-строку.
+func HistogramQueryValues(query storage.HistogramQuery) url.Values {
+	values := url.Values{}
+	values.Set("bucket", query.Bucket.String())
+	values.Set("horizon", query.Horizon.String())
+	if query.GroupDepth > 0 {
+		values.Set("group_depth", strconv.Itoa(query.GroupDepth))
+	}
+	if !query.From.IsZero() {
+		values.Set("from", query.From.Format(time.RFC3339Nano))
+	}
+	return values
+}
@@ -6,10 +6,15 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/Alexey-zaliznuak/orbital/pkg/entities/message"
+	storageentity "github.com/Alexey-zaliznuak/orbital/pkg/entities/storage"
+	"github.com/Alexey-zaliznuak/orbital/pkg/ndjson"
 	storageapi "github.com/Alexey-zaliznuak/orbital/pkg/sdk/storage/api"
 )
 
@@ -19,6 +24,9 @@ const apiPrefix = "/api/v1"
 type Client struct {
 	baseURL    string
 	httpClient *http.Client
+	// streamClient передаёт потоки экспорта и импорта: их длительность
+	// ограничивается только контекстом запроса.
+	streamClient *http.Client
 }
 
 // ClientConfig конфигурация клиента storage.
@@ -39,6 +47,7 @@ func NewClient(cfg ClientConfig) *Client {
 		httpClient: &http.Client{
 			Timeout: timeout,
 		},
+		streamClient: &http.Client{},
 	}
 }
 
@@ -101,69 +110,295 @@ func (c *Client) Store(ctx context.Context, msg *message.Message) (*message.Mess
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	return messageResponseToMessage(result), nil
+	return result.ToMessage(), nil
 }
 
-// FetchReady возвращает до limit готовых к доставке сообщений.
-// func (c *Client) FetchReady(ctx context.Context, limit int) ([]*message.Message, error) {
-// 	url := c.url("/messages/ready")
-// 	if limit > 0 {
-// 		url += "?limit=" + strconv.Itoa(limit)
-// 	}
+// FetchReady выдаёт до limit наступивших сообщений; limit <= 0 — значение сервера по умолчанию.
+// Выданные сообщения нужно подтвердить через Acknowledge или отклонить через Reject.
+func (c *Client) FetchReady(ctx context.Context, limit int) ([]*storageentity.StoredMessage, error) {
+	query := url.Values{}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
 
-// 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-// 	if err != nil {
-// 		return nil, fmt.Errorf("failed to create request: %w", err)
-// 	}
+	return c.fetch(ctx, "/messages/ready", query)
+}
 
-// 	resp, err := c.httpClient.Do(req)
-// 	if err != nil {
-// 		return nil, fmt.Errorf("failed to fetch ready messages: %w", err)
-// 	}
-// 	defer resp.Body.Close()
+// FetchExpiring возвращает до limit ожидающих сообщений, наступающих в пределах threshold.
+func (c *Client) FetchExpiring(ctx context.Context, threshold time.Duration, limit int) ([]*storageentity.StoredMessage, error) {
+	query := url.Values{}
+	query.Set("threshold", threshold.String())
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
 
-// 	if resp.StatusCode != http.StatusOK {
-// 		return nil, c.decodeError(resp)
-// 	}
+	return c.fetch(ctx, "/messages/expiring", query)
+}
 
-// 	var result storageapi.FetchReadyResponse
-// 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-// 		return nil, fmt.Errorf("failed to decode response: %w", err)
-// 	}
+// List возвращает страницу сообщений в порядке (ScheduledAt, ID), подходящих под фильтр.
+// Для следующей страницы передайте ListPage.NextCursor в ListQuery.Cursor;
+// пустой NextCursor означает последнюю страницу.
+func (c *Client) List(ctx context.Context, q storageentity.ListQuery) (*storageentity.ListPage, error) {
+	query := listFilterValues(q.Filter)
+	if q.Cursor != "" {
+		query.Set("cursor", q.Cursor)
+	}
+	if q.Limit > 0 {
+		query.Set("limit", strconv.Itoa(q.Limit))
+	}
 
-// 	messages := make([]*message.Message, len(result.Messages))
-// 	for i, m := range result.Messages {
-// 		messages[i] = messageResponseToMessage(m)
-// 	}
+	var result storageapi.ListMessagesResponse
+	if err := c.getJSON(ctx, "/messages", query, &result); err != nil {
+		return nil, err
+	}
 
-// 	return messages, nil
-// }
+	page := &storageentity.ListPage{
+		Messages:   make([]*storageentity.StoredMessage, len(result.Messages)),
+		NextCursor: result.NextCursor,
+	}
+	for i, m := range result.Messages {
+		page.Messages[i] = m.ToStoredMessage()
+	}
+
+	return page, nil
+}
+
+// Export записывает в w поток NDJSON с сообщениями, подходящими под фильтр.
+// Без Status выгружаются все сообщения, кроме Failed.
+func (c *Client) Export(ctx context.Context, w io.Writer, filter storageentity.ListFilter) error {
+	target := c.url("/messages/export")
+	if query := listFilterValues(filter); len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.streamClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to export messages: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return c.decodeError(resp)
+	}
+
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("failed to export messages: %w", err)
+	}
+
+	return nil
+}
+
+// Import сохраняет в хранилище сообщения из потока NDJSON body в формате Export.
+func (c *Client) Import(ctx context.Context, body io.Reader) (*ndjson.ImportResult, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url("/messages/import"), body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", ndjson.ContentType)
+
+	resp, err := c.streamClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to import messages: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.decodeError(resp)
+	}
+
+	var result ndjson.ImportResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &result, nil
+}
+
+// Histogram возвращает гистограмму ожидающих сообщений по ScheduledAt.
+func (c *Client) Histogram(ctx context.Context, q storageentity.HistogramQuery) (*storageentity.Histogram, error) {
+	var result storageapi.HistogramResponse
+	if err := c.getJSON(ctx, "/messages/histogram", storageapi.HistogramQueryValues(q), &result); err != nil {
+		return nil, err
+	}
+
+	h, err := result.ToHistogram()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse histogram: %w", err)
+	}
+
+	return h, nil
+}
+
+// Rehome просит хранилище передать gateway ожидающие сообщения вне диапазона query.
+func (c *Client) Rehome(ctx context.Context, query storageentity.RehomeQuery) (*storageentity.RehomeResult, error) {
+	body, err := json.Marshal(storageapi.RehomeRequestFromQuery(query))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url("/messages/rehome"), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rehome messages: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.decodeError(resp)
+	}
+
+	var result storageapi.RehomeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return result.ToResult(), nil
+}
+
+// Drain запускает вывод инстанса из кластера и возвращает его ход, не дожидаясь завершения.
+func (c *Client) Drain(ctx context.Context) (*storageentity.DrainStatus, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url("/drain"), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start drain: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		return nil, c.decodeError(resp)
+	}
+
+	var result storageapi.DrainStatusResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	status := result.ToDrainStatus()
+	return &status, nil
+}
+
+// DrainStatus возвращает ход вывода инстанса из кластера.
+func (c *Client) DrainStatus(ctx context.Context) (*storageentity.DrainStatus, error) {
+	var result storageapi.DrainStatusResponse
+	if err := c.getJSON(ctx, "/drain", nil, &result); err != nil {
+		return nil, err
+	}
+
+	status := result.ToDrainStatus()
+	return &status, nil
+}
 
 // Acknowledge подтверждает обработку сообщений по их идентификаторам.
-// func (c *Client) Acknowledge(ctx context.Context, ids []string) error {
-// 	body, err := json.Marshal(storageapi.AcknowledgeRequest{IDs: ids})
-// 	if err != nil {
-// 		return fmt.Errorf("failed to marshal request: %w", err)
-// 	}
-
-// 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url("/messages/acknowledge"), bytes.NewReader(body))
-// 	if err != nil {
-// 		return fmt.Errorf("failed to create request: %w", err)
-// 	}
-// 	req.Header.Set("Content-Type", "application/json")
-
-// 	resp, err := c.httpClient.Do(req)
-// 	if err != nil {
-// 		return fmt.Errorf("failed to acknowledge messages: %w", err)
-// 	}
-// 	defer resp.Body.Close()
-
-// 	if resp.StatusCode != http.StatusNoContent {
-// 		return c.decodeError(resp)
-// 	}
-
-// 	return nil
-// }
+func (c *Client) Acknowledge(ctx context.Context, ids []string) error {
+	body, err := json.Marshal(storageapi.AcknowledgeRequest{IDs: ids})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url("/messages/acknowledge"), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to acknowledge messages: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return c.decodeError(resp)
+	}
+
+	return nil
+}
+
+// Reject отклоняет выданное сообщение: requeue возвращает его в ожидание,
+// иначе оно переводится в failed.
+func (c *Client) Reject(ctx context.Context, id string, requeue bool) error {
+	body, err := json.Marshal(storageapi.RejectRequest{Requeue: requeue})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url("/messages/"+url.PathEscape(id)+"/reject"), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reject message: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return c.decodeError(resp)
+	}
+
+	return nil
+}
+
+// Delete удаляет сообщение в любом состоянии.
+func (c *Client) Delete(ctx context.Context, id string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, c.url("/messages/"+url.PathEscape(id)), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to delete message: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return c.decodeError(resp)
+	}
+
+	return nil
+}
+
+// Get возвращает сообщение вместе с его состоянием в хранилище.
+func (c *Client) Get(ctx context.Context, id string) (*storageentity.StoredMessage, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url("/messages/"+url.PathEscape(id)), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.decodeError(resp)
+	}
+
+	var result storageapi.StoredMessageResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return result.ToStoredMessage(), nil
+}
 
 // GetByID возвращает сообщение по идентификатору.
 func (c *Client) GetByID(ctx context.Context, id string) (*message.Message, error) {
@@ -187,7 +422,7 @@ func (c *Client) GetByID(ctx context.Context, id string) (*message.Message, erro
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	return messageResponseToMessage(result), nil
+	return result.ToMessage(), nil
 }
 
 // Count возвращает общее количество сообщений в хранилище.
@@ -215,6 +450,71 @@ func (c *Client) Count(ctx context.Context) (int64, error) {
 	return result.Count, nil
 }
 
+// fetch запрашивает список сообщений по path с параметрами query.
+func (c *Client) fetch(ctx context.Context, path string, query url.Values) ([]*storageentity.StoredMessage, error) {
+	var result storageapi.FetchMessagesResponse
+	if err := c.getJSON(ctx, path, query, &result); err != nil {
+		return nil, err
+	}
+
+	messages := make([]*storageentity.StoredMessage, len(result.Messages))
+	for i, m := range result.Messages {
+		messages[i] = m.ToStoredMessage()
+	}
+
+	return messages, nil
+}
+
+// getJSON выполняет GET-запрос к эндпоинту и декодирует ответ в out.
+func (c *Client) getJSON(ctx context.Context, path string, query url.Values, out any) error {
+	target := c.url(path)
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch messages: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return c.decodeError(resp)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return nil
+}
+
+// listFilterValues кодирует фильтр списка в query-параметры.
+func listFilterValues(filter storageentity.ListFilter) url.Values {
+	query := url.Values{}
+	if filter.RoutingKeyPrefix != "" {
+		query.Set("routing_key_prefix", filter.RoutingKeyPrefix)
+	}
+	for key, value := range filter.Metadata {
+		query.Add("metadata", key+"="+value)
+	}
+	if !filter.ScheduledFrom.IsZero() {
+		query.Set("scheduled_from", filter.ScheduledFrom.Format(time.RFC3339Nano))
+	}
+	if !filter.ScheduledTo.IsZero() {
+		query.Set("scheduled_to", filter.ScheduledTo.Format(time.RFC3339Nano))
+	}
+	if filter.Status != "" {
+		query.Set("status", string(filter.Status))
+	}
+	return query
+}
+
 // url формирует полный URL для эндпоинта.
 func (c *Client) url(path string) string {
 	return c.baseURL + apiPrefix + path
@@ -229,16 +529,3 @@ func (c *Client) decodeError(resp *http.Response) error {
 
 	return fmt.Errorf("storage error (status %d): %s", resp.StatusCode, errResp.Error)
 }
-
-// messageResponseToMessage преобразует DTO ответа в доменную модель.
-func messageResponseToMessage(r storageapi.MessageResponse) *message.Message {
-	return message.NewMessage(
-		message.WithID(r.ID),
-		message.WithRoutingKey(r.RoutingKey),
-		message.WithRoutingSettings(r.RoutingSettings),
-		message.WithPayload(r.Payload),
-		message.WithMetadata(r.Metadata),
-		message.WithCreatedAt(r.CreatedAt),
-		message.WithScheduledAt(r.ScheduledAt),
-	)
-}